@@ -0,0 +1,240 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+type AdaptiveOptions struct {
+	// Budget in entries per second.
+	Budget float64
+	// Interval over which volume is measured; defaults to 10s.
+	Interval time.Duration
+	// Recover is the fraction of the budget below which thresholds are
+	// lowered; defaults to 0.5.
+	Recover float64
+	// Floor is the highest threshold; defaults to Warning.
+	Floor LogLevel
+	// Log receives the entries reporting changes; defaults to the global
+	// context's "adaptive" stream.  Entries on it are not counted.
+	Log Log
+}
+
+type AdaptiveListener interface {
+	LogListener
+	Target() LogListener
+	// Thresholds returns the streams whose thresholds have been raised.
+	Thresholds() map[string]LogLevel
+	Dropped() uint64
+}
+
+///
+
+var adaptiveSteps = []LogLevel{Trace, Debug, Info, Warning, Error}
+
+type adaptiveStream struct {
+	step   int
+	counts [None + 1]uint64
+}
+
+// The number of the window's entries a threshold would have forwarded.
+func (as *adaptiveStream) forwarded(threshold LogLevel) uint64 {
+	var n uint64
+	for level := All; level <= None; level++ {
+		if admits(threshold, level) {
+			n += as.counts[level]
+		}
+	}
+	return n
+}
+
+type adaptiveListener struct {
+	lock    chan bool
+	name    string
+	target  LogListener
+	opts    AdaptiveOptions
+	own     string
+	maxStep int
+	start   time.Time
+	streams map[string]*adaptiveStream
+	dropped uint64
+}
+
+// NewAdaptiveListener keeps the entries reaching target under Budget per
+// second by raising the thresholds of the noisiest streams, never beyond
+// Floor, and lowering them again once the volume falls below Recover
+// times the budget.  Each change is logged.
+func NewAdaptiveListener(name string, target LogListener, opts AdaptiveOptions) AdaptiveListener {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Recover <= 0 || opts.Recover > 1 {
+		opts.Recover = 0.5
+	}
+	if opts.Floor == All || opts.Floor == Default {
+		opts.Floor = Warning
+	}
+	if opts.Log == nil {
+		opts.Log, _ = GetGlobalLoggingContext().Stream("adaptive")
+	}
+	al := &adaptiveListener{
+		lock:    make(chan bool, 1),
+		name:    name,
+		target:  target,
+		opts:    opts,
+		streams: make(map[string]*adaptiveStream),
+	}
+	if ls, ok := opts.Log.(LogStream); ok {
+		al.own = ls.Name()
+	}
+	for al.maxStep+1 < len(adaptiveSteps) && Compare(adaptiveSteps[al.maxStep+1], opts.Floor) <= 0 {
+		al.maxStep++
+	}
+	al.lock <- true
+	return al
+}
+
+func (al *adaptiveListener) Name() string {
+	return al.name
+}
+
+func (al *adaptiveListener) Target() LogListener {
+	return al.target
+}
+
+func (al *adaptiveListener) Dropped() uint64 {
+	return atomic.LoadUint64(&al.dropped)
+}
+
+func (al *adaptiveListener) Thresholds() map[string]LogLevel {
+	<-al.lock
+	defer func() { al.lock <- true }()
+	thresholds := make(map[string]LogLevel)
+	for name, as := range al.streams {
+		if as.step > 0 {
+			thresholds[name] = adaptiveSteps[as.step]
+		}
+	}
+	return thresholds
+}
+
+func (al *adaptiveListener) Receive(entry LogEntry) {
+	if entry.Stream() == al.own || al.opts.Budget <= 0 {
+		al.target.Receive(entry)
+		return
+	}
+	admit, changes := al.admit(entry)
+	for _, change := range changes {
+		change()
+	}
+	if admit {
+		al.target.Receive(entry)
+	} else {
+		atomic.AddUint64(&al.dropped, 1)
+	}
+}
+
+// Counts the entry, returning whether it passes its stream's threshold
+// and the changes to log - which may not be logged holding the lock, as
+// they may be delivered to this listener.
+func (al *adaptiveListener) admit(entry LogEntry) (bool, []func()) {
+	now := entry.LogTime()
+	level := entry.Level()
+	if level > None {
+		level = None
+	}
+	<-al.lock
+	defer func() { al.lock <- true }()
+	var changes []func()
+	if al.start.IsZero() || now.Before(al.start) {
+		al.start = now
+	} else if elapsed := now.Sub(al.start); elapsed >= al.opts.Interval {
+		changes = al.adjust(elapsed.Seconds())
+		al.start = now
+	}
+	as, ok := al.streams[entry.Stream()]
+	if !ok {
+		as = &adaptiveStream{}
+		al.streams[entry.Stream()] = as
+	}
+	as.counts[level]++
+	return admits(adaptiveSteps[as.step], level), changes
+}
+
+func (al *adaptiveListener) adjust(seconds float64) []func() {
+	var changes []func()
+	var total uint64
+	for _, as := range al.streams {
+		total += as.forwarded(adaptiveSteps[as.step])
+	}
+	rate := float64(total) / seconds
+	names := make([]string, 0, len(al.streams))
+	for name := range al.streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	budget := al.opts.Budget * seconds
+	for float64(total) > budget {
+		var noisiest string
+		var most uint64
+		for _, name := range names {
+			as := al.streams[name]
+			if n := as.forwarded(adaptiveSteps[as.step]); as.step < al.maxStep && n > most {
+				noisiest, most = name, n
+			}
+		}
+		if noisiest == "" {
+			break
+		}
+		as := al.streams[noisiest]
+		before := as.forwarded(adaptiveSteps[as.step])
+		as.step++
+		total -= before - as.forwarded(adaptiveSteps[as.step])
+		threshold := adaptiveSteps[as.step]
+		changes = append(changes, func() {
+			al.opts.Log.LogTemplate(Warning, "raised threshold of stream {Stream} to {Threshold}: {Rate} entries/s exceeds budget {Budget}",
+				noisiest, threshold, fmt.Sprintf("%.1f", rate), al.opts.Budget)
+		})
+	}
+	if len(changes) == 0 {
+		low := al.opts.Recover * budget
+		for _, name := range names {
+			as := al.streams[name]
+			if as.step == 0 {
+				continue
+			}
+			extra := as.forwarded(adaptiveSteps[as.step-1]) - as.forwarded(adaptiveSteps[as.step])
+			if float64(total+extra) > low {
+				continue
+			}
+			total += extra
+			as.step--
+			stream, threshold := name, adaptiveSteps[as.step]
+			changes = append(changes, func() {
+				al.opts.Log.LogTemplate(Info, "lowered threshold of stream {Stream} to {Threshold}: {Rate} entries/s within budget {Budget}",
+					stream, threshold, fmt.Sprintf("%.1f", rate), al.opts.Budget)
+			})
+		}
+	}
+	for name, as := range al.streams {
+		if as.step == 0 {
+			delete(al.streams, name)
+		} else {
+			as.counts = [None + 1]uint64{}
+		}
+	}
+	return changes
+}
+
+func (al *adaptiveListener) Flush() error {
+	if fl, ok := al.target.(Flusher); ok {
+		return fl.Flush()
+	}
+	return nil
+}
+
+func (al *adaptiveListener) Close() error {
+	return al.target.Close()
+}
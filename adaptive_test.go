@@ -0,0 +1,49 @@
+package log
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveListener(t *testing.T) {
+	ctx := CreateLoggingContext()
+	target := newCaptureListener()
+	notices := newCaptureListener()
+	adaptive, _ := ctx.Stream("adaptive")
+	adaptive.AddLogListener(notices, Trace)
+	al := NewAdaptiveListener("adaptive", target, AdaptiveOptions{
+		Budget:   100,
+		Interval: 50 * time.Millisecond,
+		Log:      adaptive,
+	})
+	ctx.AddGlobalLogListener(al, Trace)
+	chatty, _ := ctx.Stream("chatty")
+	quiet, _ := ctx.Stream("quiet")
+	for i := 0; i < 50; i++ {
+		chatty.Log(Trace, "detail")
+	}
+	quiet.Log(Info, "tick")
+	time.Sleep(60 * time.Millisecond)
+	chatty.Log(Trace, "detail")
+	chatty.Log(Warning, "still delivered")
+	if th := al.Thresholds(); len(th) != 1 || th["chatty"] != Debug {
+		t.Fatalf("expected chatty's threshold raised to Debug, got %v", th)
+	}
+	if al.Dropped() != 1 {
+		t.Errorf("expected 1 dropped entry, got %d", al.Dropped())
+	}
+	time.Sleep(60 * time.Millisecond)
+	chatty.Log(Trace, "detail")
+	if th := al.Thresholds(); len(th) != 0 {
+		t.Errorf("expected thresholds lowered again, got %v", th)
+	}
+	entries := notices.Entries()
+	if len(entries) != 2 || !strings.HasPrefix(entries[0].Message(), "raised threshold of stream chatty to Debug") ||
+		!strings.HasPrefix(entries[1].Message(), "lowered threshold of stream chatty to Trace") {
+		t.Errorf("unexpected notices: %v", entries)
+	}
+	if n := len(target.Entries()); n != 53 {
+		t.Errorf("expected 53 entries forwarded, got %d", n)
+	}
+}
@@ -0,0 +1,351 @@
+package log
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type AdminOptions struct {
+	// Authenticate, if set, is called before every request; requests it
+	// returns an error for are refused with 401 Unauthorized.  Otherwise
+	// it returns the principal it verified, or "" if it names none.
+	Authenticate func(r *http.Request) (string, error)
+	// Identify names the operator making a request Authenticate gave no
+	// principal for; by default the verified client certificate's common
+	// name, else the remote address.  Unverified request headers name
+	// whoever the client pleases.
+	Identify func(r *http.Request) string
+	// Metrics defaults to the default registry.
+	Metrics MetricsRegistry
+	// Async lists the async listeners whose worker pools can be resized,
+	// by name.
+	Async []AsyncListener
+}
+
+///
+
+type adminHandler struct {
+	ctx  StandardLoggingContext
+	opts AdminOptions
+}
+
+type adminStream struct {
+	Name           string            `json:"name"`
+	Entries        map[string]uint64 `json:"entries"`
+	Total          uint64            `json:"total"`
+	LastEntryTime  *time.Time        `json:"last_entry_time,omitempty"`
+	BytesFormatted uint64            `json:"bytes_formatted"`
+}
+
+type adminRoute struct {
+	Listener  string `json:"listener"`
+	Scope     string `json:"scope"`
+	Threshold string `json:"threshold"`
+	Receives  bool   `json:"receives"`
+	Reason    string `json:"reason"`
+}
+
+type adminExplanation struct {
+	Stream       string       `json:"stream"`
+	Level        string       `json:"level"`
+	StreamExists bool         `json:"stream_exists"`
+	Override     string       `json:"override,omitempty"`
+	Filter       string       `json:"filter,omitempty"`
+	Listeners    []adminRoute `json:"listeners"`
+}
+
+type adminWorkers struct {
+	Workers int `json:"workers"`
+	Pending int `json:"pending"`
+}
+
+type adminFilter struct {
+	ID          string    `json:"id,omitempty"`
+	Expression  string    `json:"expression"`
+	Action      string    `json:"action"`
+	Route       string    `json:"route,omitempty"`
+	TTL         string    `json:"ttl,omitempty"`
+	InstalledBy string    `json:"installed_by,omitempty"`
+	Installed   time.Time `json:"installed,omitempty"`
+	Expires     time.Time `json:"expires,omitempty"`
+}
+
+// NewAdminHandler exposes ctx to operators: GET /streams, /metrics and
+// /explain; GET, POST and DELETE /filters; GET, PUT and DELETE /levels;
+// GET and PUT /workers, for the async listeners in opts.Async.
+// It can silence the service's logging - mount it on a private listener or
+// set Authenticate.
+func NewAdminHandler(ctx StandardLoggingContext, opts AdminOptions) http.Handler {
+	if opts.Identify == nil {
+		opts.Identify = defaultAdminIdentity
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = DefaultMetricsRegistry()
+	}
+	return &adminHandler{ctx: ctx, opts: opts}
+}
+
+// BearerTokens returns an AdminOptions.Authenticate hook accepting
+// requests with an "Authorization: Bearer <token>" header naming one of
+// tokens.  Tokens name no principal.
+func BearerTokens(tokens ...string) func(r *http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			return "", errors.New("bearer token required")
+		}
+		presented := []byte(strings.TrimPrefix(header, "Bearer "))
+		for _, token := range tokens {
+			if subtle.ConstantTimeCompare(presented, []byte(token)) == 1 {
+				return "", nil
+			}
+		}
+		return "", errors.New("invalid bearer token")
+	}
+}
+
+func defaultAdminIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if cn := r.TLS.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+			return cn
+		}
+	}
+	return r.RemoteAddr
+}
+
+func (ah *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var operator string
+	if ah.opts.Authenticate != nil {
+		principal, err := ah.opts.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		operator = principal
+	}
+	if operator == "" {
+		operator = ah.opts.Identify(r)
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/streams" && r.Method == http.MethodGet:
+		ah.streams(w)
+	case path == "/metrics" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		ah.opts.Metrics.WriteText(w)
+	case path == "/filters" && r.Method == http.MethodGet:
+		ah.filters(w)
+	case path == "/filters" && r.Method == http.MethodPost:
+		ah.installFilter(w, r, operator)
+	case strings.HasPrefix(path, "/filters/") && r.Method == http.MethodDelete:
+		if !ah.ctx.Filters().Remove(strings.TrimPrefix(path, "/filters/"), operator) {
+			http.Error(w, "no such filter", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/levels" && r.Method == http.MethodGet:
+		levels := make(map[string]string)
+		for stream, level := range ah.ctx.LevelOverrides() {
+			levels[stream] = level.String()
+		}
+		writeAdminJSON(w, http.StatusOK, levels)
+	case strings.HasPrefix(path, "/levels/") && r.Method == http.MethodPut:
+		ah.setLevel(w, r, strings.TrimPrefix(path, "/levels/"))
+	case strings.HasPrefix(path, "/levels/") && r.Method == http.MethodDelete:
+		if err := ah.ctx.ClearLevelOverride(strings.TrimPrefix(path, "/levels/")); err != nil {
+			http.Error(w, "level override not saved: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/explain" && r.Method == http.MethodGet:
+		ah.explain(w, r)
+	case path == "/workers" && r.Method == http.MethodGet:
+		res := make(map[string]adminWorkers)
+		for _, al := range ah.opts.Async {
+			res[al.Name()] = adminWorkers{Workers: al.Workers(), Pending: al.Pending()}
+		}
+		writeAdminJSON(w, http.StatusOK, res)
+	case strings.HasPrefix(path, "/workers/") && r.Method == http.MethodPut:
+		ah.setWorkers(w, r, strings.TrimPrefix(path, "/workers/"))
+	case path == "/streams" || path == "/metrics" || path == "/filters" || path == "/levels" || path == "/explain" || path == "/workers" ||
+		strings.HasPrefix(path, "/filters/") || strings.HasPrefix(path, "/levels/") || strings.HasPrefix(path, "/workers/"):
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (ah *adminHandler) streams(w http.ResponseWriter) {
+	res := []adminStream{}
+	for _, stream := range ah.ctx.Streams() {
+		stats := stream.Stats()
+		as := adminStream{
+			Name:           stream.Name(),
+			Entries:        make(map[string]uint64),
+			Total:          stats.Total,
+			BytesFormatted: stats.BytesFormatted,
+		}
+		for level, n := range stats.Entries {
+			as.Entries[level.String()] = n
+		}
+		if !stats.LastEntryTime.IsZero() {
+			t := stats.LastEntryTime
+			as.LastEntryTime = &t
+		}
+		res = append(res, as)
+	}
+	writeAdminJSON(w, http.StatusOK, res)
+}
+
+func adminFilterView(f DynamicFilter) adminFilter {
+	return adminFilter{
+		ID:          f.ID,
+		Expression:  f.Expression,
+		Action:      f.Action.String(),
+		Route:       f.Route,
+		TTL:         f.TTL.String(),
+		InstalledBy: f.InstalledBy,
+		Installed:   f.Installed,
+		Expires:     f.Expires,
+	}
+}
+
+func (ah *adminHandler) filters(w http.ResponseWriter) {
+	res := []adminFilter{}
+	for _, f := range ah.ctx.Filters().Filters() {
+		res = append(res, adminFilterView(f))
+	}
+	writeAdminJSON(w, http.StatusOK, res)
+}
+
+func (ah *adminHandler) installFilter(w http.ResponseWriter, r *http.Request, operator string) {
+	var req adminFilter
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Action == "" {
+		req.Action = "suppress"
+	}
+	action, ok := ParseFilterAction(req.Action)
+	if !ok {
+		http.Error(w, "invalid filter action '"+req.Action+"'", http.StatusBadRequest)
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			http.Error(w, "invalid filter ttl: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	filter, err := ah.ctx.Filters().Install(DynamicFilter{
+		Expression:  req.Expression,
+		Action:      action,
+		Route:       req.Route,
+		TTL:         ttl,
+		InstalledBy: operator,
+	})
+	if err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeAdminJSON(w, http.StatusCreated, adminFilterView(filter))
+}
+
+func (ah *adminHandler) setLevel(w http.ResponseWriter, r *http.Request, stream string) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid level override: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	level, ok := ParseLogLevel(req.Level)
+	if !ok {
+		http.Error(w, "unknown level '"+req.Level+"'", http.StatusBadRequest)
+		return
+	}
+	if err := ah.ctx.SetLevelOverride(stream, level); err != nil {
+		http.Error(w, "level override not saved: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setWorkers resizes a listener's pool to a count, or to AutoWorkers (-1).
+func (ah *adminHandler) setWorkers(w http.ResponseWriter, r *http.Request, name string) {
+	var target AsyncListener
+	for _, al := range ah.opts.Async {
+		if al.Name() == name {
+			target = al
+		}
+	}
+	if target == nil {
+		http.Error(w, "no such async listener", http.StatusNotFound)
+		return
+	}
+	var req adminWorkers
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid worker count: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Workers < 1 && req.Workers != AutoWorkers {
+		http.Error(w, "invalid worker count", http.StatusBadRequest)
+		return
+	}
+	target.SetWorkers(req.Workers)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ah *adminHandler) explain(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	stream := query.Get("stream")
+	if stream == "" {
+		http.Error(w, "missing stream", http.StatusBadRequest)
+		return
+	}
+	level, ok := ParseLogLevel(query.Get("level"))
+	if !ok {
+		http.Error(w, "unknown level '"+query.Get("level")+"'", http.StatusBadRequest)
+		return
+	}
+	re := ah.ctx.Explain(stream, level)
+	if query.Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(re.String()))
+		return
+	}
+	res := adminExplanation{
+		Stream:       re.Stream,
+		Level:        re.Level.String(),
+		StreamExists: re.StreamExists,
+		Filter:       re.Filter,
+		Listeners:    []adminRoute{},
+	}
+	if re.HasOverride {
+		res.Override = re.Override.String()
+	}
+	for _, route := range re.Listeners {
+		res.Listeners = append(res.Listeners, adminRoute{
+			Listener:  route.Listener,
+			Scope:     route.Scope,
+			Threshold: route.Threshold.String(),
+			Receives:  route.Receives,
+			Reason:    route.Reason,
+		})
+	}
+	writeAdminJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,165 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type namedCaptureListener struct {
+	*captureListener
+	name string
+}
+
+func (nl *namedCaptureListener) Name() string {
+	return nl.name
+}
+
+func TestAdminFilters(t *testing.T) {
+	ctx := CreateLoggingContext()
+	main := newCaptureListener()
+	audit := &namedCaptureListener{captureListener: newCaptureListener(), name: "audit"}
+	ctx.AddGlobalLogListener(main, Info)
+	ctx.AddGlobalLogListener(audit, FatalError)
+	srv := httptest.NewServer(NewAdminHandler(ctx, AdminOptions{
+		Authenticate: func(r *http.Request) (string, error) {
+			if user, password, ok := r.BasicAuth(); ok && user == "alice" && password == "secret" {
+				return user, nil
+			}
+			return "", nil
+		},
+	}))
+	defer srv.Close()
+
+	appEntries := func() []LogEntry {
+		var res []LogEntry
+		for _, e := range main.Entries() {
+			if e.Stream() != FilterAuditStream {
+				res = append(res, e)
+			}
+		}
+		return res
+	}
+	install := func(body string) adminFilter {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/filters", strings.NewReader(body))
+		req.SetBasicAuth("alice", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("install %s: status %d", body, resp.StatusCode)
+		}
+		var f adminFilter
+		json.NewDecoder(resp.Body).Decode(&f)
+		return f
+	}
+	suppress := install(`{"expression": "stream == \"noisy\"", "ttl": "1h"}`)
+	install(`{"expression": "level <= Error && message =~ \"disk\"", "action": "route", "route": "audit"}`)
+	if suppress.InstalledBy != "alice" || suppress.Action != "suppress" {
+		t.Errorf("unexpected filter %+v", suppress)
+	}
+
+	noisy, _ := ctx.Stream("noisy")
+	app, _ := ctx.Stream("app")
+	noisy.Info("dropped")
+	app.Info("kept")
+	app.Warning("disk nearly full")
+	ctx.Flush()
+	if entries := appEntries(); len(entries) != 1 || entries[0].Message() != "kept" {
+		t.Errorf("main listener received %d entries", len(entries))
+	}
+	var routed []string
+	for _, e := range audit.Entries() {
+		routed = append(routed, e.Message())
+	}
+	if len(routed) != 1 || routed[0] != "disk nearly full" {
+		t.Errorf("route filter delivered %q", routed)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/filters/"+suppress.ID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete failed: %v", err)
+	}
+	noisy.Info("after delete")
+	ctx.Flush()
+	if entries := appEntries(); len(entries) != 2 {
+		t.Errorf("expected suppression to stop after delete, got %d entries", len(entries))
+	}
+
+	// Expired filters stop applying, and are audited.
+	if _, err := ctx.Filters().Install(DynamicFilter{Expression: "stream == \"app\"", TTL: time.Millisecond, InstalledBy: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	app.Info("after expiry")
+	ctx.Flush()
+	if entries := appEntries(); len(entries) != 3 {
+		t.Errorf("expired filter still applied, got %d entries", len(entries))
+	}
+	auditStream, _ := ctx.Stream(FilterAuditStream)
+	if n := auditStream.Stats().Total; n != 5 {
+		t.Errorf("expected 5 audit entries (3 installs, delete, expiry), got %d", n)
+	}
+}
+
+func TestAdminUnverifiedIdentity(t *testing.T) {
+	srv := httptest.NewServer(NewAdminHandler(CreateLoggingContext(), AdminOptions{}))
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/filters", strings.NewReader(`{"expression": "stream == \"x\""}`))
+	req.SetBasicAuth("alice", "")
+	req.Header.Set("X-Forwarded-User", "bob")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var f adminFilter
+	json.NewDecoder(resp.Body).Decode(&f)
+	if !strings.HasPrefix(f.InstalledBy, "127.0.0.1:") {
+		t.Errorf("filter attributed to unverified operator %q", f.InstalledBy)
+	}
+}
+
+func TestAdminWorkers(t *testing.T) {
+	al := NewAsyncListener("async", newCaptureListener(), AsyncOptions{})
+	defer al.Close()
+	srv := httptest.NewServer(NewAdminHandler(CreateLoggingContext(), AdminOptions{Async: []AsyncListener{al}}))
+	defer srv.Close()
+	put := func(name, body string) int {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/workers/"+name, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := put("async", `{"workers": 3}`); status != http.StatusNoContent || al.Workers() != 3 {
+		t.Fatalf("resize: status %d, %d workers", status, al.Workers())
+	}
+	if status := put("async", `{"workers": 0}`); status != http.StatusBadRequest || al.Workers() != 3 {
+		t.Errorf("invalid count: status %d, %d workers", status, al.Workers())
+	}
+	if status := put("other", `{"workers": 2}`); status != http.StatusNotFound {
+		t.Errorf("unknown listener: status %d", status)
+	}
+	if status := put("async", `{"workers": -1}`); status != http.StatusNoContent || al.Workers() != defaultAsyncWorkers() {
+		t.Errorf("auto: status %d, %d workers", status, al.Workers())
+	}
+	resp, err := http.Get(srv.URL + "/workers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var res map[string]adminWorkers
+	json.NewDecoder(resp.Body).Decode(&res)
+	if res["async"].Workers != defaultAsyncWorkers() {
+		t.Errorf("unexpected pools %v", res)
+	}
+}
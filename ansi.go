@@ -0,0 +1,83 @@
+package log
+
+import (
+	"io"
+)
+
+// StripAnsi removes ANSI escape sequences (CSI color/cursor sequences, OSC
+// strings and two-character escapes) from already-formatted output.
+func StripAnsi(str string) string {
+	var buf []byte
+	for i := 0; i < len(str); i++ {
+		if str[i] != 0x1B {
+			if buf != nil {
+				buf = append(buf, str[i])
+			}
+			continue
+		}
+		if buf == nil {
+			buf = make([]byte, 0, len(str))
+			buf = append(buf, str[:i]...)
+		}
+		i = skipAnsiSequence(str, i)
+	}
+	if buf == nil {
+		return str
+	}
+	return string(buf)
+}
+
+// skipAnsiSequence returns the index of the last byte of the escape sequence
+// starting at str[i].
+func skipAnsiSequence(str string, i int) int {
+	j := i + 1
+	// The standard formatter's reset sequences carry a stray NUL after ESC.
+	if j < len(str) && str[j] == 0x00 {
+		j++
+	}
+	if j >= len(str) {
+		return len(str) - 1
+	}
+	switch str[j] {
+	case '[':
+		for j++; j < len(str); j++ {
+			if str[j] >= 0x40 && str[j] <= 0x7E {
+				return j
+			}
+		}
+		return len(str) - 1
+	case ']':
+		for j++; j < len(str); j++ {
+			if str[j] == 0x07 {
+				return j
+			}
+			if str[j] == 0x1B && j+1 < len(str) && str[j+1] == '\\' {
+				return j + 1
+			}
+		}
+		return len(str) - 1
+	}
+	return j
+}
+
+type ansiStripFormatter struct {
+	base LogEntryFormatter
+}
+
+func NewAnsiStripFormatter(base LogEntryFormatter) LogEntryFormatter {
+	return &ansiStripFormatter{base: base}
+}
+
+func (asf *ansiStripFormatter) Format(entry LogEntry) string {
+	return StripAnsi(asf.base.Format(entry))
+}
+
+func (asf *ansiStripFormatter) Base() LogEntryFormatter {
+	return asf.base
+}
+
+// NewAnsiStrippingListener creates a writer listener that shares a (possibly
+// colored) formatter with other listeners, but writes colorless output.
+func NewAnsiStrippingListener(name string, writer io.Writer, formatter LogEntryFormatter) LogListener {
+	return NewWriterLogger(name, writer, NewAnsiStripFormatter(formatter))
+}
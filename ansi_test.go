@@ -0,0 +1,28 @@
+package log
+
+import (
+	"testing"
+)
+
+func TestStripAnsi(t *testing.T) {
+	for _, test := range []struct {
+		name, in, want string
+	}{
+		{"plain", "no escapes", "no escapes"},
+		{"csi color", "\x1b[1;31merror\x1b[0m done", "error done"},
+		{"csi cursor", "a\x1b[2Kb\x1b[10;20Hc", "abc"},
+		{"reset with nul", "\x1b\x00[0mtext", "text"},
+		{"osc bel", "\x1b]0;title\x07after", "after"},
+		{"osc st", "\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"two-character escape", "a\x1bMb", "ab"},
+		{"truncated csi", "text\x1b[1;3", "text"},
+		{"truncated osc", "text\x1b]0;tit", "text"},
+		{"osc truncated inside st", "text\x1b]0;title\x1b", "text"},
+		{"lone esc at end", "text\x1b", "text"},
+		{"lone esc then nul", "text\x1b\x00", "text"},
+	} {
+		if got := StripAnsi(test.in); got != test.want {
+			t.Errorf("%s: StripAnsi(%q) = %q, want %q", test.name, test.in, got, test.want)
+		}
+	}
+}
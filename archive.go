@@ -0,0 +1,380 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type ObjectMetadata struct {
+	ContentType     string
+	ContentEncoding string
+	// Lifecycle hints; stores map these onto storage classes, object
+	// tags or expiration rules as their service allows.
+	StorageClass string
+	ExpireAfter  time.Duration
+	Tags         map[string]string
+}
+
+// ObjectStore is small enough to adapt the S3, GCS or Azure Blob SDKs to.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, meta ObjectMetadata) error
+}
+
+type ArchiverOptions struct {
+	KeyTemplate       string
+	Metadata          ObjectMetadata
+	MaxRetries        int
+	RetryBackoff      time.Duration
+	DeleteAfterUpload bool
+	QueueSize         int
+	// OnError is called (from the upload goroutine) when an upload fails
+	// after all retries.
+	OnError func(key string, err error)
+}
+
+type Archiver interface {
+	ArchiveFile(path string) error
+	ArchiveBytes(name string, data []byte) error
+	Close() error
+	CloseContext(ctx context.Context) error
+}
+
+///
+
+type archiveJob struct {
+	path string
+	name string
+	data []byte
+	at   time.Time
+}
+
+type stdArchiver struct {
+	lock   chan bool
+	store  ObjectStore
+	opts   ArchiverOptions
+	queue  chan *archiveJob
+	done   chan bool
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewArchiver uploads closed log files, or batches of entries, to store.
+// Keys are built from a prefix template with strftime time verbs (%Y %m %d
+// %H %M %S %j), %h for the hostname and %f for the file name.
+func NewArchiver(store ObjectStore, opts ArchiverOptions) Archiver {
+	if opts.KeyTemplate == "" {
+		opts.KeyTemplate = "logs/%Y/%m/%d/%h-%f"
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 5
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 64
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ar := &stdArchiver{
+		lock:   make(chan bool, 1),
+		store:  store,
+		opts:   opts,
+		queue:  make(chan *archiveJob, opts.QueueSize),
+		done:   make(chan bool),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	ar.lock <- true
+	go ar.uploadLoop()
+	return ar
+}
+
+func expandKeyTemplate(template string, t time.Time, name string) string {
+	var buf []byte
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 >= len(template) {
+			buf = append(buf, template[i])
+			continue
+		}
+		i++
+		switch template[i] {
+		case 'h':
+			host, _ := os.Hostname()
+			buf = append(buf, []byte(host)...)
+		case 'f':
+			buf = append(buf, []byte(name)...)
+		default:
+			if str, ok := expandTimeVerb(template[i], t); ok {
+				buf = append(buf, []byte(str)...)
+			} else {
+				buf = append(buf, '%', template[i])
+			}
+		}
+	}
+	return string(buf)
+}
+
+func expandTimeVerb(verb byte, t time.Time) (string, bool) {
+	switch verb {
+	case 'Y':
+		return fmt.Sprintf("%04d", t.Year()), true
+	case 'm':
+		return fmt.Sprintf("%02d", int(t.Month())), true
+	case 'd':
+		return fmt.Sprintf("%02d", t.Day()), true
+	case 'H':
+		return fmt.Sprintf("%02d", t.Hour()), true
+	case 'M':
+		return fmt.Sprintf("%02d", t.Minute()), true
+	case 'S':
+		return fmt.Sprintf("%02d", t.Second()), true
+	case 'j':
+		return fmt.Sprintf("%03d", t.YearDay()), true
+	case '%':
+		return "%", true
+	}
+	return "", false
+}
+
+func (ar *stdArchiver) enqueue(job *archiveJob) error {
+	<-ar.lock
+	defer func() { ar.lock <- true }()
+	if ar.closed {
+		return fmt.Errorf("archiver is closed")
+	}
+	select {
+	case ar.queue <- job:
+		return nil
+	default:
+		return fmt.Errorf("archive queue is full")
+	}
+}
+
+func (ar *stdArchiver) ArchiveFile(path string) error {
+	return ar.enqueue(&archiveJob{path: path, name: filepath.Base(path), at: time.Now().UTC()})
+}
+
+func (ar *stdArchiver) ArchiveBytes(name string, data []byte) error {
+	return ar.enqueue(&archiveJob{name: name, data: data, at: time.Now().UTC()})
+}
+
+func (ar *stdArchiver) uploadLoop() {
+	defer close(ar.done)
+	for job := range ar.queue {
+		key := expandKeyTemplate(ar.opts.KeyTemplate, job.at, job.name)
+		err := ar.upload(key, job)
+		if err != nil {
+			if ar.opts.OnError != nil {
+				ar.opts.OnError(key, err)
+			}
+			continue
+		}
+		if job.path != "" && ar.opts.DeleteAfterUpload {
+			os.Remove(job.path)
+		}
+	}
+}
+
+func (ar *stdArchiver) upload(key string, job *archiveJob) error {
+	backoff := ar.opts.RetryBackoff
+	var err error
+	for attempt := 0; attempt < ar.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ar.ctx.Done():
+				return ar.ctx.Err()
+			}
+			backoff *= 2
+		}
+		var body io.Reader
+		var size int64
+		var file *os.File
+		if job.path != "" {
+			if file, err = os.Open(job.path); err != nil {
+				return err
+			}
+			info, serr := file.Stat()
+			if serr != nil {
+				file.Close()
+				return serr
+			}
+			body, size = file, info.Size()
+		} else {
+			body, size = bytes.NewReader(job.data), int64(len(job.data))
+		}
+		err = ar.store.Put(ar.ctx, key, body, size, ar.opts.Metadata)
+		if file != nil {
+			file.Close()
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Close waits for queued uploads to complete.  Uploads still being retried
+// are abandoned if ctx is cancelled first.
+func (ar *stdArchiver) Close() error {
+	return ar.CloseContext(context.Background())
+}
+
+func (ar *stdArchiver) CloseContext(ctx context.Context) error {
+	<-ar.lock
+	if !ar.closed {
+		ar.closed = true
+		close(ar.queue)
+	}
+	ar.lock <- true
+	select {
+	case <-ar.done:
+		return nil
+	case <-ctx.Done():
+		ar.cancel()
+		<-ar.done
+		return ctx.Err()
+	}
+}
+
+type directoryObjectStore struct {
+	root string
+}
+
+// NewDirectoryObjectStore stores objects as files below root, creating
+// intermediate directories for '/'-separated keys.
+func NewDirectoryObjectStore(root string) ObjectStore {
+	return &directoryObjectStore{root: root}
+}
+
+func (ds *directoryObjectStore) Put(ctx context.Context, key string, body io.Reader, size int64, meta ObjectMetadata) error {
+	path := filepath.Join(ds.root, filepath.FromSlash(strings.TrimLeft(key, "/")))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".partial"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+type archivingListener struct {
+	lock      chan bool
+	name      string
+	archiver  Archiver
+	formatter LogEntryFormatter
+	maxBytes  int
+	buf       []byte
+	stop      chan bool
+	done      chan bool
+	closed    bool
+}
+
+// NewArchivingListener formats entries into a buffer which is uploaded as
+// one object every interval, or whenever it reaches maxBytes.  An interval
+// <= 0 disables the timed upload; the buffer is then sent only when full,
+// flushed or closed.
+func NewArchivingListener(name string, archiver Archiver, formatter LogEntryFormatter, interval time.Duration, maxBytes int) LogListener {
+	if formatter == nil {
+		formatter = NewLogEntryFormatter()
+	}
+	al := &archivingListener{
+		lock:      make(chan bool, 1),
+		name:      name,
+		archiver:  archiver,
+		formatter: formatter,
+		maxBytes:  maxBytes,
+		stop:      make(chan bool),
+		done:      make(chan bool),
+	}
+	al.lock <- true
+	go func() {
+		defer close(al.done)
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-tick:
+				al.Flush()
+			case <-al.stop:
+				return
+			}
+		}
+	}()
+	return al
+}
+
+func (al *archivingListener) Name() string {
+	return al.name
+}
+
+func (al *archivingListener) Formatter() LogEntryFormatter {
+	return al.formatter
+}
+
+func (al *archivingListener) Receive(entry LogEntry) {
+	str := al.formatter.Format(entry)
+	recordFormattedSize(entry, len(str))
+	<-al.lock
+	if al.closed {
+		al.lock <- true
+		return
+	}
+	if len(al.buf) == 0 {
+		if hf, ok := al.formatter.(HeaderFormatter); ok {
+			al.buf = append(al.buf, []byte(hf.Header())...)
+		}
+	}
+	al.buf = append(al.buf, []byte(str)...)
+	full := al.maxBytes > 0 && len(al.buf) >= al.maxBytes
+	al.lock <- true
+	if full {
+		al.Flush()
+	}
+}
+
+func (al *archivingListener) Flush() error {
+	<-al.lock
+	data := al.buf
+	al.buf = nil
+	al.lock <- true
+	if len(data) == 0 {
+		return nil
+	}
+	return al.archiver.ArchiveBytes(fmt.Sprintf("%s-%d.log", al.name, time.Now().UnixNano()), data)
+}
+
+func (al *archivingListener) Close() error {
+	<-al.lock
+	if al.closed {
+		al.lock <- true
+		return nil
+	}
+	al.closed = true
+	al.lock <- true
+	close(al.stop)
+	<-al.done
+	return al.Flush()
+}
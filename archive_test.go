@@ -0,0 +1,164 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeArchiver struct {
+	batches chan string
+}
+
+func newFakeArchiver() *fakeArchiver {
+	return &fakeArchiver{batches: make(chan string, 16)}
+}
+
+func (fa *fakeArchiver) ArchiveFile(path string) error {
+	return errors.New("unexpected file upload")
+}
+
+func (fa *fakeArchiver) ArchiveBytes(name string, data []byte) error {
+	fa.batches <- string(data)
+	return nil
+}
+
+func (fa *fakeArchiver) Close() error {
+	return nil
+}
+
+func (fa *fakeArchiver) CloseContext(ctx context.Context) error {
+	return nil
+}
+
+func (fa *fakeArchiver) next(t *testing.T, within time.Duration) string {
+	select {
+	case batch := <-fa.batches:
+		return batch
+	case <-time.After(within):
+		t.Fatal("expected an archived batch")
+		return ""
+	}
+}
+
+func messageFormatter() LogEntryFormatter {
+	formatter := NewLogEntryFormatter()
+	formatter.ClearFlags(PrintTime)
+	return formatter
+}
+
+func TestArchivingListenerBatchesBySize(t *testing.T) {
+	ctx := CreateLoggingContext()
+	fa := newFakeArchiver()
+	al := NewArchivingListener("batches", fa, messageFormatter(), 0, 64)
+	ctx.AddGlobalLogListener(al, Trace)
+	stream, _ := ctx.Stream("archive")
+	stream.Info("a short message")
+	select {
+	case batch := <-fa.batches:
+		t.Fatalf("expected no upload below maxBytes, got %q", batch)
+	case <-time.After(20 * time.Millisecond):
+	}
+	stream.Info("a second message, long enough to fill the batch")
+	batch := fa.next(t, time.Second)
+	if !strings.Contains(batch, "a short message") || !strings.Contains(batch, "a second message") {
+		t.Errorf("expected both entries in one batch, got %q", batch)
+	}
+	stream.Info("left over")
+	al.Close()
+	if batch := fa.next(t, time.Second); !strings.Contains(batch, "left over") {
+		t.Errorf("expected Close to upload the remainder, got %q", batch)
+	}
+}
+
+func TestArchivingListenerBatchesByInterval(t *testing.T) {
+	ctx := CreateLoggingContext()
+	fa := newFakeArchiver()
+	al := NewArchivingListener("ticks", fa, messageFormatter(), 10*time.Millisecond, 0)
+	defer al.Close()
+	ctx.AddGlobalLogListener(al, Trace)
+	stream, _ := ctx.Stream("archive")
+	stream.Info("first tick")
+	if batch := fa.next(t, time.Second); !strings.Contains(batch, "first tick") {
+		t.Errorf("unexpected batch %q", batch)
+	}
+	stream.Info("second tick")
+	if batch := fa.next(t, time.Second); !strings.Contains(batch, "second tick") || strings.Contains(batch, "first tick") {
+		t.Errorf("unexpected batch %q", batch)
+	}
+}
+
+type flakyObjectStore struct {
+	failures int
+	attempts []time.Time
+	objects  map[string]string
+}
+
+func (fs *flakyObjectStore) Put(ctx context.Context, key string, body io.Reader, size int64, meta ObjectMetadata) error {
+	fs.attempts = append(fs.attempts, time.Now())
+	if len(fs.attempts) <= fs.failures {
+		return errors.New("unavailable")
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	fs.objects[key] = string(data)
+	return nil
+}
+
+func TestArchiverRetriesWithBackoff(t *testing.T) {
+	store := &flakyObjectStore{failures: 2, objects: make(map[string]string)}
+	ar := NewArchiver(store, ArchiverOptions{
+		KeyTemplate:  "logs/%f",
+		MaxRetries:   3,
+		RetryBackoff: 10 * time.Millisecond,
+	})
+	if err := ar.ArchiveBytes("batch", []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ar.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(store.attempts))
+	}
+	if store.objects["logs/batch"] != "payload" {
+		t.Errorf("expected the payload stored under logs/batch, got %v", store.objects)
+	}
+	first := store.attempts[1].Sub(store.attempts[0])
+	second := store.attempts[2].Sub(store.attempts[1])
+	if first < 10*time.Millisecond || second < 20*time.Millisecond {
+		t.Errorf("expected doubling backoff, waited %v then %v", first, second)
+	}
+}
+
+func TestArchiverCloseContextCancelsRetries(t *testing.T) {
+	store := &flakyObjectStore{failures: 1 << 30, objects: make(map[string]string)}
+	var failed string
+	ar := NewArchiver(store, ArchiverOptions{
+		KeyTemplate:  "%f",
+		MaxRetries:   10,
+		RetryBackoff: time.Hour,
+		OnError:      func(key string, err error) { failed = key },
+	})
+	ar.ArchiveBytes("stuck", []byte("payload"))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := ar.CloseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected CloseContext to abandon the retry, took %v", elapsed)
+	}
+	if failed != "stuck" {
+		t.Errorf("expected OnError for the abandoned upload, got %q", failed)
+	}
+	if err := ar.ArchiveBytes("late", nil); err == nil {
+		t.Error("expected an error archiving after close")
+	}
+}
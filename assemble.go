@@ -0,0 +1,247 @@
+package log
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type AssemblerOptions struct {
+	Key         func(entry LogEntry) string
+	KeyProperty string
+	// Complete reports whether an entry ends its request; by default,
+	// entries with the CompleteProperty.
+	Complete         func(entry LogEntry) bool
+	CompleteProperty string
+	// Timeout for incomplete requests (default 30s).
+	Timeout time.Duration
+	// Groups containing an entry at or more severe than ErrorLevel are
+	// forwarded in full (default Error3).
+	ErrorLevel    LogLevel
+	DropSummaries bool
+	// MaxEntries bounds a group (default 1000); older entries are
+	// discarded, and counted in the summary.
+	MaxEntries int
+	// MaxGroups bounds the open requests (default 10000); beyond it, new
+	// keys pass straight through.
+	MaxGroups int
+}
+
+type RequestAssembler interface {
+	LogListener
+	Flusher
+	Target() LogListener
+	Pending() int
+}
+
+///
+
+type requestGroup struct {
+	key      string
+	entries  []LogEntry
+	dropped  int
+	warnings int
+	errored  bool
+	first    time.Time
+	lastSeen time.Time
+}
+
+type requestAssembler struct {
+	lock   chan bool
+	name   string
+	target LogListener
+	opts   AssemblerOptions
+	groups map[string]*requestGroup
+	stop   chan bool
+	closed int32
+}
+
+// NewRequestAssembler groups entries by request key until the request
+// completes or times out, then forwards the whole group if it had an error
+// and a single summary entry otherwise.  Entries without a key pass
+// straight through.
+func NewRequestAssembler(name string, target LogListener, opts AssemblerOptions) RequestAssembler {
+	if opts.KeyProperty == "" {
+		opts.KeyProperty = "RequestId"
+	}
+	if opts.Key == nil {
+		opts.Key = propertyKey(opts.KeyProperty)
+	}
+	if opts.CompleteProperty == "" {
+		opts.CompleteProperty = "Status"
+	}
+	if opts.Complete == nil {
+		prop := opts.CompleteProperty
+		opts.Complete = func(entry LogEntry) bool {
+			if te, ok := entry.(TemplatedLogEntry); ok {
+				_, has := te.Properties()[prop]
+				return has
+			}
+			return false
+		}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.ErrorLevel == All {
+		opts.ErrorLevel = Error3
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	if opts.MaxGroups <= 0 {
+		opts.MaxGroups = 10000
+	}
+	ra := &requestAssembler{
+		lock:   make(chan bool, 1),
+		name:   name,
+		target: target,
+		opts:   opts,
+		groups: make(map[string]*requestGroup),
+		stop:   make(chan bool),
+	}
+	ra.lock <- true
+	go func() {
+		ticker := time.NewTicker(opts.Timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ra.expire(time.Now())
+			case <-ra.stop:
+				return
+			}
+		}
+	}()
+	return ra
+}
+
+func propertyKey(prop string) func(entry LogEntry) string {
+	return func(entry LogEntry) string {
+		if te, ok := entry.(TemplatedLogEntry); ok {
+			if val, has := te.Properties()[prop]; has {
+				return fmt.Sprint(val)
+			}
+		}
+		return ""
+	}
+}
+
+func (ra *requestAssembler) Name() string {
+	return ra.name
+}
+
+func (ra *requestAssembler) Target() LogListener {
+	return ra.target
+}
+
+func (ra *requestAssembler) Pending() int {
+	<-ra.lock
+	defer func() { ra.lock <- true }()
+	return len(ra.groups)
+}
+
+func (ra *requestAssembler) Receive(entry LogEntry) {
+	key := ra.opts.Key(entry)
+	if key == "" {
+		ra.target.Receive(entry)
+		return
+	}
+	now := time.Now()
+	<-ra.lock
+	group, has := ra.groups[key]
+	if !has {
+		if len(ra.groups) >= ra.opts.MaxGroups {
+			ra.lock <- true
+			ra.target.Receive(entry)
+			return
+		}
+		group = &requestGroup{key: key, first: entry.LogTime()}
+		ra.groups[key] = group
+	}
+	group.lastSeen = now
+	if len(group.entries) >= ra.opts.MaxEntries {
+		group.entries = group.entries[1:]
+		group.dropped++
+	}
+	group.entries = append(group.entries, entry)
+	if level := entry.Level(); level != All && Compare(level, ra.opts.ErrorLevel) >= 0 {
+		group.errored = true
+	} else if level.IsWarning() {
+		group.warnings++
+	}
+	complete := ra.opts.Complete(entry)
+	if complete {
+		delete(ra.groups, key)
+	}
+	ra.lock <- true
+	if complete {
+		ra.emit(group, false)
+	}
+}
+
+func (ra *requestAssembler) emit(group *requestGroup, timedOut bool) {
+	if group.errored {
+		for _, entry := range group.entries {
+			ra.target.Receive(entry)
+		}
+		return
+	}
+	if ra.opts.DropSummaries {
+		return
+	}
+	last := group.entries[len(group.entries)-1]
+	count := len(group.entries) + group.dropped
+	duration := last.LogTime().Sub(group.first)
+	summary := deriveEntry(last)
+	if timedOut {
+		summary.template = "request {RequestKey} timed out after {Entries} entries ({Warnings} warnings) in {Duration}"
+	} else {
+		summary.template = "request {RequestKey} completed with {Entries} entries ({Warnings} warnings) in {Duration}"
+	}
+	summary.message = cachedMessageTemplate(summary.template).Render(group.key, count, group.warnings, duration)
+	summary.setProperty("RequestKey", group.key)
+	summary.setProperty("Entries", count)
+	summary.setProperty("Warnings", group.warnings)
+	summary.setProperty("Duration", duration)
+	summary.setProperty("TimedOut", timedOut)
+	ra.target.Receive(summary)
+}
+
+func (ra *requestAssembler) expire(now time.Time) {
+	var expired []*requestGroup
+	<-ra.lock
+	for key, group := range ra.groups {
+		if now.Sub(group.lastSeen) >= ra.opts.Timeout {
+			expired = append(expired, group)
+			delete(ra.groups, key)
+		}
+	}
+	ra.lock <- true
+	for _, group := range expired {
+		ra.emit(group, true)
+	}
+}
+
+// Flush forwards the target's flush; open requests stay open.
+func (ra *requestAssembler) Flush() error {
+	if fl, ok := ra.target.(Flusher); ok {
+		return fl.Flush()
+	}
+	return nil
+}
+
+// Close emits every open request as timed out, then closes the target.
+func (ra *requestAssembler) Close() error {
+	if atomic.CompareAndSwapInt32(&ra.closed, 0, 1) {
+		close(ra.stop)
+		<-ra.lock
+		groups := ra.groups
+		ra.groups = make(map[string]*requestGroup)
+		ra.lock <- true
+		for _, group := range groups {
+			ra.emit(group, true)
+		}
+	}
+	return ra.target.Close()
+}
@@ -0,0 +1,50 @@
+package log
+
+import (
+	"testing"
+)
+
+func TestRequestAssembler(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ra := NewRequestAssembler("requests", cl, AssemblerOptions{})
+	ctx.AddGlobalLogListener(ra, Trace)
+	stream, _ := ctx.Stream("http")
+	stream.LogTemplate(Info, "request {RequestId} started", "a")
+	stream.LogTemplate(Info, "request {RequestId} started", "b")
+	stream.LogTemplate(Warning, "request {RequestId} slow query", "a")
+	stream.Info("unrelated")
+	stream.LogTemplate(Error, "request {RequestId} failed", "b")
+	stream.LogTemplate(Info, "request {RequestId} done {Status}", "a", 200)
+	stream.LogTemplate(Info, "request {RequestId} done {Status}", "b", 500)
+	stream.LogTemplate(Info, "request {RequestId} started", "c")
+	ctx.Flush()
+	if ra.Pending() != 1 {
+		t.Errorf("expected 1 pending request, got %d", ra.Pending())
+	}
+	ra.Close()
+	var got []string
+	for _, e := range cl.Entries() {
+		got = append(got, e.Message())
+	}
+	want := []string{
+		"unrelated",
+		"request a completed with 3 entries (1 warnings) in ",
+		"request b started",
+		"request b failed",
+		"request b done 500",
+		"request c timed out after 1 entries (0 warnings) in ",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q", got)
+	}
+	for i := range want {
+		if len(got[i]) < len(want[i]) || got[i][:len(want[i])] != want[i] {
+			t.Errorf("entry %d: got %q, want prefix %q", i, got[i], want[i])
+		}
+	}
+	props := cl.Entries()[1].(TemplatedLogEntry).Properties()
+	if props["RequestKey"] != "a" || props["Entries"] != 3 || props["Status"] != 200 {
+		t.Errorf("unexpected summary properties %v", props)
+	}
+}
@@ -0,0 +1,435 @@
+package log
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const AutoWorkers = -1
+
+type AsyncOptions struct {
+	QueueSize int
+	// TTL drops entries of a level still queued after the duration;
+	// Error and FatalError entries never expire.
+	TTL map[LogLevel]time.Duration
+	// Prioritized delivers queued errors first, then warnings, info and
+	// debug/trace, keeping order within each class.
+	Prioritized bool
+	// Workers deliver concurrently, without ordering, if more than one
+	// (AutoWorkers sizes the pool from GOMAXPROCS).  The target must then
+	// be safe for concurrent Receive() calls, or MaxConcurrency set.  The
+	// default is a single worker, keeping entries in order.
+	Workers        int
+	MaxConcurrency int
+	// LockOSThread wires each worker to its own OS thread.
+	LockOSThread bool
+}
+
+type AsyncListener interface {
+	FallibleLogListener
+	Flusher
+	ContextFlusher
+	Target() LogListener
+	Pending() int
+	Expired() uint64
+	Dropped() uint64
+	Workers() int
+	SetWorkers(n int)
+}
+
+///
+
+const asyncClasses = 4
+
+type asyncItem struct {
+	entry    LogEntry
+	deadline time.Time
+	seq      uint64
+}
+
+// A pending flush, released once every item up to mark has left the queue.
+type asyncFlush struct {
+	mark uint64
+	done chan bool
+}
+
+type asyncListener struct {
+	lock     chan bool
+	name     string
+	target   LogListener
+	opts     AsyncOptions
+	queues   [asyncClasses][]*asyncItem
+	pending  int
+	wake     chan bool
+	stop     chan bool
+	running  sync.WaitGroup
+	workers  int
+	alive    int
+	sem      chan bool
+	seq      uint64
+	inflight map[uint64]bool
+	flushes  []*asyncFlush
+	closed   bool
+	expired  uint64
+	dropped  uint64
+}
+
+// NewAsyncListener delivers entries to target from a queue, on background
+// workers, so that slow sinks don't stall the logging goroutine.  When the
+// queue is full an Error entry displaces the oldest non-error entry; other
+// entries are refused with ErrListenerSaturated.
+func NewAsyncListener(name string, target LogListener, opts AsyncOptions) AsyncListener {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	al := &asyncListener{
+		lock:     make(chan bool, 1),
+		name:     name,
+		target:   target,
+		opts:     opts,
+		wake:     make(chan bool, 1),
+		stop:     make(chan bool),
+		inflight: make(map[uint64]bool),
+	}
+	if opts.MaxConcurrency > 0 {
+		al.sem = make(chan bool, opts.MaxConcurrency)
+	}
+	al.lock <- true
+	al.SetWorkers(opts.Workers)
+	return al
+}
+
+func defaultAsyncWorkers() int {
+	if n := runtime.GOMAXPROCS(0) / 4; n > 1 {
+		return n
+	}
+	return 1
+}
+
+func (al *asyncListener) Workers() int {
+	<-al.lock
+	defer func() { al.lock <- true }()
+	return al.workers
+}
+
+// SetWorkers resizes the delivery pool; n <= 0 selects the default of one
+// worker, AutoWorkers a GOMAXPROCS-based size.  Surplus workers exit after
+// finishing their current entry.
+func (al *asyncListener) SetWorkers(n int) {
+	if n == AutoWorkers {
+		n = defaultAsyncWorkers()
+	} else if n <= 0 {
+		n = 1
+	}
+	<-al.lock
+	defer func() { al.lock <- true }()
+	if al.closed {
+		return
+	}
+	al.workers = n
+	for al.alive < al.workers {
+		al.alive++
+		al.running.Add(1)
+		go al.deliverLoop()
+	}
+	// Idle surplus workers must wake to notice.
+	for i := al.workers; i < al.alive; i++ {
+		al.signal()
+	}
+}
+
+func (al *asyncListener) Name() string {
+	return al.name
+}
+
+func (al *asyncListener) Target() LogListener {
+	return al.target
+}
+
+func (al *asyncListener) Receive(entry LogEntry) {
+	al.TryReceive(entry)
+}
+
+func (al *asyncListener) TryReceive(entry LogEntry) error {
+	item := &asyncItem{entry: entry}
+	if ttl, has := al.opts.TTL[entry.Level()]; has && ttl > 0 && !retainedLevel(entry.Level()) {
+		item.deadline = entry.LogTime().Add(ttl)
+	}
+	<-al.lock
+	if al.closed {
+		al.lock <- true
+		atomic.AddUint64(&al.dropped, 1)
+		return ErrListenerClosed
+	}
+	if al.pending >= al.opts.QueueSize && !al.makeRoom(entry.Level()) {
+		al.lock <- true
+		atomic.AddUint64(&al.dropped, 1)
+		return ErrListenerSaturated
+	}
+	al.push(al.class(entry.Level()), item)
+	al.lock <- true
+	al.signal()
+	return nil
+}
+
+func retainedLevel(level LogLevel) bool {
+	return level != All && admits(Error3, level)
+}
+
+func (al *asyncListener) class(level LogLevel) int {
+	switch {
+	case !al.opts.Prioritized || retainedLevel(level):
+		return 0
+	case admits(Warning3, level):
+		return 1
+	case admits(Info3, level):
+		return 2
+	}
+	return 3
+}
+
+func (al *asyncListener) push(class int, item *asyncItem) {
+	al.seq++
+	item.seq = al.seq
+	al.queues[class] = append(al.queues[class], item)
+	al.pending++
+}
+
+// makeRoom is called with the lock held when the queue is full.  Expired
+// entries are discarded first; failing that, an Error entry displaces the
+// oldest entry of the least severe class.
+func (al *asyncListener) makeRoom(level LogLevel) bool {
+	now := time.Now()
+	for class, queue := range al.queues {
+		kept := queue[:0]
+		for _, item := range queue {
+			if !item.deadline.IsZero() && now.After(item.deadline) {
+				atomic.AddUint64(&al.expired, 1)
+				al.pending--
+				continue
+			}
+			kept = append(kept, item)
+		}
+		al.queues[class] = kept
+	}
+	al.release()
+	if al.pending < al.opts.QueueSize {
+		return true
+	}
+	if !retainedLevel(level) {
+		return false
+	}
+	for class := asyncClasses - 1; class >= 0; class-- {
+		queue := al.queues[class]
+		for i, item := range queue {
+			if !retainedLevel(item.entry.Level()) {
+				al.queues[class] = append(queue[:i], queue[i+1:]...)
+				al.pending--
+				atomic.AddUint64(&al.dropped, 1)
+				al.release()
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (al *asyncListener) signal() {
+	select {
+	case al.wake <- true:
+	default:
+	}
+}
+
+// next returns the next item to deliver, or nil if the worker should sleep
+// (or exit, if retire is set).
+func (al *asyncListener) next() (item *asyncItem, retire bool) {
+	<-al.lock
+	defer func() { al.lock <- true }()
+	if al.alive > al.workers {
+		al.alive--
+		return nil, true
+	}
+	for class, queue := range al.queues {
+		if len(queue) > 0 {
+			item := queue[0]
+			queue[0] = nil
+			al.queues[class] = queue[1:]
+			al.pending--
+			al.inflight[item.seq] = true
+			if al.pending > 0 {
+				al.signal()
+			}
+			return item, false
+		}
+	}
+	if al.closed {
+		al.alive--
+		return nil, true
+	}
+	return nil, false
+}
+
+func (al *asyncListener) finish(item *asyncItem) {
+	<-al.lock
+	delete(al.inflight, item.seq)
+	al.release()
+	al.lock <- true
+}
+
+// lowest returns the sequence number of the oldest item still queued or
+// being delivered.  Each class queue is in sequence order, so only the
+// heads need checking.
+func (al *asyncListener) lowest() uint64 {
+	low := al.seq + 1
+	for _, queue := range al.queues {
+		if len(queue) > 0 && queue[0].seq < low {
+			low = queue[0].seq
+		}
+	}
+	for seq := range al.inflight {
+		if seq < low {
+			low = seq
+		}
+	}
+	return low
+}
+
+// release is called with the lock held after items leave the queue, and
+// signals the flushes whose entries have all been delivered or discarded.
+func (al *asyncListener) release() {
+	if len(al.flushes) == 0 {
+		return
+	}
+	low := al.lowest()
+	kept := al.flushes[:0]
+	for _, fl := range al.flushes {
+		if fl.mark < low {
+			close(fl.done)
+		} else {
+			kept = append(kept, fl)
+		}
+	}
+	al.flushes = kept
+}
+
+func (al *asyncListener) deliverLoop() {
+	defer al.running.Done()
+	if al.opts.LockOSThread {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+	for {
+		item, retire := al.next()
+		if retire {
+			return
+		}
+		if item == nil {
+			select {
+			case <-al.wake:
+			case <-al.stop:
+			}
+			continue
+		}
+		if !item.deadline.IsZero() && time.Now().After(item.deadline) {
+			atomic.AddUint64(&al.expired, 1)
+		} else {
+			if al.sem != nil {
+				al.sem <- true
+			}
+			DeliverEntry(item.entry, []LogListener{al.target})
+			if al.sem != nil {
+				<-al.sem
+			}
+		}
+		al.finish(item)
+	}
+}
+
+func (al *asyncListener) Pending() int {
+	<-al.lock
+	defer func() { al.lock <- true }()
+	return al.pending
+}
+
+func (al *asyncListener) Expired() uint64 {
+	return atomic.LoadUint64(&al.expired)
+}
+
+func (al *asyncListener) Dropped() uint64 {
+	return atomic.LoadUint64(&al.dropped)
+}
+
+// Flush waits until every entry queued before the call has been delivered
+// (or expired), then flushes the target.
+func (al *asyncListener) Flush() error {
+	_, err := al.FlushContext(context.Background())
+	return err
+}
+
+// FlushContext stops waiting when ctx is done, leaving the remaining
+// entries queued.
+func (al *asyncListener) FlushContext(ctx context.Context) (int, error) {
+	fl := &asyncFlush{done: make(chan bool)}
+	<-al.lock
+	if al.closed {
+		al.lock <- true
+		return 0, nil
+	}
+	// Entries queued after this call, in whatever class, don't hold it up.
+	fl.mark = al.seq
+	if al.lowest() > fl.mark {
+		close(fl.done)
+	} else {
+		al.flushes = append(al.flushes, fl)
+	}
+	al.lock <- true
+	select {
+	case <-fl.done:
+	case <-ctx.Done():
+		al.cancelFlush(fl)
+		return al.undelivered(), ctx.Err()
+	}
+	if cf, ok := al.target.(ContextFlusher); ok {
+		return cf.FlushContext(ctx)
+	}
+	if fl, ok := al.target.(Flusher); ok {
+		return 0, fl.Flush()
+	}
+	return 0, nil
+}
+
+func (al *asyncListener) cancelFlush(fl *asyncFlush) {
+	<-al.lock
+	defer func() { al.lock <- true }()
+	for i, pending := range al.flushes {
+		if pending == fl {
+			al.flushes = append(al.flushes[:i], al.flushes[i+1:]...)
+			return
+		}
+	}
+}
+
+// The number of entries queued or being delivered.
+func (al *asyncListener) undelivered() int {
+	<-al.lock
+	defer func() { al.lock <- true }()
+	return len(al.inflight) + al.pending
+}
+
+// Close delivers the remaining queue, then closes the target.
+func (al *asyncListener) Close() error {
+	<-al.lock
+	if al.closed {
+		al.lock <- true
+		return nil
+	}
+	al.closed = true
+	al.lock <- true
+	close(al.stop)
+	al.running.Wait()
+	return al.target.Close()
+}
@@ -0,0 +1,154 @@
+package log
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type gatedListener struct {
+	*captureListener
+	gate chan bool
+}
+
+func (gl *gatedListener) Receive(entry LogEntry) {
+	<-gl.gate
+	gl.captureListener.Receive(entry)
+}
+
+func TestAsyncListenerTTL(t *testing.T) {
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("async-test")
+	target := &gatedListener{newCaptureListener(), make(chan bool)}
+	al := NewAsyncListener("async", target, AsyncOptions{
+		TTL: map[LogLevel]time.Duration{Debug: time.Millisecond, Error: time.Millisecond},
+	})
+	stream.AddLogListener(al, Trace)
+	stream.Info("blocking")
+	stream.Log(Debug, "stale")
+	stream.Errorf(nil, "kept")
+	time.Sleep(10 * time.Millisecond)
+	close(target.gate)
+	al.Flush()
+	entries := target.Entries()
+	if len(entries) != 2 || entries[0].Message() != "blocking" || entries[1].Message() != "kept" {
+		t.Errorf("unexpected deliveries: %v", entries)
+	}
+	if al.Expired() != 1 {
+		t.Errorf("expected one expired entry, got %d", al.Expired())
+	}
+	al.Close()
+}
+
+func TestAsyncListenerPriority(t *testing.T) {
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("priority-test")
+	target := &gatedListener{newCaptureListener(), make(chan bool)}
+	al := NewAsyncListener("async", target, AsyncOptions{Prioritized: true})
+	stream.AddLogListener(al, Trace)
+	stream.Info("blocking")
+	// Wait for the worker to pick up (and block on) the first entry.
+	for al.Pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	stream.Log(Debug, "debug 1")
+	stream.Info("info")
+	stream.Log(Debug, "debug 2")
+	stream.Warning("warning")
+	stream.Errorf(nil, "error")
+	close(target.gate)
+	al.Flush()
+	var got []string
+	for _, entry := range target.Entries() {
+		got = append(got, entry.Message())
+	}
+	expect := []string{"blocking", "error", "warning", "info", "debug 1", "debug 2"}
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("unexpected delivery order %v", got)
+	}
+	al.Close()
+}
+
+type concurrencyListener struct {
+	active, peak, count int32
+}
+
+func (cl *concurrencyListener) Name() string {
+	return "concurrency"
+}
+
+func (cl *concurrencyListener) Receive(entry LogEntry) {
+	n := atomic.AddInt32(&cl.active, 1)
+	for {
+		peak := atomic.LoadInt32(&cl.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&cl.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(100 * time.Microsecond)
+	atomic.AddInt32(&cl.count, 1)
+	atomic.AddInt32(&cl.active, -1)
+}
+
+func (cl *concurrencyListener) Close() error {
+	return nil
+}
+
+func TestAsyncListenerWorkers(t *testing.T) {
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("workers-test")
+	target := &concurrencyListener{}
+	al := NewAsyncListener("async", target, AsyncOptions{Workers: 4, MaxConcurrency: 2})
+	stream.AddLogListener(al, Trace)
+	for i := 0; i < 200; i++ {
+		stream.Infof("entry %d", i)
+	}
+	al.SetWorkers(1)
+	al.Flush()
+	if n := atomic.LoadInt32(&target.count); n != 200 {
+		t.Errorf("expected 200 deliveries before flush returned, got %d", n)
+	}
+	if peak := atomic.LoadInt32(&target.peak); peak > 2 {
+		t.Errorf("concurrency limit exceeded: %d", peak)
+	}
+	al.Close()
+}
+
+func TestAsyncListenerFlushUnderLoad(t *testing.T) {
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("flush-load-test")
+	target := &concurrencyListener{}
+	al := NewAsyncListener("async", target, AsyncOptions{Prioritized: true, QueueSize: 64})
+	stream.AddLogListener(al, Trace)
+	for i := 0; i < 20; i++ {
+		stream.Logf(Debug, "debug %d", i)
+	}
+	// Keep the most severe class busy for as long as the flush is pending.
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				stream.Errorf(nil, "error")
+			}
+		}
+	}()
+	flushed := make(chan bool)
+	go func() {
+		al.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Error("flush waited for entries queued after it")
+	}
+	close(stop)
+	<-done
+	al.Close()
+}
@@ -0,0 +1,192 @@
+package log
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type AttachmentPolicy int
+
+const (
+	// AttachmentsSummarized leaves attachments to be written as summaries.
+	AttachmentsSummarized AttachmentPolicy = iota
+	AttachmentsInline
+	AttachmentsExternal
+	AttachmentsDropped
+)
+
+type AttachmentOptions struct {
+	Policy AttachmentPolicy
+	// MaxInline is the largest attachment inlined (default 64KiB); larger
+	// ones are summarized.
+	MaxInline int
+	// Externalized attachments are given to Store, if set, which returns
+	// a reference to them (a URL); otherwise they are written to
+	// Directory, and referred to by path.
+	Directory string
+	Store     func(attachment *Attachment, data []byte) (ref string, err error)
+}
+
+type AttachmentListener interface {
+	FallibleLogListener
+	Flusher
+	Target() LogListener
+}
+
+///
+
+// An Attachment carries binary data with an entry as a template property.
+// Formatters write a summary; an attachment listener decides whether its
+// target gets the data inline, a reference to a stored copy, or nothing.
+type Attachment struct {
+	Name        string
+	ContentType string
+	once        sync.Once
+	data        []byte
+	reader      io.Reader
+	err         error
+}
+
+func NewAttachment(name string, contentType string, data []byte) *Attachment {
+	return &Attachment{Name: name, ContentType: contentType, data: data}
+}
+
+// NewAttachmentReader makes an attachment whose data is read from r when
+// it is first needed.
+func NewAttachmentReader(name string, contentType string, r io.Reader) *Attachment {
+	return &Attachment{Name: name, ContentType: contentType, reader: r}
+}
+
+func (a *Attachment) Bytes() ([]byte, error) {
+	a.once.Do(func() {
+		if a.reader != nil {
+			a.data, a.err = io.ReadAll(a.reader)
+			a.reader = nil
+		}
+	})
+	return a.data, a.err
+}
+
+func (a *Attachment) String() string {
+	data, err := a.Bytes()
+	if err != nil {
+		return fmt.Sprintf("[attachment %s (%s): %s]", a.Name, a.ContentType, err.Error())
+	}
+	return fmt.Sprintf("[attachment %s (%s, %d bytes)]", a.Name, a.ContentType, len(data))
+}
+
+// Attachments returns the attachments among an entry's properties, by
+// property name.
+func Attachments(entry LogEntry) map[string]*Attachment {
+	te, ok := entry.(TemplatedLogEntry)
+	if !ok {
+		return nil
+	}
+	var res map[string]*Attachment
+	for name, value := range te.Properties() {
+		if a, ok := value.(*Attachment); ok {
+			if res == nil {
+				res = make(map[string]*Attachment)
+			}
+			res[name] = a
+		}
+	}
+	return res
+}
+
+type attachmentListener struct {
+	name   string
+	target LogListener
+	opts   AttachmentOptions
+}
+
+func NewAttachmentListener(name string, target LogListener, opts AttachmentOptions) AttachmentListener {
+	if opts.MaxInline <= 0 {
+		opts.MaxInline = 64 << 10
+	}
+	return &attachmentListener{name: name, target: target, opts: opts}
+}
+
+func (al *attachmentListener) Name() string {
+	return al.name
+}
+
+func (al *attachmentListener) Target() LogListener {
+	return al.target
+}
+
+func (al *attachmentListener) Receive(entry LogEntry) {
+	al.TryReceive(entry)
+}
+
+func (al *attachmentListener) TryReceive(entry LogEntry) error {
+	attachments := Attachments(entry)
+	if len(attachments) == 0 || al.opts.Policy == AttachmentsSummarized {
+		return tryReceive(al.target, entry)
+	}
+	de := deriveEntry(entry)
+	for name, a := range attachments {
+		if al.opts.Policy == AttachmentsDropped {
+			delete(de.properties, name)
+			continue
+		}
+		de.setProperty(name, al.render(a))
+	}
+	return tryReceive(al.target, de)
+}
+
+func (al *attachmentListener) render(a *Attachment) string {
+	data, err := a.Bytes()
+	if err != nil {
+		return a.String()
+	}
+	if al.opts.Policy == AttachmentsInline {
+		if len(data) > al.opts.MaxInline {
+			return a.String()
+		}
+		return "data:" + a.ContentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	}
+	ref, err := al.externalize(a, data)
+	if err != nil {
+		return fmt.Sprintf("%s (not stored: %s)", a.String(), err.Error())
+	}
+	return ref
+}
+
+// Writes an attachment to the directory as "<hash>-<name>", so identical
+// attachments are stored once.
+func (al *attachmentListener) externalize(a *Attachment, data []byte) (string, error) {
+	if al.opts.Store != nil {
+		return al.opts.Store(a, data)
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	path := filepath.Join(al.opts.Directory, fmt.Sprintf("%016x-%s", h.Sum64(), filepath.Base(a.Name)))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(al.opts.Directory, 0755); err != nil {
+		return "", err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+func (al *attachmentListener) Flush() error {
+	if fl, ok := al.target.(Flusher); ok {
+		return fl.Flush()
+	}
+	return nil
+}
+
+func (al *attachmentListener) Close() error {
+	return al.target.Close()
+}
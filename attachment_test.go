@@ -0,0 +1,41 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttachmentPolicies(t *testing.T) {
+	dir := t.TempDir()
+	ctx := CreateLoggingContext()
+	summarized, inline, external, dropped := newCaptureListener(), newCaptureListener(), newCaptureListener(), newCaptureListener()
+	ctx.AddGlobalLogListener(summarized, Trace)
+	ctx.AddGlobalLogListener(NewAttachmentListener("inline", inline, AttachmentOptions{Policy: AttachmentsInline}), Trace)
+	ctx.AddGlobalLogListener(NewAttachmentListener("external", external, AttachmentOptions{Policy: AttachmentsExternal, Directory: dir}), Trace)
+	ctx.AddGlobalLogListener(NewAttachmentListener("dropped", dropped, AttachmentOptions{Policy: AttachmentsDropped}), Trace)
+	stream, _ := ctx.Stream("http")
+	body := NewAttachmentReader("body.json", "application/json", strings.NewReader(`{"id":1}`))
+	stream.LogTemplate(Error, "request failed, body {Body}", body)
+
+	property := func(cl *captureListener) interface{} {
+		return cl.Entries()[0].(TemplatedLogEntry).Properties()["Body"]
+	}
+	if msg := summarized.Entries()[0].Message(); msg != "request failed, body [attachment body.json (application/json, 8 bytes)]" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	if property(summarized) != body {
+		t.Errorf("expected the attachment itself without a policy")
+	}
+	if property(inline) != "data:application/json;base64,eyJpZCI6MX0=" {
+		t.Errorf("unexpected inline attachment %v", property(inline))
+	}
+	path, _ := property(external).(string)
+	if data, err := os.ReadFile(path); err != nil || string(data) != `{"id":1}` || filepath.Dir(path) != dir {
+		t.Errorf("unexpected externalized attachment %s: %q %v", path, data, err)
+	}
+	if _, has := dropped.Entries()[0].(TemplatedLogEntry).Properties()["Body"]; has {
+		t.Errorf("expected the attachment dropped")
+	}
+}
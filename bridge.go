@@ -0,0 +1,25 @@
+package log
+
+// ListenerAccepts reports whether a listener registered at listenerLevel
+// receives an entry logged at level.  Listeners registered at Default use
+// the context's default listener level; a Default context level accepts
+// everything.
+func ListenerAccepts(listenerLevel, defaultLevel, level LogLevel) bool {
+	if listenerLevel == Default {
+		listenerLevel = defaultLevel
+	}
+	return listenerLevel == Default || admits(listenerLevel, level)
+}
+
+// Subscribe registers listener as a global listener on each of the given
+// contexts, and returns a function which removes it from all of them.
+func Subscribe(listener LogListener, level LogLevel, contexts ...LoggingContext) (detach func()) {
+	for _, ctx := range contexts {
+		ctx.AddGlobalLogListener(listener, level)
+	}
+	return func() {
+		for _, ctx := range contexts {
+			ctx.RemoveGlobalLogListener(listener)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A new bucket starts whenever the expanded name changes, so buckets follow
+// the wall clock across DST, and entries from before a backwards clock step
+// go to the earlier bucket's file.
+func (fl *fileListener) bucketPath(t time.Time) string {
+	loc := fl.opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	return expandKeyTemplate(fl.template, t.In(loc), "")
+}
+
+func (fl *fileListener) ensureDir() error {
+	if dir := filepath.Dir(fl.path); dir != "." {
+		return os.MkdirAll(dir, 0755)
+	}
+	return nil
+}
+
+// roll is called with the listener lock held.  The expansion is cached for
+// the current second, which keeps the common case to a comparison.
+func (fl *fileListener) roll(t time.Time) {
+	sec := t.Unix()
+	if fl.closed || sec == fl.bucketSec && fl.file != nil {
+		return
+	}
+	fl.bucketSec = sec
+	path := fl.bucketPath(t)
+	if path == fl.path && fl.file != nil {
+		return
+	}
+	if fl.file != nil {
+		fl.closeFile()
+		if fl.opts.OnBucketClosed != nil {
+			go fl.opts.OnBucketClosed(fl.path)
+		}
+	}
+	fl.path = path
+	if err := fl.ensureDir(); err == nil {
+		fl.open()
+	}
+}
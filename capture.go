@@ -0,0 +1,185 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrCaptureUnsupported = errors.New("output capture is not supported on this platform")
+var ErrCaptureActive = errors.New("output capture is already active")
+
+type CaptureOptions struct {
+	// Context receives the captured lines; defaults to the global context.
+	Context LoggingContext
+	// Stdout and Stderr select the descriptors to capture; if neither is
+	// set, both are.
+	Stdout bool
+	Stderr bool
+	// StdoutLevel defaults to Info, StderrLevel to Warning.
+	StdoutLevel LogLevel
+	StderrLevel LogLevel
+}
+
+// An OutputCapture redirects fd 1 and 2 through a pipe into the "stdout"
+// and "stderr" streams.  Meanwhile listeners writing to os.Stdout or
+// os.Stderr reach the original console instead (see ConsoleWriter).
+type OutputCapture interface {
+	// Stop restores the original descriptors, and returns once every
+	// captured line has been logged.
+	Stop() error
+}
+
+// ConsoleWriter returns the writer that reaches the real console in place
+// of w, if w is os.Stdout or os.Stderr and that descriptor is captured.
+// Otherwise w itself is returned.
+func ConsoleWriter(w io.Writer) io.Writer {
+	f, ok := w.(*os.File)
+	if !ok {
+		return w
+	}
+	<-_GLOBAL_captureLock
+	defer func() { _GLOBAL_captureLock <- true }()
+	if _GLOBAL_capture != nil {
+		for _, cs := range _GLOBAL_capture.streams {
+			if cs.file == f {
+				return cs.console
+			}
+		}
+	}
+	return w
+}
+
+///
+
+type capturedStream struct {
+	fd      int
+	file    *os.File
+	console *os.File
+	reader  *os.File
+	stream  LogStream
+	level   LogLevel
+	done    chan bool
+}
+
+type stdOutputCapture struct {
+	streams []*capturedStream
+}
+
+var _GLOBAL_capture *stdOutputCapture
+var _GLOBAL_captureLock chan bool = make(chan bool, 1)
+
+func init() {
+	_GLOBAL_captureLock <- true
+}
+
+// CaptureOutput starts capturing the process's stdout and/or stderr.  Only
+// one capture may be active at a time.
+func CaptureOutput(opts CaptureOptions) (OutputCapture, error) {
+	if opts.Context == nil {
+		opts.Context = GetGlobalLoggingContext()
+	}
+	if !opts.Stdout && !opts.Stderr {
+		opts.Stdout, opts.Stderr = true, true
+	}
+	if opts.StdoutLevel == All {
+		opts.StdoutLevel = Info
+	}
+	if opts.StderrLevel == All {
+		opts.StderrLevel = Warning
+	}
+	<-_GLOBAL_captureLock
+	defer func() { _GLOBAL_captureLock <- true }()
+	if _GLOBAL_capture != nil {
+		return nil, ErrCaptureActive
+	}
+	oc := &stdOutputCapture{}
+	add := func(fd int, file *os.File, name string, level LogLevel) error {
+		stream, _ := opts.Context.Stream(name)
+		console, reader, err := redirectFd(fd, name)
+		if err != nil {
+			return err
+		}
+		oc.streams = append(oc.streams, &capturedStream{
+			fd:      fd,
+			file:    file,
+			console: console,
+			reader:  reader,
+			stream:  stream,
+			level:   level,
+			done:    make(chan bool),
+		})
+		return nil
+	}
+	var err error
+	if opts.Stdout {
+		err = add(1, os.Stdout, "stdout", opts.StdoutLevel)
+	}
+	if err == nil && opts.Stderr {
+		err = add(2, os.Stderr, "stderr", opts.StderrLevel)
+	}
+	if err != nil {
+		oc.restore()
+		for _, cs := range oc.streams {
+			cs.reader.Close()
+			cs.console.Close()
+		}
+		return nil, err
+	}
+	for _, cs := range oc.streams {
+		go cs.pump()
+	}
+	_GLOBAL_capture = oc
+	return oc, nil
+}
+
+func (cs *capturedStream) pump() {
+	defer close(cs.done)
+	r := bufio.NewReader(cs.reader)
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			cs.stream.Log(cs.level, line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Puts the original descriptors back; the pipes' write ends close with
+// them, so the pumps see EOF once the remaining output is read.
+func (oc *stdOutputCapture) restore() error {
+	var errs []error
+	for _, cs := range oc.streams {
+		if err := restoreFd(cs.fd, cs.console); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (oc *stdOutputCapture) Stop() error {
+	<-_GLOBAL_captureLock
+	if _GLOBAL_capture != oc {
+		_GLOBAL_captureLock <- true
+		return nil
+	}
+	err := oc.restore()
+	_GLOBAL_captureLock <- true
+	// Console redirection stays in place until the pumps are drained.
+	for _, cs := range oc.streams {
+		<-cs.done
+		cs.reader.Close()
+	}
+	<-_GLOBAL_captureLock
+	_GLOBAL_capture = nil
+	_GLOBAL_captureLock <- true
+	for _, cs := range oc.streams {
+		cs.console.Close()
+	}
+	return err
+}
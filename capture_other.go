@@ -0,0 +1,15 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package log
+
+import (
+	"os"
+)
+
+func redirectFd(fd int, name string) (console *os.File, reader *os.File, err error) {
+	return nil, nil, ErrCaptureUnsupported
+}
+
+func restoreFd(fd int, console *os.File) error {
+	return ErrCaptureUnsupported
+}
@@ -0,0 +1,47 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCaptureOutput(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	// A console listener must reach the real stdout rather than feed the
+	// captured lines back into the pipe.
+	ctx.AddGlobalLogListener(NewWriterLogger("console", os.Stdout, NewLogEntryFormatter()), Trace)
+	ctx.AddGlobalLogListener(NewMultiWriterListener("multi", nil, Destination{Name: "console", Writer: os.Stdout, Level: Trace}), Trace)
+	oc, err := CaptureOutput(CaptureOptions{Context: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CaptureOutput(CaptureOptions{Context: ctx}); err != ErrCaptureActive {
+		t.Errorf("expected ErrCaptureActive, got %v", err)
+	}
+	fmt.Println("from fmt")
+	syscall.Write(2, []byte("from fd 2\npartial"))
+	if err := oc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Flush()
+	var lines []string
+	for _, entry := range cl.Entries() {
+		lines = append(lines, fmt.Sprintf("%s %s %s", entry.Stream(), entry.Level(), entry.Message()))
+	}
+	got := strings.Join(lines, "|")
+	want := "stdout Info from fmt|stderr Warning from fd 2|stderr Warning partial"
+	if got != want {
+		// Order between the two descriptors is not guaranteed.
+		if len(got) != len(want) || !strings.Contains(got, "stdout Info from fmt") ||
+			!strings.Contains(got, "stderr Warning from fd 2|stderr Warning partial") {
+			t.Errorf("captured %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package log
+
+import (
+	"os"
+	"syscall"
+)
+
+// Points fd at the write end of a new pipe, returning a duplicate of the
+// original descriptor and the pipe's read end.
+func redirectFd(fd int, name string) (console *os.File, reader *os.File, err error) {
+	saved, err := syscall.Dup(fd)
+	if err != nil {
+		return nil, nil, err
+	}
+	syscall.CloseOnExec(saved)
+	r, w, err := os.Pipe()
+	if err != nil {
+		syscall.Close(saved)
+		return nil, nil, err
+	}
+	err = dup2(int(w.Fd()), fd)
+	w.Close()
+	if err != nil {
+		r.Close()
+		syscall.Close(saved)
+		return nil, nil, err
+	}
+	return os.NewFile(uintptr(saved), name), r, nil
+}
+
+func restoreFd(fd int, console *os.File) error {
+	return dup2(int(console.Fd()), fd)
+}
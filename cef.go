@@ -0,0 +1,172 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// CEF (ArcSight) and LEEF (QRadar) formatters feed security streams to a
+// SIEM: the stream is the event category, and properties become extension
+// attributes, under sanitized keys ("fields.<name>" if they clash).
+type SecurityEventProduct struct {
+	Vendor  string
+	Product string
+	Version string
+}
+
+func SecuritySeverity(level LogLevel) int {
+	switch {
+	case level.IsFatal():
+		return 10
+	case level == Error:
+		return 8
+	case level.IsError():
+		return 7
+	case level == Warning:
+		return 6
+	case level.IsWarning():
+		return 5
+	case level == Info:
+		return 3
+	case level.IsInfo():
+		return 2
+	case level.IsDebug():
+		return 1
+	}
+	return 0
+}
+
+///
+
+type cefFormatter struct {
+	product SecurityEventProduct
+}
+
+type leefFormatter struct {
+	product SecurityEventProduct
+}
+
+func NewCEFFormatter(product SecurityEventProduct) LogEntryFormatter {
+	return &cefFormatter{product: product}
+}
+
+func NewLEEFFormatter(product SecurityEventProduct) LogEntryFormatter {
+	return &leefFormatter{product: product}
+}
+
+var cefHeaderEscaper = strings.NewReplacer("\\", "\\\\", "|", "\\|", "\n", " ", "\r", " ")
+var cefValueEscaper = strings.NewReplacer("\\", "\\\\", "=", "\\=", "\n", "\\n", "\r", "\\r")
+var leefValueEscaper = strings.NewReplacer("\t", "\\t", "\n", " ", "\r", " ")
+
+func (cf *cefFormatter) Format(entry LogEntry) string {
+	name := entry.Message()
+	if len(name) > 512 {
+		cut := 512
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut]
+	}
+	var buf []byte
+	buf = append(buf, []byte(fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeaderEscaper.Replace(cf.product.Vendor),
+		cefHeaderEscaper.Replace(cf.product.Product),
+		cefHeaderEscaper.Replace(cf.product.Version),
+		Fingerprint(entry),
+		cefHeaderEscaper.Replace(name),
+		SecuritySeverity(entry.Level())))...)
+	attrs := securityEventAttributes(entry, [][2]string{
+		{"rt", fmt.Sprintf("%d", entry.LogTime().UnixNano()/1000000)},
+		{"cs1Label", "stream"},
+		{"cs1", entry.Stream()},
+		{"msg", PrefixedMessage(entry)},
+	})
+	for i, kv := range attrs {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, []byte(kv[0]+"="+cefValueEscaper.Replace(kv[1]))...)
+	}
+	buf = append(buf, '\n')
+	return string(buf)
+}
+
+func (lf *leefFormatter) Format(entry LogEntry) string {
+	var buf []byte
+	buf = append(buf, []byte(fmt.Sprintf("LEEF:1.0|%s|%s|%s|%s|",
+		cefHeaderEscaper.Replace(lf.product.Vendor),
+		cefHeaderEscaper.Replace(lf.product.Product),
+		cefHeaderEscaper.Replace(lf.product.Version),
+		Fingerprint(entry)))...)
+	sev := SecuritySeverity(entry.Level())
+	if sev < 1 {
+		sev = 1
+	}
+	attrs := securityEventAttributes(entry, [][2]string{
+		{"devTime", entry.LogTime().Format("Jan 02 2006 15:04:05.000")},
+		{"devTimeFormat", "MMM dd yyyy HH:mm:ss.SSS"},
+		{"sev", fmt.Sprintf("%d", sev)},
+		{"cat", entry.Stream()},
+		{"msg", PrefixedMessage(entry)},
+	})
+	for i, kv := range attrs {
+		if i > 0 {
+			buf = append(buf, '\t')
+		}
+		buf = append(buf, []byte(kv[0]+"="+leefValueEscaper.Replace(kv[1]))...)
+	}
+	buf = append(buf, '\n')
+	return string(buf)
+}
+
+// securityEventAttributes appends the error, source and property
+// attributes to the formatter's own.
+func securityEventAttributes(entry LogEntry, attrs [][2]string) [][2]string {
+	used := map[string]bool{"cs2Label": true, "cs2": true, "cs3Label": true, "cs3": true}
+	for _, kv := range attrs {
+		used[kv[0]] = true
+	}
+	if entry.HasAssociatedError() {
+		attrs = append(attrs, [2]string{"cs2Label", "error"}, [2]string{"cs2", entry.AssociatedError().Error()})
+	}
+	if entry.HasTrace() {
+		if trace := entry.Trace(); len(trace) > 0 {
+			attrs = append(attrs, [2]string{"cs3Label", "source"},
+				[2]string{"cs3", fmt.Sprintf("%s:%d", trace[0].File(), trace[0].Line())})
+		}
+	}
+	if te, ok := entry.(TemplatedLogEntry); ok {
+		props := te.Properties()
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			key := securityEventKey(k)
+			for used[key] {
+				key = "fields." + key
+			}
+			used[key] = true
+			attrs = append(attrs, [2]string{key, fmt.Sprintf("%v", props[k])})
+		}
+	}
+	return attrs
+}
+
+// Extension keys may hold only letters, digits, '_' and '.'; anything else
+// would split or corrupt the record.
+func securityEventKey(name string) string {
+	key := []byte(name)
+	for i, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.') {
+			key[i] = '_'
+		}
+	}
+	if len(key) == 0 {
+		return "_"
+	}
+	return string(key)
+}
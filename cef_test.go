@@ -0,0 +1,61 @@
+package log
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSecurityEventKeys(t *testing.T) {
+	entry := &stdLogEntry{
+		ts:              time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		stream:          &stdLogStream{name: "auth"},
+		level:           Warning,
+		message:         "login failed",
+		associatedError: errors.New("bad password"),
+		properties: map[string]interface{}{
+			"user name": "bob",
+			"a=b":       1,
+			"x|y\tz":    2,
+			"cs2":       "forged",
+			"cs3Label":  "forged",
+			"sev":       "forged",
+		},
+	}
+	product := SecurityEventProduct{Vendor: "dtromb", Product: "log", Version: "1"}
+	cef := NewCEFFormatter(product).Format(entry)
+	for _, want := range []string{" user_name=bob", " a_b=1", " x_y_z=2", " cs2Label=error cs2=bad password",
+		" fields.cs2=forged", " fields.cs3Label=forged", " sev=forged"} {
+		if !strings.Contains(cef, want) {
+			t.Errorf("CEF record lacks %q:\n%s", want, cef)
+		}
+	}
+	if strings.Count(cef, "|") != 7 {
+		t.Errorf("CEF header corrupted:\n%s", cef)
+	}
+	leef := NewLEEFFormatter(product).Format(entry)
+	for _, want := range []string{"\tuser_name=bob", "\tx_y_z=2", "\tsev=6\t", "\tfields.sev=forged", "\tfields.cs2=forged"} {
+		if !strings.Contains(leef, want) {
+			t.Errorf("LEEF record lacks %q:\n%s", want, leef)
+		}
+	}
+	if strings.Count(leef, "\t") != 12 {
+		t.Errorf("LEEF attributes split:\n%s", leef)
+	}
+}
+
+func TestCEFNameTruncation(t *testing.T) {
+	entry := &stdLogEntry{
+		ts:      time.Now(),
+		stream:  &stdLogStream{name: "auth"},
+		level:   Info,
+		message: "a" + strings.Repeat("é", 300),
+	}
+	out := NewCEFFormatter(SecurityEventProduct{}).Format(entry)
+	name := strings.Split(out, "|")[5]
+	if !utf8.ValidString(name) || len(name) != 511 {
+		t.Errorf("name cut inside a rune: %d bytes, valid %v", len(name), utf8.ValidString(name))
+	}
+}
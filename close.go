@@ -0,0 +1,34 @@
+package log
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Close is idempotent, flushes pending data first, interrupts a delivery
+// still blocked after closeGrace, and returns every error met, joined.
+// Entries received after Close are refused with ErrListenerClosed.
+var ErrListenerClosed = errors.New("listener closed")
+
+// How long Close waits for an in-flight delivery before interrupting it.
+const closeGrace = 250 * time.Millisecond
+
+///
+
+// Marks a listener closing, returning false if it already was.
+func beginClose(closing *int32) bool {
+	return atomic.CompareAndSwapInt32(closing, 0, 1)
+}
+
+// Acquires a listener's lock for Close.  If an in-flight delivery holds it
+// past closeGrace, interrupt is called to unblock the delivery.
+func acquireForClose(lock chan bool, interrupt func()) {
+	select {
+	case <-lock:
+		return
+	case <-time.After(closeGrace):
+	}
+	interrupt()
+	<-lock
+}
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCloseWhileLogging(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := ServeStreams(l, CreateLoggingContext(), StreamServerOptions{})
+	defer server.Close()
+	fl, err := NewFileListener("file", filepath.Join(t.TempDir(), "close.log"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listeners := []FallibleLogListener{
+		NewWriterLoggerOpts("writer", io.Discard, nil, WriterOptions{BufferSize: 4096}).(FallibleLogListener),
+		fl.(FallibleLogListener),
+		NewNetworkListener("network", "tcp", server.Addr().String(), NetworkOptions{}),
+	}
+	stream, _ := CreateLoggingContext().Stream("close")
+	entry := &stdLogEntry{ts: time.Now(), stream: stream, level: Info, message: "closing"}
+	for _, ll := range listeners {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for !errors.Is(ll.TryReceive(entry), ErrListenerClosed) {
+				}
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() { errs <- ll.Close() }()
+		}
+		for i := 0; i < 2; i++ {
+			if err := <-errs; err != nil {
+				t.Errorf("%s: unexpected error closing: %v", ll.Name(), err)
+			}
+		}
+		wg.Wait()
+		if err := ll.Close(); err != nil {
+			t.Errorf("%s: expected closing again to be a no-op, got %v", ll.Name(), err)
+		}
+	}
+}
+
+func TestCloseUnblocksReceive(t *testing.T) {
+	r, w := io.Pipe()
+	defer r.Close()
+	wl := NewWriterLogger("pipe", w, nil).(FallibleLogListener)
+	stream, _ := CreateLoggingContext().Stream("close")
+	entry := &stdLogEntry{ts: time.Now(), stream: stream, level: Info, message: "stalled"}
+	received := make(chan error)
+	go func() { received <- wl.TryReceive(entry) }()
+	time.Sleep(10 * time.Millisecond)
+	closed := make(chan error)
+	go func() { closed <- wl.Close() }()
+	select {
+	case err := <-received:
+		if err == nil {
+			t.Errorf("expected the stalled write to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not unblock the stalled write")
+	}
+	if err := <-closed; err != nil {
+		t.Errorf("unexpected error closing: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+// Command logbench generates synthetic log load against a pipeline built
+// from the log package - a sink, optionally behind an async listener - and
+// reports throughput, the latency of logging calls and the entries lost,
+// to size queues and sinks before production.
+//
+//	logbench -duration 30s -workers 8 -rate 50000 -sink tcp:collector:5140 -async 4096
+//
+// The load is shaped by the number of streams, the level mix, the number
+// of properties per entry and the number of distinct values each takes,
+// and the fractions of entries logged with an error or a stack trace.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dtromb/log"
+)
+
+// Latency samples kept per worker.
+const maxSamples = 100000
+
+type config struct {
+	duration     time.Duration
+	count        int
+	workers      int
+	rate         float64
+	streams      int
+	levels       []weightedLevel
+	fields       int
+	cardinality  int
+	errorRatio   float64
+	traceRatio   float64
+	sink         string
+	format       string
+	asyncQueue   int
+	asyncWorkers int
+	seed         int64
+}
+
+type weightedLevel struct {
+	level  log.LogLevel
+	weight float64
+}
+
+// Counts the entries a sink refuses.
+type countingListener struct {
+	log.LogListener
+	failed uint64
+}
+
+type workerResult struct {
+	calls   uint64
+	samples []time.Duration
+}
+
+func main() {
+	cfg, err := parseFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "logbench:", err)
+		os.Exit(2)
+	}
+	if err := run(cfg, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "logbench:", err)
+		os.Exit(1)
+	}
+}
+
+func parseFlags(args []string) (*config, error) {
+	cfg := &config{}
+	fs := flag.NewFlagSet("logbench", flag.ContinueOnError)
+	fs.DurationVar(&cfg.duration, "duration", 10*time.Second, "how long to generate load")
+	fs.IntVar(&cfg.count, "n", 0, "entries to log per worker (overrides -duration)")
+	fs.IntVar(&cfg.workers, "workers", 4, "goroutines logging concurrently")
+	fs.Float64Var(&cfg.rate, "rate", 0, "target entries per second over all workers (0 for as fast as possible)")
+	fs.IntVar(&cfg.streams, "streams", 8, "number of streams")
+	levels := fs.String("levels", "Info=70,Debug=20,Warning=8,Error=2", "level mix, as level=weight pairs")
+	fs.IntVar(&cfg.fields, "fields", 3, "template properties per entry")
+	fs.IntVar(&cfg.cardinality, "cardinality", 100, "distinct values per property")
+	fs.Float64Var(&cfg.errorRatio, "error-ratio", 0.01, "fraction of entries logged with an error")
+	fs.Float64Var(&cfg.traceRatio, "trace-ratio", 0.001, "fraction of entries logged with a stack trace")
+	fs.StringVar(&cfg.sink, "sink", "discard", "discard, stdout, file:PATH, tcp:ADDRESS or unix:PATH")
+	fs.StringVar(&cfg.format, "format", "text", "text or json")
+	fs.IntVar(&cfg.asyncQueue, "async", 0, "deliver through an async listener with this queue size (0 for synchronous delivery)")
+	fs.IntVar(&cfg.asyncWorkers, "async-workers", 1, "async delivery workers")
+	fs.Int64Var(&cfg.seed, "seed", 1, "random seed")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	var err error
+	if cfg.levels, err = parseLevels(*levels); err != nil {
+		return nil, err
+	}
+	if cfg.workers <= 0 || cfg.streams <= 0 {
+		return nil, errors.New("-workers and -streams must be positive")
+	}
+	if cfg.cardinality <= 0 {
+		cfg.cardinality = 1
+	}
+	return cfg, nil
+}
+
+func parseLevels(spec string) ([]weightedLevel, error) {
+	var levels []weightedLevel
+	for _, pair := range strings.Split(spec, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("level mix %q: expected level=weight", pair)
+		}
+		level, known := log.ParseLogLevel(name)
+		if !known {
+			return nil, fmt.Errorf("level mix %q: unknown level '%s'", pair, name)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("level mix %q: bad weight", pair)
+		}
+		levels = append(levels, weightedLevel{level: level, weight: w})
+	}
+	return levels, nil
+}
+
+func newSink(cfg *config) (log.LogListener, error) {
+	var formatter log.LogEntryFormatter = log.NewLogEntryFormatter()
+	switch cfg.format {
+	case "text":
+	case "json":
+		formatter = log.NewJSONFormatter()
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", cfg.format)
+	}
+	kind, target, _ := strings.Cut(cfg.sink, ":")
+	switch kind {
+	case "discard":
+		return log.NewWriterLogger("bench", io.Discard, formatter), nil
+	case "stdout":
+		return log.NewWriterLogger("bench", os.Stdout, formatter), nil
+	case "file":
+		return log.NewFileListener("bench", target, formatter)
+	case "tcp", "unix":
+		return log.NewNetworkListener("bench", kind, target, log.NetworkOptions{}), nil
+	}
+	return nil, fmt.Errorf("unknown sink '%s'", cfg.sink)
+}
+
+func (cl *countingListener) TryReceive(entry log.LogEntry) error {
+	var err error
+	if fl, ok := cl.LogListener.(log.FallibleLogListener); ok {
+		err = fl.TryReceive(entry)
+	} else {
+		cl.LogListener.Receive(entry)
+	}
+	if err != nil {
+		atomic.AddUint64(&cl.failed, 1)
+	}
+	return err
+}
+
+func (cl *countingListener) Receive(entry log.LogEntry) {
+	cl.TryReceive(entry)
+}
+
+func run(cfg *config, out io.Writer) error {
+	sink, err := newSink(cfg)
+	if err != nil {
+		return err
+	}
+	counted := &countingListener{LogListener: sink}
+	var listener log.LogListener = counted
+	var async log.AsyncListener
+	if cfg.asyncQueue > 0 {
+		async = log.NewAsyncListener("bench-async", counted, log.AsyncOptions{QueueSize: cfg.asyncQueue, Workers: cfg.asyncWorkers})
+		listener = async
+	}
+	ctx := log.CreateLoggingContext()
+	ctx.AddGlobalLogListener(listener, log.Trace)
+	streams := make([]log.LogStream, cfg.streams)
+	for i := range streams {
+		streams[i], _ = ctx.Stream(fmt.Sprintf("bench-%d", i))
+	}
+	template := "benchmark entry"
+	for i := 0; i < cfg.fields; i++ {
+		template += fmt.Sprintf(" k%d={K%d}", i, i)
+	}
+	reentrant := log.ReentrantDrops()
+	results := make([]workerResult, cfg.workers)
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(cfg.duration)
+	for w := 0; w < cfg.workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			results[w] = generate(cfg, streams, template, w, deadline)
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	var flushErr error
+	if async != nil {
+		flushErr = async.Flush()
+	} else if fl, ok := sink.(log.Flusher); ok {
+		flushErr = fl.Flush()
+	}
+	drained := time.Since(start)
+	var calls uint64
+	var samples []time.Duration
+	for _, r := range results {
+		calls += r.calls
+		samples = append(samples, r.samples...)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	fmt.Fprintf(out, "entries    %d in %s (%.0f/s); delivered by %s (%.0f/s)\n",
+		calls, elapsed.Round(time.Millisecond), float64(calls)/elapsed.Seconds(),
+		drained.Round(time.Millisecond), float64(calls)/drained.Seconds())
+	fmt.Fprintf(out, "latency    p50 %s  p99 %s  p99.9 %s  max %s\n",
+		percentile(samples, 0.5), percentile(samples, 0.99), percentile(samples, 0.999), percentile(samples, 1))
+	fmt.Fprintf(out, "lost       %d refused by the sink", atomic.LoadUint64(&counted.failed))
+	if async != nil {
+		fmt.Fprintf(out, ", %d dropped and %d expired by the async queue", async.Dropped(), async.Expired())
+	}
+	fmt.Fprintf(out, ", %d reentrant\n", log.ReentrantDrops()-reentrant)
+	if flushErr != nil {
+		fmt.Fprintf(out, "flush      %s\n", flushErr)
+	}
+	return listener.Close()
+}
+
+func generate(cfg *config, streams []log.LogStream, template string, w int, deadline time.Time) workerResult {
+	var res workerResult
+	rng := rand.New(rand.NewSource(cfg.seed + int64(w)))
+	var total float64
+	for _, wl := range cfg.levels {
+		total += wl.weight
+	}
+	var interval time.Duration
+	if cfg.rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(cfg.workers) / cfg.rate)
+	}
+	args := make([]interface{}, cfg.fields)
+	next := time.Now()
+	for i := 0; ; i++ {
+		if cfg.count > 0 && i >= cfg.count || cfg.count <= 0 && !time.Now().Before(deadline) {
+			break
+		}
+		if interval > 0 {
+			next = next.Add(interval)
+			if d := time.Until(next); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		stream := streams[rng.Intn(len(streams))]
+		level := pickLevel(cfg.levels, total, rng)
+		for f := range args {
+			args[f] = rng.Intn(cfg.cardinality)
+		}
+		begin := time.Now()
+		switch r := rng.Float64(); {
+		case r < cfg.errorRatio:
+			stream.Errorf(fmt.Errorf("synthetic failure %d", rng.Intn(cfg.cardinality)), "benchmark error")
+		case r < cfg.errorRatio+cfg.traceRatio:
+			stream.LogTrace(level, "benchmark entry with trace")
+		default:
+			stream.LogTemplate(level, template, args...)
+		}
+		took := time.Since(begin)
+		res.calls++
+		if len(res.samples) < maxSamples {
+			res.samples = append(res.samples, took)
+		} else if j := rng.Int63n(int64(res.calls)); j < maxSamples {
+			res.samples[j] = took
+		}
+	}
+	return res
+}
+
+func pickLevel(levels []weightedLevel, total float64, rng *rand.Rand) log.LogLevel {
+	r := rng.Float64() * total
+	for _, wl := range levels {
+		if r < wl.weight {
+			return wl.level
+		}
+		r -= wl.weight
+	}
+	return levels[len(levels)-1].level
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(sorted)-1))
+	return sorted[i]
+}
@@ -0,0 +1,225 @@
+// Command logship ships existing log files to a sink: each file is tailed,
+// its lines folded into records and parsed for times, levels and fields as
+// TailFile does in process, and the resulting entries delivered through the
+// package's listeners - a stream server over TCP or a unix socket, a file,
+// or stdout.
+//
+//	logship -file app=/var/log/app.log -file /var/log/worker.log \
+//	    -parser logfmt -to tcp:collector:5140 -compression gzip -receipts
+//
+// Entries are named after the file's stream (by default its base name
+// without extension).  Network sinks are queued through an async listener
+// so that short outages do not stall tailing.  On SIGINT or SIGTERM the
+// tailers stop, the sinks are flushed for up to -shutdown-timeout, and the
+// entries left unsent are reported.
+//
+// Files written by a file listener with FileOptions.Encryption are shipped
+// decrypted when -key names the key file (raw or hex-encoded key bytes).
+//
+// The package has no configuration file format, so logship is configured
+// by flags.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dtromb/log"
+)
+
+type stringList []string
+
+type config struct {
+	files       stringList
+	sinks       stringList
+	parser      string
+	format      string
+	fromStart   bool
+	noFolding   bool
+	queue       int
+	compression string
+	receipts    bool
+	token       string
+	caFile      string
+	certFile    string
+	keyFile     string
+	serverName  string
+	decryptKey  string
+	level       log.LogLevel
+	timeSource  log.TimeSource
+	shutdown    time.Duration
+}
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *stringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
+func main() {
+	cfg, err := parseFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "logship:", err)
+		os.Exit(2)
+	}
+	if err := run(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "logship:", err)
+		os.Exit(1)
+	}
+}
+
+func parseFlags(args []string) (*config, error) {
+	cfg := &config{}
+	fs := flag.NewFlagSet("logship", flag.ContinueOnError)
+	fs.Var(&cfg.files, "file", "file to ship, as PATH or STREAM=PATH (repeatable)")
+	fs.Var(&cfg.sinks, "to", "sink: tcp:ADDRESS, unix:PATH, file:PATH or stdout (repeatable)")
+	fs.StringVar(&cfg.parser, "parser", "plain", "line format: plain, json or logfmt")
+	fs.StringVar(&cfg.format, "format", "json", "entry format for file and stdout sinks: text or json")
+	fs.BoolVar(&cfg.fromStart, "from-start", false, "ship the files' existing contents, not only appended lines")
+	fs.BoolVar(&cfg.noFolding, "no-folding", false, "ship every line as its own entry")
+	fs.IntVar(&cfg.queue, "queue", 4096, "entries queued for each network sink")
+	fs.StringVar(&cfg.compression, "compression", "", "compression offered to stream servers (gzip)")
+	fs.BoolVar(&cfg.receipts, "receipts", false, "have stream servers acknowledge entries, resending those lost")
+	fs.StringVar(&cfg.token, "token", "", "token presented to stream servers (or $LOGSHIP_TOKEN)")
+	fs.StringVar(&cfg.caFile, "tls-ca", "", "CA certificate verifying stream servers; enables TLS")
+	fs.StringVar(&cfg.certFile, "tls-cert", "", "client certificate for TLS")
+	fs.StringVar(&cfg.keyFile, "tls-key", "", "client key for TLS")
+	fs.StringVar(&cfg.serverName, "tls-server-name", "", "server name verified for TLS")
+	fs.StringVar(&cfg.decryptKey, "key", "", "key file decrypting encrypted log files")
+	level := fs.String("level", "Trace", "least severe level shipped")
+	timeSource := fs.String("time", "ingest", "entry time: event (parsed from the line) or ingest")
+	fs.DurationVar(&cfg.shutdown, "shutdown-timeout", 10*time.Second, "how long to flush the sinks at shutdown")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if len(cfg.files) == 0 || len(cfg.sinks) == 0 {
+		return nil, fmt.Errorf("at least one -file and one -to are required")
+	}
+	var known bool
+	if cfg.level, known = log.ParseLogLevel(*level); !known {
+		return nil, fmt.Errorf("unknown level '%s'", *level)
+	}
+	switch *timeSource {
+	case "ingest":
+		cfg.timeSource = log.TimeFromIngestion
+	case "event":
+		cfg.timeSource = log.TimeFromEvent
+	default:
+		return nil, fmt.Errorf("unknown time source '%s'", *timeSource)
+	}
+	if cfg.token == "" {
+		cfg.token = os.Getenv("LOGSHIP_TOKEN")
+	}
+	return cfg, nil
+}
+
+func newParser(name string) (log.LineParser, error) {
+	switch name {
+	case "plain":
+		return log.NewPlainLineParser(), nil
+	case "json":
+		return log.NewJSONLineParser(), nil
+	case "logfmt":
+		return log.NewLogfmtLineParser(), nil
+	}
+	return nil, fmt.Errorf("unknown parser '%s'", name)
+}
+
+func newSink(cfg *config, spec string, n int) (log.LogListener, error) {
+	var formatter log.LogEntryFormatter = log.NewJSONFormatter()
+	if cfg.format == "text" {
+		formatter = log.NewLogEntryFormatter()
+	}
+	name := fmt.Sprintf("sink-%d", n)
+	kind, target, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "stdout":
+		return log.NewWriterLogger(name, os.Stdout, formatter), nil
+	case "file":
+		return log.NewFileListener(name, target, formatter)
+	case "tcp", "unix":
+		opts := log.NetworkOptions{
+			Compression: cfg.compression,
+			Receipts:    cfg.receipts,
+		}
+		if cfg.token != "" {
+			token := cfg.token
+			opts.Token = func() (string, error) { return token, nil }
+		}
+		if cfg.caFile != "" {
+			tlsConfig, err := log.LoadClientTLSConfig(cfg.caFile, cfg.certFile, cfg.keyFile, cfg.serverName)
+			if err != nil {
+				return nil, err
+			}
+			opts.TLS = tlsConfig
+		}
+		network := log.NewNetworkListener(name, kind, target, opts)
+		return log.NewAsyncListener(name+"-queue", network, log.AsyncOptions{QueueSize: cfg.queue}), nil
+	}
+	return nil, fmt.Errorf("unknown sink '%s'", spec)
+}
+
+func run(cfg *config) error {
+	parser, err := newParser(cfg.parser)
+	if err != nil {
+		return err
+	}
+	ctx := log.CreateLoggingContext()
+	var sinks []log.LogListener
+	for i, spec := range cfg.sinks {
+		sink, err := newSink(cfg, spec, i)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+		ctx.AddGlobalLogListener(sink, cfg.level)
+	}
+	var tailers []log.Tailer
+	for _, spec := range cfg.files {
+		stream, path, named := strings.Cut(spec, "=")
+		if !named {
+			path = spec
+			stream = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		ls, _ := ctx.Stream(stream)
+		file := path
+		opts := log.TailOptions{FromStart: cfg.fromStart}
+		opts.Parser = parser
+		opts.NoFolding = cfg.noFolding
+		opts.TimeSource = cfg.timeSource
+		if cfg.decryptKey != "" {
+			opts.Decryption = log.KeyFile(cfg.decryptKey)
+		}
+		opts.OnError = func(err error) {
+			fmt.Fprintf(os.Stderr, "logship: %s: %s\n", file, err)
+		}
+		tailers = append(tailers, log.TailFile(path, ls, opts))
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	<-signals
+	signal.Stop(signals)
+	for _, tailer := range tailers {
+		tailer.Stop()
+	}
+	deadline, cancel := context.WithTimeout(context.Background(), cfg.shutdown)
+	defer cancel()
+	report, err := log.FlushAllContext(deadline)
+	if total := report.Total(); total > 0 {
+		fmt.Fprintf(os.Stderr, "logship: %d entries unsent at shutdown\n", total)
+	}
+	for _, sink := range sinks {
+		sink.Close()
+	}
+	return err
+}
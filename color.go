@@ -0,0 +1,161 @@
+package log
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type ColorSupport uint8
+
+const (
+	NoColor ColorSupport = iota
+	Color8
+	Color256
+	TrueColor
+)
+
+///
+
+func (cs ColorSupport) String() string {
+	switch cs {
+	case NoColor:
+		return "none"
+	case Color8:
+		return "8"
+	case Color256:
+		return "256"
+	case TrueColor:
+		return "truecolor"
+	}
+	return "ColorSupport(" + strconv.Itoa(int(cs)) + ")"
+}
+
+// DetectColor decides what w can display: NO_COLOR and FORCE_COLOR take
+// precedence, then whether w is a terminal, COLORTERM, TERM and the
+// terminfo colors capability.
+func DetectColor(w io.Writer) ColorSupport {
+	if _, set := os.LookupEnv("NO_COLOR"); set {
+		return NoColor
+	}
+	if force, set := os.LookupEnv("FORCE_COLOR"); set {
+		switch strings.ToLower(force) {
+		case "0", "false":
+			return NoColor
+		case "2":
+			return Color256
+		case "3":
+			return TrueColor
+		}
+		return Color8
+	}
+	if !hasTerminal(w) {
+		return NoColor
+	}
+	term := os.Getenv("TERM")
+	if term == "" || term == "dumb" {
+		return NoColor
+	}
+	switch strings.ToLower(os.Getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return TrueColor
+	}
+	switch {
+	case strings.HasSuffix(term, "-direct"):
+		return TrueColor
+	case strings.HasSuffix(term, "-256color"):
+		return Color256
+	}
+	switch colors := terminfoColors(term); {
+	case colors >= 1<<24:
+		return TrueColor
+	case colors >= 256:
+		return Color256
+	case colors > 0 && colors < 8:
+		return NoColor
+	}
+	return Color8
+}
+
+// DefaultColorSupport reports the color used by the global context's
+// stdout listener.
+func DefaultColorSupport() ColorSupport {
+	GetGlobalLoggingContext()
+	_GLOBAL_loggingContextLock <- true
+	defer func() { <-_GLOBAL_loggingContextLock }()
+	return _GLOBAL_colorSupport
+}
+
+func terminfoDirs() []string {
+	var dirs []string
+	if dir := os.Getenv("TERMINFO"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".terminfo"))
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("TERMINFO_DIRS")) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs, "/etc/terminfo", "/lib/terminfo", "/usr/share/terminfo")
+}
+
+// Reads the "colors" number from term's compiled terminfo entry, or returns
+// -1 if there is none.
+func terminfoColors(term string) int {
+	if term == "" || strings.ContainsAny(term, `/\`) {
+		return -1
+	}
+	for _, dir := range terminfoDirs() {
+		// Directories are named by the first character, or (on macOS) by
+		// its hex code.
+		for _, sub := range []string{term[:1], strconv.FormatInt(int64(term[0]), 16)} {
+			if data, err := ioutil.ReadFile(filepath.Join(dir, sub, term)); err == nil {
+				return parseTerminfoColors(data)
+			}
+		}
+	}
+	return -1
+}
+
+const terminfoColorsIndex = 13
+
+func parseTerminfoColors(data []byte) int {
+	if len(data) < 12 {
+		return -1
+	}
+	header := make([]int, 6)
+	for i := range header {
+		header[i] = int(int16(binary.LittleEndian.Uint16(data[2*i:])))
+	}
+	numberSize := 2
+	switch header[0] {
+	case 0432:
+	case 01036:
+		numberSize = 4
+	default:
+		return -1
+	}
+	names, bools, numbers := header[1], header[2], header[3]
+	if names < 0 || bools < 0 || numbers <= terminfoColorsIndex {
+		return -1
+	}
+	offset := 12 + names + bools
+	if offset%2 != 0 {
+		offset++
+	}
+	offset += terminfoColorsIndex * numberSize
+	if offset+numberSize > len(data) {
+		return -1
+	}
+	if numberSize == 2 {
+		return int(int16(binary.LittleEndian.Uint16(data[offset:])))
+	}
+	return int(int32(binary.LittleEndian.Uint32(data[offset:])))
+}
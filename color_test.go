@@ -0,0 +1,79 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func TestDetectColor(t *testing.T) {
+	for _, name := range []string{"NO_COLOR", "FORCE_COLOR"} {
+		if value, set := os.LookupEnv(name); set {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+	var buf bytes.Buffer
+	cases := []struct {
+		noColor, forceColor string
+		expected            ColorSupport
+	}{
+		{"", "", NoColor},
+		{"", "1", Color8},
+		{"", "2", Color256},
+		{"", "3", TrueColor},
+		{"", "false", NoColor},
+		{"1", "3", NoColor},
+	}
+	for _, c := range cases {
+		os.Unsetenv("NO_COLOR")
+		os.Unsetenv("FORCE_COLOR")
+		if c.noColor != "" {
+			os.Setenv("NO_COLOR", c.noColor)
+		}
+		if c.forceColor != "" {
+			os.Setenv("FORCE_COLOR", c.forceColor)
+		}
+		if got := DetectColor(&buf); got != c.expected {
+			t.Errorf("NO_COLOR=%q FORCE_COLOR=%q: expected %s, got %s", c.noColor, c.forceColor, c.expected, got)
+		}
+	}
+}
+
+func TestTerminfoColors(t *testing.T) {
+	entry := func(magic uint16, numberSize int, colors int) []byte {
+		names := []byte("fake|Fake terminal\x00")
+		var buf bytes.Buffer
+		for _, v := range []uint16{magic, uint16(len(names)), 1, 14, 0, 0} {
+			binary.Write(&buf, binary.LittleEndian, v)
+		}
+		buf.Write(names)
+		buf.WriteByte(1)
+		if buf.Len()%2 != 0 {
+			buf.WriteByte(0)
+		}
+		for i := 0; i < 14; i++ {
+			n := -1
+			if i == terminfoColorsIndex {
+				n = colors
+			}
+			if numberSize == 2 {
+				binary.Write(&buf, binary.LittleEndian, int16(n))
+			} else {
+				binary.Write(&buf, binary.LittleEndian, int32(n))
+			}
+		}
+		return buf.Bytes()
+	}
+	if got := parseTerminfoColors(entry(0432, 2, 256)); got != 256 {
+		t.Errorf("expected 256 colors from a legacy entry, got %d", got)
+	}
+	if got := parseTerminfoColors(entry(01036, 4, 1<<24)); got != 1<<24 {
+		t.Errorf("expected 16777216 colors from an extended entry, got %d", got)
+	}
+	if got := parseTerminfoColors([]byte("not terminfo")); got != -1 {
+		t.Errorf("expected -1 for garbage, got %d", got)
+	}
+}
@@ -0,0 +1,63 @@
+// +build js,wasm
+
+package log
+
+import (
+	"syscall/js"
+)
+
+type consoleListener struct {
+	name      string
+	formatter LogEntryFormatter
+	console   js.Value
+}
+
+// NewConsoleListener creates a listener writing to the global console
+// object, with console.error, warn, info or debug by level.  A nil
+// formatter uses the standard formatter without time or trailing newline,
+// as the console timestamps and separates entries itself.
+func NewConsoleListener(name string, formatter LogEntryFormatter) FormattingLogListener {
+	if formatter == nil {
+		slf := NewLogEntryFormatter()
+		slf.ClearFlags(PrintTime | PrintNewline)
+		formatter = slf
+	}
+	return &consoleListener{
+		name:      name,
+		formatter: formatter,
+		console:   js.Global().Get("console"),
+	}
+}
+
+func consoleMethod(level LogLevel) string {
+	switch {
+	case level.IsFatal(), level.IsError():
+		return "error"
+	case level.IsWarning():
+		return "warn"
+	case level.IsInfo():
+		return "info"
+	}
+	return "debug"
+}
+
+func (cl *consoleListener) Name() string {
+	return cl.name
+}
+
+func (cl *consoleListener) Formatter() LogEntryFormatter {
+	return cl.formatter
+}
+
+func (cl *consoleListener) Receive(entry LogEntry) {
+	str := cl.formatter.Format(entry)
+	recordFormattedSize(entry, len(str))
+	if cl.console.IsUndefined() {
+		return
+	}
+	cl.console.Call(consoleMethod(entry.Level()), str)
+}
+
+func (cl *consoleListener) Close() error {
+	return nil
+}
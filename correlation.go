@@ -0,0 +1,120 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Entries logged with a correlation ID carry it as this property.
+const CorrelationProperty = "CorrelationId"
+
+// CorrelationEnviron passes the ID to child processes in this variable,
+// alongside a TRACEPARENT.
+const CorrelationEnv = "LOG_CORRELATION_ID"
+
+// IDs are 32 hex digits, so that they double as W3C trace IDs.
+func NewCorrelationID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// WithCorrelation returns a context whose entries, logged through
+// LogContext(), carry id.
+func WithCorrelation(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+func CorrelationFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(correlationKey{}).(string)
+	return id, ok && id != ""
+}
+
+// SetProcessCorrelation sets the ID carried by every entry the process logs
+// without an ID from a context; "" removes it.
+func SetProcessCorrelation(id string) {
+	_GLOBAL_correlation.Store(id)
+}
+
+func ProcessCorrelation() string {
+	id, _ := _GLOBAL_correlation.Load().(string)
+	return id
+}
+
+// EnterCorrelation makes id the ambient ID until exit is called, which
+// restores the ID entered before.  The ambient ID is process-wide, so
+// scopes suit work done one unit at a time - a job, a frame - rather than
+// concurrent requests, which should pass a context.
+func EnterCorrelation(id string) (exit func()) {
+	prev, _ := _GLOBAL_ambientCorrelation.Load().(string)
+	_GLOBAL_ambientCorrelation.Store(id)
+	return func() { _GLOBAL_ambientCorrelation.Store(prev) }
+}
+
+// AmbientCorrelation returns the ID carried by entries logged without a
+// context: the entered ID, or the process-wide ID.
+func AmbientCorrelation() string {
+	if id, _ := _GLOBAL_ambientCorrelation.Load().(string); id != "" {
+		return id
+	}
+	return ProcessCorrelation()
+}
+
+// CorrelationEnviron returns the environment variables which pass ctx's
+// correlation ID (or the ambient ID, if ctx has none) to a child process.
+func CorrelationEnviron(ctx context.Context) []string {
+	id, ok := CorrelationFromContext(ctx)
+	if !ok {
+		id = AmbientCorrelation()
+	}
+	if id == "" {
+		return nil
+	}
+	env := []string{CorrelationEnv + "=" + id}
+	if isTraceID(id) {
+		var span [8]byte
+		rand.Read(span[:])
+		env = append(env, "TRACEPARENT=00-"+id+"-"+hex.EncodeToString(span[:])+"-01")
+	}
+	return env
+}
+
+// InheritCorrelation sets the process-wide ID to the one passed by the
+// parent process, or to a new ID if there is none; inherited reports which.
+func InheritCorrelation() (id string, inherited bool) {
+	id = os.Getenv(CorrelationEnv)
+	if id == "" {
+		// version-traceid-spanid-flags
+		if parts := strings.Split(os.Getenv("TRACEPARENT"), "-"); len(parts) == 4 && isTraceID(parts[1]) {
+			id = parts[1]
+		}
+	}
+	inherited = id != ""
+	if !inherited {
+		id = NewCorrelationID()
+	}
+	SetProcessCorrelation(id)
+	return id, inherited
+}
+
+///
+
+type correlationKey struct{}
+
+var _GLOBAL_correlation atomic.Value
+var _GLOBAL_ambientCorrelation atomic.Value
+
+func isTraceID(id string) bool {
+	if len(id) != 32 || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
@@ -0,0 +1,48 @@
+package log
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCorrelation(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("jobs")
+
+	os.Unsetenv(CorrelationEnv)
+	os.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	defer os.Unsetenv("TRACEPARENT")
+	id, inherited := InheritCorrelation()
+	defer SetProcessCorrelation("")
+	if !inherited || id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected the TRACEPARENT trace ID to be inherited, got %q (%v)", id, inherited)
+	}
+	stream.Info("started")
+	request := NewCorrelationID()
+	stream.LogContext(WithCorrelation(context.Background(), request), Info, "handling request")
+
+	entries := cl.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if got := entries[0].(TemplatedLogEntry).Properties()[CorrelationProperty]; got != id {
+		t.Errorf("expected the process correlation ID, got %v", got)
+	}
+	if got := entries[1].(TemplatedLogEntry).Properties()[CorrelationProperty]; got != request {
+		t.Errorf("expected the context's correlation ID, got %v", got)
+	}
+
+	env := CorrelationEnviron(context.Background())
+	if len(env) != 2 || env[0] != CorrelationEnv+"="+id || !strings.HasPrefix(env[1], "TRACEPARENT=00-"+id+"-") {
+		t.Fatalf("unexpected child environment %v", env)
+	}
+	os.Setenv(CorrelationEnv, request)
+	defer os.Unsetenv(CorrelationEnv)
+	if child, inherited := InheritCorrelation(); !inherited || child != request {
+		t.Errorf("expected %s to be inherited from the environment, got %q", request, child)
+	}
+}
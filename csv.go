@@ -0,0 +1,143 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A DelimitedFormatter writes CSV (quoted per RFC 4180) or TSV (tabs and
+// line breaks escaped).  Columns are time, stream, level, message, error,
+// file, line, fingerprint or a property name.
+type DelimitedFormatter interface {
+	HeaderFormatter
+	Columns() []string
+	SetHeaderEnabled(enabled bool)
+	TimeFormat() string
+	SetTimeFormat(format string)
+}
+
+var DefaultDelimitedColumns = []string{"time", "stream", "level", "message", "error"}
+
+///
+
+type delimitedFormatter struct {
+	delim      byte
+	columns    []string
+	header     bool
+	timeFormat string
+}
+
+func NewDelimitedFormatter(delim byte, columns ...string) DelimitedFormatter {
+	if len(columns) == 0 {
+		columns = DefaultDelimitedColumns
+	}
+	df := &delimitedFormatter{
+		delim:      delim,
+		columns:    make([]string, len(columns)),
+		header:     true,
+		timeFormat: "2006-01-02T15:04:05.000Z07:00",
+	}
+	copy(df.columns, columns)
+	return df
+}
+
+func NewCSVFormatter(columns ...string) DelimitedFormatter {
+	return NewDelimitedFormatter(',', columns...)
+}
+
+func NewTSVFormatter(columns ...string) DelimitedFormatter {
+	return NewDelimitedFormatter('\t', columns...)
+}
+
+func (df *delimitedFormatter) Columns() []string {
+	res := make([]string, len(df.columns))
+	copy(res, df.columns)
+	return res
+}
+
+func (df *delimitedFormatter) SetHeaderEnabled(enabled bool) {
+	df.header = enabled
+}
+
+func (df *delimitedFormatter) TimeFormat() string {
+	return df.timeFormat
+}
+
+func (df *delimitedFormatter) SetTimeFormat(format string) {
+	df.timeFormat = format
+}
+
+func (df *delimitedFormatter) Header() string {
+	if !df.header {
+		return ""
+	}
+	return df.formatRow(df.columns)
+}
+
+func (df *delimitedFormatter) Format(entry LogEntry) string {
+	row := make([]string, len(df.columns))
+	for i, col := range df.columns {
+		row[i] = df.columnValue(col, entry)
+	}
+	return df.formatRow(row)
+}
+
+func (df *delimitedFormatter) columnValue(col string, entry LogEntry) string {
+	switch col {
+	case "time":
+		return entry.LogTime().Format(df.timeFormat)
+	case "stream":
+		return entry.Stream()
+	case "level":
+		return entry.Level().String()
+	case "message":
+		return PrefixedMessage(entry)
+	case "error":
+		if entry.HasAssociatedError() {
+			return entry.AssociatedError().Error()
+		}
+		return ""
+	case "file", "line":
+		if !entry.HasTrace() {
+			return ""
+		}
+		trace := entry.Trace()
+		if len(trace) == 0 {
+			return ""
+		}
+		if col == "file" {
+			return trace[0].File()
+		}
+		return fmt.Sprintf("%d", trace[0].Line())
+	case "fingerprint":
+		return Fingerprint(entry)
+	}
+	if te, ok := entry.(TemplatedLogEntry); ok {
+		if val, has := te.Properties()[col]; has {
+			return fmt.Sprintf("%v", val)
+		}
+	}
+	return ""
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func (df *delimitedFormatter) formatRow(row []string) string {
+	var buf []byte
+	for i, val := range row {
+		if i > 0 {
+			buf = append(buf, df.delim)
+		}
+		if df.delim == '\t' {
+			buf = append(buf, []byte(tsvEscaper.Replace(val))...)
+		} else if strings.IndexByte(val, df.delim) >= 0 || strings.ContainsAny(val, "\"\r\n") {
+			buf = append(buf, '"')
+			buf = append(buf, []byte(strings.Replace(val, "\"", "\"\"", -1))...)
+			buf = append(buf, '"')
+		} else {
+			buf = append(buf, []byte(val)...)
+		}
+	}
+	buf = append(buf, '\n')
+	return string(buf)
+}
@@ -0,0 +1,382 @@
+package log
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type DatabaseOptions struct {
+	Table         string
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxPending    int
+	BlockWhenFull bool
+	MaxRows       int64
+	// MaxRetries defaults to 5; negative values drop a failed batch at
+	// once.
+	MaxRetries int
+}
+
+type DatabaseListener interface {
+	LogListener
+	Flusher
+	ContextFlusher
+	LastError() error
+	Dropped() uint64
+}
+
+type EntryRow struct {
+	Time    time.Time
+	Stream  string
+	Level   string
+	Message string
+	Error   string
+	Trace   string
+	Fields  string
+}
+
+var EntryRowColumns = []string{"time", "stream", "level", "message", "error", "trace", "fields"}
+
+func (row *EntryRow) Values() []interface{} {
+	return []interface{}{row.Time, row.Stream, row.Level, row.Message,
+		nullString(row.Error), nullString(row.Trace), nullString(row.Fields)}
+}
+
+// A DatabaseDialect adapts the schema and bulk inserts to a database;
+// SQLite, PostgreSQL and ClickHouse dialects are provided.
+type DatabaseDialect interface {
+	Name() string
+	// Migrate creates the table if needed and adds any missing columns.
+	Migrate(db *sql.DB, table string) error
+	BulkInsert(tx *sql.Tx, table string, rows []*EntryRow) error
+	// Prune removes all but the newest maxRows rows.  Dialects which
+	// cannot prune (or prune by other means, such as TTLs) return nil.
+	Prune(db *sql.DB, table string, maxRows int64) error
+}
+
+///
+
+type stackFrameRecord struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Function string `json:"function,omitempty"`
+}
+
+type databaseFlush struct {
+	ctx   context.Context
+	reply chan error
+}
+
+type databaseListener struct {
+	lock    chan bool
+	name    string
+	db      *sql.DB
+	dialect DatabaseDialect
+	opts    DatabaseOptions
+	pending []*EntryRow
+	lastErr error
+	dropped uint64
+	// Consecutive failures of the batch at the head of pending.
+	failures int
+	retryAt  time.Time
+	closed  bool
+	wake    chan bool
+	space   chan bool
+	flushed chan *databaseFlush
+	done    chan bool
+}
+
+// NewDatabaseListener inserts entries, in batches, into a table of db,
+// creating the table and any missing columns.  Entries beyond MaxPending
+// are dropped, or block if BlockWhenFull.
+func NewDatabaseListener(name string, db *sql.DB, dialect DatabaseDialect, opts DatabaseOptions) (DatabaseListener, error) {
+	if opts.Table == "" {
+		opts.Table = "log_entries"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 100 * opts.BatchSize
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 5
+	} else if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if err := dialect.Migrate(db, opts.Table); err != nil {
+		return nil, err
+	}
+	dl := &databaseListener{
+		lock:    make(chan bool, 1),
+		name:    name,
+		db:      db,
+		dialect: dialect,
+		opts:    opts,
+		wake:    make(chan bool, 1),
+		space:   make(chan bool),
+		flushed: make(chan *databaseFlush),
+		done:    make(chan bool),
+	}
+	dl.lock <- true
+	go dl.writeLoop()
+	return dl, nil
+}
+
+func NewSQLiteListener(name string, db *sql.DB, opts DatabaseOptions) (DatabaseListener, error) {
+	return NewDatabaseListener(name, db, SQLiteDialect(), opts)
+}
+
+func NewEntryRow(entry LogEntry) *EntryRow {
+	row := &EntryRow{
+		Time:    entry.LogTime(),
+		Stream:  entry.Stream(),
+		Level:   entry.Level().String(),
+		Message: PrefixedMessage(entry),
+	}
+	if entry.HasAssociatedError() {
+		row.Error = entry.AssociatedError().Error()
+	}
+	if entry.HasTrace() {
+		trace := entry.Trace()
+		frames := make([]stackFrameRecord, len(trace))
+		for i, ste := range trace {
+			frames[i] = stackFrameRecord{File: ste.File(), Line: ste.Line(), Function: ste.Function().Name()}
+		}
+		if js, err := json.Marshal(frames); err == nil {
+			row.Trace = string(js)
+		}
+	}
+	if te, ok := entry.(TemplatedLogEntry); ok {
+		if props := te.Properties(); len(props) > 0 {
+			row.Fields = marshalFields(props)
+		}
+	}
+	return row
+}
+
+// marshalFields encodes a field map as a JSON object, falling back to the
+// %v rendering for values which cannot be marshaled.
+func marshalFields(fields map[string]interface{}) string {
+	if js, err := json.Marshal(fields); err == nil {
+		return string(js)
+	}
+	safe := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if _, err := json.Marshal(v); err != nil {
+			safe[k] = fmt.Sprintf("%v", v)
+		} else {
+			safe[k] = v
+		}
+	}
+	js, _ := json.Marshal(safe)
+	return string(js)
+}
+
+func nullString(str string) interface{} {
+	if str == "" {
+		return nil
+	}
+	return str
+}
+
+func (dl *databaseListener) Name() string {
+	return dl.name
+}
+
+func (dl *databaseListener) Receive(entry LogEntry) {
+	row := NewEntryRow(entry)
+	for {
+		<-dl.lock
+		if dl.closed {
+			dl.lock <- true
+			return
+		}
+		if len(dl.pending) < dl.opts.MaxPending {
+			dl.pending = append(dl.pending, row)
+			full := len(dl.pending) >= dl.opts.BatchSize
+			dl.lock <- true
+			if full {
+				dl.signal()
+			}
+			return
+		}
+		if !dl.opts.BlockWhenFull {
+			dl.dropped++
+			dl.lock <- true
+			return
+		}
+		dl.lock <- true
+		dl.signal()
+		select {
+		case <-dl.space:
+		case <-dl.done:
+			return
+		}
+	}
+}
+
+func (dl *databaseListener) signal() {
+	select {
+	case dl.wake <- true:
+	default:
+	}
+}
+
+func (dl *databaseListener) writeLoop() {
+	ticker := time.NewTicker(dl.opts.FlushInterval)
+	defer ticker.Stop()
+	defer close(dl.done)
+	for {
+		select {
+		case <-ticker.C:
+			dl.writePending(context.Background(), false)
+		case <-dl.wake:
+			dl.writePending(context.Background(), false)
+		case flush := <-dl.flushed:
+			err := dl.writePending(flush.ctx, true)
+			<-dl.lock
+			closed := dl.closed
+			dl.lock <- true
+			flush.reply <- err
+			if closed {
+				return
+			}
+		}
+	}
+}
+
+func (dl *databaseListener) writePending(ctx context.Context, flush bool) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		<-dl.lock
+		if !flush && time.Now().Before(dl.retryAt) {
+			dl.lock <- true
+			return nil
+		}
+		n := len(dl.pending)
+		if n > dl.opts.BatchSize {
+			n = dl.opts.BatchSize
+		}
+		rows := dl.pending[:n]
+		dl.pending = dl.pending[n:]
+		dl.lock <- true
+		// Wake any producers blocked on a full buffer.
+		for released := false; !released; {
+			select {
+			case dl.space <- true:
+			default:
+				released = true
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		err := dl.write(ctx, rows)
+		var pruneErr error
+		if err == nil && dl.opts.MaxRows > 0 {
+			// The batch is committed whether or not pruning succeeds, so
+			// a prune failure is only recorded, never retried.
+			pruneErr = dl.dialect.Prune(dl.db, dl.opts.Table, dl.opts.MaxRows)
+		}
+		<-dl.lock
+		switch {
+		case err == nil:
+			if pruneErr != nil {
+				dl.lastErr = pruneErr
+			}
+			dl.failures = 0
+			dl.retryAt = time.Time{}
+		case ctx.Err() != nil:
+			// The batch is kept for a later flush.
+			dl.pending = append(rows[:n:n], dl.pending...)
+			err = ctx.Err()
+		case dl.failures >= dl.opts.MaxRetries:
+			dl.lastErr = err
+			dl.dropped += uint64(n)
+			dl.failures = 0
+			dl.retryAt = time.Time{}
+		default:
+			dl.lastErr = err
+			dl.pending = append(rows[:n:n], dl.pending...)
+			backoff := dl.opts.FlushInterval << uint(dl.failures)
+			if dl.failures > 6 {
+				backoff = dl.opts.FlushInterval << 6
+			}
+			dl.retryAt = time.Now().Add(backoff)
+			dl.failures++
+		}
+		dl.lock <- true
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (dl *databaseListener) write(ctx context.Context, rows []*EntryRow) error {
+	tx, err := dl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := dl.dialect.BulkInsert(tx, dl.opts.Table, rows); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (dl *databaseListener) Flush() error {
+	_, err := dl.FlushContext(context.Background())
+	return err
+}
+
+func (dl *databaseListener) FlushContext(ctx context.Context) (int, error) {
+	flush := &databaseFlush{ctx: ctx, reply: make(chan error, 1)}
+	var err error
+	select {
+	case dl.flushed <- flush:
+		select {
+		case err = <-flush.reply:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	case <-dl.done:
+		return 0, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	<-dl.lock
+	defer func() { dl.lock <- true }()
+	return len(dl.pending), err
+}
+
+func (dl *databaseListener) LastError() error {
+	<-dl.lock
+	defer func() { dl.lock <- true }()
+	return dl.lastErr
+}
+
+func (dl *databaseListener) Dropped() uint64 {
+	<-dl.lock
+	defer func() { dl.lock <- true }()
+	return dl.dropped
+}
+
+func (dl *databaseListener) Close() error {
+	<-dl.lock
+	if dl.closed {
+		dl.lock <- true
+		return nil
+	}
+	dl.closed = true
+	dl.lock <- true
+	return dl.Flush()
+}
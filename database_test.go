@@ -0,0 +1,301 @@
+package log
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A database/sql driver recording the statements it is given.
+type fakeSQLDriver struct {
+	lock       sync.Mutex
+	statements []string
+	batches    []int
+	fail       bool
+}
+
+type fakeSQLConn struct {
+	drv *fakeSQLDriver
+	tx  *fakeSQLTx
+}
+
+type fakeSQLTx struct {
+	conn *fakeSQLConn
+	rows int
+}
+
+type fakeSQLStmt struct {
+	conn  *fakeSQLConn
+	query string
+}
+
+type fakeSQLRows struct {
+	columns []string
+	next    int
+}
+
+func (drv *fakeSQLDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeSQLConn{drv: drv}, nil
+}
+
+func (drv *fakeSQLDriver) Driver() driver.Driver {
+	return nil
+}
+
+func (drv *fakeSQLDriver) setFail(fail bool) {
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+	drv.fail = fail
+}
+
+func (drv *fakeSQLDriver) recorded() ([]string, []int) {
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+	return append([]string(nil), drv.statements...), append([]int(nil), drv.batches...)
+}
+
+func (conn *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{conn: conn, query: query}, nil
+}
+
+func (conn *fakeSQLConn) Close() error {
+	return nil
+}
+
+func (conn *fakeSQLConn) Begin() (driver.Tx, error) {
+	conn.tx = &fakeSQLTx{conn: conn}
+	return conn.tx, nil
+}
+
+func (tx *fakeSQLTx) Commit() error {
+	drv := tx.conn.drv
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+	drv.batches = append(drv.batches, tx.rows)
+	tx.conn.tx = nil
+	return nil
+}
+
+func (tx *fakeSQLTx) Rollback() error {
+	tx.conn.tx = nil
+	return nil
+}
+
+func (stmt *fakeSQLStmt) Close() error {
+	return nil
+}
+
+func (stmt *fakeSQLStmt) NumInput() int {
+	return -1
+}
+
+func (stmt *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	drv := stmt.conn.drv
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+	drv.statements = append(drv.statements, fmt.Sprintf("%s [%d]", stmt.query, len(args)))
+	if strings.HasPrefix(stmt.query, "INSERT") || strings.HasPrefix(stmt.query, "COPY") {
+		if drv.fail {
+			return nil, errors.New("database unavailable")
+		}
+		if stmt.conn.tx != nil {
+			stmt.conn.tx.rows += len(args) / len(EntryRowColumns)
+		}
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (stmt *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	// PRAGMA table_info: the columns of a table created by an older
+	// version.
+	return &fakeSQLRows{columns: []string{"id", "time", "stream", "level", "message"}}, nil
+}
+
+func (rows *fakeSQLRows) Columns() []string {
+	return []string{"cid", "name", "type", "notnull", "dflt_value", "pk"}
+}
+
+func (rows *fakeSQLRows) Close() error {
+	return nil
+}
+
+func (rows *fakeSQLRows) Next(dest []driver.Value) error {
+	if rows.next >= len(rows.columns) {
+		return io.EOF
+	}
+	dest[0], dest[1], dest[2], dest[3], dest[4], dest[5] = int64(rows.next), rows.columns[rows.next], "TEXT", int64(0), nil, int64(0)
+	rows.next++
+	return nil
+}
+
+func newFakeDatabase(t *testing.T) (*fakeSQLDriver, *sql.DB) {
+	drv := &fakeSQLDriver{}
+	db := sql.OpenDB(drv)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return drv, db
+}
+
+func TestDatabaseListenerBatching(t *testing.T) {
+	drv, db := newFakeDatabase(t)
+	dl, err := NewSQLiteListener("db", db, DatabaseOptions{BatchSize: 3, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("db-test")
+	stream.AddLogListener(dl, Trace)
+	for i := 0; i < 7; i++ {
+		stream.Infof("entry %d", i)
+	}
+	if err := dl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, batches := drv.recorded()
+	total := 0
+	for _, n := range batches {
+		if n > 3 {
+			t.Errorf("batch of %d rows exceeds the batch size", n)
+		}
+		total += n
+	}
+	if total != 7 {
+		t.Errorf("inserted %d rows in batches %v", total, batches)
+	}
+}
+
+func TestDatabaseDialects(t *testing.T) {
+	copyIn := func(table string, columns ...string) string {
+		return fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(columns, ", "))
+	}
+	cols := strings.Join(EntryRowColumns, ", ")
+	for _, test := range []struct {
+		dialect DatabaseDialect
+		want    []string
+	}{
+		{SQLiteDialect(), []string{
+			"ALTER TABLE log_entries ADD COLUMN fields TEXT [0]",
+			"INSERT INTO log_entries (" + cols + ") VALUES (?, ?, ?, ?, ?, ?, ?) [7]",
+			"DELETE FROM log_entries WHERE id <= (SELECT MAX(id) FROM log_entries) - ? [1]",
+		}},
+		{PostgresDialect(nil), []string{
+			"ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS trace JSONB [0]",
+			"CREATE INDEX IF NOT EXISTS log_entries_time_idx ON log_entries (time) [0]",
+			"INSERT INTO log_entries (" + cols + ") VALUES ($1, $2, $3, $4, $5, $6, $7), ($8, $9, $10, $11, $12, $13, $14) [14]",
+			"DELETE FROM log_entries WHERE id <= (SELECT MAX(id) FROM log_entries) - $1 [1]",
+		}},
+		{PostgresDialect(copyIn), []string{
+			"COPY log_entries (" + cols + ") FROM STDIN [7]",
+			"COPY log_entries (" + cols + ") FROM STDIN [0]",
+		}},
+		{ClickHouseDialect(), []string{
+			"ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS level LowCardinality(String) [0]",
+			"INSERT INTO log_entries (" + cols + ") [7]",
+		}},
+	} {
+		drv, db := newFakeDatabase(t)
+		dl, err := NewDatabaseListener("db", db, test.dialect, DatabaseOptions{MaxRows: 1000, FlushInterval: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dl.Receive(&stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "a"}, level: Info, message: "one"})
+		dl.Receive(&stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "a"}, level: Error, message: "two"})
+		if err := dl.Close(); err != nil {
+			t.Fatal(err)
+		}
+		statements, batches := drv.recorded()
+		got := strings.Join(statements, "\n")
+		for _, want := range test.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: missing statement %q in:\n%s", test.dialect.Name(), want, got)
+			}
+		}
+		if len(batches) != 1 || batches[0] != 2 {
+			t.Errorf("%s: unexpected batches %v", test.dialect.Name(), batches)
+		}
+	}
+}
+
+func TestDatabaseListenerFailures(t *testing.T) {
+	drv, db := newFakeDatabase(t)
+	dl, err := NewSQLiteListener("db", db, DatabaseOptions{FlushInterval: time.Hour, MaxRetries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "a"}, level: Info, message: "kept"}
+	drv.setFail(true)
+	dl.Receive(entry)
+	// A failed batch is kept for the retries...
+	if n, err := dl.FlushContext(context.Background()); err == nil || n != 1 {
+		t.Fatalf("expected a failed flush leaving 1 entry pending, got %d, %v", n, err)
+	}
+	if dl.LastError() == nil {
+		t.Error("expected the insert error to be recorded")
+	}
+	drv.setFail(false)
+	if err := dl.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, batches := drv.recorded(); len(batches) != 1 || batches[0] != 1 || dl.Dropped() != 0 {
+		t.Fatalf("expected the retried batch to be inserted, got %v, %d dropped", batches, dl.Dropped())
+	}
+	// ...and dropped, and counted, once they are exhausted.
+	drv.setFail(true)
+	dl.Receive(entry)
+	dl.Receive(entry)
+	for i := 0; i < 3; i++ {
+		dl.Flush()
+	}
+	if n, _ := dl.FlushContext(context.Background()); n != 0 || dl.Dropped() != 2 {
+		t.Errorf("expected 2 dropped entries, got %d dropped, %d pending", dl.Dropped(), n)
+	}
+	dl.Close()
+}
+
+type failingPruneDialect struct {
+	DatabaseDialect
+}
+
+func (d failingPruneDialect) Prune(db *sql.DB, table string, maxRows int64) error {
+	return errors.New("prune failed")
+}
+
+func TestDatabaseListenerPruneFailure(t *testing.T) {
+	drv, db := newFakeDatabase(t)
+	dl, err := NewDatabaseListener("db", db, failingPruneDialect{SQLiteDialect()},
+		DatabaseOptions{BatchSize: 2, MaxRows: 10, FlushInterval: time.Hour, MaxRetries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "a"}, level: Info, message: "once"}
+	for i := 0; i < 5; i++ {
+		dl.Receive(entry)
+	}
+	// A failed prune does not fail, requeue or drop the committed batch.
+	for i := 0; i < 3; i++ {
+		if err := dl.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, batches := drv.recorded()
+	total := 0
+	for _, n := range batches {
+		total += n
+	}
+	if total != 5 || dl.Dropped() != 0 {
+		t.Errorf("expected each row inserted once, got batches %v, %d dropped", batches, dl.Dropped())
+	}
+	if err := dl.LastError(); err == nil || err.Error() != "prune failed" {
+		t.Errorf("expected the prune error to be recorded, got %v", err)
+	}
+}
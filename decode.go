@@ -0,0 +1,277 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var structuredTimeKeys = []string{"time", "ts", "timestamp", "@timestamp", "@t", "t"}
+var structuredLevelKeys = []string{"level", "lvl", "severity", "loglevel", "@l"}
+var structuredMessageKeys = []string{"msg", "message", "@message", "@m"}
+
+type jsonLineParser struct {
+	plain plainLineParser
+}
+
+type logfmtLineParser struct {
+	plain plainLineParser
+}
+
+// NewJSONLineParser parses lines holding one JSON object each.  Numeric
+// levels follow the bunyan/pino convention (10 trace ... 60 fatal), numeric
+// times are Unix seconds, or milliseconds if too large to be seconds.
+func NewJSONLineParser() LineParser {
+	return &jsonLineParser{}
+}
+
+// NewLogfmtLineParser parses key=value lines; values may be double-quoted
+// with backslash escapes, and a bare key is taken as true.
+func NewLogfmtLineParser() LineParser {
+	return &logfmtLineParser{}
+}
+
+func (jp *jsonLineParser) ParseLine(line string) ParsedLine {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "{") {
+		return jp.plain.ParseLine(line)
+	}
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil || dec.More() {
+		return jp.plain.ParseLine(line)
+	}
+	return structuredLine(fields)
+}
+
+func (lp *logfmtLineParser) ParseLine(line string) ParsedLine {
+	fields, ok := decodeLogfmt(line)
+	if !ok {
+		return lp.plain.ParseLine(line)
+	}
+	return structuredLine(fields)
+}
+
+// Returns false unless the line holds at least one key=value pair.
+func decodeLogfmt(line string) (map[string]interface{}, bool) {
+	fields := make(map[string]interface{})
+	pairs := false
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			if line[i] == '"' {
+				return nil, false
+			}
+			i++
+		}
+		key := line[start:i]
+		if i >= len(line) || line[i] != '=' {
+			fields[key] = true
+			continue
+		}
+		i++
+		if key == "" {
+			return nil, false
+		}
+		pairs = true
+		if i < len(line) && line[i] == '"' {
+			var buf []byte
+			j := i + 1
+			for ; j < len(line) && line[j] != '"'; j++ {
+				if line[j] == '\\' && j+1 < len(line) {
+					j++
+					switch line[j] {
+					case 'n':
+						buf = append(buf, '\n')
+					case 't':
+						buf = append(buf, '\t')
+					case 'r':
+						buf = append(buf, '\r')
+					default:
+						buf = append(buf, line[j])
+					}
+					continue
+				}
+				buf = append(buf, line[j])
+			}
+			if j >= len(line) {
+				return nil, false
+			}
+			fields[key] = string(buf)
+			i = j + 1
+			continue
+		}
+		start = i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		fields[key] = line[start:i]
+	}
+	return fields, pairs
+}
+
+func takeField(fields map[string]interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		if v, has := fields[key]; has {
+			delete(fields, key)
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func structuredLine(fields map[string]interface{}) ParsedLine {
+	var pl ParsedLine
+	if v, has := takeField(fields, structuredTimeKeys); has {
+		pl.Time, pl.HasTime = structuredTime(v)
+	}
+	if v, has := takeField(fields, structuredLevelKeys); has {
+		pl.Level, pl.HasLevel = structuredLevel(v)
+	}
+	if v, has := takeField(fields, structuredMessageKeys); has {
+		if s, ok := v.(string); ok {
+			pl.Message = s
+		} else {
+			data, _ := json.Marshal(v)
+			pl.Message = string(data)
+		}
+	}
+	if len(fields) > 0 {
+		pl.Fields = fields
+	}
+	return pl
+}
+
+func structuredNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func structuredTime(v interface{}) (time.Time, bool) {
+	if s, ok := v.(string); ok {
+		for _, layout := range plainTimeLayouts {
+			if t, err := time.Parse(layout, strings.Replace(s, ",", ".", 1)); err == nil {
+				return t, true
+			}
+		}
+	}
+	f, ok := structuredNumber(v)
+	if !ok || math.IsNaN(f) || math.IsInf(f, 0) || f < 0 || f > 1e17 {
+		return time.Time{}, false
+	}
+	if f >= 1e11 {
+		f /= 1000
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+func structuredLevel(v interface{}) (LogLevel, bool) {
+	if s, ok := v.(string); ok {
+		if level, has := plainLevelNames[strings.ToUpper(s)]; has {
+			return level, true
+		}
+	}
+	f, ok := structuredNumber(v)
+	if !ok {
+		return None, false
+	}
+	switch {
+	case f >= 60:
+		return FatalError, true
+	case f >= 50:
+		return Error, true
+	case f >= 40:
+		return Warning, true
+	case f >= 30:
+		return Info, true
+	case f >= 20:
+		return Debug, true
+	case f >= 10:
+		return Trace, true
+	}
+	return None, false
+}
+
+// Escapes text for literal use in a message template.
+func escapeTemplateText(text string) string {
+	if strings.IndexAny(text, "{}") < 0 {
+		return text
+	}
+	return strings.NewReplacer("{", "{{", "}", "}}").Replace(text)
+}
+
+func isTemplateName(key string) bool {
+	if key == "" || key[0] >= '0' && key[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Builds a template logging message followed by the fields, in key order,
+// as " key=value"; keys usable as template property names become
+// properties.
+func fieldsTemplate(message string, fields map[string]interface{}, suffix string) (string, []interface{}) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	buf.WriteString(escapeTemplateText(message))
+	var args []interface{}
+	for _, key := range keys {
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		value := fields[key]
+		if n, ok := value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				value = i
+			} else if f, err := n.Float64(); err == nil {
+				value = f
+			}
+		}
+		if isTemplateName(key) {
+			buf.WriteString(key + "={" + key + "}")
+			args = append(args, value)
+			continue
+		}
+		buf.WriteString(escapeTemplateText(key + "=" + structuredText(value)))
+	}
+	buf.WriteString(escapeTemplateText(suffix))
+	return buf.String(), args
+}
+
+func structuredText(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case json.Number:
+		return s.String()
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,140 @@
+package log
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A FormatterDecorator wraps a formatter to adjust its output - a prefix,
+// injected fields, a length limit - without a new LogEntryFormatter.
+type FormatterDecorator func(next LogEntryFormatter) LogEntryFormatter
+
+// FormatterFunc adapts a function to LogEntryFormatter.
+type FormatterFunc func(entry LogEntry) string
+
+///
+
+func (ff FormatterFunc) Format(entry LogEntry) string {
+	return ff(entry)
+}
+
+type decoratedFormatter struct {
+	LogEntryFormatter
+	base LogEntryFormatter
+}
+
+// WrapFormatter applies decorators in order, each seeing the entry after
+// those before it.  Wrapped formatters keep the base formatter's header.
+func WrapFormatter(base LogEntryFormatter, decorators ...FormatterDecorator) LogEntryFormatter {
+	if base == nil {
+		base = NewLogEntryFormatter()
+	}
+	formatter := base
+	for _, decorate := range decorators {
+		formatter = decorate(formatter)
+	}
+	return &decoratedFormatter{LogEntryFormatter: formatter, base: base}
+}
+
+func (df *decoratedFormatter) Base() LogEntryFormatter {
+	return df.base
+}
+
+func (df *decoratedFormatter) Header() string {
+	if hf, ok := df.base.(HeaderFormatter); ok {
+		return hf.Header()
+	}
+	return ""
+}
+
+// Prefix adds a prefix to each entry's output.
+func Prefix(prefix string) FormatterDecorator {
+	return func(next LogEntryFormatter) LogEntryFormatter {
+		return FormatterFunc(func(entry LogEntry) string {
+			return prefix + next.Format(entry)
+		})
+	}
+}
+
+// Suffix adds a suffix to each entry's output, before any trailing newline.
+func Suffix(suffix string) FormatterDecorator {
+	return func(next LogEntryFormatter) LogEntryFormatter {
+		return FormatterFunc(func(entry LogEntry) string {
+			out := next.Format(entry)
+			end := len(strings.TrimRightFunc(out, unicode.IsSpace))
+			return out[:end] + suffix + out[end:]
+		})
+	}
+}
+
+// InjectFields adds properties to each entry, for formatters which write
+// them; properties the entry already has are kept.
+func InjectFields(fields ...Field) FormatterDecorator {
+	return func(next LogEntryFormatter) LogEntryFormatter {
+		return FormatterFunc(func(entry LogEntry) string {
+			de := deriveEntry(entry)
+			for _, f := range fields {
+				if _, has := de.properties[f.Key]; !has {
+					de.setProperty(f.Key, f.Value)
+				}
+			}
+			return next.Format(de)
+		})
+	}
+}
+
+// TruncateMessage limits messages to max bytes, cut on a UTF-8 boundary
+// and marked with "...".
+func TruncateMessage(max int) FormatterDecorator {
+	return func(next LogEntryFormatter) LogEntryFormatter {
+		return FormatterFunc(func(entry LogEntry) string {
+			if max <= 0 || len(entry.Message()) <= max {
+				return next.Format(entry)
+			}
+			de := deriveEntry(entry)
+			de.message = truncatePayload(de.message, max, "...")
+			return next.Format(de)
+		})
+	}
+}
+
+// StripAnsiDecorator removes ANSI escape sequences from the output.
+func StripAnsiDecorator() FormatterDecorator {
+	return func(next LogEntryFormatter) LogEntryFormatter {
+		return NewAnsiStripFormatter(next)
+	}
+}
+
+// UppercaseLevel upper-cases the first occurrence of the entry's level
+// name (in the formatter's locale, if it has one) in the output.
+func UppercaseLevel() FormatterDecorator {
+	return func(next LogEntryFormatter) LogEntryFormatter {
+		locale := formatterLocale(next)
+		return FormatterFunc(func(entry LogEntry) string {
+			out := next.Format(entry)
+			name := entry.Level().String()
+			if locale != nil {
+				name = locale.LevelName(entry.Level())
+			}
+			if i := strings.Index(out, name); i >= 0 && name != "" {
+				out = out[:i] + strings.ToUpper(name) + out[i+len(name):]
+			}
+			return out
+		})
+	}
+}
+
+// Finds the locale of a formatter, or of the formatter it decorates.
+func formatterLocale(formatter LogEntryFormatter) *Locale {
+	for formatter != nil {
+		if lf, ok := formatter.(interface{ Locale() *Locale }); ok {
+			return lf.Locale()
+		}
+		bf, ok := formatter.(interface{ Base() LogEntryFormatter })
+		if !ok {
+			return nil
+		}
+		formatter = bf.Base()
+	}
+	return nil
+}
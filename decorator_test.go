@@ -0,0 +1,38 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrapFormatter(t *testing.T) {
+	base := NewLogEntryFormatter()
+	base.ClearFlags(PrintTime)
+	base.SetFlags(PrintColor)
+	formatter := WrapFormatter(base,
+		TruncateMessage(8),
+		StripAnsiDecorator(),
+		UppercaseLevel(),
+		Prefix("> "),
+		Suffix(" <"),
+	)
+	ctx := CreateLoggingContext()
+	capture := newCaptureListener()
+	ctx.AddGlobalLogListener(capture, Trace)
+	stream, _ := ctx.Stream("app")
+	stream.Warning("disk almost full")
+	out := formatter.Format(capture.Entries()[0])
+	if !strings.HasPrefix(out, "> ") || !strings.Contains(out, "WARNING") || !strings.Contains(out, "disk alm... <\n") {
+		t.Errorf("unexpected output: %q", out)
+	}
+	if strings.Contains(out, "\x1b") {
+		t.Errorf("expected ANSI sequences stripped: %q", out)
+	}
+
+	json := WrapFormatter(NewJSONFormatter(), InjectFields(F("Service", "billing")))
+	stream.LogTemplate(Info, "charged {Amount}", 12)
+	out = json.Format(capture.Entries()[1])
+	if !strings.Contains(out, `"Amount":12`) || !strings.Contains(out, `"Service":"billing"`) {
+		t.Errorf("expected injected field alongside the entry's: %q", out)
+	}
+}
@@ -0,0 +1,236 @@
+package log
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+///
+
+type sqliteDialect struct{}
+
+type postgresDialect struct {
+	copyIn func(table string, columns ...string) string
+}
+
+type clickHouseDialect struct{}
+
+func SQLiteDialect() DatabaseDialect {
+	return &sqliteDialect{}
+}
+
+// PostgresDialect inserts batches with COPY when given the driver's CopyIn
+// statement builder (e.g. lib/pq's pq.CopyIn), and with multi-row INSERT
+// statements otherwise.
+func PostgresDialect(copyIn func(table string, columns ...string) string) DatabaseDialect {
+	return &postgresDialect{copyIn: copyIn}
+}
+
+// ClickHouseDialect relies on the driver batching all inserts prepared
+// within a transaction (as clickhouse-go does) into a single block.
+// ClickHouse tables are not pruned by row count; use a table TTL.
+func ClickHouseDialect() DatabaseDialect {
+	return &clickHouseDialect{}
+}
+
+func (sd *sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sd *sqliteDialect) Migrate(db *sql.DB, table string) error {
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time TEXT NOT NULL,
+		stream TEXT NOT NULL,
+		level TEXT NOT NULL,
+		message TEXT NOT NULL)`, table))
+	if err != nil {
+		return err
+	}
+	existing, err := sqliteColumns(db, table)
+	if err != nil {
+		return err
+	}
+	for _, col := range EntryRowColumns {
+		if !existing[col] {
+			if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s TEXT", table, col)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sqliteColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var cid int
+		var name, ctype string
+		var notnull int
+		var dflt interface{}
+		var pk int
+		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols[name] = true
+	}
+	return cols, rows.Err()
+}
+
+func (sd *sqliteDialect) BulkInsert(tx *sql.Tx, table string, rows []*EntryRow) error {
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		table, strings.Join(EntryRowColumns, ", ")))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		values := row.Values()
+		values[0] = row.Time.Format("2006-01-02T15:04:05.000000000Z07:00")
+		if _, err := stmt.Exec(values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sd *sqliteDialect) Prune(db *sql.DB, table string, maxRows int64) error {
+	_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id <= (SELECT MAX(id) FROM %s) - ?", table, table), maxRows)
+	return err
+}
+
+var postgresColumnTypes = map[string]string{
+	"time":    "TIMESTAMPTZ NOT NULL",
+	"stream":  "TEXT NOT NULL",
+	"level":   "TEXT NOT NULL",
+	"message": "TEXT NOT NULL",
+	"error":   "TEXT",
+	"trace":   "JSONB",
+	"fields":  "JSONB",
+}
+
+func (pd *postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (pd *postgresDialect) Migrate(db *sql.DB, table string) error {
+	if _, err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id BIGSERIAL PRIMARY KEY)", table)); err != nil {
+		return err
+	}
+	for _, col := range EntryRowColumns {
+		ctype := strings.TrimSuffix(postgresColumnTypes[col], " NOT NULL")
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, col, ctype)); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_time_idx ON %s (time)", table, table))
+	return err
+}
+
+func (pd *postgresDialect) BulkInsert(tx *sql.Tx, table string, rows []*EntryRow) error {
+	if pd.copyIn != nil {
+		stmt, err := tx.Prepare(pd.copyIn(table, EntryRowColumns...))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, row := range rows {
+			if _, err := stmt.Exec(row.Values()...); err != nil {
+				return err
+			}
+		}
+		_, err = stmt.Exec()
+		return err
+	}
+	// Without COPY support, insert with multi-row statements, keeping
+	// under the 65535 bind parameter limit.
+	ncols := len(EntryRowColumns)
+	chunk := 65535 / ncols
+	for start := 0; start < len(rows); start += chunk {
+		end := start + chunk
+		if end > len(rows) {
+			end = len(rows)
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "INSERT INTO %s (%s) VALUES ", table, strings.Join(EntryRowColumns, ", "))
+		args := make([]interface{}, 0, (end-start)*ncols)
+		for i, row := range rows[start:end] {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteByte('(')
+			for c := 0; c < ncols; c++ {
+				if c > 0 {
+					sb.WriteString(", ")
+				}
+				fmt.Fprintf(&sb, "$%d", i*ncols+c+1)
+			}
+			sb.WriteByte(')')
+			args = append(args, row.Values()...)
+		}
+		if _, err := tx.Exec(sb.String(), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pd *postgresDialect) Prune(db *sql.DB, table string, maxRows int64) error {
+	_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id <= (SELECT MAX(id) FROM %s) - $1", table, table), maxRows)
+	return err
+}
+
+var clickHouseColumnTypes = map[string]string{
+	"time":    "DateTime64(9)",
+	"stream":  "LowCardinality(String)",
+	"level":   "LowCardinality(String)",
+	"message": "String",
+	"error":   "Nullable(String)",
+	"trace":   "Nullable(String)",
+	"fields":  "Nullable(String)",
+}
+
+func (cd *clickHouseDialect) Name() string {
+	return "clickhouse"
+}
+
+func (cd *clickHouseDialect) Migrate(db *sql.DB, table string) error {
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		time %s, stream %s, level %s, message %s)
+		ENGINE = MergeTree ORDER BY (stream, time)`, table,
+		clickHouseColumnTypes["time"], clickHouseColumnTypes["stream"],
+		clickHouseColumnTypes["level"], clickHouseColumnTypes["message"]))
+	if err != nil {
+		return err
+	}
+	for _, col := range EntryRowColumns {
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, col, clickHouseColumnTypes[col])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cd *clickHouseDialect) BulkInsert(tx *sql.Tx, table string, rows []*EntryRow) error {
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s)", table, strings.Join(EntryRowColumns, ", ")))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		if _, err := stmt.Exec(row.Values()...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cd *clickHouseDialect) Prune(db *sql.DB, table string, maxRows int64) error {
+	return nil
+}
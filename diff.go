@@ -0,0 +1,145 @@
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const maxDiffDepth = 32
+
+type DiffChange struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+	// Added and Removed mark paths present on only one side.
+	Added   bool
+	Removed bool
+}
+
+// DiffChanges renders as "server.port: 8080 -> 9090; hosts[2]: added \"c\"".
+type DiffChanges []DiffChange
+
+// Diff returns a "diff" field holding the changed paths between old and new.
+// Structs (exported fields), maps, slices and pointers are descended into;
+// other values are compared with reflect.DeepEqual.
+func Diff(old, new interface{}) Field {
+	var changes DiffChanges
+	diffValues(&changes, "", reflect.ValueOf(old), reflect.ValueOf(new), 0)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return Field{Key: "diff", Value: changes}
+}
+
+func (dc DiffChanges) String() string {
+	if len(dc) == 0 {
+		return "no changes"
+	}
+	parts := make([]string, len(dc))
+	for i, c := range dc {
+		path := c.Path
+		if path == "" {
+			path = "."
+		}
+		switch {
+		case c.Added:
+			parts[i] = fmt.Sprintf("%s: added %s", path, diffRender(c.New))
+		case c.Removed:
+			parts[i] = fmt.Sprintf("%s: removed", path)
+		default:
+			parts[i] = fmt.Sprintf("%s: %s -> %s", path, diffRender(c.Old), diffRender(c.New))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func diffRender(val interface{}) string {
+	if str, ok := val.(string); ok {
+		return fmt.Sprintf("%q", str)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+func diffInterface(val reflect.Value) interface{} {
+	if !val.IsValid() {
+		return nil
+	}
+	if val.CanInterface() {
+		return val.Interface()
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+func joinDiffPath(path string, elem string) string {
+	if path == "" {
+		return elem
+	}
+	return path + "." + elem
+}
+
+func diffValues(changes *DiffChanges, path string, old, new reflect.Value, depth int) {
+	for old.IsValid() && (old.Kind() == reflect.Interface || old.Kind() == reflect.Ptr) && !old.IsNil() {
+		old = old.Elem()
+	}
+	for new.IsValid() && (new.Kind() == reflect.Interface || new.Kind() == reflect.Ptr) && !new.IsNil() {
+		new = new.Elem()
+	}
+	oldNil := !old.IsValid() || (old.Kind() == reflect.Ptr || old.Kind() == reflect.Interface) && old.IsNil()
+	newNil := !new.IsValid() || (new.Kind() == reflect.Ptr || new.Kind() == reflect.Interface) && new.IsNil()
+	switch {
+	case oldNil && newNil:
+		return
+	case oldNil:
+		*changes = append(*changes, DiffChange{Path: path, New: diffInterface(new), Added: true})
+		return
+	case newNil:
+		*changes = append(*changes, DiffChange{Path: path, Old: diffInterface(old), Removed: true})
+		return
+	}
+	if old.Type() != new.Type() || depth >= maxDiffDepth {
+		if !reflect.DeepEqual(diffInterface(old), diffInterface(new)) {
+			*changes = append(*changes, DiffChange{Path: path, Old: diffInterface(old), New: diffInterface(new)})
+		}
+		return
+	}
+	switch old.Kind() {
+	case reflect.Struct:
+		for i := 0; i < old.NumField(); i++ {
+			field := old.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			diffValues(changes, joinDiffPath(path, field.Name), old.Field(i), new.Field(i), depth+1)
+		}
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, k := range old.MapKeys() {
+			keys[fmt.Sprint(diffInterface(k))] = k
+		}
+		for _, k := range new.MapKeys() {
+			keys[fmt.Sprint(diffInterface(k))] = k
+		}
+		for name, k := range keys {
+			diffValues(changes, joinDiffPath(path, name), old.MapIndex(k), new.MapIndex(k), depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		n := old.Len()
+		if new.Len() > n {
+			n = new.Len()
+		}
+		for i := 0; i < n; i++ {
+			var o, v reflect.Value
+			if i < old.Len() {
+				o = old.Index(i)
+			}
+			if i < new.Len() {
+				v = new.Index(i)
+			}
+			diffValues(changes, fmt.Sprintf("%s[%d]", path, i), o, v, depth+1)
+		}
+	default:
+		if !reflect.DeepEqual(diffInterface(old), diffInterface(new)) {
+			*changes = append(*changes, DiffChange{Path: path, Old: diffInterface(old), New: diffInterface(new)})
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package log
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	type server struct {
+		Port   int
+		Hosts  []string
+		Labels map[string]string
+	}
+	old := &server{Port: 8080, Hosts: []string{"a", "b"}, Labels: map[string]string{"env": "prod", "tier": "1"}}
+	new := &server{Port: 9090, Hosts: []string{"a", "b", "c"}, Labels: map[string]string{"tier": "2"}}
+	expect := `Hosts[2]: added "c"; Labels.env: removed; Labels.tier: "1" -> "2"; Port: 8080 -> 9090`
+	if got := Diff(old, new).String(); got != expect {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+	if got := Diff(old, old).String(); got != "no changes" {
+		t.Errorf("unexpected diff of identical values: %s", got)
+	}
+}
@@ -0,0 +1,12 @@
+// +build linux
+
+package log
+
+import (
+	"syscall"
+)
+
+// Some linux ports (arm64, riscv64) have no dup2 system call.
+func dup2(oldfd, newfd int) error {
+	return syscall.Dup3(oldfd, newfd, 0)
+}
@@ -0,0 +1,393 @@
+package log
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const encryptedLogMagic = "LOGAESGCM2\n"
+
+const encryptedLogIDSize = 16
+
+const maxEncryptedRecord = 64 << 20
+
+const finalEncryptedRecord = 1 << 31
+
+// Encrypted files are a magic line and a random file ID followed by AES-GCM
+// records, each authenticated with the file ID and its position.  A writer
+// closing the file appends an empty final record; a file without one
+// decrypts up to its last record, then reports ErrEncryptedLogTruncated.
+var ErrEncryptedLogTruncated = errors.New("encrypted log file ends without a final record")
+
+// A KeySource gives a 16, 24 or 32 byte AES key - from a key file, or from
+// a KeySourceFunc unwrapping a data key with a KMS.
+type KeySource interface {
+	EncryptionKey() ([]byte, error)
+}
+
+type KeySourceFunc func() ([]byte, error)
+
+func (f KeySourceFunc) EncryptionKey() ([]byte, error) {
+	return f()
+}
+
+///
+
+type keyFile struct {
+	path string
+}
+
+// KeyFile reads a key from path, either as raw key bytes or hex-encoded
+// (surrounding whitespace is ignored).
+func KeyFile(path string) KeySource {
+	return &keyFile{path: path}
+}
+
+func (kf *keyFile) EncryptionKey() ([]byte, error) {
+	data, err := ioutil.ReadFile(kf.path)
+	if err != nil {
+		return nil, err
+	}
+	if text := strings.TrimSpace(string(data)); len(text) == 32 || len(text) == 48 || len(text) == 64 {
+		if key, err := hex.DecodeString(text); err == nil {
+			return key, nil
+		}
+	}
+	return data, nil
+}
+
+func newLogCipher(keys KeySource) (cipher.AEAD, error) {
+	key, err := keys.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// The associated data binding a record to its file and position.
+func encryptedRecordAD(id []byte, counter uint64, final bool) []byte {
+	ad := make([]byte, len(id), len(id)+9)
+	copy(ad, id)
+	ad = binary.BigEndian.AppendUint64(ad, counter)
+	if final {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+func sealLogRecord(aead cipher.AEAD, id []byte, counter uint64, final bool, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	record := make([]byte, 4, 4+len(nonce)+len(plain)+aead.Overhead())
+	record = append(record, nonce...)
+	record = aead.Seal(record, nonce, plain, encryptedRecordAD(id, counter, final))
+	size := uint32(len(record) - 4)
+	if final {
+		size |= finalEncryptedRecord
+	}
+	binary.BigEndian.PutUint32(record[:4], size)
+	return record, nil
+}
+
+// The writer's state for an encrypted file being appended to.
+type encryptedLog struct {
+	aead    cipher.AEAD
+	id      []byte
+	records uint64
+	// scanned is the end of the last record counted, and finalAt the
+	// start of that record if it is a final record.
+	scanned int64
+	finalAt int64
+}
+
+// begin starts a new file, returning its magic and ID.
+func (el *encryptedLog) begin() ([]byte, error) {
+	id := make([]byte, encryptedLogIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	el.id, el.records, el.finalAt = id, 0, 0
+	preamble := append([]byte(encryptedLogMagic), id...)
+	el.scanned = int64(len(preamble))
+	return preamble, nil
+}
+
+// resume continues an existing file after the records already in it.
+func (el *encryptedLog) resume(file *os.File) error {
+	hdr := make([]byte, len(encryptedLogMagic)+encryptedLogIDSize)
+	if _, err := file.ReadAt(hdr, 0); err != nil || string(hdr[:len(encryptedLogMagic)]) != encryptedLogMagic {
+		return errors.New("not an encrypted log file")
+	}
+	el.id, el.records, el.finalAt = hdr[len(encryptedLogMagic):], 0, 0
+	el.scanned = int64(len(hdr))
+	return el.sync(file)
+}
+
+var errEncryptedLogShrunk = errors.New("encrypted log file was truncated")
+
+// sync counts the records appended since the last call - by another
+// process, for shared files - before appending more.  A record torn by a
+// crashed writer is cut off so that the next record starts at a record
+// boundary, and so is a final record written by a closed writer: records
+// never follow a final record, so a file cut back to an earlier writer's
+// final record cannot pass as complete.
+func (el *encryptedLog) sync(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size < el.scanned {
+		return errEncryptedLogShrunk
+	}
+	var hdr [4]byte
+	for el.scanned+4 <= size {
+		if _, err := file.ReadAt(hdr[:], el.scanned); err != nil {
+			return err
+		}
+		length := binary.BigEndian.Uint32(hdr[:])
+		next := el.scanned + 4 + int64(length&^finalEncryptedRecord)
+		if next > size {
+			break
+		}
+		el.finalAt = 0
+		if length&finalEncryptedRecord != 0 {
+			el.finalAt = el.scanned
+		}
+		el.scanned = next
+		el.records++
+	}
+	if el.finalAt > 0 {
+		el.scanned, el.finalAt = el.finalAt, 0
+		el.records--
+	}
+	if el.scanned < size {
+		return file.Truncate(el.scanned)
+	}
+	return nil
+}
+
+func (el *encryptedLog) seal(plain []byte, final bool) ([]byte, error) {
+	record, err := sealLogRecord(el.aead, el.id, el.records, final, plain)
+	if err != nil {
+		return nil, err
+	}
+	if final {
+		el.finalAt = el.scanned
+	}
+	el.records++
+	el.scanned += int64(len(record))
+	return record, nil
+}
+
+type decryptingReader struct {
+	in      io.Reader
+	aead    cipher.AEAD
+	id      []byte
+	records uint64
+	final   bool
+	// Following a file being written, the end of the data is not the end
+	// of the file: an incomplete record is kept to be completed later.
+	tail    bool
+	buf     []byte
+	read    int64
+	pending []byte
+	err     error
+}
+
+// NewDecryptingReader returns a reader producing the plaintext of an
+// encrypted log file.  A record which fails authentication ends the stream
+// with an error, as does a record following the final record; a truncated
+// final record ends it with io.ErrUnexpectedEOF, and a file without a final
+// record with ErrEncryptedLogTruncated.
+func NewDecryptingReader(r io.Reader, keys KeySource) (io.Reader, error) {
+	aead, err := newLogCipher(keys)
+	if err != nil {
+		return nil, err
+	}
+	dr := &decryptingReader{in: r, aead: aead}
+	if err := dr.header(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return dr, nil
+}
+
+func newTailDecrypter(r io.ReadSeeker, aead cipher.AEAD) *decryptingReader {
+	return &decryptingReader{in: r, aead: aead, tail: true}
+}
+
+// fill reads until n bytes are buffered, returning io.EOF (and keeping
+// what was read) if the input ends first.
+func (dr *decryptingReader) fill(n int) error {
+	for len(dr.buf) < n {
+		chunk := make([]byte, n-len(dr.buf)+4096)
+		m, err := dr.in.Read(chunk)
+		dr.buf = append(dr.buf, chunk[:m]...)
+		dr.read += int64(m)
+		if err != nil && len(dr.buf) < n {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dr *decryptingReader) header() error {
+	if dr.id != nil {
+		return nil
+	}
+	n := len(encryptedLogMagic) + encryptedLogIDSize
+	if err := dr.fill(n); err != nil {
+		if err == io.EOF && len(dr.buf) > 0 && !dr.tail {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if string(dr.buf[:len(encryptedLogMagic)]) != encryptedLogMagic {
+		return errors.New("not an encrypted log file")
+	}
+	dr.id = append([]byte(nil), dr.buf[len(encryptedLogMagic):n]...)
+	dr.buf = dr.buf[n:]
+	return nil
+}
+
+// record returns the next complete record's length and final flag.
+func (dr *decryptingReader) record() (int, bool, error) {
+	if err := dr.header(); err != nil {
+		return 0, false, err
+	}
+	if err := dr.fill(4); err != nil {
+		return 0, false, dr.end(err)
+	}
+	size := binary.BigEndian.Uint32(dr.buf[:4])
+	final := size&finalEncryptedRecord != 0
+	size &^= finalEncryptedRecord
+	ns := dr.aead.NonceSize()
+	if size < uint32(ns+dr.aead.Overhead()) || size > maxEncryptedRecord {
+		return 0, false, fmt.Errorf("corrupt encrypted log record (length %d)", size)
+	}
+	if err := dr.fill(4 + int(size)); err != nil {
+		return 0, false, dr.end(err)
+	}
+	return int(size), final, nil
+}
+
+// end translates the input ending within or between records.
+func (dr *decryptingReader) end(err error) error {
+	switch {
+	case err != io.EOF || dr.tail:
+		return err
+	case len(dr.buf) > 0:
+		return io.ErrUnexpectedEOF
+	case !dr.final:
+		return ErrEncryptedLogTruncated
+	}
+	return io.EOF
+}
+
+var errRecordAfterFinal = errors.New("encrypted log record follows the final record")
+
+func (dr *decryptingReader) next() ([]byte, error) {
+	size, final, err := dr.record()
+	if err != nil {
+		return nil, err
+	}
+	if dr.final {
+		return nil, errRecordAfterFinal
+	}
+	if final && dr.tail {
+		if err := dr.unreadFinal(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	ns := dr.aead.NonceSize()
+	record := dr.buf[4 : 4+size]
+	plain, err := dr.aead.Open(nil, record[:ns], record[ns:], encryptedRecordAD(dr.id, dr.records, final))
+	if err != nil {
+		return nil, fmt.Errorf("encrypted log record %d failed authentication: %s", dr.records, err)
+	}
+	dr.buf = dr.buf[4+size:]
+	dr.records++
+	dr.final = final
+	return plain, nil
+}
+
+// unreadFinal leaves a tail before the final record: a writer reopening
+// the file replaces the final record with the records it appends.
+func (dr *decryptingReader) unreadFinal() error {
+	dr.read -= int64(len(dr.buf))
+	dr.buf = nil
+	_, err := dr.in.(io.Seeker).Seek(dr.read, io.SeekStart)
+	return err
+}
+
+// skip passes over the complete records available without decrypting
+// them, so that a tail starts at the end of the file.
+func (dr *decryptingReader) skip() error {
+	for {
+		size, final, err := dr.record()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if dr.final {
+			return errRecordAfterFinal
+		}
+		if final && dr.tail {
+			return dr.unreadFinal()
+		}
+		dr.buf = dr.buf[4+size:]
+		dr.records++
+		dr.final = final
+	}
+}
+
+func (dr *decryptingReader) Read(buf []byte) (int, error) {
+	for len(dr.pending) == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		plain, err := dr.next()
+		if err == io.EOF && dr.tail {
+			return 0, io.EOF
+		}
+		dr.pending, dr.err = plain, err
+	}
+	n := copy(buf, dr.pending)
+	dr.pending = dr.pending[n:]
+	return n, nil
+}
+
+// DecryptLogFile writes the plaintext of the encrypted log file at path to w.
+func DecryptLogFile(path string, keys KeySource, w io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, err := NewDecryptingReader(file, keys)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,179 @@
+package log
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProxyFromEnvironment returns the proxy for address given by the
+// HTTPS_PROXY and NO_PROXY environment variables (or their lower-case
+// forms), for NetworkOptions.Proxy.
+func ProxyFromEnvironment(address string) (*url.URL, error) {
+	return http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: "https", Host: address}})
+}
+
+///
+
+type networkEndpoint struct {
+	// address is dialed (through proxy, if set); host is the name the
+	// address was configured with, for TLS verification.
+	address string
+	host    string
+	proxy   *url.URL
+}
+
+// The address followed by the failover addresses, each expanded to every
+// address its host resolves to with ResolveAll (but not through a proxy).
+// An endpoint which fails is passed over for EndpointBackoff.
+func (nl *networkListener) endpoints() []networkEndpoint {
+	var res []networkEndpoint
+	tcp := strings.HasPrefix(nl.network, "tcp")
+	for _, address := range append([]string{nl.address}, nl.opts.Failover...) {
+		host, port, err := net.SplitHostPort(address)
+		if !tcp || err != nil {
+			res = append(res, networkEndpoint{address: address, host: address})
+			continue
+		}
+		if nl.opts.Proxy != nil {
+			if proxy, err := nl.opts.Proxy(address); err == nil && proxy != nil {
+				res = append(res, networkEndpoint{address: address, host: host, proxy: proxy})
+				continue
+			}
+		}
+		var addrs []string
+		if nl.opts.ResolveAll && net.ParseIP(host) == nil {
+			addrs, _ = net.LookupHost(host)
+		}
+		if len(addrs) == 0 {
+			res = append(res, networkEndpoint{address: address, host: host})
+			continue
+		}
+		for _, addr := range addrs {
+			res = append(res, networkEndpoint{address: net.JoinHostPort(addr, port), host: host})
+		}
+	}
+	return res
+}
+
+func (nl *networkListener) markUnhealthy(address string) {
+	nl.unhealthy[address] = time.Now().Add(nl.opts.EndpointBackoff)
+}
+
+// Dials the endpoints in order of preference until one connects.
+func (nl *networkListener) dialEndpoints() (net.Conn, string, error) {
+	endpoints := nl.endpoints()
+	start := 0
+	if nl.opts.RoundRobin {
+		start = nl.next % len(endpoints)
+		nl.next++
+	}
+	now := time.Now()
+	var healthy, unhealthy []networkEndpoint
+	for i := range endpoints {
+		ep := endpoints[(start+i)%len(endpoints)]
+		if nl.unhealthy[ep.address].After(now) {
+			unhealthy = append(unhealthy, ep)
+		} else {
+			healthy = append(healthy, ep)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = unhealthy
+	}
+	var first error
+	for _, ep := range healthy {
+		conn, err := nl.dial(ep)
+		if err == nil {
+			delete(nl.unhealthy, ep.address)
+			return conn, ep.address, nil
+		}
+		nl.markUnhealthy(ep.address)
+		if first == nil {
+			first = err
+		}
+	}
+	return nil, "", first
+}
+
+func (nl *networkListener) dial(ep networkEndpoint) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: nl.opts.DialTimeout}
+	var conn net.Conn
+	var err error
+	if ep.proxy != nil {
+		conn, err = dialProxy(dialer, nl.network, ep.proxy, ep.address)
+	} else {
+		conn, err = dialer.DialContext(nl.dialCtx, nl.network, ep.address)
+	}
+	if err != nil || nl.opts.TLS == nil {
+		return conn, err
+	}
+	config := nl.opts.TLS
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = ep.host
+	}
+	tc := tls.Client(conn, config)
+	tc.SetDeadline(time.Now().Add(nl.opts.DialTimeout))
+	if err := tc.HandshakeContext(nl.dialCtx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tc.SetDeadline(time.Time{})
+	return tc, nil
+}
+
+// Opens a tunnel to address through an HTTP (or HTTPS) proxy.
+func dialProxy(dialer *net.Dialer, network string, proxy *url.URL, address string) (net.Conn, error) {
+	proxyAddress := proxy.Host
+	if proxy.Port() == "" {
+		port := "80"
+		if proxy.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddress = net.JoinHostPort(proxy.Hostname(), port)
+	}
+	var conn net.Conn
+	var err error
+	switch proxy.Scheme {
+	case "http", "":
+		conn, err = dialer.Dial(network, proxyAddress)
+	case "https":
+		conn, err = tls.DialWithDialer(dialer, network, proxyAddress, &tls.Config{ServerName: proxy.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%s'", proxy.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	req := "CONNECT " + address + " HTTP/1.1\r\nHost: " + address + "\r\n"
+	if user := proxy.User; user != nil {
+		password, _ := user.Password()
+		req += "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)) + "\r\n"
+	}
+	if _, err := conn.Write([]byte(req + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The endpoint says nothing before the client does, so nothing past
+	// the response is buffered.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused tunnel to %s: %s", proxyAddress, address, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
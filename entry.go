@@ -0,0 +1,78 @@
+package log
+
+// Listeners which rewrite entries wrap the original in a derivedEntry,
+// which keeps its template, fingerprint and formatted-size accounting.
+type derivedEntry struct {
+	LogEntry
+	message    string
+	template   string
+	properties map[string]interface{}
+	err        error
+	noTrace    bool
+}
+
+func deriveEntry(entry LogEntry) *derivedEntry {
+	de := &derivedEntry{
+		LogEntry: entry,
+		message:  entry.Message(),
+	}
+	if te, ok := entry.(TemplatedLogEntry); ok {
+		de.properties = te.Properties()
+	}
+	return de
+}
+
+func (de *derivedEntry) Message() string {
+	return de.message
+}
+
+func (de *derivedEntry) AssociatedError() error {
+	if de.err != nil {
+		return de.err
+	}
+	return de.LogEntry.AssociatedError()
+}
+
+func (de *derivedEntry) HasTrace() bool {
+	return !de.noTrace && de.LogEntry.HasTrace()
+}
+
+func (de *derivedEntry) Trace() []*StackTraceEntry {
+	if de.noTrace {
+		return nil
+	}
+	return de.LogEntry.Trace()
+}
+
+func (de *derivedEntry) MessageTemplate() string {
+	if de.template != "" {
+		return de.template
+	}
+	if te, ok := de.LogEntry.(TemplatedLogEntry); ok {
+		return te.MessageTemplate()
+	}
+	return de.LogEntry.Message()
+}
+
+func (de *derivedEntry) Properties() map[string]interface{} {
+	res := make(map[string]interface{}, len(de.properties))
+	for k, v := range de.properties {
+		res[k] = v
+	}
+	return res
+}
+
+func (de *derivedEntry) setProperty(name string, value interface{}) {
+	if de.properties == nil {
+		de.properties = make(map[string]interface{})
+	}
+	de.properties[name] = value
+}
+
+func (de *derivedEntry) Fingerprint() string {
+	return Fingerprint(de.LogEntry)
+}
+
+func (de *derivedEntry) recordFormatted(n int) {
+	recordFormattedSize(de.LogEntry, n)
+}
@@ -0,0 +1,61 @@
+package log
+
+import (
+	"errors"
+)
+
+// Errors unwound at most, against cycles.
+const maxErrorChain = 64
+
+// The standard formatter writes each cause in an entry's error chain on a
+// line of its own, indented by its depth.
+type ErrorChainLogEntry interface {
+	LogEntry
+	// ErrorChain returns the associated error and the errors it wraps.
+	ErrorChain() []error
+}
+
+///
+
+type chainedError struct {
+	err   error
+	depth int
+}
+
+// ErrorChain returns err followed by the errors it wraps, depth first:
+// those returned by Unwrap() error or Unwrap() []error, and so on.
+func ErrorChain(err error) []error {
+	var res []error
+	for _, ce := range unwindError(err) {
+		res = append(res, ce.err)
+	}
+	return res
+}
+
+func unwindError(err error) []chainedError {
+	var res []chainedError
+	var walk func(e error, depth int)
+	walk = func(e error, depth int) {
+		for e != nil && len(res) < maxErrorChain {
+			res = append(res, chainedError{err: e, depth: depth})
+			if multi, ok := e.(interface{ Unwrap() []error }); ok {
+				for _, cause := range multi.Unwrap() {
+					walk(cause, depth+1)
+				}
+				return
+			}
+			e = errors.Unwrap(e)
+			depth++
+		}
+	}
+	walk(err, 0)
+	return res
+}
+
+func (le *stdLogEntry) ErrorChain() []error {
+	return ErrorChain(le.associatedError)
+}
+
+func (de *derivedEntry) ErrorChain() []error {
+	return ErrorChain(de.AssociatedError())
+}
@@ -0,0 +1,36 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrorChain(t *testing.T) {
+	disk := errors.New("disk full")
+	quota := errors.New("quota exceeded")
+	err := fmt.Errorf("saving report: %w", errors.Join(fmt.Errorf("writing: %w", disk), quota))
+	chain := ErrorChain(err)
+	if len(chain) != 5 || chain[0] != err || chain[3] != disk || chain[4] != quota {
+		t.Fatalf("unexpected chain %q", chain)
+	}
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("reports")
+	stream.Error(err)
+	entry := cl.Entries()[0]
+	if got := entry.(ErrorChainLogEntry).ErrorChain(); len(got) != 5 {
+		t.Errorf("unexpected entry chain %q", got)
+	}
+	formatter := NewLogEntryFormatter()
+	formatter.ClearFlags(PrintTime)
+	out := formatter.Format(entry)
+	want := "\n   saving report: writing: disk full\nquota exceeded" +
+		"\n      writing: disk full\nquota exceeded" +
+		"\n         writing: disk full\n            disk full\n         quota exceeded"
+	if !strings.Contains(out, want) {
+		t.Errorf("unexpected output %q", out)
+	}
+}
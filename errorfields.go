@@ -0,0 +1,158 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"syscall"
+)
+
+const (
+	ErrorTypeProperty  = "ErrorType"
+	StatusCodeProperty = "StatusCode"
+	GRPCCodeProperty   = "GRPCCode"
+	RetryableProperty  = "Retryable"
+	TimeoutProperty    = "Timeout"
+	PeerProperty       = "Peer"
+	OpProperty         = "Op"
+)
+
+///
+
+var retryableGRPCCodes = map[string]bool{
+	"Unavailable":       true,
+	"ResourceExhausted": true,
+	"Aborted":           true,
+	"DeadlineExceeded":  true,
+}
+
+func retryableHTTPStatus(code int) bool {
+	switch code {
+	case 408, 425, 429, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// ErrorFields returns the metadata recovered from err's chain, starting
+// with ErrorType, the type of the innermost error: Op, Peer and Timeout
+// from *url.Error, *net.OpError and *net.DNSError, StatusCode from errors
+// with a StatusCode() method and GRPCCode from gRPC status errors.
+func ErrorFields(err error) []Field {
+	if err == nil {
+		return nil
+	}
+	var fields []Field
+	var op, peer string
+	timeout, retryable := false, false
+	var status int
+	var grpcCode string
+	innermost := err
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		innermost = e
+		switch te := e.(type) {
+		case *url.Error:
+			if op == "" {
+				op = te.Op
+			}
+			if u, perr := url.Parse(te.URL); perr == nil && peer == "" {
+				peer = u.Host
+			}
+		case *net.OpError:
+			if op == "" {
+				op = te.Op
+			}
+			if te.Addr != nil && peer == "" {
+				peer = te.Addr.String()
+			}
+		case *net.DNSError:
+			if peer == "" {
+				peer = te.Name
+			}
+			retryable = retryable || te.IsTemporary || te.IsTimeout
+		}
+		if sc, ok := e.(interface{ StatusCode() int }); ok && status == 0 {
+			status = sc.StatusCode()
+		}
+		if grpcCode == "" {
+			grpcCode = grpcStatusCode(e)
+		}
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		timeout = true
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		timeout = true
+	}
+	if timeout || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		retryable = true
+	}
+	if status != 0 && retryableHTTPStatus(status) || retryableGRPCCodes[grpcCode] {
+		retryable = true
+	}
+	fields = append(fields, F(ErrorTypeProperty, fmt.Sprintf("%T", innermost)))
+	if status != 0 {
+		fields = append(fields, F(StatusCodeProperty, status))
+	}
+	if grpcCode != "" {
+		fields = append(fields, F(GRPCCodeProperty, grpcCode))
+	}
+	if op != "" {
+		fields = append(fields, F(OpProperty, op))
+	}
+	if peer != "" {
+		fields = append(fields, F(PeerProperty, peer))
+	}
+	fields = append(fields, F(TimeoutProperty, timeout), F(RetryableProperty, retryable))
+	return fields
+}
+
+// Calls e.GRPCStatus().Code() by reflection, returning the code's name, or
+// "" if e is not a gRPC status error.
+func grpcStatusCode(e error) string {
+	value := reflect.ValueOf(e)
+	if value.Kind() == reflect.Ptr && value.IsNil() {
+		return ""
+	}
+	method := value.MethodByName("GRPCStatus")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return ""
+	}
+	status := method.Call(nil)[0]
+	if status.Kind() == reflect.Ptr && status.IsNil() {
+		return ""
+	}
+	code := status.MethodByName("Code")
+	if !code.IsValid() || code.Type().NumIn() != 0 || code.Type().NumOut() != 1 {
+		return ""
+	}
+	return fmt.Sprint(code.Call(nil)[0].Interface())
+}
+
+func (ctx *stdLoggingContext) SetErrorAnnotation(enabled bool) {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	ctx.annotateErrors = enabled
+}
+
+func (ctx *stdLoggingContext) ErrorAnnotation() bool {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	return ctx.annotateErrors
+}
+
+func annotateError(entry *stdLogEntry) {
+	for _, f := range ErrorFields(entry.associatedError) {
+		if _, has := entry.properties[f.Key]; has {
+			continue
+		}
+		if entry.properties == nil {
+			entry.properties = make(map[string]interface{})
+		}
+		entry.properties[f.Key] = f.Value
+	}
+}
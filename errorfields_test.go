@@ -0,0 +1,54 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+)
+
+type testHTTPError struct{ code int }
+
+func (e testHTTPError) Error() string   { return fmt.Sprintf("status %d", e.code) }
+func (e testHTTPError) StatusCode() int { return e.code }
+
+type testCode uint32
+
+func (c testCode) String() string { return "Unavailable" }
+
+type testStatus struct{}
+
+func (s *testStatus) Code() testCode { return 14 }
+
+type testGRPCError struct{}
+
+func (e testGRPCError) Error() string            { return "rpc error: code = Unavailable" }
+func (e testGRPCError) GRPCStatus() *testStatus { return &testStatus{} }
+
+func TestErrorAnnotation(t *testing.T) {
+	ctx := CreateLoggingContext()
+	capture := newCaptureListener()
+	ctx.AddGlobalLogListener(capture, Trace)
+	ctx.SetErrorAnnotation(true)
+	stream, _ := ctx.Stream("client")
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 443}
+	dial := &url.Error{Op: "Get", URL: "https://api.example.com/v1", Err: &net.OpError{Op: "dial", Net: "tcp", Addr: addr, Err: errors.New("connection refused")}}
+	stream.Error(dial)
+	stream.Errorf(fmt.Errorf("charging: %w", testHTTPError{503}), "payment failed")
+	stream.Error(fmt.Errorf("listing: %w", testGRPCError{}))
+	entries := capture.Entries()
+	expect := []map[string]interface{}{
+		{OpProperty: "Get", PeerProperty: "api.example.com", TimeoutProperty: false, ErrorTypeProperty: "*errors.errorString"},
+		{StatusCodeProperty: 503, RetryableProperty: true, ErrorTypeProperty: "log.testHTTPError"},
+		{GRPCCodeProperty: "Unavailable", RetryableProperty: true},
+	}
+	for i, want := range expect {
+		props := entries[i].(TemplatedLogEntry).Properties()
+		for key, value := range want {
+			if props[key] != value {
+				t.Errorf("entry %d: expected %s=%v, got %v", i, key, value, props[key])
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package log
+
+import (
+	"errors"
+	"reflect"
+)
+
+// An ErrorLevelRule sets the level of entries logged with a matching error,
+// so that benign errors stop paging people.  The first matching rule wins;
+// entries received from other processes keep their level.
+type ErrorLevelRule struct {
+	Match func(err error) bool
+	Level LogLevel
+	// Streams restricts the rule to entries on the named streams.
+	Streams []string
+}
+
+///
+
+// ErrorIs matches errors for which errors.Is(err, target) holds.
+func ErrorIs(target error) func(err error) bool {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
+// ErrorAs matches errors for which errors.As finds an error of the type of
+// target in the chain.  Target is a value of that type, typically a nil
+// pointer: ErrorAs((*os.PathError)(nil)).
+func ErrorAs(target interface{}) func(err error) bool {
+	typ := reflect.TypeOf(target)
+	return func(err error) bool {
+		if typ == nil {
+			return false
+		}
+		return errors.As(err, reflect.New(typ).Interface())
+	}
+}
+
+func (ctx *stdLoggingContext) SetErrorLevelRules(rules ...ErrorLevelRule) {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	ctx.errorRules = append([]ErrorLevelRule(nil), rules...)
+}
+
+func (ctx *stdLoggingContext) ErrorLevelRules() []ErrorLevelRule {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	return append([]ErrorLevelRule(nil), ctx.errorRules...)
+}
+
+// Returns the level of an entry with the given error on stream, by the
+// first rule which matches.
+func (ctx *stdLoggingContext) errorLevel(stream string, err error, level LogLevel) LogLevel {
+	<-ctx.lock
+	rules := ctx.errorRules
+	ctx.lock <- true
+	for _, rule := range rules {
+		if rule.Match == nil || !ruleAppliesTo(rule, stream) {
+			continue
+		}
+		if rule.Match(err) {
+			return rule.Level
+		}
+	}
+	return level
+}
+
+func ruleAppliesTo(rule ErrorLevelRule, stream string) bool {
+	if len(rule.Streams) == 0 {
+		return true
+	}
+	for _, name := range rule.Streams {
+		if name == stream {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestErrorLevelRules(t *testing.T) {
+	ctx := CreateLoggingContext()
+	capture := newCaptureListener()
+	ctx.AddGlobalLogListener(capture, Trace)
+	ctx.SetErrorLevelRules(
+		ErrorLevelRule{Match: ErrorIs(context.DeadlineExceeded), Level: Warning},
+		ErrorLevelRule{Match: ErrorAs((*os.PathError)(nil)), Level: FatalError, Streams: []string{"storage"}},
+	)
+	app, _ := ctx.Stream("app")
+	storage, _ := ctx.Stream("storage")
+	_, pathErr := os.Open("/nonexistent/file")
+	app.Error(fmt.Errorf("fetching quote: %w", context.DeadlineExceeded))
+	app.Error(pathErr)
+	storage.Errorf(pathErr, "loading index")
+	app.Error(context.Canceled)
+	want := []LogLevel{Warning, Error, FatalError, Error}
+	entries := capture.Entries()
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Level() != want[i] {
+			t.Errorf("entry %d (%s): expected level %s, got %s", i, entry.Message(), want[i], entry.Level())
+		}
+	}
+}
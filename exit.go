@@ -0,0 +1,255 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"weak"
+)
+
+// Listeners which buffer output implement Flusher, so that FlushAll() and
+// Exit() can drain every registered context before the process ends.
+type Flusher interface {
+	Flush() error
+}
+
+type ContextFlusher interface {
+	// FlushContext flushes as Flush() does, giving up when ctx is done;
+	// it returns the number of entries left undelivered.
+	FlushContext(ctx context.Context) (unsent int, err error)
+}
+
+type FlushReport struct {
+	// Unsent maps the names of listeners left holding entries to the
+	// number of entries.
+	Unsent map[string]int
+}
+
+var _GLOBAL_flushContexts []registeredContext
+var _GLOBAL_flushContextsLock chan bool = make(chan bool, 1)
+var _GLOBAL_exitFunc func(code int) = os.Exit
+
+func init() {
+	_GLOBAL_flushContextsLock <- true
+}
+
+// RegisterLoggingContext adds a context to the set flushed by FlushAll().
+// Standard contexts register themselves; other LoggingContext
+// implementations may register to have their global listeners flushed,
+// and are held until unregistered.
+func RegisterLoggingContext(ctx LoggingContext) {
+	<-_GLOBAL_flushContextsLock
+	defer func() { _GLOBAL_flushContextsLock <- true }()
+	for _, rc := range _GLOBAL_flushContexts {
+		if rc.get() == ctx {
+			return
+		}
+	}
+	rc := registeredContext{ctx: ctx}
+	if std, ok := ctx.(*stdLoggingContext); ok {
+		rc = registeredContext{std: weak.Make(std)}
+	}
+	_GLOBAL_flushContexts = append(_GLOBAL_flushContexts, rc)
+}
+
+// UnregisterLoggingContext removes a context from the set flushed by
+// FlushAll() and reopened by ReopenAll().
+func UnregisterLoggingContext(ctx LoggingContext) {
+	<-_GLOBAL_flushContextsLock
+	defer func() { _GLOBAL_flushContextsLock <- true }()
+	kept := make([]registeredContext, 0, len(_GLOBAL_flushContexts))
+	for _, rc := range _GLOBAL_flushContexts {
+		if c := rc.get(); c != nil && c != ctx {
+			kept = append(kept, rc)
+		}
+	}
+	_GLOBAL_flushContexts = kept
+}
+
+type registeredContext struct {
+	ctx LoggingContext
+	std weak.Pointer[stdLoggingContext]
+}
+
+// Returns the context, or nil once a standard context is collected.
+func (rc registeredContext) get() LoggingContext {
+	if rc.ctx != nil {
+		return rc.ctx
+	}
+	if std := rc.std.Value(); std != nil {
+		return std
+	}
+	return nil
+}
+
+// The live registered contexts; collected ones are dropped.
+func registeredContexts() []LoggingContext {
+	<-_GLOBAL_flushContextsLock
+	defer func() { _GLOBAL_flushContextsLock <- true }()
+	contexts := make([]LoggingContext, 0, len(_GLOBAL_flushContexts))
+	kept := make([]registeredContext, 0, len(_GLOBAL_flushContexts))
+	for _, rc := range _GLOBAL_flushContexts {
+		if ctx := rc.get(); ctx != nil {
+			contexts = append(contexts, ctx)
+			kept = append(kept, rc)
+		}
+	}
+	_GLOBAL_flushContexts = kept
+	return contexts
+}
+
+func FlushAll() error {
+	contexts := registeredContexts()
+	var errs []error
+	for _, ctx := range contexts {
+		var err error
+		if fc, ok := ctx.(Flusher); ok {
+			err = fc.Flush()
+		} else {
+			err = flushListeners(ctx.GlobalListeners())
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FlushAllContext flushes as FlushAll() does, until ctx is done.  Flushers
+// which are not ContextFlushers are abandoned, still flushing, when it is.
+func FlushAllContext(ctx context.Context) (FlushReport, error) {
+	contexts := registeredContexts()
+	report := FlushReport{Unsent: make(map[string]int)}
+	var errs []error
+	for _, c := range contexts {
+		listeners := c.GlobalListeners()
+		sc, std := c.(*stdLoggingContext)
+		if std {
+			listeners = sc.allListeners()
+		}
+		if err := flushListenersContext(ctx, listeners, &report); err != nil {
+			errs = append(errs, err)
+		}
+		if std {
+			if err := sc.flushSequences(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// Total returns the number of entries left undelivered.
+func (fr FlushReport) Total() int {
+	total := 0
+	for _, n := range fr.Unsent {
+		total += n
+	}
+	return total
+}
+
+// Exit flushes all registered logging contexts, then terminates the process
+// with the given status code.
+func Exit(code int) {
+	FlushAll()
+	_GLOBAL_exitFunc(code)
+}
+
+// ExitContext is Exit() with the flush limited by ctx.
+func ExitContext(ctx context.Context, code int) {
+	FlushAllContext(ctx)
+	_GLOBAL_exitFunc(code)
+}
+
+// FlushOnSignals installs a handler which flushes all logging contexts and
+// exits when one of the given signals (SIGTERM and SIGINT, if none are
+// given) is received.  The returned function uninstalls the handler.
+func FlushOnSignals(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	c := make(chan os.Signal, 1)
+	done := make(chan bool)
+	signal.Notify(c, sigs...)
+	go func() {
+		select {
+		case sig := <-c:
+			code := 1
+			if ss, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(ss)
+			}
+			Exit(code)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// SetExitFunc replaces the function Exit() calls after flushing (os.Exit by
+// default), so tests can exercise exit paths.  It returns a function that
+// restores the previous value.
+func SetExitFunc(exit func(code int)) (restore func()) {
+	prev := _GLOBAL_exitFunc
+	_GLOBAL_exitFunc = exit
+	return func() { _GLOBAL_exitFunc = prev }
+}
+
+// Summarizers log their reports before any listener is flushed, so that
+// buffering listeners flush the reports too.
+type summaryReporter interface {
+	emitReport()
+}
+
+func flushListeners(listeners []LogListener) error {
+	for _, ll := range listeners {
+		if sr, ok := ll.(summaryReporter); ok {
+			sr.emitReport()
+		}
+	}
+	var errs []error
+	for _, ll := range listeners {
+		if fl, ok := ll.(Flusher); ok {
+			if err := fl.Flush(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func flushListenersContext(ctx context.Context, listeners []LogListener, report *FlushReport) error {
+	for _, ll := range listeners {
+		if sr, ok := ll.(summaryReporter); ok {
+			sr.emitReport()
+		}
+	}
+	var errs []error
+	for _, ll := range listeners {
+		var err error
+		if cf, ok := ll.(ContextFlusher); ok {
+			var unsent int
+			unsent, err = cf.FlushContext(ctx)
+			if unsent > 0 {
+				report.Unsent[ll.Name()] += unsent
+			}
+		} else if fl, ok := ll.(Flusher); ok {
+			done := make(chan error, 1)
+			go func() { done <- fl.Flush() }()
+			select {
+			case err = <-done:
+			case <-ctx.Done():
+				err = fmt.Errorf("flushing %s: %w", ll.Name(), ctx.Err())
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestExitFlushes(t *testing.T) {
+	var out bytes.Buffer
+	buffered := bufio.NewWriter(&out)
+	ctx := CreateLoggingContext()
+	formatter := NewLogEntryFormatter()
+	formatter.ClearFlags(PrintTime)
+	ctx.AddGlobalLogListener(NewWriterLogger("buffered", buffered, formatter), Trace)
+	stream, _ := ctx.Stream("exit-test")
+	stream.Info("last words")
+	if out.Len() != 0 {
+		t.Fatal("expected output to be buffered before exit")
+	}
+	exitCode := -1
+	restore := SetExitFunc(func(code int) { exitCode = code })
+	defer restore()
+	Exit(3)
+	if exitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", exitCode)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("last words")) {
+		t.Errorf("expected buffered output to be flushed, got %q", out.String())
+	}
+}
+
+func TestExitContextReportsUnsent(t *testing.T) {
+	ctx := CreateLoggingContext()
+	target := &gatedListener{newCaptureListener(), make(chan bool)}
+	al := NewAsyncListener("exit-shipper", target, AsyncOptions{})
+	ctx.AddGlobalLogListener(al, Trace)
+	stream, _ := ctx.Stream("exit-context-test")
+	for i := 0; i < 3; i++ {
+		stream.Info("queued")
+	}
+	deadline, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report, err := FlushAllContext(deadline)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to cut the flush short, got %v", err)
+	}
+	if report.Unsent["exit-shipper"] != 3 {
+		t.Errorf("expected 3 unsent entries, got %v", report.Unsent)
+	}
+	close(target.gate)
+	al.Close()
+	if n := len(target.Entries()); n != 3 {
+		t.Errorf("expected the queue delivered on close, got %d entries", n)
+	}
+}
+
+func TestContextRegistryReleases(t *testing.T) {
+	registered := func(ctx LoggingContext) bool {
+		for _, c := range registeredContexts() {
+			if c == ctx {
+				return true
+			}
+		}
+		return false
+	}
+	ctx := CreateLoggingContext()
+	if !registered(ctx) {
+		t.Fatal("expected a created context to be registered")
+	}
+	UnregisterLoggingContext(ctx)
+	if registered(ctx) {
+		t.Error("expected an unregistered context to be dropped")
+	}
+	before := len(registeredContexts())
+	for i := 0; i < 8; i++ {
+		CreateLoggingContext()
+	}
+	runtime.GC()
+	runtime.GC()
+	if after := len(registeredContexts()); after > before {
+		t.Errorf("expected collected contexts to leave the registry, %d -> %d", before, after)
+	}
+}
@@ -0,0 +1,197 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ListenerRoute struct {
+	Listener string
+	// Scope is "stream" for the stream's own listeners, "ancestor <name>"
+	// for those of an ancestor stream, "context" for the context's global
+	// listeners.
+	Scope string
+	// Threshold is the listener's level, with Default resolved.
+	Threshold LogLevel
+	Receives  bool
+	Reason    string
+}
+
+// A RoutingExplanation reports how an entry would be routed, without
+// logging it.  Filters are matched against an entry with no message, error
+// or properties.
+type RoutingExplanation struct {
+	Stream string
+	Level  LogLevel
+	// StreamExists is false if the stream has not been created yet; only
+	// the context's listeners are then considered.
+	StreamExists bool
+	Override     LogLevel
+	HasOverride  bool
+	// OverrideFrom is the stream name or pattern the override was set on:
+	// the stream's, an ancestor's or "*".
+	OverrideFrom string
+	// Filter is the ID of the dynamic filter which applies, if any.
+	Filter    string
+	Listeners []ListenerRoute
+}
+
+///
+
+func (ctx *stdLoggingContext) Explain(streamName string, level LogLevel) RoutingExplanation {
+	re := RoutingExplanation{Stream: streamName, Level: level}
+	<-ctx.lock
+	stream, exists := ctx.streams[streamName]
+	ancestors := ctx.ancestorStreams(streamName)
+	ctx.lock <- true
+	if exists {
+		<-stream.lock
+	}
+	<-ctx.lock
+	re.StreamExists = exists
+	re.Override, re.OverrideFrom, re.HasOverride = ctx.resolveLevel(streamName)
+	dropped := re.HasOverride && !admits(re.Override, level)
+	verbosity := All
+	if re.HasOverride && !dropped {
+		verbosity = re.Override
+	}
+	defaultListenerLevel := ctx.defaultListenerLevel
+	explain := func(scope string, listeners map[LogListener]LogLevel) {
+		for ll, lv := range listeners {
+			route := ListenerRoute{Listener: ll.Name(), Scope: scope, Threshold: lv}
+			if lv == Default {
+				route.Threshold = defaultListenerLevel
+			}
+			switch {
+			case dropped:
+				route.Reason = fmt.Sprintf("level override %s on the stream drops %s entries", re.Override, level)
+			case ListenerAccepts(lv, defaultListenerLevel, level):
+				route.Receives = true
+				route.Reason = fmt.Sprintf("threshold %s accepts %s", route.Threshold, level)
+			case verbosity != All && admits(verbosity, level):
+				route.Receives = true
+				route.Reason = fmt.Sprintf("level override %s on the stream raises verbosity to %s", re.Override, level)
+			default:
+				route.Reason = fmt.Sprintf("threshold %s excludes %s", route.Threshold, level)
+			}
+			re.Listeners = append(re.Listeners, route)
+		}
+	}
+	if exists {
+		explain("stream", stream.listeners)
+	}
+	explain("context", ctx.listeners)
+	ctx.lock <- true
+	if exists {
+		stream.lock <- true
+	}
+	// Ancestors' locks are taken after the stream's and the context's are
+	// released, as in dispatch.
+	for _, as := range ancestors {
+		<-as.lock
+		explain("ancestor "+as.name, as.listeners)
+		as.lock <- true
+	}
+	rank := func(scope string) int {
+		switch {
+		case scope == "stream":
+			return 0
+		case scope == "context":
+			return len(ancestors) + 1
+		}
+		for i, as := range ancestors {
+			if scope == "ancestor "+as.name {
+				return i + 1
+			}
+		}
+		return len(ancestors) + 1
+	}
+	sort.Slice(re.Listeners, func(i, j int) bool {
+		if ri, rj := rank(re.Listeners[i].Scope), rank(re.Listeners[j].Scope); ri != rj {
+			return ri < rj
+		}
+		return re.Listeners[i].Listener < re.Listeners[j].Listener
+	})
+	if dropped {
+		return re
+	}
+	probe := &stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: streamName}, level: level}
+	var interested []LogListener
+	for _, route := range re.Listeners {
+		if route.Receives {
+			interested = append(interested, routeListener(route.Listener))
+		}
+	}
+	routed, filter := ctx.filters.apply(probe, interested)
+	if filter == "" {
+		return re
+	}
+	re.Filter = filter
+	receiving := make(map[string]bool)
+	for _, ll := range routed {
+		receiving[ll.Name()] = true
+	}
+	for i := range re.Listeners {
+		route := &re.Listeners[i]
+		switch {
+		case receiving[route.Listener] && !route.Receives:
+			route.Receives = true
+			route.Reason = "routed by filter " + filter
+		case !receiving[route.Listener] && route.Receives:
+			route.Receives = false
+			route.Reason = route.Reason + ", but filter " + filter + " drops the entry"
+		}
+	}
+	return re
+}
+
+// Stands in for a listener when evaluating filters, which select routed
+// listeners by name.
+type routeListener string
+
+func (rl routeListener) Name() string          { return string(rl) }
+func (rl routeListener) Receive(entry LogEntry) {}
+func (rl routeListener) Close() error          { return nil }
+
+// Receivers returns the names of the listeners which would receive the
+// entry.
+func (re RoutingExplanation) Receivers() []string {
+	var names []string
+	for _, route := range re.Listeners {
+		if route.Receives {
+			names = append(names, route.Listener)
+		}
+	}
+	return names
+}
+
+func (re RoutingExplanation) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s entries on stream %q", re.Level, re.Stream)
+	if !re.StreamExists {
+		buf.WriteString(" (not yet created)")
+	}
+	if re.HasOverride {
+		fmt.Fprintf(&buf, ", level override %s", re.Override)
+		if re.OverrideFrom != re.Stream {
+			fmt.Fprintf(&buf, " from %q", re.OverrideFrom)
+		}
+	}
+	if re.Filter != "" {
+		fmt.Fprintf(&buf, ", filter %s applies", re.Filter)
+	}
+	buf.WriteString(":\n")
+	if len(re.Listeners) == 0 {
+		buf.WriteString("    no listeners\n")
+	}
+	for _, route := range re.Listeners {
+		verdict := "drops"
+		if route.Receives {
+			verdict = "receives"
+		}
+		fmt.Fprintf(&buf, "    %s listener %q %s: %s\n", route.Scope, route.Listener, verdict, route.Reason)
+	}
+	return buf.String()
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExplainRouting(t *testing.T) {
+	ctx := CreateLoggingContext()
+	console := &namedCaptureListener{captureListener: newCaptureListener(), name: "console"}
+	debug := &namedCaptureListener{captureListener: newCaptureListener(), name: "debug"}
+	alerts := &namedCaptureListener{captureListener: newCaptureListener(), name: "alerts"}
+	ctx.AddGlobalLogListener(console, Info)
+	ctx.AddGlobalLogListener(alerts, FatalError)
+	stream, _ := ctx.Stream("db")
+	stream.AddLogListener(debug, Debug)
+
+	re := ctx.Explain("db", Debug)
+	if got := strings.Join(re.Receivers(), ","); got != "debug" {
+		t.Errorf("expected only the stream's debug listener, got %q:\n%s", got, re)
+	}
+	if _, err := ctx.Filters().Install(DynamicFilter{Expression: `stream == "db" && level <= Error`, Action: FilterRoute, Route: "alerts"}); err != nil {
+		t.Fatal(err)
+	}
+	re = ctx.Explain("db", Error)
+	if got := strings.Join(re.Receivers(), ","); re.Filter != "f1" || got != "alerts" {
+		t.Errorf("expected the filter to route to alerts, got %q:\n%s", got, re)
+	}
+	ctx.SetLevelOverride("db", Warning)
+	re = ctx.Explain("db", Info)
+	if len(re.Receivers()) != 0 || !re.HasOverride {
+		t.Errorf("expected the override to drop Info entries:\n%s", re)
+	}
+
+	srv := httptest.NewServer(NewAdminHandler(ctx, AdminOptions{}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/explain?stream=db&level=Warning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var res adminExplanation
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Override != "Warning" || len(res.Listeners) != 3 {
+		t.Errorf("unexpected explanation: %+v", res)
+	}
+}
@@ -0,0 +1,90 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrListenerSaturated = errors.New("listener saturated")
+
+// Listeners which can fail to accept an entry implement FallibleLogListener.
+// Receive() should be equivalent to TryReceive() with the error discarded.
+type FallibleLogListener interface {
+	LogListener
+	TryReceive(entry LogEntry) error
+}
+
+// A FallbackPolicy writes a rate limited, single-line rendering of entries
+// every interested listener failed to accept.
+type FallbackPolicy struct {
+	// Writer defaults to os.Stderr.
+	Writer io.Writer
+	// At most Limit entries (default 10) are written per Interval
+	// (default one minute).
+	Limit    int
+	Interval time.Duration
+}
+
+///
+
+type fallbackWriter struct {
+	lock        chan bool
+	policy      FallbackPolicy
+	windowStart time.Time
+	written     int
+	suppressed  int
+}
+
+func newFallbackWriter(policy FallbackPolicy) *fallbackWriter {
+	if policy.Writer == nil {
+		policy.Writer = os.Stderr
+	}
+	if policy.Limit <= 0 {
+		policy.Limit = 10
+	}
+	if policy.Interval <= 0 {
+		policy.Interval = time.Minute
+	}
+	fw := &fallbackWriter{
+		lock:   make(chan bool, 1),
+		policy: policy,
+	}
+	fw.lock <- true
+	return fw
+}
+
+func (fw *fallbackWriter) write(entry LogEntry, errs []error) {
+	<-fw.lock
+	defer func() { fw.lock <- true }()
+	now := time.Now()
+	if now.Sub(fw.windowStart) >= fw.policy.Interval {
+		fw.windowStart = now
+		fw.written = 0
+	}
+	if fw.written >= fw.policy.Limit {
+		fw.suppressed++
+		return
+	}
+	fw.written++
+	line := compactEntry(entry)
+	if len(errs) > 0 {
+		line += " (listeners failed: " + errors.Join(errs...).Error() + ")"
+	}
+	if fw.suppressed > 0 {
+		line += fmt.Sprintf(" (%d earlier entries suppressed)", fw.suppressed)
+		fw.suppressed = 0
+	}
+	ConsoleWriter(fw.policy.Writer).Write([]byte(strings.Replace(line, "\n", " ", -1) + "\n"))
+}
+
+func compactEntry(entry LogEntry) string {
+	line := fmt.Sprintf("%s %s [%s] %s", entry.LogTime().UTC().Format(time.RFC3339), entry.Level(), entry.Stream(), PrefixedMessage(entry))
+	if entry.HasAssociatedError() {
+		line += ": " + entry.AssociatedError().Error()
+	}
+	return line
+}
@@ -0,0 +1,221 @@
+package log
+
+import (
+	"context"
+	"fmt"
+)
+
+// A Field is a named value carried alongside an entry's message.  Fields
+// may be passed as message template arguments; the hole's name becomes the
+// property name and the field's value its value.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Entries logged through WithFields() or With() return their fields from
+// Fields(), and among their properties; template captures of the same name
+// win.
+type StructuredLogEntry interface {
+	LogEntry
+	// Fields returns the structured fields the entry was logged with.
+	Fields() map[string]interface{}
+}
+
+///
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+func (f Field) String() string {
+	return fmt.Sprintf("%v", f.Value)
+}
+
+type fieldLog struct {
+	stream *stdLogStream
+	fields map[string]interface{}
+}
+
+func (ls *stdLogStream) WithFields(fields map[string]interface{}) Log {
+	fl := &fieldLog{stream: ls, fields: make(map[string]interface{}, len(fields))}
+	for k, v := range fields {
+		fl.fields[k] = v
+	}
+	return fl
+}
+
+func (ls *stdLogStream) With(key string, value interface{}) Log {
+	return &fieldLog{stream: ls, fields: map[string]interface{}{key: value}}
+}
+
+func (fl *fieldLog) With(key string, value interface{}) Log {
+	fields := make(map[string]interface{}, len(fl.fields)+1)
+	for k, v := range fl.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &fieldLog{stream: fl.stream, fields: fields}
+}
+
+// Like the stream's dispatchXXX() helpers, called directly from each
+// logging method, so traces start at the caller.
+func (ls *stdLogStream) dispatchFields(fields map[string]interface{}, req *dispatchRequest) {
+	req.fields = fields
+	if req.ctx != nil {
+		if verbosity, has := VerbosityFromContext(req.ctx); has {
+			req.verbosity = verbosity
+		}
+		req.correlation, _ = CorrelationFromContext(req.ctx)
+	}
+	ls.dispatchEntry(req)
+}
+
+// Adds the fields to the entry's properties, keeping those it has.
+func addFields(entry *stdLogEntry, fields map[string]interface{}) {
+	entry.fields = fields
+	for k, v := range fields {
+		if _, has := entry.properties[k]; has {
+			continue
+		}
+		if entry.properties == nil {
+			entry.properties = make(map[string]interface{}, len(fields))
+		}
+		entry.properties[k] = v
+	}
+}
+
+func (le *stdLogEntry) Fields() map[string]interface{} {
+	res := make(map[string]interface{}, len(le.fields))
+	for k, v := range le.fields {
+		res[k] = v
+	}
+	return res
+}
+
+func (de *derivedEntry) Fields() map[string]interface{} {
+	if se, ok := de.LogEntry.(StructuredLogEntry); ok {
+		return se.Fields()
+	}
+	return nil
+}
+
+func (fl *fieldLog) Log(level LogLevel, msg string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: level, format: msg})
+}
+
+func (fl *fieldLog) Logf(level LogLevel, format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: level, format: format, args: args})
+}
+
+func (fl *fieldLog) LogTemplate(level LogLevel, template string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: level, templated: true, format: template, args: args})
+}
+
+func (fl *fieldLog) LogContext(ctx context.Context, level LogLevel, msg string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: level, format: msg, ctx: ctx})
+}
+
+func (fl *fieldLog) LogContextf(ctx context.Context, level LogLevel, format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: level, format: format, args: args, ctx: ctx})
+}
+
+func (fl *fieldLog) LogTrace(level LogLevel, msg string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: level, generateTrace: true, format: msg})
+}
+
+func (fl *fieldLog) LogTracef(level LogLevel, format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: level, generateTrace: true, format: format, args: args})
+}
+
+func (fl *fieldLog) Fatal(msg string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: FatalError, format: msg})
+}
+
+func (fl *fieldLog) Fatalf(format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: FatalError, format: format, args: args})
+}
+
+func (fl *fieldLog) FatalTrace(msg string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: FatalError, generateTrace: true, format: msg})
+}
+
+func (fl *fieldLog) FatalTracef(format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: FatalError, generateTrace: true, format: format, args: args})
+}
+
+func (fl *fieldLog) Error(err error) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Error, err: err, format: err.Error()})
+}
+
+func (fl *fieldLog) Errorf(err error, format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Error, err: err, format: format, args: args})
+}
+
+func (fl *fieldLog) Warning(msg string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Warning, format: msg})
+}
+
+func (fl *fieldLog) Warningf(format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Warning, format: format, args: args})
+}
+
+func (fl *fieldLog) WarningTrace(msg string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Warning, generateTrace: true, format: msg})
+}
+
+func (fl *fieldLog) WarningTracef(format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Warning, generateTrace: true, format: format, args: args})
+}
+
+func (fl *fieldLog) Info(msg string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Info, format: msg})
+}
+
+func (fl *fieldLog) Infof(format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Info, format: format, args: args})
+}
+
+func (fl *fieldLog) InfoTrace(msg string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Info, generateTrace: true, format: msg})
+}
+
+func (fl *fieldLog) InfoTracef(format string, args ...interface{}) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Info, generateTrace: true, format: format, args: args})
+}
+
+func (fl *fieldLog) Debug(msg string) {
+	if fl.stream.ctx.DebuggingEnabled() {
+		fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Debug, format: msg})
+	}
+}
+
+func (fl *fieldLog) Debugf(format string, args ...interface{}) {
+	if fl.stream.ctx.DebuggingEnabled() {
+		fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Debug, format: format, args: args})
+	}
+}
+
+func (fl *fieldLog) DebugTrace(msg string) {
+	if fl.stream.ctx.DebuggingEnabled() {
+		fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Debug, generateTrace: true, format: msg})
+	}
+}
+
+func (fl *fieldLog) DebugTracef(format string, args ...interface{}) {
+	if fl.stream.ctx.DebuggingEnabled() {
+		fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Debug, generateTrace: true, format: format, args: args})
+	}
+}
+
+func (fl *fieldLog) Trace(msg string) {
+	if fl.stream.ctx.DebuggingEnabled() {
+		fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Trace, generateTrace: true, format: msg})
+	}
+}
+
+func (fl *fieldLog) Tracef(format string, args ...interface{}) {
+	if fl.stream.ctx.DebuggingEnabled() {
+		fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Trace, generateTrace: true, format: format, args: args})
+	}
+}
@@ -0,0 +1,56 @@
+package log
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithFields(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("http")
+	requests := stream.WithFields(map[string]interface{}{"Method": "GET", "Path": "/"})
+	requests.Info("served")
+	requests.LogTemplate(Warning, "slow {Path}", "/slow")
+	stream.Info("without fields")
+	entries := cl.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	want := map[string]interface{}{"Method": "GET", "Path": "/"}
+	for _, entry := range entries[:2] {
+		if fields := entry.(StructuredLogEntry).Fields(); !reflect.DeepEqual(fields, want) {
+			t.Errorf("%q: unexpected fields %v", entry.Message(), fields)
+		}
+	}
+	if path := entries[1].(TemplatedLogEntry).Properties()["Path"]; path != "/slow" {
+		t.Errorf("expected the template capture to win, got %v", path)
+	}
+	if method := entries[1].(TemplatedLogEntry).Properties()["Method"]; method != "GET" {
+		t.Errorf("expected the field among the properties, got %v", method)
+	}
+	if fields := entries[2].(StructuredLogEntry).Fields(); len(fields) != 0 {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+func TestWith(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("billing")
+	component := stream.With("Component", "invoices")
+	component.With("Tenant", "acme").Info("for a tenant")
+	component.Info("for the component")
+	entries := cl.Entries()
+	want := []map[string]interface{}{
+		{"Component": "invoices", "Tenant": "acme"},
+		{"Component": "invoices"},
+	}
+	for i, entry := range entries {
+		if fields := entry.(StructuredLogEntry).Fields(); !reflect.DeepEqual(fields, want[i]) {
+			t.Errorf("%q: unexpected fields %v", entry.Message(), fields)
+		}
+	}
+}
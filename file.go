@@ -0,0 +1,333 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type FileListener interface {
+	FormattingLogListener
+	Path() string
+	Reopen() error
+	Rotate() error
+}
+
+type FileOptions struct {
+	// Encryption, if set, seals everything written to the file with
+	// AES-GCM (see NewDecryptingReader).  Shared encrypted files are
+	// written under the exclusive lock, to keep the record count in step.
+	Encryption KeySource
+	// Rotation, if set, moves the file aside once it grows past a size
+	// limit and prunes old backups.
+	Rotation *RotationPolicy
+	// TimeBucketed treats the path as a template containing strftime
+	// style time verbs ("app-%Y%m%d-%H.log"); see bucket.go.
+	TimeBucketed   bool
+	Location       *time.Location
+	OnBucketClosed func(path string)
+	// Shared allows several processes to write (and rotate) the same
+	// file.  Appends are atomic only on local filesystems.
+	Shared bool
+}
+
+///
+
+type fileListener struct {
+	lock      chan bool
+	name      string
+	path      string
+	formatter LogEntryFormatter
+	file      *os.File
+	opts      FileOptions
+	crypt     *encryptedLog
+	size      int64
+	started   time.Time
+	template  string
+	bucketSec int64
+	closed    bool
+	closing   int32
+	// The open file, for Close to interrupt a stalled write.
+	active    atomic.Value
+	lockFile  *os.File
+	lockPath  string
+	exclusive bool
+}
+
+// NewFileListener opens (or creates) path for appending.  If the file is new
+// or empty and the formatter is a HeaderFormatter, the header is written
+// first.
+func NewFileListener(name string, path string, formatter LogEntryFormatter) (FileListener, error) {
+	return NewFileListenerWithOptions(name, path, formatter, FileOptions{})
+}
+
+func NewFileListenerWithOptions(name string, path string, formatter LogEntryFormatter, opts FileOptions) (FileListener, error) {
+	if formatter == nil {
+		formatter = NewLogEntryFormatter()
+	}
+	fl := &fileListener{
+		lock:      make(chan bool, 1),
+		name:      name,
+		path:      path,
+		formatter: formatter,
+		opts:      opts,
+	}
+	if opts.Encryption != nil {
+		aead, err := newLogCipher(opts.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		fl.crypt = &encryptedLog{aead: aead}
+	}
+	if opts.TimeBucketed {
+		// The first bucket's file is opened by the first entry.
+		fl.template = path
+		fl.path = fl.bucketPath(time.Now())
+		if err := fl.ensureDir(); err != nil {
+			return nil, err
+		}
+	} else if err := fl.open(); err != nil {
+		return nil, err
+	}
+	fl.lock <- true
+	return fl, nil
+}
+
+func (fl *fileListener) open() error {
+	if fl.opts.Shared {
+		unlock, err := fl.lockExclusive()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	return fl.openFile()
+}
+
+func (fl *fileListener) openFile() error {
+	file, err := os.OpenFile(fl.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	fl.file = file
+	fl.active.Store(file)
+	fl.size = info.Size()
+	fl.started = time.Time{}
+	if info.Size() > 0 {
+		if fl.crypt != nil {
+			if err := fl.crypt.resume(file); err != nil {
+				fl.dropFile()
+				return fmt.Errorf("%s: %s", fl.path, err)
+			}
+		}
+		return nil
+	}
+	var preamble []byte
+	if fl.crypt != nil {
+		if preamble, err = fl.crypt.begin(); err != nil {
+			fl.dropFile()
+			return err
+		}
+	}
+	if hf, ok := fl.formatter.(HeaderFormatter); ok {
+		if header := hf.Header(); header != "" {
+			sealed, err := fl.seal([]byte(header))
+			if err != nil {
+				fl.dropFile()
+				return err
+			}
+			preamble = append(preamble, sealed...)
+		}
+	}
+	if len(preamble) > 0 {
+		n, err := file.Write(preamble)
+		fl.size += int64(n)
+		if err != nil {
+			fl.dropFile()
+			return err
+		}
+	}
+	return nil
+}
+
+// closeFile ends an encrypted file with its final record.
+func (fl *fileListener) closeFile() error {
+	if fl.file == nil {
+		return nil
+	}
+	err := fl.finish()
+	return errors.Join(err, fl.dropFile())
+}
+
+func (fl *fileListener) dropFile() error {
+	if fl.file == nil {
+		return nil
+	}
+	err := fl.file.Close()
+	fl.file = nil
+	fl.active.Store((*os.File)(nil))
+	return err
+}
+
+func (fl *fileListener) finish() error {
+	if fl.crypt == nil {
+		return nil
+	}
+	if fl.opts.Shared {
+		unlock, err := fl.lockExclusive()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		// Whoever rotated the file finished it.
+		if fl.stale() {
+			return nil
+		}
+	}
+	if err := fl.crypt.sync(fl.file); err != nil {
+		if err == errEncryptedLogShrunk {
+			// Truncated in place by an external rotation tool.
+			return nil
+		}
+		return err
+	}
+	record, err := fl.crypt.seal(nil, true)
+	if err != nil {
+		return err
+	}
+	n, err := fl.file.Write(record)
+	fl.size += int64(n)
+	return err
+}
+
+func (fl *fileListener) seal(data []byte) ([]byte, error) {
+	if fl.crypt == nil {
+		return data, nil
+	}
+	return fl.crypt.seal(data, false)
+}
+
+func (fl *fileListener) write(data []byte) error {
+	if fl.opts.Shared {
+		return fl.sharedWrite(data)
+	}
+	if fl.opts.Rotation != nil && fl.opts.Rotation.due(fl.size, len(data), fl.started) {
+		if err := fl.rotate(); err != nil && fl.file == nil {
+			return err
+		}
+	}
+	data, err := fl.seal(data)
+	if err != nil {
+		return err
+	}
+	n, err := fl.file.Write(data)
+	fl.size += int64(n)
+	if fl.started.IsZero() {
+		fl.started = time.Now()
+	}
+	return err
+}
+
+func (fl *fileListener) Name() string {
+	return fl.name
+}
+
+func (fl *fileListener) Path() string {
+	<-fl.lock
+	defer func() { fl.lock <- true }()
+	return fl.path
+}
+
+func (fl *fileListener) Formatter() LogEntryFormatter {
+	return fl.formatter
+}
+
+func (fl *fileListener) Receive(entry LogEntry) {
+	fl.TryReceive(entry)
+}
+
+func (fl *fileListener) TryReceive(entry LogEntry) error {
+	str := fl.formatter.Format(entry)
+	recordFormattedSize(entry, len(str))
+	<-fl.lock
+	defer func() { fl.lock <- true }()
+	if fl.closed {
+		return ErrListenerClosed
+	}
+	if fl.template != "" {
+		fl.roll(entry.LogTime())
+	}
+	if fl.file == nil {
+		return fmt.Errorf("file listener '%s' has no open file", fl.name)
+	}
+	return fl.write([]byte(str))
+}
+
+func (fl *fileListener) Flush() error {
+	<-fl.lock
+	defer func() { fl.lock <- true }()
+	if fl.file == nil {
+		return nil
+	}
+	return fl.sync()
+}
+
+// Devices and pipes cannot be synced.
+func (fl *fileListener) sync() error {
+	if err := fl.file.Sync(); !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
+
+// Reopen closes and reopens the file by path, so that output follows a file
+// renamed or truncated by an external rotation tool.
+func (fl *fileListener) Reopen() error {
+	<-fl.lock
+	defer func() { fl.lock <- true }()
+	if fl.closed {
+		return ErrListenerClosed
+	}
+	fl.closeFile()
+	if fl.template != "" {
+		// Reopened lazily by the next entry's bucket.
+		fl.bucketSec = 0
+		return nil
+	}
+	return fl.open()
+}
+
+func (fl *fileListener) Close() error {
+	if !beginClose(&fl.closing) {
+		return nil
+	}
+	acquireForClose(fl.lock, fl.interrupt)
+	defer func() { fl.lock <- true }()
+	fl.closed = true
+	var errs []error
+	if fl.file != nil {
+		errs = append(errs, fl.finish(), fl.sync())
+	}
+	errs = append(errs, fl.dropFile())
+	if fl.lockFile != nil {
+		errs = append(errs, fl.lockFile.Close())
+		fl.lockFile = nil
+	}
+	return errors.Join(errs...)
+}
+
+// Unblocks a write stalled on a pipe or FIFO; regular files have no
+// deadlines, and their writes are waited for.
+func (fl *fileListener) interrupt() {
+	if file, _ := fl.active.Load().(*os.File); file != nil {
+		file.SetWriteDeadline(time.Now())
+	}
+}
@@ -0,0 +1,381 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileListenerCSVHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.csv")
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("csv-test")
+	for i := 0; i < 2; i++ {
+		fl, err := NewFileListener("csv", path, NewCSVFormatter("level", "message", "User"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.AddLogListener(fl, Trace)
+		stream.LogTemplate(Warning, "Hello, {User}", "Smith, \"Bob\"")
+		stream.RemoveLogListener(fl)
+		fl.Close()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "level,message,User\n" +
+		"Warning,\"Hello, Smith, \"\"Bob\"\"\",\"Smith, \"\"Bob\"\"\"\n" +
+		"Warning,\"Hello, Smith, \"\"Bob\"\"\",\"Smith, \"\"Bob\"\"\"\n"
+	if string(data) != expect {
+		t.Errorf("unexpected file contents:\n%s", data)
+	}
+	if n := strings.Count(string(data), "level,message"); n != 1 {
+		t.Errorf("expected a single header row, got %d", n)
+	}
+}
+
+func TestFileListenerEncryption(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secure.log")
+	keys := KeySourceFunc(func() ([]byte, error) {
+		return []byte("0123456789abcdef0123456789abcdef"), nil
+	})
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("enc-test")
+	fl, err := NewFileListenerWithOptions("enc", path, NewCSVFormatter("level", "message"), FileOptions{Encryption: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.AddLogListener(fl, Trace)
+	stream.Log(Warning, "account 4111-1111")
+	fl.Close()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "4111") {
+		t.Fatal("plaintext found in encrypted file")
+	}
+	var out strings.Builder
+	if err := DecryptLogFile(path, keys, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "level,message\nWarning,account 4111-1111\n" {
+		t.Errorf("unexpected plaintext:\n%s", out.String())
+	}
+	raw[len(raw)-1] ^= 1
+	os.WriteFile(path, raw, 0644)
+	if err := DecryptLogFile(path, keys, &out); err == nil {
+		t.Error("expected tampered record to fail authentication")
+	}
+}
+
+// Splits an encrypted log file into its preamble and records.
+func encryptedRecords(t *testing.T, path string) ([]byte, [][]byte) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(encryptedLogMagic) + encryptedLogIDSize
+	preamble, rest := raw[:n], raw[n:]
+	var records [][]byte
+	for len(rest) > 0 {
+		size := 4 + int(binary.BigEndian.Uint32(rest[:4])&^finalEncryptedRecord)
+		records = append(records, rest[:size])
+		rest = rest[size:]
+	}
+	return preamble, records
+}
+
+func TestEncryptedLogIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	keys := KeySourceFunc(func() ([]byte, error) {
+		return []byte("0123456789abcdef"), nil
+	})
+	write := func(name string, messages ...string) string {
+		path := filepath.Join(dir, name)
+		fl, err := NewFileListenerWithOptions(name, path, NewCSVFormatter("message"), FileOptions{Encryption: keys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := CreateLoggingContext()
+		stream, _ := ctx.Stream("integrity")
+		stream.AddLogListener(fl, Trace)
+		for _, msg := range messages {
+			stream.Info(msg)
+		}
+		if err := fl.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	decrypt := func(data []byte) (string, error) {
+		var out strings.Builder
+		r, err := NewDecryptingReader(bytes.NewReader(data), keys)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(&out, r)
+		return out.String(), err
+	}
+	a := write("a.log", "one", "two")
+	closed, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Appending replaces the first writer's final record and resumes the
+	// numbering after its last entry.
+	write("a.log", "three")
+	b := write("b.log", "other")
+	preamble, records := encryptedRecords(t, a)
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(append([][]byte{preamble}, parts...), nil)
+	}
+	if out, err := decrypt(join(records...)); err != nil || out != "message\none\ntwo\nthree\n" {
+		t.Fatalf("decrypted %q, %v", out, err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("expected header, 3 entries and final records, got %d", len(records))
+	}
+	_, others := encryptedRecords(t, b)
+	for name, data := range map[string][]byte{
+		"dropped":   join(records[0], records[2], records[3], records[4]),
+		"reordered": join(records[0], records[2], records[1], records[3], records[4]),
+		"spliced":   join(records[0], records[1], others[1], records[3], records[4]),
+		"appended":  append(closed, records[3]...),
+	} {
+		if _, err := decrypt(data); err == nil || errors.Is(err, ErrEncryptedLogTruncated) {
+			t.Errorf("%s record: expected authentication failure, got %v", name, err)
+		}
+	}
+	if out, err := decrypt(join(records[:4]...)); !errors.Is(err, ErrEncryptedLogTruncated) || out != "message\none\ntwo\nthree\n" {
+		t.Errorf("missing final record: decrypted %q, %v", out, err)
+	}
+	if _, err := decrypt(closed); err != nil {
+		t.Errorf("file ending with a final record: %v", err)
+	}
+	// Cut back to where the first writer closed it, the reopened file no
+	// longer passes as complete.
+	cut, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := decrypt(cut[:len(closed)]); err == nil {
+		t.Errorf("file cut back to the first final record: decrypted %q", out)
+	}
+}
+
+func TestFileListenerTimeBuckets(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no zoneinfo available")
+	}
+	dir := t.TempDir()
+	fl, err := NewFileListenerWithOptions("bucket", filepath.Join(dir, "app-%Y%m%d-%H.log"),
+		NewCSVFormatter("message"), FileOptions{TimeBucketed: true, Location: loc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("bucket-test")
+	// 2024-11-03 01:xx local time occurs twice; both hours share a bucket.
+	base := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC)
+	for i, offset := range []time.Duration{0, time.Hour, 2 * time.Hour, 30 * time.Minute} {
+		fl.Receive(&stdLogEntry{ts: base.Add(offset), stream: stream, level: Info, message: fmt.Sprint(i)})
+	}
+	fl.Close()
+	expect := map[string]string{
+		"app-20241103-01.log": "message\n0\n1\n3\n",
+		"app-20241103-02.log": "message\n2\n",
+	}
+	for name, content := range expect {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s: unexpected contents %q", name, data)
+		}
+	}
+}
+
+func TestFileListenerSharedContention(t *testing.T) {
+	keys := KeySourceFunc(func() ([]byte, error) {
+		return []byte("0123456789abcdef"), nil
+	})
+	for name, encryption := range map[string]KeySource{"plain": nil, "encrypted": keys} {
+		encryption := encryption
+		t.Run(name, func(t *testing.T) {
+			testSharedContention(t, encryption)
+		})
+	}
+}
+
+func testSharedContention(t *testing.T, encryption KeySource) {
+	path := filepath.Join(t.TempDir(), "shared.log")
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("shared-test")
+	const writers, lines = 4, 250
+	// Each listener has its own descriptors, as separate processes would.
+	var listeners []FileListener
+	for i := 0; i < writers; i++ {
+		fl, err := NewFileListenerWithOptions(fmt.Sprint("shared-", i), path, NewCSVFormatter("message"),
+			FileOptions{Shared: true, Rotation: &RotationPolicy{MaxSize: 4096}, Encryption: encryption})
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, fl)
+	}
+	done := make(chan bool)
+	for i, fl := range listeners {
+		go func(i int, fl FileListener) {
+			for j := 0; j < lines; j++ {
+				fl.Receive(&stdLogEntry{ts: time.Now(), stream: stream, level: Info,
+					message: fmt.Sprintf("writer-%d-line-%04d-%s", i, j, strings.Repeat("x", 40))})
+			}
+			done <- true
+		}(i, fl)
+	}
+	for range listeners {
+		<-done
+	}
+	for _, fl := range listeners {
+		fl.Close()
+	}
+	seen := make(map[string]bool)
+	files := append(rotatedFiles(path), path)
+	if len(files) < 2 {
+		t.Fatal("expected the shared file to rotate")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if encryption != nil {
+			var out strings.Builder
+			err = DecryptLogFile(file, encryption, &out)
+			data = []byte(out.String())
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		rows := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		if rows[0] != "message" {
+			t.Errorf("%s: missing header", file)
+		}
+		for _, row := range rows[1:] {
+			if len(row) != 59 || seen[row] {
+				t.Fatalf("%s: torn or duplicated row %q", file, row)
+			}
+			seen[row] = true
+		}
+	}
+	if len(seen) != writers*lines {
+		t.Errorf("expected %d rows, found %d", writers*lines, len(seen))
+	}
+}
+
+func TestFileListenerReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("reopen-test")
+	fl, err := NewFileListener("reopen", path, NewCSVFormatter("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fl.Close()
+	stream.AddLogListener(fl, Trace)
+	stream.Log(Info, "before")
+	// As logrotate's "create" mode would.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	stream.Log(Info, "after")
+	for file, expect := range map[string]string{path + ".1": "message\nbefore\n", path: "message\nafter\n"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expect {
+			t.Errorf("%s: unexpected contents %q", file, data)
+		}
+	}
+}
+
+func TestFileListenerDeviceClose(t *testing.T) {
+	// Devices cannot be synced: Flush and Close ignore it alike.
+	fl, err := NewFileListener("null", os.DevNull, NewCSVFormatter("message"))
+	if err != nil {
+		t.Skip("no null device")
+	}
+	stream, _ := CreateLoggingContext().Stream("device")
+	stream.AddLogListener(fl, Trace)
+	stream.Info("discarded")
+	if err := fl.(Flusher).Flush(); err != nil {
+		t.Errorf("flush: %v", err)
+	}
+	if err := fl.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	if err := fl.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+	if err := fl.Reopen(); !errors.Is(err, ErrListenerClosed) {
+		t.Errorf("expected reopening a closed listener to fail with ErrListenerClosed, got %v", err)
+	}
+}
+
+func TestFileListenerRotationHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.log")
+	var events []string
+	policy := &RotationPolicy{
+		Interval: 50 * time.Millisecond,
+		PreClose: func(p string) { events = append(events, "close "+filepath.Base(p)) },
+		PostOpen: func(p, rotated string) {
+			events = append(events, "open "+filepath.Base(p))
+			if !strings.HasPrefix(rotated, path+".") {
+				t.Errorf("unexpected rotated path %s", rotated)
+			}
+		},
+	}
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("rotate-test")
+	fl, err := NewFileListenerWithOptions("job", path, NewCSVFormatter("message"), FileOptions{Rotation: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fl.Close()
+	stream.AddLogListener(fl, Trace)
+	stream.Log(Info, "first run")
+	if err := fl.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fl.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	stream.Log(Info, "second run")
+	time.Sleep(60 * time.Millisecond)
+	stream.Log(Info, "after the interval")
+	if len(rotatedFiles(path)) != 3 {
+		t.Errorf("expected 3 rotated files, found %v", rotatedFiles(path))
+	}
+	if len(events) != 6 || events[0] != "close job.log" || events[1] != "open job.log" {
+		t.Errorf("unexpected events %v", events)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "message\nafter the interval\n" {
+		t.Errorf("unexpected contents %q", data)
+	}
+}
@@ -0,0 +1,221 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const FilterAuditStream = "filter-audit"
+
+const DefaultFilterTTL = time.Hour
+
+type FilterAction uint8
+
+const (
+	FilterSuppress FilterAction = iota
+	FilterRoute
+)
+
+// A DynamicFilter suppresses or reroutes the entries matching a query
+// until it expires; the first matching filter decides.  Changes are
+// audited on FilterAuditStream, which filters never apply to.
+type DynamicFilter struct {
+	ID         string
+	Expression string
+	Action     FilterAction
+	// Route names the listener receiving matching entries, for FilterRoute.
+	Route string
+	// TTL defaults to DefaultFilterTTL.
+	TTL         time.Duration
+	InstalledBy string
+	Installed   time.Time
+	Expires     time.Time
+}
+
+type FilterSet interface {
+	Install(filter DynamicFilter) (DynamicFilter, error)
+	Remove(id string, by string) bool
+	Filters() []DynamicFilter
+}
+
+///
+
+func (fa FilterAction) String() string {
+	switch fa {
+	case FilterSuppress:
+		return "suppress"
+	case FilterRoute:
+		return "route"
+	}
+	return "unknown"
+}
+
+func ParseFilterAction(name string) (FilterAction, bool) {
+	switch name {
+	case "suppress":
+		return FilterSuppress, true
+	case "route":
+		return FilterRoute, true
+	}
+	return FilterSuppress, false
+}
+
+type installedFilter struct {
+	DynamicFilter
+	query EntryQuery
+}
+
+type filterSet struct {
+	lock    chan bool
+	ctx     LoggingContext
+	filters []*installedFilter
+	nextId  int
+	// Count of installed filters, read without the lock on the dispatch
+	// path so that contexts without filters pay nothing.
+	active int32
+}
+
+func newFilterSet(ctx LoggingContext) *filterSet {
+	fs := &filterSet{
+		lock:   make(chan bool, 1),
+		ctx:    ctx,
+		nextId: 1,
+	}
+	fs.lock <- true
+	return fs
+}
+
+func (fs *filterSet) audit(template string, args ...interface{}) {
+	stream, _ := fs.ctx.Stream(FilterAuditStream)
+	stream.LogTemplate(Info, template, args...)
+}
+
+func (fs *filterSet) Install(filter DynamicFilter) (DynamicFilter, error) {
+	query, err := ParseQuery(filter.Expression)
+	if err != nil {
+		return filter, err
+	}
+	if filter.Action == FilterRoute && filter.Route == "" {
+		return filter, errors.New("route filter has no target listener")
+	}
+	if filter.TTL <= 0 {
+		filter.TTL = DefaultFilterTTL
+	}
+	filter.Installed = time.Now()
+	filter.Expires = filter.Installed.Add(filter.TTL)
+	<-fs.lock
+	filter.ID = fmt.Sprintf("f%d", fs.nextId)
+	fs.nextId++
+	fs.filters = append(fs.filters, &installedFilter{DynamicFilter: filter, query: query})
+	atomic.StoreInt32(&fs.active, int32(len(fs.filters)))
+	fs.lock <- true
+	if filter.Action == FilterRoute {
+		fs.audit("filter {FilterId} installed by {InstalledBy}: route {Expression} to {Route} until {Expires}",
+			filter.ID, filter.InstalledBy, filter.Expression, filter.Route, filter.Expires)
+	} else {
+		fs.audit("filter {FilterId} installed by {InstalledBy}: suppress {Expression} until {Expires}",
+			filter.ID, filter.InstalledBy, filter.Expression, filter.Expires)
+	}
+	return filter, nil
+}
+
+func (fs *filterSet) Remove(id string, by string) bool {
+	<-fs.lock
+	removed := false
+	for i, f := range fs.filters {
+		if f.ID == id {
+			fs.filters = append(fs.filters[:i:i], fs.filters[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	atomic.StoreInt32(&fs.active, int32(len(fs.filters)))
+	fs.lock <- true
+	if removed {
+		fs.audit("filter {FilterId} removed by {RemovedBy}", id, by)
+	}
+	return removed
+}
+
+func (fs *filterSet) Filters() []DynamicFilter {
+	fs.expire(time.Now())
+	<-fs.lock
+	defer func() { fs.lock <- true }()
+	res := make([]DynamicFilter, len(fs.filters))
+	for i, f := range fs.filters {
+		res[i] = f.DynamicFilter
+	}
+	return res
+}
+
+func (fs *filterSet) expire(now time.Time) {
+	<-fs.lock
+	var expired []*installedFilter
+	kept := fs.filters[:0:0]
+	for _, f := range fs.filters {
+		if now.After(f.Expires) {
+			expired = append(expired, f)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	if len(expired) > 0 {
+		fs.filters = kept
+		atomic.StoreInt32(&fs.active, int32(len(fs.filters)))
+	}
+	fs.lock <- true
+	for _, f := range expired {
+		fs.audit("filter {FilterId} installed by {InstalledBy} expired", f.ID, f.InstalledBy)
+	}
+}
+
+// Returns the listeners an entry is delivered to, given the listeners
+// interested by level, and the ID of the filter which decided (if any).
+func (fs *filterSet) apply(entry LogEntry, interest []LogListener) ([]LogListener, string) {
+	if atomic.LoadInt32(&fs.active) == 0 || entry.Stream() == FilterAuditStream {
+		return interest, ""
+	}
+	now := time.Now()
+	var match *installedFilter
+	var stale bool
+	<-fs.lock
+	for _, f := range fs.filters {
+		if now.After(f.Expires) {
+			stale = true
+			continue
+		}
+		if f.query.Match(entry) {
+			match = f
+			break
+		}
+	}
+	fs.lock <- true
+	if stale {
+		fs.expire(now)
+	}
+	if match == nil {
+		return interest, ""
+	}
+	if match.Action == FilterSuppress {
+		return nil, match.ID
+	}
+	var routed []LogListener
+	for _, ll := range append(interest, fs.ctx.GlobalListeners()...) {
+		if ll.Name() != match.Route {
+			continue
+		}
+		dup := false
+		for _, r := range routed {
+			if r == ll {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			routed = append(routed, ll)
+		}
+	}
+	return routed, match.ID
+}
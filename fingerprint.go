@@ -0,0 +1,41 @@
+package log
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// A fingerprint identifies entries which are "the same event": it hashes the
+// stream, level, message template (the format string of Logf-style entries,
+// or the message itself otherwise) and the top stack frame, if the entry has
+// a trace.  Dedup, grouping and suppression components should all key on it.
+type FingerprintedLogEntry interface {
+	LogEntry
+	Fingerprint() string
+}
+
+func Fingerprint(entry LogEntry) string {
+	if fe, ok := entry.(FingerprintedLogEntry); ok {
+		return fe.Fingerprint()
+	}
+	return computeFingerprint(entry)
+}
+
+func computeFingerprint(entry LogEntry) string {
+	h := fnv.New64a()
+	h.Write([]byte(entry.Stream()))
+	h.Write([]byte{0, byte(entry.Level()), 0})
+	if le, ok := entry.(*stdLogEntry); ok && le.format != "" {
+		h.Write([]byte(le.format))
+	} else if te, ok := entry.(TemplatedLogEntry); ok {
+		h.Write([]byte(te.MessageTemplate()))
+	} else {
+		h.Write([]byte(entry.Message()))
+	}
+	if entry.HasTrace() {
+		if trace := entry.Trace(); len(trace) > 0 {
+			h.Write([]byte(fmt.Sprintf("\x00%s:%d", trace[0].File(), trace[0].Line())))
+		}
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
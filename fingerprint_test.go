@@ -0,0 +1,47 @@
+package log
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	db, _ := ctx.Stream("db")
+	web, _ := ctx.Stream("web")
+	db.Logf(Info, "query took %dms", 12)
+	db.Logf(Info, "query took %dms", 340)
+	db.Errorf(errors.New("timeout"), "connection to %s lost", "primary")
+	db.Errorf(errors.New("refused"), "connection to %s lost", "replica")
+	db.LogTemplate(Info, "user {Id} logged in", 1)
+	db.LogTemplate(Info, "user {Id} logged in", 2)
+	db.Info("ready")
+	db.Logf(Warning, "query took %dms", 12)
+	web.Logf(Info, "query took %dms", 12)
+	db.Logf(Info, "query failed after %dms", 12)
+	db.Info("stopped")
+	ctx.Flush()
+	entries := cl.Entries()
+	if len(entries) != 11 {
+		t.Fatalf("expected 11 entries, got %d", len(entries))
+	}
+	fp := make([]string, len(entries))
+	for i, e := range entries {
+		fp[i] = Fingerprint(e)
+	}
+	for _, same := range [][2]int{{0, 1}, {2, 3}, {4, 5}} {
+		if fp[same[0]] != fp[same[1]] {
+			t.Errorf("entries %q and %q fingerprint differently", entries[same[0]].Message(), entries[same[1]].Message())
+		}
+	}
+	// Level, stream, format and message all distinguish entries.
+	seen := map[string]int{}
+	for _, i := range []int{0, 2, 4, 6, 7, 8, 9, 10} {
+		if j, dup := seen[fp[i]]; dup {
+			t.Errorf("entries %d and %d share fingerprint %s", j, i, fp[i])
+		}
+		seen[fp[i]] = i
+	}
+}
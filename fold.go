@@ -0,0 +1,134 @@
+package log
+
+import (
+	"regexp"
+	"strings"
+)
+
+// By default a line continues a record if it is indented, part of a Java
+// exception ("Caused by:", "... 12 more") or of a Python traceback,
+// including chained tracebacks.
+type FoldOptions struct {
+	// Start, if set, matches the lines which begin a new record; every
+	// other line is a continuation.
+	Start *regexp.Regexp
+	// Continuation, if set, matches continuation lines in addition to the
+	// default heuristics.
+	Continuation *regexp.Regexp
+	// NoHeuristics disables the default heuristics.
+	NoHeuristics bool
+	// MaxLines bounds a folded record (default 1000); further lines start
+	// a new record.
+	MaxLines int
+}
+
+// A LineFolder joins the lines of a multi-line record, such as a stack
+// trace, to the line which started it.
+type LineFolder interface {
+	// Add adds a line, returning the previous record if the line starts a
+	// new one.
+	Add(line string) (record string, complete bool)
+	// Flush returns the pending record, if any.
+	Flush() (record string, complete bool)
+}
+
+///
+
+var javaExceptionHeader = regexp.MustCompile(`^(Exception in thread "[^"]*" )?([\w$]+\.)*[\w$]*(Exception|Error|Throwable)(: .*)?$`)
+var javaFrameTail = regexp.MustCompile(`^(Caused by: |Suppressed: |\.\.\. \d+ (more|common frames omitted))`)
+
+const pythonTracebackHeader = "Traceback (most recent call last):"
+
+type stdLineFolder struct {
+	opts           FoldOptions
+	lines          []string
+	inTraceback    bool
+	afterTraceback bool
+	blanks         int
+}
+
+func NewLineFolder(opts FoldOptions) LineFolder {
+	if opts.MaxLines <= 0 {
+		opts.MaxLines = 1000
+	}
+	return &stdLineFolder{opts: opts}
+}
+
+func (lf *stdLineFolder) continues(line string) bool {
+	if lf.opts.Start != nil {
+		return !lf.opts.Start.MatchString(line)
+	}
+	if lf.opts.Continuation != nil && lf.opts.Continuation.MatchString(line) {
+		return true
+	}
+	if lf.opts.NoHeuristics {
+		return false
+	}
+	if line == "" {
+		// Blank lines after a traceback belong to it if a chained
+		// traceback follows them; otherwise Flush drops them.
+		if lf.afterTraceback {
+			lf.blanks++
+			return true
+		}
+		return false
+	}
+	if lf.blanks > 0 {
+		if pythonChainBanner(line) {
+			lf.blanks = 0
+			return true
+		}
+		if strings.HasPrefix(line, pythonTracebackHeader) {
+			lf.blanks = 0
+			lf.inTraceback, lf.afterTraceback = true, false
+			return true
+		}
+		return false
+	}
+	if line[0] == ' ' || line[0] == '\t' {
+		return true
+	}
+	if lf.inTraceback {
+		// The unindented exception line closes the traceback.
+		lf.inTraceback, lf.afterTraceback = false, true
+		return true
+	}
+	if strings.HasPrefix(line, pythonTracebackHeader) || pythonChainBanner(line) {
+		lf.inTraceback = strings.HasPrefix(line, pythonTracebackHeader)
+		lf.afterTraceback = !lf.inTraceback
+		return true
+	}
+	lf.afterTraceback = false
+	return javaFrameTail.MatchString(line) || javaExceptionHeader.MatchString(line)
+}
+
+func pythonChainBanner(line string) bool {
+	return strings.HasPrefix(line, "During handling of the above exception") ||
+		strings.HasPrefix(line, "The above exception was the direct cause")
+}
+
+func (lf *stdLineFolder) Add(line string) (string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if len(lf.lines) > 0 && len(lf.lines) < lf.opts.MaxLines && lf.continues(line) {
+		lf.lines = append(lf.lines, line)
+		return "", false
+	}
+	record, complete := lf.Flush()
+	if lf.opts.Start == nil && !lf.opts.NoHeuristics && strings.HasPrefix(line, pythonTracebackHeader) {
+		// A traceback with no preceding log line starts its own record.
+		lf.inTraceback = true
+	}
+	lf.lines = append(lf.lines, line)
+	return record, complete
+}
+
+func (lf *stdLineFolder) Flush() (string, bool) {
+	if len(lf.lines) == 0 {
+		return "", false
+	}
+	record := strings.Join(lf.lines[:len(lf.lines)-lf.blanks], "\n")
+	lf.lines = lf.lines[:0]
+	lf.inTraceback, lf.afterTraceback = false, false
+	lf.blanks = 0
+	return record, true
+}
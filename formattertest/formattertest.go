@@ -0,0 +1,282 @@
+// Package formattertest checks LogEntryFormatter implementations against the
+// LogEntry contract, using a battery of canonical entries - the awkward ones
+// a formatter meets sooner or later in production:
+//
+//	unicode and invalid UTF-8 messages, control characters, empty and very
+//	long messages, no error and errors with empty or multi-line text,
+//	empty and very deep stack traces (including frames without a known
+//	function), the zero time and times in other locations, every standard
+//	level plus Default and out-of-range custom levels, and templated
+//	entries with nil, nested and unusual property values.
+//
+// Check runs the battery against a formatter, failing on panics,
+// non-deterministic output and entries modified by formatting.  CheckGolden
+// additionally compares the output with a golden file, which is rewritten
+// when the FORMATTERTEST_UPDATE environment variable is set:
+//
+//	func TestFormatter(t *testing.T) {
+//	    formattertest.Check(t, NewMyFormatter())
+//	    formattertest.CheckGolden(t, NewMyFormatter(), "testdata/my.golden")
+//	}
+package formattertest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dtromb/log"
+)
+
+// UpdateEnv names the environment variable which makes CheckGolden rewrite
+// golden files instead of comparing against them.
+const UpdateEnv = "FORMATTERTEST_UPDATE"
+
+type Case struct {
+	Name  string
+	Entry log.LogEntry
+}
+
+///
+
+type entry struct {
+	ts         time.Time
+	stream     string
+	level      log.LogLevel
+	message    string
+	err        error
+	trace      []*log.StackTraceEntry
+	template   string
+	properties map[string]interface{}
+}
+
+func (e *entry) LogTime() time.Time            { return e.ts }
+func (e *entry) Stream() string                { return e.stream }
+func (e *entry) Level() log.LogLevel           { return e.level }
+func (e *entry) Message() string               { return e.message }
+func (e *entry) HasAssociatedError() bool      { return e.err != nil }
+func (e *entry) AssociatedError() error        { return e.err }
+func (e *entry) HasTrace() bool                { return e.trace != nil }
+func (e *entry) Trace() []*log.StackTraceEntry { return e.trace }
+func (e *entry) MessageTemplate() string       { return e.template }
+func (e *entry) Properties() map[string]interface{} {
+	res := make(map[string]interface{}, len(e.properties))
+	for k, v := range e.properties {
+		res[k] = v
+	}
+	return res
+}
+
+// A fixed, non-UTC time, so that golden output does not depend on the
+// machine's zone.
+var caseTime = time.Date(2017, time.March, 4, 13, 5, 9, 120000000, time.FixedZone("UTC+0530", 5*3600+1800))
+
+type caseStruct struct {
+	Id   int
+	Tags []string
+}
+
+type stringerValue struct{}
+
+func (stringerValue) String() string { return "stringer \"value\"" }
+
+func plain(message string) *entry {
+	return &entry{ts: caseTime, stream: "formattertest", level: log.Info, message: message}
+}
+
+func deepTrace(n int) []*log.StackTraceEntry {
+	trace := make([]*log.StackTraceEntry, n)
+	for i := range trace {
+		trace[i] = log.NewStackTraceEntry(0, fmt.Sprintf("/src/pkg%d/file%d.go", i%7, i), i+1)
+	}
+	return trace
+}
+
+// Entries returns the canonical entries, in a fixed order.  Every call
+// returns fresh entries.
+func Entries() []Case {
+	var cases []Case
+	add := func(name string, e *entry) {
+		cases = append(cases, Case{Name: name, Entry: e})
+	}
+	add("plain", plain("the quick brown fox"))
+	add("empty-message", plain(""))
+	add("unicode", plain("naïve café – 日本語 – العربية – עברית – 😀👍🏽 – e\u0301 – \u200b\u2028zero-width"))
+	add("invalid-utf8", plain("bad \xff\xfe bytes \xc3("))
+	add("control-characters", plain("tab\there\r\nnew line\x00nul\x1b[31mescape\x7f"))
+	add("huge-message", plain(strings.Repeat("0123456789abcdef", 64*1024/16)))
+	e := plain("empty stream name")
+	e.stream = ""
+	add("empty-stream", e)
+	e = plain("no error")
+	e.level = log.Error
+	add("nil-error", e)
+	e = plain("failed")
+	e.level, e.err = log.Error, errors.New("connection refused")
+	add("error", e)
+	e = plain("failed without reason")
+	e.level, e.err = log.Error, errors.New("")
+	add("empty-error", e)
+	e = plain("failed badly")
+	e.level, e.err = log.Error, errors.New("first line\nsecond line\n\tindented: 世界")
+	add("multiline-error", e)
+	e = plain("empty trace")
+	e.trace = []*log.StackTraceEntry{}
+	add("empty-trace", e)
+	e = plain("short trace")
+	e.trace = []*log.StackTraceEntry{
+		log.NewStackTraceEntry(0, "/src/app/main.go", 42),
+		log.NewStackTraceEntry(0, "", 0),
+	}
+	add("trace", e)
+	e = plain("huge trace")
+	e.level, e.err, e.trace = log.FatalError, errors.New("stack overflow"), deepTrace(1000)
+	add("huge-trace", e)
+	e = plain("zero time")
+	e.ts = time.Time{}
+	add("zero-time", e)
+	e = plain("far future")
+	e.ts = time.Date(9999, time.December, 31, 23, 59, 59, 999999999, time.UTC)
+	add("far-future-time", e)
+	for level := log.All; level <= log.Default; level++ {
+		e = plain("level " + level.String())
+		e.level = level
+		add("level-"+strings.ToLower(level.String()), e)
+	}
+	e = plain("custom level")
+	e.level = log.LogLevel(200)
+	add("level-custom", e)
+	e = plain("User 42 logged in from 10.0.0.1")
+	e.template = "User {UserId} logged in from {IP}"
+	e.properties = map[string]interface{}{"UserId": 42, "IP": "10.0.0.1"}
+	add("template", e)
+	e = plain("odd values")
+	e.template = "odd values"
+	e.properties = map[string]interface{}{
+		"Nil":      nil,
+		"NilError": error(nil),
+		"Slice":    []int{1, 2, 3},
+		"Map":      map[string]interface{}{"nested": map[string]int{"deep": 1}},
+		"Struct":   caseStruct{Id: 7, Tags: []string{"a", "b"}},
+		"Pointer":  &caseStruct{Id: 8},
+		"Bytes":    []byte("raw\x00bytes"),
+		"Float":    3.25,
+		"Bool":     true,
+		"Time":     caseTime,
+		"Duration": 1500 * time.Millisecond,
+		"Stringer": stringerValue{},
+		"Unicode":  "日本語\n\"quoted\"",
+		"":         "empty name",
+		"Sp ace=":  "awkward name",
+	}
+	add("template-odd-values", e)
+	e = plain("template without properties")
+	e.template = "{Missing} property"
+	add("template-missing-property", e)
+	return cases
+}
+
+// Format formats an entry, returning a panic as an error.
+func Format(formatter log.LogEntryFormatter, entry log.LogEntry) (out string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("formatter panicked: %v", r)
+		}
+	}()
+	return formatter.Format(entry), nil
+}
+
+// Check formats each canonical entry, in a subtest named after the case.
+// Formatting must not panic, must give the same output twice, and must
+// leave the entry (and its properties) unchanged.
+func Check(t *testing.T, formatter log.LogEntryFormatter) {
+	for _, c := range Entries() {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			checkCase(t, formatter, c)
+		})
+	}
+}
+
+func snapshot(e log.LogEntry) *entry {
+	s := &entry{
+		ts:      e.LogTime(),
+		stream:  e.Stream(),
+		level:   e.Level(),
+		message: e.Message(),
+		err:     e.AssociatedError(),
+		trace:   e.Trace(),
+	}
+	if te, ok := e.(log.TemplatedLogEntry); ok {
+		s.template, s.properties = te.MessageTemplate(), te.Properties()
+	}
+	return s
+}
+
+func checkCase(t *testing.T, formatter log.LogEntryFormatter, c Case) {
+	before := snapshot(c.Entry)
+	out, err := Format(formatter, c.Entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Format(formatter, c.Entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != again {
+		t.Errorf("formatting the entry twice gave different output:\n%q\n%q", out, again)
+	}
+	if !reflect.DeepEqual(before, snapshot(c.Entry)) {
+		t.Error("formatting modified the entry")
+	}
+}
+
+// CheckGolden compares each canonical entry's output with the golden file
+// at path, or rewrites the file if UpdateEnv is set.
+func CheckGolden(t *testing.T, formatter log.LogEntryFormatter, path string) {
+	var buf bytes.Buffer
+	for _, c := range Entries() {
+		out, err := Format(formatter, c.Entry)
+		if err != nil {
+			t.Fatalf("%s: %s", c.Name, err.Error())
+		}
+		fmt.Fprintf(&buf, "=== %s\n%q\n", c.Name, out)
+	}
+	if os.Getenv(UpdateEnv) != "" {
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (set %s=1 to create it)", err.Error(), UpdateEnv)
+	}
+	want, got := goldenSections(golden), goldenSections(buf.Bytes())
+	for _, c := range Entries() {
+		if want[c.Name] != got[c.Name] {
+			t.Errorf("%s: output differs from %s:\n got: %s\nwant: %s", c.Name, path, got[c.Name], want[c.Name])
+		}
+	}
+}
+
+func goldenSections(data []byte) map[string]string {
+	sections := make(map[string]string)
+	name := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "=== ") {
+			name = strings.TrimPrefix(line, "=== ")
+			continue
+		}
+		if name != "" {
+			sections[name] += line
+		}
+	}
+	return sections
+}
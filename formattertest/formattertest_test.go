@@ -0,0 +1,31 @@
+package formattertest
+
+import (
+	"testing"
+
+	"github.com/dtromb/log"
+)
+
+func TestPackageFormatters(t *testing.T) {
+	product := log.SecurityEventProduct{Vendor: "dtromb", Product: "log", Version: "1"}
+	formatters := map[string]log.LogEntryFormatter{
+		"standard": log.NewLogEntryFormatter(),
+		"ansi":     log.NewAnsiStripFormatter(log.NewLogEntryFormatter()),
+		"csv":      log.NewCSVFormatter(),
+		"w3c":      log.NewW3CFormatter(),
+		"cef":      log.NewCEFFormatter(product),
+		"leef":     log.NewLEEFFormatter(product),
+		"json":     log.NewJSONFormatter(),
+	}
+	fixed := log.NewJSONFormatter()
+	fixed.SetFixedKeyOrder(true)
+	formatters["json-fixed"] = fixed
+	for name, formatter := range formatters {
+		formatter := formatter
+		t.Run(name, func(t *testing.T) {
+			Check(t, formatter)
+		})
+	}
+	CheckGolden(t, log.NewLogEntryFormatter(), "testdata/standard.golden")
+	CheckGolden(t, fixed, "testdata/json-fixed.golden")
+}
@@ -0,0 +1,65 @@
+// +build go1.18
+
+package log
+
+import (
+	"testing"
+)
+
+// Fuzz targets for the parsers which see untrusted input; run with, e.g.
+//
+//    go test -fuzz=FuzzLineParsers
+//
+// The seed corpora are in testdata/fuzz.
+
+func FuzzLineParsers(f *testing.F) {
+	f.Add("2024-03-01 10:00:01,456 ERROR [worker-1] app.Handler - request failed")
+	f.Add(`{"time":1709287200123,"level":30,"msg":"ok","nested":{"a":[1,2]}}`)
+	f.Add(`level=info msg="quoted \"value\"" bare key=`)
+	parsers := []LineParser{NewPlainLineParser(), NewJSONLineParser(), NewLogfmtLineParser()}
+	f.Fuzz(func(t *testing.T, line string) {
+		for _, parser := range parsers {
+			pl := parser.ParseLine(line)
+			if pl.HasLevel && pl.Level > None {
+				t.Errorf("%T parsed invalid level %d", parser, pl.Level)
+			}
+			template, args := fieldsTemplate(pl.Message, pl.Fields, "\nmore")
+			mt, err := ParseMessageTemplate(template)
+			if err != nil {
+				t.Fatalf("%T gave an invalid template %q: %s", parser, template, err.Error())
+			}
+			mt.Render(args...)
+		}
+	})
+}
+
+func FuzzMessageTemplate(f *testing.F) {
+	f.Add("User {UserId} logged in from {IP,-8}| {{ok}} {@Extra}", "x")
+	f.Add("{1} before {0:%05.1f}", "2.5")
+	f.Add("{When:2006-01-02} {$Value,1024}", "")
+	f.Fuzz(func(t *testing.T, text string, arg string) {
+		mt, err := ParseMessageTemplate(text)
+		if err != nil {
+			return
+		}
+		mt.Render(arg, 2.5, nil)
+		mt.Capture(arg)
+		if got := mt.Render(); len(got) > len(text) {
+			t.Errorf("rendering %q without arguments grew it to %q", text, got)
+		}
+	})
+}
+
+func FuzzParseQuery(f *testing.F) {
+	f.Add(`level >= Warning && stream == "db" && message =~ "time(d )?out"`)
+	f.Add(`!(stream == "health") || UserId == 42`)
+	stream, _ := CreateLoggingContext().Stream("db")
+	entry := &stdLogEntry{stream: stream, level: Error, message: "timed out", properties: map[string]interface{}{"UserId": 42}}
+	f.Fuzz(func(t *testing.T, text string) {
+		q, err := ParseQuery(text)
+		if err != nil {
+			return
+		}
+		q.Match(entry)
+	})
+}
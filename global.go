@@ -1,14 +1,16 @@
 package log
 
 import (
-	"unsafe"
 	"io"
-	"syscall"
 	"os"
+	"sync/atomic"
 )
 
-var _GLOBAL_loggingContext LoggingContext
+var _GLOBAL_loggingContext StandardLoggingContext
 var _GLOBAL_loggingContextLock chan bool = make(chan bool, 1)
+var _GLOBAL_defaultFormatter StandardLogFormatter
+var _GLOBAL_colorSupport ColorSupport
+var _GLOBAL_loggers = newStreamCache()
 
 func init() {
 	GetGlobalLoggingContext()
@@ -18,14 +20,16 @@ func IsTerminal(term io.Writer) bool {
 	return hasTerminal(term)
 }
 
-func GetGlobalLoggingContext() LoggingContext {
+func GetGlobalLoggingContext() StandardLoggingContext {
 	_GLOBAL_loggingContextLock <- true
 	if _GLOBAL_loggingContext == nil {
 		_GLOBAL_loggingContext = CreateLoggingContext()
 	
 		// Set up a default output stream listener.
 		formatter := NewLogEntryFormatter()
-		if hasTerminal(os.Stdout) {
+		_GLOBAL_defaultFormatter = formatter
+		_GLOBAL_colorSupport = DetectColor(os.Stdout)
+		if _GLOBAL_colorSupport != NoColor {
 			formatter.SetFlags(PrintColor)
 		}
 		stdoutLogger := NewWriterLogger("default-stdout", os.Stdout, formatter)
@@ -36,19 +40,66 @@ func GetGlobalLoggingContext() LoggingContext {
 	return _GLOBAL_loggingContext
 }
 
+// SetDefaultColor enables or disables color on the global context's default
+// stdout listener, overriding color detection (which never finds a terminal
+// in 'logminimal' builds).
+func SetDefaultColor(enabled bool) {
+	GetGlobalLoggingContext()
+	_GLOBAL_loggingContextLock <- true
+	defer func() { <-_GLOBAL_loggingContextLock }()
+	if enabled {
+		_GLOBAL_defaultFormatter.SetFlags(PrintColor)
+		if _GLOBAL_colorSupport == NoColor {
+			_GLOBAL_colorSupport = Color8
+		}
+	} else {
+		_GLOBAL_defaultFormatter.ClearFlags(PrintColor)
+		_GLOBAL_colorSupport = NoColor
+	}
+}
+
+// Logger returns the global context's stream by name.  Streams are cached,
+// so calling Logger in a hot path takes no lock once a name has been seen.
 func Logger(name string) Log {
+	if stream, has := _GLOBAL_loggers.get(name); has {
+		return stream
+	}
 	stream, _ := GetGlobalLoggingContext().Stream(name)
-	return stream
+	return _GLOBAL_loggers.add(name, stream)
 }
 
-func hasTerminal(writer io.Writer) bool {
-	var termios syscall.Termios
-    switch v := writer.(type) {
-    		case *os.File: {
-            _, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(v.Fd()), 
-					syscall.TCGETS, uintptr(unsafe.Pointer(&termios)), 0, 0, 0)
-    			return err == 0
-		}
+// A copy-on-write map of streams: lookups load it atomically, without a
+// lock, and additions replace it under one.
+type streamCache struct {
+	lock    chan bool
+	streams atomic.Value
+}
+
+func newStreamCache() *streamCache {
+	sc := &streamCache{lock: make(chan bool, 1)}
+	sc.streams.Store(map[interface{}]LogStream{})
+	sc.lock <- true
+	return sc
+}
+
+func (sc *streamCache) get(key interface{}) (LogStream, bool) {
+	stream, has := sc.streams.Load().(map[interface{}]LogStream)[key]
+	return stream, has
+}
+
+// Adds a stream, returning the one cached first if another add won a race.
+func (sc *streamCache) add(key interface{}, stream LogStream) LogStream {
+	<-sc.lock
+	defer func() { sc.lock <- true }()
+	current := sc.streams.Load().(map[interface{}]LogStream)
+	if cached, has := current[key]; has {
+		return cached
 	}
-	return false
+	next := make(map[interface{}]LogStream, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	next[key] = stream
+	sc.streams.Store(next)
+	return stream
 }
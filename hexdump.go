@@ -0,0 +1,50 @@
+package log
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Bytes dumped by DebugHex, which logs buffers in the format of
+// "hexdump -C".
+const HexDumpLimit = 1024
+
+const (
+	DumpLabelProperty = "DumpLabel"
+	DumpSizeProperty  = "DumpSize"
+)
+
+///
+
+// HexDump dumps up to max bytes of data (all of it if max <= 0), with a
+// final line noting the bytes left out.
+func HexDump(data []byte, max int) string {
+	omitted := 0
+	if max > 0 && len(data) > max {
+		data, omitted = data[:max], len(data)-max
+	}
+	dump := strings.TrimSuffix(hex.Dump(data), "\n")
+	if omitted > 0 {
+		dump += fmt.Sprintf("\n... %d more bytes not shown", omitted)
+	}
+	return dump
+}
+
+func hexDumpMessage(label string, data []byte) string {
+	return fmt.Sprintf("%s (%d bytes):\n%s", label, len(data), HexDump(data, HexDumpLimit))
+}
+
+func (ls *stdLogStream) dispatchHex(label string, data []byte) {
+	ls.dispatchEntry(&dispatchRequest{
+		level:  Debug,
+		fields: map[string]interface{}{DumpLabelProperty: label, DumpSizeProperty: len(data)},
+		lazy:   func() string { return hexDumpMessage(label, data) },
+	})
+}
+
+func (ls *stdLogStream) DebugHex(label string, data []byte) {
+	if ls.ctx.DebuggingEnabled() {
+		ls.dispatchHex(label, data)
+	}
+}
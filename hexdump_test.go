@@ -0,0 +1,32 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebugHex(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Debug)
+	stream, _ := ctx.Stream("hex")
+	stream.DebugHex("ignored", []byte("not debugging"))
+	ctx.EnableDebugging(true)
+	stream.DebugHex("greeting", []byte("Hello, world\n"))
+	stream.DebugHex("large", make([]byte, HexDumpLimit+100))
+	entries := cl.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	want := "greeting (13 bytes):\n" +
+		"00000000  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 0a           |Hello, world.|"
+	if entries[0].Message() != want {
+		t.Errorf("unexpected dump:\n%s", entries[0].Message())
+	}
+	if props := entries[1].(TemplatedLogEntry).Properties(); props[DumpSizeProperty] != HexDumpLimit+100 {
+		t.Errorf("unexpected properties %v", props)
+	}
+	if !strings.HasSuffix(entries[1].Message(), "\n... 100 more bytes not shown") {
+		t.Errorf("expected a truncation note, got %q", entries[1].Message()[len(entries[1].Message())-60:])
+	}
+}
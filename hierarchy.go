@@ -0,0 +1,94 @@
+package log
+
+import (
+	"strings"
+)
+
+// The pattern matching every stream.  Other stream level patterns match a
+// name and its descendants by dots ("net" covers "net.http.client"), the
+// most specific winning.
+const AllStreams = "*"
+
+// SetStreamLevel sets the level of the streams matching pattern ("net" or
+// "net.*" for "net" and its descendants, "*" for all); Default clears it.
+func (ctx *stdLoggingContext) SetStreamLevel(pattern string, level LogLevel) {
+	pattern = strings.TrimSuffix(pattern, ".*")
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	if level == Default {
+		delete(ctx.streamLevels, pattern)
+		return
+	}
+	if ctx.streamLevels == nil {
+		ctx.streamLevels = make(map[string]LogLevel)
+	}
+	ctx.streamLevels[pattern] = level
+}
+
+func (ctx *stdLoggingContext) StreamLevels() map[string]LogLevel {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	res := make(map[string]LogLevel, len(ctx.streamLevels))
+	for pattern, level := range ctx.streamLevels {
+		res[pattern] = level
+	}
+	return res
+}
+
+// Returns the parent of a stream name, and false for a name with none
+// ("*" is the parent of top-level names).
+func parentStream(name string) (string, bool) {
+	if name == AllStreams {
+		return "", false
+	}
+	if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+		return name[:dot], true
+	}
+	return AllStreams, true
+}
+
+// Finds the level which applies to a stream, and the name or pattern it
+// was set on.  Called with the context lock held.
+func (ctx *stdLoggingContext) resolveLevel(name string) (LogLevel, string, bool) {
+	for n, more := name, true; more; n, more = parentStream(n) {
+		if level, has := ctx.overrides[n]; has {
+			return level, n, true
+		}
+		if level, has := ctx.streamLevels[n]; has {
+			return level, n, true
+		}
+	}
+	return Default, "", false
+}
+
+// The existing ancestors of a stream, nearest first.  Called with the
+// context lock held.
+func (ctx *stdLoggingContext) ancestorStreams(name string) []*stdLogStream {
+	var res []*stdLogStream
+	for n, more := parentStream(name); more; n, more = parentStream(n) {
+		if stream, has := ctx.streams[n]; has {
+			res = append(res, stream)
+		}
+	}
+	return res
+}
+
+// Adds the stream's listeners accepting an entry at level to interest,
+// unless already there.
+func (ls *stdLogStream) interest(interest []LogListener, defaultListenerLevel LogLevel, level LogLevel, verbose bool) []LogListener {
+	<-ls.lock
+	defer func() { ls.lock <- true }()
+outer:
+	for ll, lv := range ls.listeners {
+		if !ListenerAccepts(lv, defaultListenerLevel, level) && !verbose {
+			continue
+		}
+		for _, have := range interest {
+			if have == ll {
+				continue outer
+			}
+		}
+		interest = append(interest, ll)
+	}
+	return interest
+}
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamHierarchy(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Info)
+	ctx.SetStreamLevel("net", Warning)
+	ctx.SetStreamLevel("net.http.*", Debug)
+	client, _ := ctx.Stream("net.http.client")
+	dns, _ := ctx.Stream("net.dns")
+	client.Log(Debug, "client debug")
+	dns.Info("dns info")
+	dns.Warning("dns warning")
+	var got []string
+	for _, entry := range cl.Entries() {
+		got = append(got, entry.Message())
+	}
+	if strings.Join(got, ",") != "client debug,dns warning" {
+		t.Errorf("unexpected entries %q", got)
+	}
+
+	ctx.SetLevelOverride("net.dns", Info)
+	if re := ctx.Explain("net.dns", Info); re.OverrideFrom != "net.dns" || len(re.Receivers()) != 1 {
+		t.Errorf("expected the override to win over the ancestor's level:\n%s", re)
+	}
+	if re := ctx.Explain("net.http.server", Debug); re.OverrideFrom != "net.http" || re.Override != Debug {
+		t.Errorf("expected the level set on net.http to apply:\n%s", re)
+	}
+
+	net, _ := ctx.Stream("net")
+	nl := &namedCaptureListener{captureListener: newCaptureListener(), name: "net"}
+	net.AddLogListener(nl, Error)
+	ctx.AddGlobalLogListener(nl, Error)
+	dns.Log(Error, "dns error")
+	if n := len(nl.Entries()); n != 1 {
+		t.Errorf("expected the ancestor's listener to receive the entry once, got %d", n)
+	}
+	if re := ctx.Explain("net.dns", Error); len(re.Listeners) != 3 || re.Listeners[0].Scope != "ancestor net" {
+		t.Errorf("expected the ancestor's listener explained:\n%s", re)
+	}
+
+	ctx.SetStreamLevel("net", Default)
+	if levels := ctx.StreamLevels(); len(levels) != 1 || levels["net.http"] != Debug {
+		t.Errorf("unexpected stream levels %v", levels)
+	}
+}
@@ -0,0 +1,524 @@
+package log
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type ParsedLine struct {
+	Time    time.Time
+	HasTime bool
+	Level   LogLevel
+	// HasLevel is false if the line carries no recognisable level.
+	HasLevel bool
+	Message  string
+	// Fields holds the other values decoded from structured lines; they
+	// are logged as " key=value" after the message, and as properties.
+	Fields map[string]interface{}
+}
+
+// Imported entries have two times: the event's, parsed from the line, and
+// the time of import.  Timestamps without a year are taken to be within
+// the last year.
+type TimeSource int
+
+const (
+	// TimeFromIngestion stamps imported entries with the time they are
+	// imported.
+	TimeFromIngestion TimeSource = iota
+	// TimeFromEvent stamps them with the time parsed from the line, if it
+	// has one.
+	TimeFromEvent
+)
+
+// Entries imported into a standard stream implement ImportedLogEntry,
+// whichever time is their LogTime().
+type ImportedLogEntry interface {
+	LogEntry
+	// EventTime returns the time the source gave the event, if it gave
+	// one.
+	EventTime() (time.Time, bool)
+	// IngestTime returns the time the entry was imported.
+	IngestTime() time.Time
+}
+
+type LineParser interface {
+	ParseLine(line string) ParsedLine
+}
+
+type ImportOptions struct {
+	// Parser defaults to NewPlainLineParser().
+	Parser LineParser
+	Fold   FoldOptions
+	// NoFolding imports every line as its own entry.
+	NoFolding bool
+	// Level is used for records without a recognisable level (default
+	// Info).
+	Level LogLevel
+	// FoldTimeout is how long a pending record waits for continuation
+	// lines before it is logged (default 500ms).
+	FoldTimeout time.Duration
+	// TimeSource chooses the entries' LogTime() (default
+	// TimeFromIngestion).
+	TimeSource TimeSource
+}
+
+type TailOptions struct {
+	ImportOptions
+	// FromStart reads the existing contents of the file; by default only
+	// lines appended after TailFile is called are imported.
+	FromStart bool
+	// PollInterval defaults to 250ms.
+	PollInterval time.Duration
+	// OnError is called with errors other than the file being missing.
+	OnError func(err error)
+	// Decryption, if set, reads the file as written by a file listener
+	// with FileOptions.Encryption.
+	Decryption KeySource
+}
+
+type Tailer interface {
+	Path() string
+	Stop()
+}
+
+///
+
+var plainTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006/01/02 15:04:05.999999999",
+	"Jan _2 15:04:05",
+}
+
+var plainLevelNames = map[string]LogLevel{
+	"FATAL":    FatalError,
+	"CRITICAL": FatalError,
+	"CRIT":     FatalError,
+	"PANIC":    FatalError,
+	"ERROR":    Error,
+	"ERR":      Error,
+	"SEVERE":   Error,
+	"WARN":     Warning,
+	"WARNING":  Warning,
+	"INFO":     Info,
+	"NOTICE":   Info,
+	"DEBUG":    Debug,
+	"FINE":     Debug,
+	"TRACE":    Trace,
+	"FINER":    Trace,
+	"FINEST":   Trace,
+}
+
+type plainLineParser struct{}
+
+// NewPlainLineParser parses the common plain-text layouts: an optional
+// leading timestamp (RFC 3339, "2006-01-02 15:04:05,000" as written by
+// log4j/logback and Python, Go's "2006/01/02 15:04:05", syslog's
+// "Jan _2 15:04:05") followed by an optional level word, bare or in
+// brackets, or Python's "LEVEL:logger:" prefix.
+func NewPlainLineParser() LineParser {
+	return &plainLineParser{}
+}
+
+func (plainLineParser) ParseLine(line string) ParsedLine {
+	pl := ParsedLine{Message: line}
+	rest := strings.TrimLeft(line, " ")
+	fields := strings.SplitN(rest, " ", 4)
+	// Try the longest candidate timestamp (up to three fields) first.
+	for n := 3; n >= 1 && !pl.HasTime; n-- {
+		if len(fields) < n {
+			continue
+		}
+		candidate := strings.Replace(strings.Join(fields[:n], " "), ",", ".", 1)
+		for _, layout := range plainTimeLayouts {
+			if t, err := time.Parse(layout, candidate); err == nil {
+				pl.Time, pl.HasTime = t, true
+				rest = strings.TrimLeft(strings.Join(fields[n:], " "), " ")
+				break
+			}
+		}
+	}
+	word := rest
+	if idx := strings.IndexByte(rest, ' '); idx >= 0 {
+		word = rest[:idx]
+	}
+	token := strings.Trim(word, "[]()<>:|")
+	if idx := strings.IndexByte(token, ':'); idx >= 0 {
+		// Python's default "ERROR:root:message" format.
+		token = token[:idx]
+		if level, ok := plainLevelNames[strings.ToUpper(token)]; ok {
+			pl.Level, pl.HasLevel = level, true
+			msg := rest[idx+1:]
+			if j := strings.IndexByte(msg, ':'); j >= 0 {
+				msg = msg[j+1:]
+			}
+			pl.Message = strings.TrimLeft(msg, " ")
+			return pl
+		}
+	}
+	if level, ok := plainLevelNames[strings.ToUpper(token)]; ok {
+		pl.Level, pl.HasLevel = level, true
+		rest = strings.TrimLeft(rest[len(word):], " -:|")
+	}
+	if pl.HasTime || pl.HasLevel {
+		pl.Message = rest
+	}
+	return pl
+}
+
+type lineImporter struct {
+	stream LogStream
+	opts   ImportOptions
+	folder LineFolder
+}
+
+func newLineImporter(stream LogStream, opts ImportOptions) *lineImporter {
+	if opts.Parser == nil {
+		opts.Parser = NewPlainLineParser()
+	}
+	if opts.Level == All {
+		opts.Level = Info
+	}
+	if opts.FoldTimeout <= 0 {
+		opts.FoldTimeout = 500 * time.Millisecond
+	}
+	li := &lineImporter{stream: stream, opts: opts}
+	if !opts.NoFolding {
+		li.folder = NewLineFolder(opts.Fold)
+	}
+	return li
+}
+
+func (li *lineImporter) emit(record string) {
+	first, more := record, ""
+	if idx := strings.IndexByte(record, '\n'); idx >= 0 {
+		first, more = record[:idx], record[idx:]
+	}
+	pl := li.opts.Parser.ParseLine(first)
+	level := li.opts.Level
+	if pl.HasLevel {
+		level = pl.Level
+	}
+	if pl.HasTime && pl.Time.Year() == 0 {
+		pl.Time = completeYear(pl.Time, time.Now())
+	}
+	ls, std := li.stream.(*stdLogStream)
+	if len(pl.Fields) > 0 {
+		template, args := fieldsTemplate(pl.Message, pl.Fields, more)
+		if std {
+			ls.dispatchImport(level, true, template, args, pl, li.opts.TimeSource)
+			return
+		}
+		li.stream.LogTemplate(level, template, args...)
+		return
+	}
+	if std {
+		ls.dispatchImport(level, false, pl.Message+more, nil, pl, li.opts.TimeSource)
+		return
+	}
+	li.stream.Log(level, pl.Message+more)
+}
+
+// Gives a timestamp parsed without a year the latest year which does not
+// put it more than a day after now.
+func completeYear(t time.Time, now time.Time) time.Time {
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// The times of an imported entry.
+type importedTime struct {
+	event    time.Time
+	hasEvent bool
+	ingested time.Time
+}
+
+func (le *stdLogEntry) EventTime() (time.Time, bool) {
+	if le.imported == nil {
+		return le.ts, true
+	}
+	return le.imported.event, le.imported.hasEvent
+}
+
+func (le *stdLogEntry) IngestTime() time.Time {
+	if le.imported == nil {
+		return le.ts
+	}
+	return le.imported.ingested
+}
+
+func (de *derivedEntry) EventTime() (time.Time, bool) {
+	if ie, ok := de.LogEntry.(ImportedLogEntry); ok {
+		return ie.EventTime()
+	}
+	return de.LogTime(), true
+}
+
+func (de *derivedEntry) IngestTime() time.Time {
+	if ie, ok := de.LogEntry.(ImportedLogEntry); ok {
+		return ie.IngestTime()
+	}
+	return de.LogTime()
+}
+
+func (li *lineImporter) line(line string) {
+	if li.folder == nil {
+		li.emit(strings.TrimRight(line, "\r\n"))
+		return
+	}
+	if record, ok := li.folder.Add(line); ok {
+		li.emit(record)
+	}
+}
+
+func (li *lineImporter) flush() {
+	if li.folder == nil {
+		return
+	}
+	if record, ok := li.folder.Flush(); ok {
+		li.emit(record)
+	}
+}
+
+// ImportLines logs the lines read from r to stream until r is exhausted,
+// returning the read error (nil at EOF).
+func ImportLines(r io.Reader, stream LogStream, opts ImportOptions) error {
+	li := newLineImporter(stream, opts)
+	lines := make(chan string, 64)
+	errc := make(chan error, 1)
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				lines <- line
+			}
+			if err != nil {
+				close(lines)
+				if err == io.EOF {
+					err = nil
+				}
+				errc <- err
+				return
+			}
+		}
+	}()
+	timer := time.NewTimer(li.opts.FoldTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				li.flush()
+				return <-errc
+			}
+			li.line(line)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(li.opts.FoldTimeout)
+		case <-timer.C:
+			li.flush()
+			timer.Reset(li.opts.FoldTimeout)
+		}
+	}
+}
+
+type fileTailer struct {
+	path     string
+	opts     TailOptions
+	importer *lineImporter
+	file     *os.File
+	aead     cipher.AEAD
+	dr       *decryptingReader
+	reader   *bufio.Reader
+	offset   int64
+	partial  string
+	lastLine time.Time
+	stop     chan bool
+	done     chan bool
+	stopped  int32
+}
+
+// TailFile follows the file at path, logging appended lines to stream.  A
+// missing file is waited for; a rotated (replaced) file is read to its end
+// and the new one followed from its start, as is a truncated file.
+func TailFile(path string, stream LogStream, opts TailOptions) Tailer {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 250 * time.Millisecond
+	}
+	ft := &fileTailer{
+		path:     path,
+		opts:     opts,
+		importer: newLineImporter(stream, opts.ImportOptions),
+		stop:     make(chan bool),
+		done:     make(chan bool),
+	}
+	if opts.Decryption != nil {
+		aead, err := newLogCipher(opts.Decryption)
+		ft.aead = aead
+		ft.error(err)
+	}
+	ft.open(!opts.FromStart)
+	go ft.run()
+	return ft
+}
+
+func (ft *fileTailer) Path() string {
+	return ft.path
+}
+
+func (ft *fileTailer) error(err error) {
+	if ft.opts.OnError != nil && err != nil {
+		ft.opts.OnError(err)
+	}
+}
+
+func (ft *fileTailer) open(atEnd bool) {
+	if ft.opts.Decryption != nil && ft.aead == nil {
+		return
+	}
+	file, err := os.Open(ft.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			ft.error(err)
+		}
+		return
+	}
+	ft.offset = 0
+	ft.file = file
+	ft.partial = ""
+	if ft.aead != nil {
+		// Records are numbered from the start of the file, so it is read
+		// (though not decrypted) to reach the end.
+		ft.dr = newTailDecrypter(file, ft.aead)
+		if atEnd {
+			ft.error(ft.dr.skip())
+		}
+		ft.reader = bufio.NewReader(ft.dr)
+		return
+	}
+	if atEnd {
+		if ft.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			ft.error(err)
+		}
+	}
+	ft.reader = bufio.NewReader(file)
+}
+
+// The bytes of the file read so far.
+func (ft *fileTailer) position() int64 {
+	if ft.dr != nil {
+		return ft.dr.read
+	}
+	return ft.offset
+}
+
+func (ft *fileTailer) closeFile() {
+	if ft.file != nil {
+		ft.file.Close()
+		ft.file = nil
+		ft.dr = nil
+	}
+}
+
+// Reads the complete lines available; a trailing partial line is kept
+// until its newline arrives.
+func (ft *fileTailer) read() {
+	// A record failing authentication ends an encrypted file.
+	if ft.dr != nil && ft.dr.err != nil {
+		return
+	}
+	for ft.file != nil {
+		chunk, err := ft.reader.ReadString('\n')
+		ft.offset += int64(len(chunk))
+		if err != nil {
+			ft.partial += chunk
+			if err != io.EOF {
+				ft.error(err)
+			}
+			return
+		}
+		ft.importer.line(ft.partial + chunk)
+		ft.partial = ""
+		ft.lastLine = time.Now()
+	}
+}
+
+func (ft *fileTailer) poll() {
+	if ft.file == nil {
+		// Files appearing after the tail started are read from the start.
+		ft.open(false)
+	}
+	ft.read()
+	if ft.file == nil {
+		return
+	}
+	fi, err := os.Stat(ft.path)
+	switch {
+	case err != nil || !sameFile(ft.file, fi):
+		// Rotated away: the old file has been drained above.
+		if ft.partial != "" {
+			ft.importer.line(ft.partial)
+		}
+		ft.importer.flush()
+		ft.closeFile()
+		if err == nil {
+			ft.open(false)
+			ft.read()
+		}
+	case fi.Size() < ft.position():
+		ft.importer.flush()
+		ft.closeFile()
+		ft.open(false)
+		ft.read()
+	}
+	if !ft.lastLine.IsZero() && time.Since(ft.lastLine) >= ft.importer.opts.FoldTimeout {
+		ft.importer.flush()
+		ft.lastLine = time.Time{}
+	}
+}
+
+func sameFile(file *os.File, fi os.FileInfo) bool {
+	ofi, err := file.Stat()
+	return err == nil && os.SameFile(ofi, fi)
+}
+
+func (ft *fileTailer) run() {
+	defer close(ft.done)
+	ticker := time.NewTicker(ft.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ft.poll()
+		case <-ft.stop:
+			ft.poll()
+			ft.importer.flush()
+			ft.closeFile()
+			return
+		}
+	}
+}
+
+// Stop reads any remaining lines, logs the pending record and stops.
+func (ft *fileTailer) Stop() {
+	if atomic.CompareAndSwapInt32(&ft.stopped, 0, 1) {
+		close(ft.stop)
+	}
+	<-ft.done
+}
@@ -0,0 +1,263 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const childProcessOutput = `2024-03-01 10:00:00,123 INFO  [main] app.Server - starting
+2024-03-01 10:00:01,456 ERROR [worker-1] app.Handler - request failed
+java.lang.IllegalStateException: boom
+	at app.Handler.handle(Handler.java:42)
+	at app.Server.run(Server.java:17)
+Caused by: java.io.IOException: disk full
+	at app.Store.write(Store.java:9)
+	... 2 more
+2024-03-01 10:00:02,000 WARN  [main] app.Server - slow
+ERROR:root:task crashed
+Traceback (most recent call last):
+  File "task.py", line 3, in <module>
+    run()
+ValueError: bad value
+plain line
+`
+
+func TestImportLinesFolding(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("child")
+	if err := ImportLines(strings.NewReader(childProcessOutput), stream, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Flush()
+	var got []string
+	for _, e := range cl.Entries() {
+		got = append(got, fmt.Sprintf("%s|%s", e.Level(), e.Message()))
+	}
+	want := []string{
+		"Info|[main] app.Server - starting",
+		"Error|[worker-1] app.Handler - request failed\njava.lang.IllegalStateException: boom\n\tat app.Handler.handle(Handler.java:42)\n\tat app.Server.run(Server.java:17)\nCaused by: java.io.IOException: disk full\n\tat app.Store.write(Store.java:9)\n\t... 2 more",
+		"Warning|[main] app.Server - slow",
+		"Error|task crashed\nTraceback (most recent call last):\n  File \"task.py\", line 3, in <module>\n    run()\nValueError: bad value",
+		"Info|plain line",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries: %q", len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d:\n got %q\nwant %q", i, got[i], want[i])
+		}
+	}
+}
+
+const chainedTracebackOutput = `ERROR:root:job failed
+Traceback (most recent call last):
+  File "job.py", line 5, in load
+    return cache[key]
+KeyError: 'config'
+
+During handling of the above exception, another exception occurred:
+
+Traceback (most recent call last):
+  File "job.py", line 9, in <module>
+    load()
+ValueError: no config
+
+INFO:root:retrying
+`
+
+func TestImportLinesChainedTraceback(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("child")
+	if err := ImportLines(strings.NewReader(chainedTracebackOutput), stream, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Flush()
+	var got []string
+	for _, e := range cl.Entries() {
+		got = append(got, fmt.Sprintf("%s|%s", e.Level(), e.Message()))
+	}
+	want := []string{
+		"Error|job failed\nTraceback (most recent call last):\n  File \"job.py\", line 5, in load\n    return cache[key]\nKeyError: 'config'\n\nDuring handling of the above exception, another exception occurred:\n\nTraceback (most recent call last):\n  File \"job.py\", line 9, in <module>\n    load()\nValueError: no config",
+		"Info|retrying",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries: %q", len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d:\n got %q\nwant %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTailFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	os.WriteFile(path, []byte("old line\n"), 0644)
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("tail")
+	tailer := TailFile(path, stream, TailOptions{PollInterval: 10 * time.Millisecond})
+	appendLine := func(p, line string) {
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(line)
+		f.Close()
+	}
+	appendLine(path, "first\n")
+	time.Sleep(50 * time.Millisecond)
+	appendLine(path, "second, writ")
+	appendLine(path, "ten in two parts\n")
+	os.Rename(path, path+".1")
+	appendLine(path+".1", "last before rotation\n")
+	appendLine(path, "after rotation\n")
+	time.Sleep(50 * time.Millisecond)
+	tailer.Stop()
+	ctx.Flush()
+	var got []string
+	for _, e := range cl.Entries() {
+		got = append(got, e.Message())
+	}
+	want := "first|second, written in two parts|last before rotation|after rotation"
+	if strings.Join(got, "|") != want {
+		t.Errorf("tailed %q, want %q", strings.Join(got, "|"), want)
+	}
+}
+
+func TestStructuredLineImport(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("structured")
+	jsonLines := `{"time":"2024-03-01T10:00:00Z","level":"warn","msg":"slow {query}","ms":1500,"user.id":"u1"}
+{"level":50,"message":"failed","error":"disk full"}
+not json at all
+`
+	if err := ImportLines(strings.NewReader(jsonLines), stream, ImportOptions{Parser: NewJSONLineParser(), NoFolding: true}); err != nil {
+		t.Fatal(err)
+	}
+	logfmtLines := `level=debug msg="cache \"miss\"" key=abc hit
+`
+	if err := ImportLines(strings.NewReader(logfmtLines), stream, ImportOptions{Parser: NewLogfmtLineParser(), NoFolding: true}); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Flush()
+	var got []string
+	for _, e := range cl.Entries() {
+		got = append(got, fmt.Sprintf("%s|%s|%v", e.Level(), e.Message(), e.(TemplatedLogEntry).Properties()))
+	}
+	want := []string{
+		"Warning|slow {query} ms=1500 user.id=u1|map[ms:1500]",
+		"Error|failed error=disk full|map[error:disk full]",
+		"Info|not json at all|map[]",
+		`Debug|cache "miss" hit=true key=abc|map[hit:true key:abc]`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries: %q", len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d:\n got %q\nwant %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestImportTimeSource(t *testing.T) {
+	input := "2024-03-01 10:00:00,123 INFO starting\nno timestamp here\n"
+	event := time.Date(2024, 3, 1, 10, 0, 0, 123000000, time.UTC)
+	for _, source := range []TimeSource{TimeFromIngestion, TimeFromEvent} {
+		ctx := CreateLoggingContext()
+		cl := newCaptureListener()
+		ctx.AddGlobalLogListener(cl, Trace)
+		stream, _ := ctx.Stream("import")
+		before := time.Now()
+		if err := ImportLines(strings.NewReader(input), stream, ImportOptions{NoFolding: true, TimeSource: source}); err != nil {
+			t.Fatal(err)
+		}
+		entries := cl.Entries()
+		if len(entries) != 2 {
+			t.Fatalf("expected 2 entries, got %d", len(entries))
+		}
+		first := entries[0].(ImportedLogEntry)
+		if et, ok := first.EventTime(); !ok || !et.Equal(event) {
+			t.Errorf("unexpected event time %s", et)
+		}
+		if first.IngestTime().Before(before) {
+			t.Errorf("unexpected ingestion time %s", first.IngestTime())
+		}
+		if source == TimeFromEvent && !first.LogTime().Equal(event) || source == TimeFromIngestion && !first.LogTime().Equal(first.IngestTime()) {
+			t.Errorf("source %d: unexpected log time %s", source, first.LogTime())
+		}
+		second := entries[1].(ImportedLogEntry)
+		if _, ok := second.EventTime(); ok || !second.LogTime().Equal(second.IngestTime()) {
+			t.Errorf("source %d: entry without a timestamp should have its ingestion time", source)
+		}
+	}
+	if got := completeYear(time.Date(0, 12, 31, 23, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 30, 0, 0, time.UTC)); got.Year() != 2024 {
+		t.Errorf("expected a December timestamp in January to complete to the previous year, got %s", got)
+	}
+}
+
+func TestTailEncryptedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secure.log")
+	keys := KeySourceFunc(func() ([]byte, error) {
+		return []byte("0123456789abcdef"), nil
+	})
+	fl, err := NewFileListenerWithOptions("enc", path, NewCSVFormatter("message"), FileOptions{Encryption: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := CreateLoggingContext()
+	source, _ := writer.Stream("source")
+	source.AddLogListener(fl, Trace)
+	source.Info("before the tail")
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("tail")
+	var errs []error
+	tailer := TailFile(path, stream, TailOptions{
+		PollInterval:  10 * time.Millisecond,
+		ImportOptions: ImportOptions{NoFolding: true},
+		Decryption:    keys,
+		OnError:       func(err error) { errs = append(errs, err) },
+	})
+	source.Info("first")
+	time.Sleep(50 * time.Millisecond)
+	source.Info("second")
+	fl.Close()
+	time.Sleep(50 * time.Millisecond)
+	// A writer reopening the file replaces the final record the tail
+	// stopped before.
+	fl, err = NewFileListenerWithOptions("enc", path, NewCSVFormatter("message"), FileOptions{Encryption: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, _ := CreateLoggingContext().Stream("source")
+	reopened.AddLogListener(fl, Trace)
+	reopened.Info("third")
+	fl.Close()
+	time.Sleep(50 * time.Millisecond)
+	tailer.Stop()
+	ctx.Flush()
+	var got []string
+	for _, e := range cl.Entries() {
+		got = append(got, e.Message())
+	}
+	if strings.Join(got, "|") != "first|second|third" || len(errs) > 0 {
+		t.Errorf("tailed %q, errors %v", got, errs)
+	}
+}
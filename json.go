@@ -0,0 +1,129 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// A JSONFormatter writes one object per entry: time, level, stream, msg,
+// then seq, ingested or event_time, error, file and line, then the
+// properties (as "fields.<name>" if they clash).  Keys are sorted unless
+// FixedKeyOrder is set.
+type JSONFormatter interface {
+	LogEntryFormatter
+	TimeFormat() string
+	SetTimeFormat(format string)
+	FixedKeyOrder() bool
+	SetFixedKeyOrder(fixed bool)
+}
+
+///
+
+type jsonFormatter struct {
+	timeFormat string
+	fixed      bool
+}
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+func NewJSONFormatter() JSONFormatter {
+	return &jsonFormatter{timeFormat: "2006-01-02T15:04:05.000000000Z07:00"}
+}
+
+func (jf *jsonFormatter) TimeFormat() string {
+	return jf.timeFormat
+}
+
+func (jf *jsonFormatter) SetTimeFormat(format string) {
+	jf.timeFormat = format
+}
+
+func (jf *jsonFormatter) FixedKeyOrder() bool {
+	return jf.fixed
+}
+
+func (jf *jsonFormatter) SetFixedKeyOrder(fixed bool) {
+	jf.fixed = fixed
+}
+
+func (jf *jsonFormatter) Format(entry LogEntry) string {
+	fields := []jsonField{
+		{"time", entry.LogTime().Format(jf.timeFormat)},
+		{"level", entry.Level().String()},
+		{"stream", entry.Stream()},
+		{"msg", PrefixedMessage(entry)},
+	}
+	if se, ok := entry.(SequencedLogEntry); ok && se.Sequence() != 0 {
+		fields = append(fields, jsonField{"seq", se.Sequence()})
+	}
+	if ie, ok := entry.(ImportedLogEntry); ok {
+		event, known := ie.EventTime()
+		switch ingested := ie.IngestTime(); {
+		case !ingested.Equal(entry.LogTime()):
+			fields = append(fields, jsonField{"ingested", ingested.Format(jf.timeFormat)})
+		case known && !event.Equal(entry.LogTime()):
+			fields = append(fields, jsonField{"event_time", event.Format(jf.timeFormat)})
+		}
+	}
+	if entry.HasAssociatedError() {
+		fields = append(fields, jsonField{"error", entry.AssociatedError().Error()})
+	}
+	if entry.HasTrace() && len(entry.Trace()) > 0 {
+		frame := entry.Trace()[0]
+		fields = append(fields, jsonField{"file", frame.File()}, jsonField{"line", frame.Line()})
+	}
+	own := len(fields)
+	if te, ok := entry.(TemplatedLogEntry); ok {
+		props := te.Properties()
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key := name
+			for _, f := range fields[:own] {
+				if f.key == name {
+					key = "fields." + name
+				}
+			}
+			fields = append(fields, jsonField{key, props[name]})
+		}
+	}
+	if !jf.fixed {
+		sort.SliceStable(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		enc.Encode(f.key)
+		buf.Truncate(buf.Len() - 1)
+		buf.WriteByte(':')
+		mark := buf.Len()
+		value := f.value
+		switch v := value.(type) {
+		case json.Marshaler:
+		case error:
+			value = v.Error()
+		case fmt.Stringer:
+			value = v.String()
+		}
+		if err := enc.Encode(value); err != nil {
+			buf.Truncate(mark)
+			enc.Encode(fmt.Sprintf("%v", f.value))
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
@@ -0,0 +1,31 @@
+package log
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJSONFormatterKeyOrder(t *testing.T) {
+	template, _ := parseMessageTemplate("{level} {Attempt} {Cause}")
+	entry := &stdLogEntry{
+		ts:              time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		stream:          &stdLogStream{name: "db"},
+		level:           Warning,
+		message:         "retrying",
+		associatedError: errors.New("timeout"),
+		template:        template,
+		properties:      map[string]interface{}{"level": "high", "Attempt": 2, "Cause": errors.New("reset")},
+	}
+	jf := NewJSONFormatter()
+	jf.SetTimeFormat(time.RFC3339)
+	sorted := `{"Attempt":2,"Cause":"reset","error":"timeout","fields.level":"high","level":"Warning","msg":"retrying","stream":"db","time":"2020-01-02T03:04:05Z"}` + "\n"
+	if out := jf.Format(entry); out != sorted {
+		t.Errorf("unexpected sorted output:\n%s", out)
+	}
+	jf.SetFixedKeyOrder(true)
+	fixed := `{"time":"2020-01-02T03:04:05Z","level":"Warning","stream":"db","msg":"retrying","error":"timeout","Attempt":2,"Cause":"reset","fields.level":"high"}` + "\n"
+	if out := jf.Format(entry); out != fixed {
+		t.Errorf("unexpected fixed order output:\n%s", out)
+	}
+}
@@ -0,0 +1,45 @@
+package log
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// ProfilerLabelFields returns the pprof labels of ctx, which entries logged
+// through LogContext() carry with SetProfilerLabels enabled.
+func ProfilerLabelFields(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	var fields []Field
+	pprof.ForLabels(ctx, func(key, value string) bool {
+		fields = append(fields, F(key, value))
+		return true
+	})
+	return fields
+}
+
+func (ctx *stdLoggingContext) SetProfilerLabels(enabled bool) {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	ctx.profilerLabels = enabled
+}
+
+func (ctx *stdLoggingContext) ProfilerLabels() bool {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	return ctx.profilerLabels
+}
+
+// Adds fields to the entry's properties, keeping those it has.
+func addProperties(entry *stdLogEntry, fields []Field) {
+	for _, f := range fields {
+		if _, has := entry.properties[f.Key]; has {
+			continue
+		}
+		if entry.properties == nil {
+			entry.properties = make(map[string]interface{})
+		}
+		entry.properties[f.Key] = f.Value
+	}
+}
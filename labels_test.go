@@ -0,0 +1,31 @@
+package log
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+)
+
+func TestProfilerLabels(t *testing.T) {
+	ctx := CreateLoggingContext()
+	capture := newCaptureListener()
+	ctx.AddGlobalLogListener(capture, Trace)
+	stream, _ := ctx.Stream("handler")
+	labelled := pprof.WithLabels(context.Background(), pprof.Labels("handler", "checkout", "RequestId", "r-1"))
+	stream.LogContext(labelled, Info, "not labelled until enabled")
+	ctx.SetProfilerLabels(true)
+	pprof.Do(labelled, pprof.Labels("step", "charge"), func(c context.Context) {
+		stream.LogContext(c, Info, "charging card")
+	})
+	entries := capture.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if props := entries[0].(TemplatedLogEntry).Properties(); len(props) != 0 {
+		t.Errorf("unexpected properties with labels disabled: %v", props)
+	}
+	props := entries[1].(TemplatedLogEntry).Properties()
+	if props["handler"] != "checkout" || props["RequestId"] != "r-1" || props["step"] != "charge" {
+		t.Errorf("unexpected properties: %v", props)
+	}
+}
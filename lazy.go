@@ -0,0 +1,51 @@
+package log
+
+func (ls *stdLogStream) dispatchLazy(level LogLevel, generateTrace bool, fn func() string) {
+	ls.dispatchEntry(&dispatchRequest{
+		level:         level,
+		generateTrace: generateTrace,
+		lazy:          fn,
+	})
+}
+
+// fn is called, once, only if some listener will receive the entry or a
+// recorder records it.
+func (ls *stdLogStream) LogLazy(level LogLevel, fn func() string) {
+	ls.dispatchLazy(level, false, fn)
+}
+
+func (ls *stdLogStream) InfoLazy(fn func() string) {
+	ls.dispatchLazy(Info, false, fn)
+}
+
+func (ls *stdLogStream) DebugLazy(fn func() string) {
+	if ls.ctx.DebuggingEnabled() {
+		ls.dispatchLazy(Debug, false, fn)
+	}
+}
+
+func (ls *stdLogStream) TraceLazy(fn func() string) {
+	if ls.ctx.DebuggingEnabled() {
+		ls.dispatchLazy(Trace, true, fn)
+	}
+}
+
+func (fl *fieldLog) LogLazy(level LogLevel, fn func() string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: level, lazy: fn})
+}
+
+func (fl *fieldLog) InfoLazy(fn func() string) {
+	fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Info, lazy: fn})
+}
+
+func (fl *fieldLog) DebugLazy(fn func() string) {
+	if fl.stream.ctx.DebuggingEnabled() {
+		fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Debug, lazy: fn})
+	}
+}
+
+func (fl *fieldLog) TraceLazy(fn func() string) {
+	if fl.stream.ctx.DebuggingEnabled() {
+		fl.stream.dispatchFields(fl.fields, &dispatchRequest{level: Trace, generateTrace: true, lazy: fn})
+	}
+}
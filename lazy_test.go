@@ -0,0 +1,31 @@
+package log
+
+import "testing"
+
+func TestLogLazy(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Info)
+	stream, _ := ctx.Stream("lazy")
+	calls := 0
+	message := func() string {
+		calls++
+		return "expensive"
+	}
+	stream.LogLazy(Debug2, message)
+	ctx.EnableDebugging(true)
+	stream.DebugLazy(message)
+	if calls != 0 {
+		t.Errorf("expected no calls without an interested listener, got %d", calls)
+	}
+	stream.InfoLazy(message)
+	stream.With("Key", 1).LogLazy(Warning, message)
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+	for _, entry := range cl.Entries() {
+		if entry.Message() != "expensive" {
+			t.Errorf("unexpected message %q", entry.Message())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A LevelStore saves level overrides as they change, so that they survive
+// restarts until cleared.
+type LevelStore interface {
+	Load() (map[string]LogLevel, error)
+	Save(overrides map[string]LogLevel) error
+}
+
+///
+
+type fileLevelStore struct {
+	path string
+}
+
+// NewFileLevelStore keeps overrides in a JSON file mapping stream names to
+// level names.  A missing file holds no overrides.
+func NewFileLevelStore(path string) LevelStore {
+	return &fileLevelStore{path: path}
+}
+
+func (fls *fileLevelStore) Load() (map[string]LogLevel, error) {
+	overrides := make(map[string]LogLevel)
+	data, err := os.ReadFile(fls.path)
+	if os.IsNotExist(err) {
+		return overrides, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names map[string]string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("level overrides %s: %w", fls.path, err)
+	}
+	for stream, name := range names {
+		level, ok := ParseLogLevel(name)
+		if !ok {
+			return nil, fmt.Errorf("level overrides %s: unknown level '%s' for stream '%s'", fls.path, name, stream)
+		}
+		overrides[stream] = level
+	}
+	return overrides, nil
+}
+
+func (fls *fileLevelStore) Save(overrides map[string]LogLevel) error {
+	names := make(map[string]string, len(overrides))
+	for stream, level := range overrides {
+		names[stream] = level.String()
+	}
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fls.path), filepath.Base(fls.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fls.path)
+}
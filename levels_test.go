@@ -0,0 +1,95 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLevelOverridesPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "levels.json")
+	ctx := CreateLoggingContext()
+	if err := ctx.SetLevelStore(NewFileLevelStore(path)); err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetLevelOverride("db", Debug)
+	ctx.SetLevelOverride("noisy", Error)
+	ctx.SetLevelOverride("gone", Trace)
+	ctx.ClearLevelOverride("gone")
+
+	// A restarted process restores the overrides from the store.
+	restarted := CreateLoggingContext()
+	cl := newCaptureListener()
+	restarted.AddGlobalLogListener(cl, Info)
+	if err := restarted.SetLevelStore(NewFileLevelStore(path)); err != nil {
+		t.Fatal(err)
+	}
+	overrides := restarted.LevelOverrides()
+	if len(overrides) != 2 || overrides["db"] != Debug || overrides["noisy"] != Error {
+		t.Fatalf("restored overrides %v", overrides)
+	}
+	db, _ := restarted.Stream("db")
+	noisy, _ := restarted.Stream("noisy")
+	db.Log(Debug, "db debug")
+	db.Log(Trace, "db trace")
+	noisy.Warning("noisy warning")
+	noisy.Error(errors.New("noisy error"))
+	restarted.Flush()
+	var got []string
+	for _, e := range cl.Entries() {
+		got = append(got, e.Message())
+	}
+	if len(got) != 2 || got[0] != "db debug" || got[1] != "noisy error" {
+		t.Errorf("delivered %q", got)
+	}
+}
+
+// A store whose saves take varying time, recording the last one to finish.
+type slowLevelStore struct {
+	lock  sync.Mutex
+	saves int
+	saved map[string]LogLevel
+}
+
+func (ss *slowLevelStore) Load() (map[string]LogLevel, error) {
+	return map[string]LogLevel{}, nil
+}
+
+func (ss *slowLevelStore) Save(overrides map[string]LogLevel) error {
+	ss.lock.Lock()
+	ss.saves++
+	delay := time.Duration(ss.saves%3) * time.Millisecond
+	ss.lock.Unlock()
+	time.Sleep(delay)
+	ss.lock.Lock()
+	ss.saved = overrides
+	ss.lock.Unlock()
+	return nil
+}
+
+func TestLevelOverrideSaveOrder(t *testing.T) {
+	ctx := CreateLoggingContext()
+	store := &slowLevelStore{}
+	ctx.SetLevelStore(store)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				ctx.SetLevelOverride("db", []LogLevel{Debug, Info, Warning}[i%3])
+			} else {
+				ctx.ClearLevelOverride("db")
+			}
+		}(i)
+	}
+	wg.Wait()
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if fmt.Sprint(store.saved) != fmt.Sprint(ctx.LevelOverrides()) {
+		t.Errorf("store holds %v, context %v", store.saved, ctx.LevelOverrides())
+	}
+}
@@ -0,0 +1,181 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type PayloadLimits struct {
+	MaxMessage  int
+	MaxProperty int
+	// Marker is appended to truncated values; a %d verb is replaced by
+	// the number of bytes removed.  Default "...[truncated %d bytes]".
+	Marker       string
+	Externalizer Externalizer
+}
+
+type Externalizer interface {
+	Externalize(entry LogEntry, name string, payload []byte) (ref string, err error)
+}
+
+///
+
+type limitingListener struct {
+	target LogListener
+	limits PayloadLimits
+}
+
+// NewLimitingListener truncates long messages and string properties on a
+// UTF-8 boundary, appending Marker.  With an Externalizer the full payload
+// is stored first and referenced as the property "<name>_ref".
+func NewLimitingListener(target LogListener, limits PayloadLimits) LogListener {
+	if limits.Marker == "" {
+		limits.Marker = "...[truncated %d bytes]"
+	}
+	return &limitingListener{target: target, limits: limits}
+}
+
+func (ll *limitingListener) Name() string {
+	return ll.target.Name()
+}
+
+func (ll *limitingListener) Target() LogListener {
+	return ll.target
+}
+
+func (ll *limitingListener) Receive(entry LogEntry) {
+	ll.target.Receive(ll.limit(entry))
+}
+
+func (ll *limitingListener) limit(entry LogEntry) LogEntry {
+	var de *derivedEntry
+	if max := ll.limits.MaxMessage; max > 0 && len(entry.Message()) > max {
+		de = deriveEntry(entry)
+		de.message = ll.shorten(de, "message", de.message, max)
+	}
+	if max := ll.limits.MaxProperty; max > 0 {
+		if te, ok := entry.(TemplatedLogEntry); ok {
+			for name, val := range te.Properties() {
+				str, ok := stringPayload(val)
+				if !ok || len(str) <= max {
+					continue
+				}
+				if de == nil {
+					de = deriveEntry(entry)
+				}
+				de.setProperty(name, ll.shorten(de, name, str, max))
+			}
+		}
+	}
+	if de == nil {
+		return entry
+	}
+	return de
+}
+
+func stringPayload(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return "", false
+}
+
+func (ll *limitingListener) shorten(de *derivedEntry, name string, str string, max int) string {
+	if ll.limits.Externalizer != nil {
+		if ref, err := ll.limits.Externalizer.Externalize(de.LogEntry, name, []byte(str)); err == nil {
+			de.setProperty(name+"_ref", ref)
+		}
+	}
+	return truncatePayload(str, max, ll.limits.Marker)
+}
+
+func truncatePayload(str string, max int, marker string) string {
+	cut := max
+	for cut > 0 && !utf8.RuneStart(str[cut]) {
+		cut--
+	}
+	if strings.Contains(marker, "%d") {
+		marker = fmt.Sprintf(marker, len(str)-cut)
+	}
+	return str[:cut] + marker
+}
+
+func (ll *limitingListener) Flush() error {
+	if fl, ok := ll.target.(Flusher); ok {
+		return fl.Flush()
+	}
+	return nil
+}
+
+func (ll *limitingListener) Close() error {
+	return ll.target.Close()
+}
+
+func externalPayloadName(entry LogEntry, name string) string {
+	safe := strings.NewReplacer("/", "_", "\\", "_", ":", "_")
+	return fmt.Sprintf("%s-%s-%d-%s.txt", safe.Replace(entry.Stream()), Fingerprint(entry), entry.LogTime().UnixNano(), safe.Replace(name))
+}
+
+type fileExternalizer struct {
+	dir string
+}
+
+// NewFileExternalizer writes payloads to files in dir; references are the
+// file paths.
+func NewFileExternalizer(dir string) Externalizer {
+	return &fileExternalizer{dir: dir}
+}
+
+func (fe *fileExternalizer) Externalize(entry LogEntry, name string, payload []byte) (string, error) {
+	if err := os.MkdirAll(fe.dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(fe.dir, externalPayloadName(entry, name))
+	if err := ioutil.WriteFile(path, payload, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+type objectStoreExternalizer struct {
+	store       ObjectStore
+	keyTemplate string
+	timeout     time.Duration
+}
+
+// NewObjectStoreExternalizer uploads payloads to store under keys built from
+// keyTemplate (see Archiver; %f is the generated payload name).  References
+// are the object keys.  Uploads are synchronous, and bounded by timeout.
+func NewObjectStoreExternalizer(store ObjectStore, keyTemplate string, timeout time.Duration) Externalizer {
+	if keyTemplate == "" {
+		keyTemplate = "payloads/%Y/%m/%d/%f"
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &objectStoreExternalizer{store: store, keyTemplate: keyTemplate, timeout: timeout}
+}
+
+func (oe *objectStoreExternalizer) Externalize(entry LogEntry, name string, payload []byte) (string, error) {
+	key := expandKeyTemplate(oe.keyTemplate, entry.LogTime().UTC(), externalPayloadName(entry, name))
+	ctx, cancel := context.WithTimeout(context.Background(), oe.timeout)
+	defer cancel()
+	err := oe.store.Put(ctx, key, bytes.NewReader(payload), int64(len(payload)),
+		ObjectMetadata{ContentType: "text/plain; charset=utf-8"})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
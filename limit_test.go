@@ -0,0 +1,71 @@
+package log
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+type recordingExternalizer struct {
+	payloads map[string]string
+}
+
+func (re *recordingExternalizer) Externalize(entry LogEntry, name string, payload []byte) (string, error) {
+	ref := "ref:" + name
+	re.payloads[ref] = string(payload)
+	return ref, nil
+}
+
+func TestLimitingListener(t *testing.T) {
+	cl := newCaptureListener()
+	ext := &recordingExternalizer{payloads: map[string]string{}}
+	ll := NewLimitingListener(cl, PayloadLimits{MaxMessage: 8, MaxProperty: 5, Marker: "~%d", Externalizer: ext})
+	message := "abcdefgé and more"
+	body := "ééééé"
+	entry := &stdLogEntry{
+		ts:         time.Now(),
+		stream:     &stdLogStream{name: "api"},
+		level:      Info,
+		message:    message,
+		properties: map[string]interface{}{"Body": body, "Id": 42, "Short": "ok"},
+	}
+	ll.Receive(entry)
+	got := cl.Entries()[0].(TemplatedLogEntry)
+	// "é" straddles the 8-byte limit, so the cut falls before it.
+	if got.Message() != "abcdefg~11" {
+		t.Errorf("message truncated to %q", got.Message())
+	}
+	props := got.Properties()
+	if props["Body"] != "éé~6" || !utf8.ValidString(props["Body"].(string)) {
+		t.Errorf("property truncated to %q", props["Body"])
+	}
+	if props["Id"] != 42 || props["Short"] != "ok" {
+		t.Errorf("untouched properties changed: %v", props)
+	}
+	if ref := props["message_ref"]; ref != "ref:message" || ext.payloads["ref:message"] != message {
+		t.Errorf("message not externalized: %v %q", ref, ext.payloads["ref:message"])
+	}
+	if ref := props["Body_ref"]; ref != "ref:Body" || ext.payloads["ref:Body"] != body {
+		t.Errorf("property not externalized: %v %q", ref, ext.payloads["ref:Body"])
+	}
+	if entry.message != message || entry.properties["Body"] != body || len(entry.properties) != 3 {
+		t.Errorf("original entry modified: %q %v", entry.message, entry.properties)
+	}
+
+	// Entries within the limits pass through as they are.
+	small := &stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "api"}, level: Info, message: "short"}
+	ll.Receive(small)
+	if cl.Entries()[1] != LogEntry(small) {
+		t.Error("entry within limits was rewritten")
+	}
+}
+
+func TestTruncatePayloadMarker(t *testing.T) {
+	if got := truncatePayload(strings.Repeat("x", 10), 4, "...[truncated %d bytes]"); got != "xxxx...[truncated 6 bytes]" {
+		t.Errorf("got %q", got)
+	}
+	if got := truncatePayload(strings.Repeat("x", 10), 4, "…"); got != "xxxx…" {
+		t.Errorf("got %q", got)
+	}
+}
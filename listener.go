@@ -1,13 +1,19 @@
 package log
 
 import (
+	"bufio"
+	"errors"
 	"io"
 	"fmt"
+	"strings"
+	"sync/atomic"
 )
 
 type LogListener interface {
 	Name() string
 	Receive(entry LogEntry)
+	// Close flushes and releases the listener; see close.go for the
+	// contract every listener follows.
 	Close() error
 }
 
@@ -16,7 +22,7 @@ type FormattingLogListener interface {
 	Formatter() LogEntryFormatter
 }
 
-type StandardLogFormatterFlags uint16 
+type StandardLogFormatterFlags uint32
 const (
 	Zero					StandardLogFormatterFlags = 1 << iota
 	PrintTime		
@@ -28,6 +34,20 @@ const (
 	PrintMessage
 	PrintNewline
 	PrintColor
+	// Content from the message and error text is escaped (newlines,
+	// ANSI sequences and other control characters) so that it cannot
+	// forge entries or recolor output.  With MarkContinuations instead,
+	// embedded newlines are kept but each continuation line is visibly
+	// marked; other control characters are still escaped.
+	EscapeContent
+	MarkContinuations
+	// Metadata added by the context's metadata providers (see
+	// MetadataProvider), written after the time, if the entry has it.
+	// PrintService writes the service and version as service@version.
+	PrintHost
+	PrintPID
+	PrintGoroutine
+	PrintService
 )
 
 type BaseColor uint8
@@ -72,6 +92,18 @@ type StandardLogFormatter interface {
 	SetIndent(indent string)
 	GetLevelColorPrefix(level LogLevel) ColorPrefix
 	SetLevelColorPrefix(level LogLevel, prefix ColorPrefix) 
+	Locale() *Locale
+	SetLocale(locale *Locale)
+}
+
+// Writer listeners serialize their writes, so entries dispatched
+// concurrently are never interleaved.
+type WriterOptions struct {
+	// BufferSize, if positive, buffers up to this many bytes of output,
+	// written when the buffer fills, on Flush() and on Close().
+	BufferSize int
+	// OnError, if set, is called with each error writing to the writer.
+	OnError func(err error)
 }
 
 ///
@@ -82,6 +114,7 @@ type stdLogEntryFormatter struct {
 	sep string
 	indent string
 	colorPrefixes map[LogLevel]ColorPrefix
+	locale *Locale
 }
 
 func NewLogEntryFormatter() StandardLogFormatter {
@@ -124,7 +157,13 @@ func (lef *stdLogEntryFormatter) Format(entry LogEntry) string {
 	}
 	if lef.flags & PrintTime != 0 {
 		fsep()
-		buf = append(buf, []byte(entry.LogTime().Format(lef.timeFormat))...)
+		buf = append(buf, []byte(lef.locale.FormatTime(entry.LogTime(), lef.timeFormat))...)
+	}
+	if lef.flags & (PrintHost | PrintPID | PrintGoroutine | PrintService) != 0 {
+		for _, value := range lef.metadata(entry) {
+			fsep()
+			buf = append(buf, []byte(lef.content(value))...)
+		}
 	}
 	if lef.flags & PrintStreamName != 0 {
 		fsep()
@@ -132,13 +171,13 @@ func (lef *stdLogEntryFormatter) Format(entry LogEntry) string {
 	}
 	if lef.flags & PrintLevel != 0 {
 		fsep()
-		buf = append(buf, []byte(entry.Level().String())...)
+		buf = append(buf, []byte(lef.locale.LevelName(entry.Level()))...)
 	}
 	if lef.flags & PrintMessage != 0{
 		fsep()
-		buf = append(buf, []byte(entry.Message())...)
+		buf = append(buf, []byte(lef.content(PrefixedMessage(entry)))...)
 	}
-	if entry.HasTrace() && lef.flags & PrintFileLine != 0 {
+	if entry.HasTrace() && len(entry.Trace()) > 0 && lef.flags & PrintFileLine != 0 {
 		traceFrame := entry.Trace()[0]
 		fsep()
 		buf = append(buf, fmt.Sprintf("%s:%d", traceFrame.File(), traceFrame.Line())...)
@@ -150,10 +189,16 @@ func (lef *stdLogEntryFormatter) Format(entry LogEntry) string {
 			}
 			buf = append(buf, '\n')
 			buf = append(buf, []byte(lef.indent)...)
-			buf = append(buf, []byte(entry.AssociatedError().Error())...)
+			buf = append(buf, []byte(lef.content(entry.AssociatedError().Error()))...)
+			// The causes, each indented by its depth in the chain.
+			for _, cause := range unwindError(entry.AssociatedError())[1:] {
+				buf = append(buf, '\n')
+				buf = append(buf, []byte(strings.Repeat(lef.indent, cause.depth+1))...)
+				buf = append(buf, []byte(lef.content(cause.err.Error()))...)
+			}
 		} else {
 			fsep()
-			buf = append(buf, []byte(entry.AssociatedError().Error())...)
+			buf = append(buf, []byte(lef.content(entry.AssociatedError().Error()))...)
 		}
 	}
 	if lef.flags & PrintStackTrace != 0 && entry.HasTrace() {
@@ -174,6 +219,47 @@ func (lef *stdLogEntryFormatter) Format(entry LogEntry) string {
 	return string(buf)
 }
 
+// The metadata the flags select, in order, which the entry has.
+func (lef *stdLogEntryFormatter) metadata(entry LogEntry) []string {
+	te, ok := entry.(TemplatedLogEntry)
+	if !ok {
+		return nil
+	}
+	props := te.Properties()
+	var res []string
+	for _, m := range []struct {
+		flag StandardLogFormatterFlags
+		key string
+	}{
+		{PrintHost, HostProperty},
+		{PrintPID, PIDProperty},
+		{PrintGoroutine, GoroutineProperty},
+		{PrintService, ServiceProperty},
+	} {
+		value, has := props[m.key]
+		if lef.flags & m.flag == 0 || !has {
+			continue
+		}
+		str := fmt.Sprint(value)
+		if version, has := props[VersionProperty]; has && m.flag == PrintService {
+			str += fmt.Sprintf("@%v", version)
+		}
+		res = append(res, str)
+	}
+	return res
+}
+
+func (lef *stdLogEntryFormatter) content(str string) string {
+	switch {
+	case lef.flags & MarkContinuations != 0:
+		str = Sanitize(str, SanitizePolicy{AllowNewlines: true, AllowTabs: true})
+		return strings.Replace(str, "\n", "\n" + lef.indent + "> ", -1)
+	case lef.flags & EscapeContent != 0:
+		return Sanitize(str, DefaultSanitizePolicy)
+	}
+	return str
+}
+
 func (lef *stdLogEntryFormatter) SetFlags(flags StandardLogFormatterFlags) {
 	lef.flags = lef.flags | flags
 }
@@ -218,23 +304,108 @@ func (lef *stdLogEntryFormatter) SetLevelColorPrefix(level LogLevel, prefix Colo
 	lef.colorPrefixes[level] = prefix
 }
 
+func (lef *stdLogEntryFormatter) Locale() *Locale {
+	if lef.locale == nil {
+		return LocaleEnglish
+	}
+	return lef.locale
+}
+
+func (lef *stdLogEntryFormatter) SetLocale(locale *Locale) {
+	lef.locale = locale
+}
+
 type writerLogger struct {
+	lock chan bool
 	formatter LogEntryFormatter
 	out io.Writer
 	name string
+	opts WriterOptions
+	buffer *bufio.Writer
+	headerWritten bool
+	closing int32
+	closed bool
+	outClosed int32
 }
 
+// Writes to the console in place of a captured stdout or stderr, resolved
+// on each write since capture can start and stop while output is buffered.
+type consoleWriter struct {
+	w io.Writer
+}
+
+func (cw consoleWriter) Write(p []byte) (int, error) {
+	return ConsoleWriter(cw.w).Write(p)
+}
+
+// NewWriterLogger writes each entry formatted by formatter to writer.  A
+// nil formatter is replaced by a standard formatter configured as the
+// global context's default is, with color if writer is a terminal.
 func NewWriterLogger(name string, writer io.Writer, formatter LogEntryFormatter) LogListener {
-	return &writerLogger{
+	return NewWriterLoggerOpts(name, writer, formatter, WriterOptions{})
+}
+
+func NewWriterLoggerOpts(name string, writer io.Writer, formatter LogEntryFormatter, opts WriterOptions) LogListener {
+	if formatter == nil {
+		std := NewLogEntryFormatter()
+		if DetectColor(writer) != NoColor {
+			std.SetFlags(PrintColor)
+		}
+		formatter = std
+	}
+	wl := &writerLogger{
+		lock: make(chan bool, 1),
 		formatter: formatter,
 		out: writer,
 		name: name,
+		opts: opts,
 	}
+	if opts.BufferSize > 0 {
+		wl.buffer = bufio.NewWriterSize(consoleWriter{writer}, opts.BufferSize)
+	}
+	wl.lock <- true
+	return wl
 }
 
 func (wl *writerLogger) Receive(entry LogEntry) {
+	wl.TryReceive(entry)
+}
+
+func (wl *writerLogger) TryReceive(entry LogEntry) error {
 	str := wl.formatter.Format(entry)
-	wl.out.Write([]byte(str))
+	recordFormattedSize(entry, len(str))
+	<-wl.lock
+	if wl.closed {
+		wl.lock <- true
+		return ErrListenerClosed
+	}
+	if !wl.headerWritten {
+		wl.headerWritten = true
+		if hf, ok := wl.formatter.(HeaderFormatter); ok {
+			str = hf.Header() + str
+		}
+	}
+	// Formatters which write nothing for an entry are not an error.
+	if str == "" {
+		wl.lock <- true
+		return nil
+	}
+	var err error
+	if wl.buffer != nil {
+		_, err = wl.buffer.WriteString(str)
+	} else {
+		_, err = ConsoleWriter(wl.out).Write([]byte(str))
+	}
+	wl.lock <- true
+	return wl.error(err)
+}
+
+// Called without the lock held, so OnError may log.
+func (wl *writerLogger) error(err error) error {
+	if err != nil && wl.opts.OnError != nil {
+		wl.opts.OnError(err)
+	}
+	return err
 }
 
 func (wl *writerLogger) Name() string {
@@ -242,12 +413,51 @@ func (wl *writerLogger) Name() string {
 }
 
 func (wl *writerLogger) Close() error {
-	if wc, ok := wl.out.(io.WriteCloser); ok {
-		return wc.Close()
+	if !beginClose(&wl.closing) {
+		return nil
+	}
+	// Closing the writer unblocks a write stalled on it.
+	var interrupted error
+	acquireForClose(wl.lock, func() { interrupted = wl.closeOut() })
+	wl.closed = true
+	var err error
+	if wl.buffer != nil {
+		err = wl.buffer.Flush()
+	}
+	if fl, ok := wl.out.(interface{ Flush() error }); ok && err == nil {
+		err = fl.Flush()
+	}
+	wl.lock <- true
+	wl.error(err)
+	return errors.Join(err, interrupted, wl.closeOut())
+}
+
+// Closes the writer once, if it is closable.
+func (wl *writerLogger) closeOut() error {
+	wc, ok := wl.out.(io.WriteCloser)
+	if !ok || !atomic.CompareAndSwapInt32(&wl.outClosed, 0, 1) {
+		return nil
 	}
-	return nil
+	return wc.Close()
 }
 
 func (wl *writerLogger) Formatter() LogEntryFormatter {
 	return wl.formatter
-}
\ No newline at end of file
+}
+
+func (wl *writerLogger) Flush() error {
+	<-wl.lock
+	if wl.closed {
+		wl.lock <- true
+		return nil
+	}
+	var err error
+	if wl.buffer != nil {
+		err = wl.buffer.Flush()
+	}
+	if fl, ok := wl.out.(interface{ Flush() error }); ok && err == nil {
+		err = fl.Flush()
+	}
+	wl.lock <- true
+	return wl.error(err)
+}
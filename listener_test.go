@@ -0,0 +1,99 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Writes in small pieces, so that unsynchronized writers would interleave.
+type choppyWriter struct {
+	buf bytes.Buffer
+}
+
+func (cw *choppyWriter) Write(p []byte) (int, error) {
+	for i := range p {
+		cw.buf.WriteByte(p[i])
+	}
+	return len(p), nil
+}
+
+func TestWriterLoggerOptions(t *testing.T) {
+	out := &choppyWriter{}
+	wl := NewWriterLoggerOpts("buffered", out, nil, WriterOptions{BufferSize: 1 << 16})
+	ctx := CreateLoggingContext()
+	ctx.AddGlobalLogListener(wl, Trace)
+	stream, _ := ctx.Stream("writer")
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				stream.Logf(Info, "worker %d entry %d", w, i)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if out.buf.Len() != 0 {
+		t.Errorf("expected output to be buffered until flushed")
+	}
+	if err := wl.(Flusher).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.buf.String()), "\n")
+	if len(lines) != 400 {
+		t.Fatalf("expected 400 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var w, i int
+		if _, err := fmt.Sscanf(line[strings.Index(line, "worker"):], "worker %d entry %d", &w, &i); err != nil {
+			t.Fatalf("interleaved line %q", line)
+		}
+	}
+
+	var reported []error
+	failing := NewWriterLoggerOpts("failing", failingWriter{}, nil, WriterOptions{OnError: func(err error) {
+		reported = append(reported, err)
+	}})
+	stream.AddLogListener(failing, Trace)
+	stream.Log(Info, "lost")
+	if len(reported) != 1 || reported[0].Error() != "disk full" {
+		t.Errorf("expected the write error reported, got %v", reported)
+	}
+}
+
+func TestFormatterContentEscaping(t *testing.T) {
+	entry := func(message string, err error) LogEntry {
+		return &stdLogEntry{stream: &stdLogStream{name: "web"}, level: Warning, message: message, associatedError: err}
+	}
+	hostile := entry("user said hi\n\x1b[31mFATAL forged", errors.New("bad\x1b[2J"))
+	clean := entry("user said hi", errors.New("bad"))
+	for _, c := range []struct {
+		flag    StandardLogFormatterFlags
+		message string
+		err     string
+		lines   int
+	}{
+		{EscapeContent, `user said hi\n\x1b[31mFATAL forged`, `bad\x1b[2J`, 2},
+		{MarkContinuations, "user said hi\n   > \\x1b[31mFATAL forged", `bad\x1b[2J`, 3},
+	} {
+		lef := NewLogEntryFormatter()
+		lef.ClearFlags(PrintTime | PrintFileLine | PrintStackTrace | PrintStreamName | PrintLevel)
+		lef.SetFlags(PrintColor | c.flag)
+		got := lef.Format(hostile)
+		if !strings.Contains(got, c.message) || !strings.Contains(got, c.err) {
+			t.Errorf("flag %d: content not escaped in %q", c.flag, got)
+		}
+		if n := strings.Count(got, "\n"); n != c.lines {
+			t.Errorf("flag %d: expected %d newlines, got %d in %q", c.flag, c.lines, n, got)
+		}
+		// The formatter's own color sequences are untouched.
+		if esc, want := strings.Count(got, "\x1b"), strings.Count(lef.Format(clean), "\x1b"); esc != want || want == 0 {
+			t.Errorf("flag %d: expected %d escape sequences, got %d in %q", c.flag, want, esc, got)
+		}
+	}
+}
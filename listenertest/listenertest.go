@@ -0,0 +1,368 @@
+// Package listenertest exercises LogListener implementations against the
+// package's delivery semantics: Receive() is called concurrently from any
+// goroutine, entries may be malformed or extreme, Close() may race with
+// deliveries still in progress (later deliveries must be tolerated, if
+// dropped), and listeners may be delivered to from inside another
+// listener's Receive().  A listener which panics, deadlocks or fails to
+// close under any of these fails the check:
+//
+//	func TestListener(t *testing.T) {
+//		listenertest.Check(t, func() log.LogListener {
+//			return NewMyListener("test")
+//		}, listenertest.Options{})
+//	}
+//
+// EntryFromBytes turns arbitrary bytes into an entry, for fuzz targets:
+//
+//	func FuzzListener(f *testing.F) {
+//		ll := NewMyListener("fuzz")
+//		f.Fuzz(func(t *testing.T, data []byte) {
+//			if err := listenertest.Deliver(ll, listenertest.EntryFromBytes(data)); err != nil {
+//				t.Fatal(err)
+//			}
+//		})
+//	}
+package listenertest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dtromb/log"
+	"github.com/dtromb/log/formattertest"
+)
+
+type Options struct {
+	// Goroutines delivering concurrently (default 8).
+	Goroutines int
+	// Entries delivered by each goroutine (default 200).
+	Entries int
+	// RandomEntries is the number of EntryFromBytes entries delivered
+	// (default 500).
+	RandomEntries int
+	// Seed for the random entries (default 1).
+	Seed int64
+	// Timeout bounds each step; a step exceeding it is reported as a
+	// deadlock (default 10s).
+	Timeout time.Duration
+}
+
+///
+
+func (opts *Options) defaults() {
+	if opts.Goroutines <= 0 {
+		opts.Goroutines = 8
+	}
+	if opts.Entries <= 0 {
+		opts.Entries = 200
+	}
+	if opts.RandomEntries <= 0 {
+		opts.RandomEntries = 500
+	}
+	if opts.Seed == 0 {
+		opts.Seed = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+}
+
+type entry struct {
+	ts         time.Time
+	stream     string
+	level      log.LogLevel
+	message    string
+	err        error
+	trace      []*log.StackTraceEntry
+	template   string
+	properties map[string]interface{}
+}
+
+func (e *entry) LogTime() time.Time            { return e.ts }
+func (e *entry) Stream() string                { return e.stream }
+func (e *entry) Level() log.LogLevel           { return e.level }
+func (e *entry) Message() string               { return e.message }
+func (e *entry) HasAssociatedError() bool      { return e.err != nil }
+func (e *entry) AssociatedError() error        { return e.err }
+func (e *entry) HasTrace() bool                { return e.trace != nil }
+func (e *entry) Trace() []*log.StackTraceEntry { return e.trace }
+func (e *entry) MessageTemplate() string       { return e.template }
+func (e *entry) Properties() map[string]interface{} {
+	res := make(map[string]interface{}, len(e.properties))
+	for k, v := range e.properties {
+		res[k] = v
+	}
+	return res
+}
+
+// Reads successive fields from fuzz input; exhausted input reads as zeros.
+type byteReader struct {
+	data []byte
+}
+
+func (br *byteReader) byte() byte {
+	if len(br.data) == 0 {
+		return 0
+	}
+	b := br.data[0]
+	br.data = br.data[1:]
+	return b
+}
+
+func (br *byteReader) string() string {
+	n := int(br.byte())
+	if n > len(br.data) {
+		n = len(br.data)
+	}
+	s := string(br.data[:n])
+	br.data = br.data[n:]
+	return s
+}
+
+// EntryFromBytes builds an entry from arbitrary input: every input, including
+// an empty one, gives a valid (if strange) LogEntry, with any level value,
+// times from the zero time to the far future, arbitrary bytes in its
+// strings, and optional errors, traces and template properties.
+func EntryFromBytes(data []byte) log.LogEntry {
+	br := &byteReader{data: data}
+	flags := br.byte()
+	e := &entry{
+		level: log.LogLevel(br.byte()),
+	}
+	if flags&1 != 0 {
+		var sec int64
+		for i := 0; i < 5; i++ {
+			sec = sec<<8 | int64(br.byte())
+		}
+		e.ts = time.Unix(sec-1<<38, int64(br.byte())*1000003).In(time.FixedZone("", (int(br.byte())-128)*60))
+	}
+	e.stream = br.string()
+	e.message = br.string()
+	if flags&2 != 0 {
+		e.err = errors.New(br.string())
+	}
+	if flags&4 != 0 {
+		e.trace = make([]*log.StackTraceEntry, int(br.byte())*4)
+		for i := range e.trace {
+			e.trace[i] = log.NewStackTraceEntry(0, br.string(), int(br.byte())-1)
+		}
+	}
+	if flags&8 != 0 {
+		e.template = br.string()
+		e.properties = make(map[string]interface{})
+		for n := br.byte() % 16; n > 0; n-- {
+			name := br.string()
+			switch br.byte() % 5 {
+			case 0:
+				e.properties[name] = nil
+			case 1:
+				e.properties[name] = int(int8(br.byte()))
+			case 2:
+				e.properties[name] = br.string()
+			case 3:
+				e.properties[name] = []byte(br.string())
+			default:
+				e.properties[name] = map[string]interface{}{br.string(): br.string()}
+			}
+		}
+	}
+	if flags&16 != 0 {
+		e.message += string(make([]byte, int(br.byte())<<10))
+	}
+	return e
+}
+
+// Deliver delivers an entry through log.DeliverEntry, returning a panic as
+// an error.
+func Deliver(ll log.LogListener, entry log.LogEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("listener panicked: %v", r)
+		}
+	}()
+	log.DeliverEntry(entry, []log.LogListener{ll})
+	return nil
+}
+
+// Runs fn, failing the test if it panics or takes longer than the timeout.
+func step(t *testing.T, what string, timeout time.Duration, fn func() error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panicked: %v", r)
+			}
+		}()
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("%s: %s", what, err.Error())
+		}
+	case <-time.After(timeout):
+		buf := make([]byte, 1<<20)
+		buf = buf[:runtime.Stack(buf, true)]
+		t.Fatalf("%s: no progress after %s, deadlocked?\n%s", what, timeout, buf)
+	}
+}
+
+func closeListener(t *testing.T, ll log.LogListener, opts Options) {
+	step(t, "Close", opts.Timeout, func() error {
+		if f, ok := ll.(log.Flusher); ok {
+			f.Flush()
+		}
+		ll.Close()
+		return nil
+	})
+}
+
+// Check runs the conformance battery, each part in a subtest with a fresh
+// listener from newListener.  Errors returned by Close(), Flush() and
+// TryReceive() are not failures - a listener may legitimately refuse
+// entries (after Close(), for instance) - but panics and deadlocks are.
+func Check(t *testing.T, newListener func() log.LogListener, opts Options) {
+	opts.defaults()
+	t.Run("name", func(t *testing.T) {
+		ll := newListener()
+		if ll.Name() == "" || ll.Name() != ll.Name() {
+			t.Errorf("listener name %q is empty or unstable", ll.Name())
+		}
+		closeListener(t, ll, opts)
+	})
+	t.Run("canonical-entries", func(t *testing.T) {
+		ll := newListener()
+		for _, c := range formattertest.Entries() {
+			c := c
+			step(t, c.Name, opts.Timeout, func() error {
+				return Deliver(ll, c.Entry)
+			})
+		}
+		closeListener(t, ll, opts)
+	})
+	t.Run("random-entries", func(t *testing.T) {
+		ll := newListener()
+		r := rand.New(rand.NewSource(opts.Seed))
+		step(t, "random entries", opts.Timeout, func() error {
+			for i := 0; i < opts.RandomEntries; i++ {
+				data := make([]byte, r.Intn(512))
+				r.Read(data)
+				if err := Deliver(ll, EntryFromBytes(data)); err != nil {
+					return fmt.Errorf("entry from %x: %s", data, err.Error())
+				}
+			}
+			return nil
+		})
+		closeListener(t, ll, opts)
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		ll := newListener()
+		step(t, "concurrent delivery", opts.Timeout, func() error {
+			return deliverConcurrently(ll, opts, nil)
+		})
+		closeListener(t, ll, opts)
+	})
+	t.Run("close-during-receive", func(t *testing.T) {
+		ll := newListener()
+		closing := make(chan bool)
+		step(t, "close during delivery", opts.Timeout, func() error {
+			var closeErr error
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					if r := recover(); r != nil {
+						closeErr = fmt.Errorf("Close panicked: %v", r)
+					}
+				}()
+				<-closing
+				ll.Close()
+			}()
+			err := deliverConcurrently(ll, opts, closing)
+			wg.Wait()
+			if err == nil {
+				err = closeErr
+			}
+			return err
+		})
+		step(t, "second Close", opts.Timeout, func() error {
+			ll.Close()
+			return nil
+		})
+	})
+	t.Run("reentrant", func(t *testing.T) {
+		ll := newListener()
+		step(t, "reentrant delivery", opts.Timeout, func() error {
+			return deliverReentrantly(ll, opts)
+		})
+		closeListener(t, ll, opts)
+	})
+}
+
+// Delivers from opts.Goroutines goroutines at once; closing, if given, is
+// closed halfway through.
+func deliverConcurrently(ll log.LogListener, opts Options, closing chan bool) error {
+	cases := formattertest.Entries()
+	errs := make(chan error, opts.Goroutines)
+	var once sync.Once
+	var wg sync.WaitGroup
+	for g := 0; g < opts.Goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < opts.Entries; i++ {
+				if closing != nil && g == 0 && i == opts.Entries/2 {
+					once.Do(func() { close(closing) })
+				}
+				if err := Deliver(ll, cases[(g+i)%len(cases)].Entry); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if closing != nil {
+		once.Do(func() { close(closing) })
+	}
+	close(errs)
+	return <-errs
+}
+
+// A relay logs each entry it receives back into the context, so that the
+// listener under test receives entries from inside another listener's
+// Receive(), and the relay's own reentrant deliveries are bypassed.
+type relayListener struct {
+	stream log.LogStream
+}
+
+func (rl *relayListener) Name() string {
+	return "listenertest-relay"
+}
+
+func (rl *relayListener) Receive(entry log.LogEntry) {
+	rl.stream.Log(log.Info, "relayed: "+entry.Message())
+}
+
+func (rl *relayListener) Close() error {
+	return nil
+}
+
+func deliverReentrantly(ll log.LogListener, opts Options) error {
+	ctx := log.CreateLoggingContext()
+	stream, _ := ctx.Stream("listenertest")
+	relayed, _ := ctx.Stream("listenertest-relayed")
+	ctx.AddGlobalLogListener(&relayListener{stream: relayed}, log.Trace)
+	ctx.AddGlobalLogListener(ll, log.Trace)
+	defer ctx.RemoveGlobalLogListener(ll)
+	for i := 0; i < opts.Entries; i++ {
+		stream.Log(log.Info, fmt.Sprintf("entry %d", i))
+	}
+	return nil
+}
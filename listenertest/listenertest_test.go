@@ -0,0 +1,47 @@
+package listenertest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dtromb/log"
+)
+
+func TestPackageListeners(t *testing.T) {
+	dir := t.TempDir()
+	listeners := map[string]func() log.LogListener{
+		"writer": func() log.LogListener {
+			return log.NewWriterLogger("writer", ioutil.Discard, log.NewLogEntryFormatter())
+		},
+		"file": func() log.LogListener {
+			fl, err := log.NewFileListener("file", filepath.Join(dir, "test.log"), log.NewLogEntryFormatter())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fl
+		},
+		"async": func() log.LogListener {
+			target := log.NewWriterLogger("target", ioutil.Discard, log.NewCSVFormatter())
+			return log.NewAsyncListener("async", target, log.AsyncOptions{QueueSize: 64})
+		},
+		"sanitizing": func() log.LogListener {
+			target := log.NewWriterLogger("target", ioutil.Discard, log.NewLogEntryFormatter())
+			return log.NewSanitizingListener(target, log.DefaultSanitizePolicy)
+		},
+		"multiwriter": func() log.LogListener {
+			return log.NewMultiWriterListener("multiwriter", nil,
+				log.Destination{Name: "console", Writer: ioutil.Discard, Level: log.Warning},
+				log.Destination{Name: "file", Writer: ioutil.Discard, Level: log.Trace})
+		},
+		"assembler": func() log.LogListener {
+			target := log.NewWriterLogger("target", ioutil.Discard, log.NewLogEntryFormatter())
+			return log.NewRequestAssembler("assembler", target, log.AssemblerOptions{})
+		},
+	}
+	for name, newListener := range listeners {
+		t.Run(name, func(t *testing.T) {
+			Check(t, newListener, Options{Entries: 50, RandomEntries: 200})
+		})
+	}
+}
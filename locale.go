@@ -0,0 +1,142 @@
+package log
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locales render level names and timestamps for user-facing output; a nil
+// *Locale behaves as LocaleEnglish.
+type Locale struct {
+	Name             string
+	LevelNames       map[LogLevel]string
+	MonthNames       [12]string
+	ShortMonthNames  [12]string
+	DayNames         [7]string
+	ShortDayNames    [7]string
+	DecimalSeparator string
+}
+
+var LocaleEnglish = &Locale{
+	Name:             "en",
+	MonthNames:       [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	ShortMonthNames:  [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	DayNames:         [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	ShortDayNames:    [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	DecimalSeparator: ".",
+}
+
+var LocaleGerman = &Locale{
+	Name: "de",
+	LevelNames: map[LogLevel]string{
+		FatalError: "Fataler Fehler",
+		Error:      "Fehler",
+		Error2:     "Fehler-2",
+		Error3:     "Fehler-3",
+		Warning:    "Warnung",
+		Warning2:   "Warnung-2",
+		Warning3:   "Warnung-3",
+	},
+	MonthNames:       [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+	ShortMonthNames:  [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+	DayNames:         [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+	ShortDayNames:    [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+	DecimalSeparator: ",",
+}
+
+var LocaleFrench = &Locale{
+	Name: "fr",
+	LevelNames: map[LogLevel]string{
+		FatalError: "Erreur fatale",
+		Error:      "Erreur",
+		Error2:     "Erreur-2",
+		Error3:     "Erreur-3",
+		Warning:    "Avertissement",
+		Warning2:   "Avertissement-2",
+		Warning3:   "Avertissement-3",
+		Debug:      "Débogage",
+		Debug2:     "Débogage-2",
+		Debug3:     "Débogage-3",
+		Debug4:     "Débogage-4",
+		Debug5:     "Débogage-5",
+		Trace:      "Trace",
+	},
+	MonthNames:       [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+	ShortMonthNames:  [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+	DayNames:         [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+	ShortDayNames:    [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	DecimalSeparator: ",",
+}
+
+func (loc *Locale) LevelName(level LogLevel) string {
+	if loc != nil {
+		if name, has := loc.LevelNames[level]; has {
+			return name
+		}
+	}
+	return level.String()
+}
+
+// FormatTime formats t according to a time.Format layout, substituting the
+// locale's month and day names and decimal separator.
+func (loc *Locale) FormatTime(t time.Time, layout string) string {
+	if loc == nil || loc == LocaleEnglish {
+		return t.Format(layout)
+	}
+	if loc.DecimalSeparator == "," {
+		layout = localizeFractionLayout(layout)
+	}
+	var buf []byte
+	start := 0
+	for i := 0; i < len(layout); {
+		var name string
+		var n int
+		switch {
+		case strings.HasPrefix(layout[i:], "January"):
+			name, n = loc.MonthNames[t.Month()-1], 7
+		case strings.HasPrefix(layout[i:], "Jan"):
+			name, n = loc.ShortMonthNames[t.Month()-1], 3
+		case strings.HasPrefix(layout[i:], "Monday"):
+			name, n = loc.DayNames[t.Weekday()], 6
+		case strings.HasPrefix(layout[i:], "Mon"):
+			name, n = loc.ShortDayNames[t.Weekday()], 3
+		default:
+			i++
+			continue
+		}
+		if i > start {
+			buf = append(buf, []byte(t.Format(layout[start:i]))...)
+		}
+		buf = append(buf, []byte(name)...)
+		i += n
+		start = i
+	}
+	if start < len(layout) {
+		buf = append(buf, []byte(t.Format(layout[start:]))...)
+	}
+	return string(buf)
+}
+
+func (loc *Locale) FormatFloat(f float64, prec int) string {
+	str := strconv.FormatFloat(f, 'f', prec, 64)
+	if loc != nil && loc.DecimalSeparator != "" && loc.DecimalSeparator != "." {
+		str = strings.Replace(str, ".", loc.DecimalSeparator, 1)
+	}
+	return str
+}
+
+// Fractional seconds in a layout ("05.000") are rendered with a comma
+// separator when written as "05,000".
+func localizeFractionLayout(layout string) string {
+	var buf []byte
+	for i := 0; i < len(layout); i++ {
+		if layout[i] == '.' && i >= 2 && layout[i-2:i] == "05" && i+1 < len(layout) &&
+			(layout[i+1] == '0' || layout[i+1] == '9') {
+			buf = append(buf, ',')
+			continue
+		}
+		buf = append(buf, layout[i])
+	}
+	return string(buf)
+}
@@ -0,0 +1,29 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocaleFormatTime(t *testing.T) {
+	ts := time.Date(2017, time.March, 5, 14, 7, 9, 123000000, time.UTC)
+	if str := LocaleGerman.FormatTime(ts, "Monday, 2. January 2006 15:04:05.000"); str != "Sonntag, 5. März 2017 14:07:09,123" {
+		t.Errorf("unexpected german rendering: %q", str)
+	}
+	if str := LocaleFrench.FormatTime(ts, "Mon 2 Jan"); str != "dim. 5 mars" {
+		t.Errorf("unexpected french rendering: %q", str)
+	}
+	var nilLocale *Locale
+	if str := nilLocale.FormatTime(ts, time.RFC3339); str != ts.Format(time.RFC3339) {
+		t.Errorf("nil locale should use english rendering, got %q", str)
+	}
+	if name := LocaleGerman.LevelName(Warning); name != "Warnung" {
+		t.Errorf("unexpected level name: %q", name)
+	}
+	if name := LocaleGerman.LevelName(Info); name != "Info" {
+		t.Errorf("missing level names should fall back to english, got %q", name)
+	}
+	if str := LocaleFrench.FormatFloat(3.25, 2); str != "3,25" {
+		t.Errorf("unexpected float rendering: %q", str)
+	}
+}
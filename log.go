@@ -1,7 +1,11 @@
 package log
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sync/atomic"
 	"time"
 )
 
@@ -35,9 +39,42 @@ type LoggingContext interface {
 	DebuggingEnabled() bool
 	EnableDebugging(val bool)
 }
+
+type StandardLoggingContext interface {
+	LoggingContext
+	Flush() error
+	Reopen() error
+	SetFallbackPolicy(policy *FallbackPolicy)
+	Streams() []LogStream
+	Filters() FilterSet
+	SetLevelOverride(stream string, level LogLevel) error
+	ClearLevelOverride(stream string) error
+	LevelOverrides() map[string]LogLevel
+	SetLevelStore(store LevelStore) error
+	RecordDispatch(w io.Writer) DispatchRecorder
+	Explain(stream string, level LogLevel) RoutingExplanation
+	SetStreamSchema(stream string, schema *Schema)
+	StreamSchema(stream string) *Schema
+	SetErrorLevelRules(rules ...ErrorLevelRule)
+	ErrorLevelRules() []ErrorLevelRule
+	SetErrorAnnotation(enabled bool)
+	ErrorAnnotation() bool
+	SetProfilerLabels(enabled bool)
+	ProfilerLabels() bool
+	EnableSequences(store SequenceStore) error
+	SequenceError() error
+	SetMetadataProviders(providers ...MetadataProvider)
+	MetadataProviders() []MetadataProvider
+	SetStreamLevel(pattern string, level LogLevel)
+	StreamLevels() map[string]LogLevel
+}
+
 type Log interface {
 	Log(level LogLevel, msg string)
 	Logf(level LogLevel, format string, args ...interface{})
+	LogTemplate(level LogLevel, template string, args ...interface{})
+	LogContext(ctx context.Context, level LogLevel, msg string)
+	LogContextf(ctx context.Context, level LogLevel, format string, args ...interface{})
 	LogTrace(level LogLevel, msg string)
 	LogTracef(level LogLevel, format string, args ...interface{})
 	Fatal(msg string)
@@ -60,6 +97,15 @@ type Log interface {
 	DebugTracef(format string, args ...interface{})
 	Trace(msg string)
 	Tracef(format string, args ...interface{})
+	// LogLazy logs the message fn returns, calling fn only if some
+	// listener will receive the entry.
+	LogLazy(level LogLevel, fn func() string)
+	InfoLazy(fn func() string)
+	DebugLazy(fn func() string)
+	TraceLazy(fn func() string)
+	// With returns a Log whose entries carry the field, in addition to
+	// any this one's carry.
+	With(key string, value interface{}) Log
 }
 
 type LogStream interface {
@@ -72,8 +118,15 @@ type LogStream interface {
 	SetDefaultLogListenerLevel(level LogLevel)
 	AddLogListener(logListener LogListener, level LogLevel)
 	RemoveLogListener(logListener LogListener)
+	Tee(writer io.Writer, formatter LogEntryFormatter) (detach func())
+	WithFields(fields map[string]interface{}) Log
+	Stats() StreamStats
 	TracesByDefault() bool
 	SetTracesByDefault(traces bool)
+	Prefix() string
+	SetPrefix(prefix string)
+	Timed(level LogLevel, name string) func()
+	DebugHex(label string, data []byte)
 	IsActive() bool
 	Shutdown()
 }
@@ -120,8 +173,9 @@ func (ll LogLevel) String() string {
 		case	 Debug5: return "Debug-5"
 		case	 Trace: return "Trace"
 		case	 None: return "None"
+		case	 Default: return "Default"
 	}
-	panic("invalid log level")
+	return fmt.Sprintf("Level(%d)", uint8(ll))
 }
 
 func (ll LogLevel) IsFatal() bool {
@@ -171,10 +225,45 @@ func (ll LogLevel) IsTrace() bool {
 	return ll == Trace
 }
 
+// Severity ranks levels from Trace (1) to FatalError (16), independently of
+// the order they are declared in.  As thresholds, All ranks below every
+// level and None above; Default, which stands for another level, and
+// unknown levels rank with None.
+func (ll LogLevel) Severity() int {
+	switch {
+	case ll == All:
+		return 0
+	case ll >= FatalError && ll <= Trace:
+		return int(Trace) + 1 - int(ll)
+	}
+	return int(Trace) + 1
+}
+
+// Compare returns -1, 0 or 1 as a is less severe than, as severe as or more
+// severe than b.
+func Compare(a, b LogLevel) int {
+	sa, sb := a.Severity(), b.Severity()
+	switch {
+	case sa < sb:
+		return -1
+	case sa > sb:
+		return 1
+	}
+	return 0
+}
+
+// Whether a threshold admits entries at level: those at least as severe,
+// and those logged at All, which every threshold admits.
+func admits(threshold, level LogLevel) bool {
+	return level == All || Compare(level, threshold) >= 0
+}
+
 
 ///
 
 type stdLoggingContext struct {
+	// Entries dispatched, first for atomic access on 32-bit platforms.
+	dispatched uint64
 	lock chan bool
 	debugging bool
 	streams map[string]*stdLogStream
@@ -182,6 +271,21 @@ type stdLoggingContext struct {
 	defaultListenerLevel LogLevel
 	listeners map[LogListener]LogLevel
 	traces bool
+	fallback *fallbackWriter
+	filters *filterSet
+	overrides map[string]LogLevel
+	streamLevels map[string]LogLevel
+	levelStore LevelStore
+	// Serializes changes to the overrides with their saves.
+	saveLock chan bool
+	recorder dispatchSink
+	schemas map[string]*Schema
+	schemaReported map[string]bool
+	errorRules []ErrorLevelRule
+	annotateErrors bool
+	profilerLabels bool
+	sequences *sequencer
+	metadata []MetadataProvider
 }
 
 type stdLogStream struct {
@@ -193,6 +297,8 @@ type stdLogStream struct {
 	listeners map[LogListener]LogLevel
 	traces bool
 	active bool
+	stats *StreamStatsCounter
+	prefix string
 }
 
 type stdLogEntry struct {
@@ -202,16 +308,30 @@ type stdLogEntry struct {
 	message string
 	associatedError error
 	stackTrace []*StackTraceEntry	
-}
-
-func CreateLoggingContext() LoggingContext {
+	template *stdMessageTemplate
+	// The format string of a Logf-style entry.
+	format string
+	properties map[string]interface{}
+	imported *importedTime
+	seq uint64
+	cseq uint64
+	fields map[string]interface{}
+	prefix string
+}
+
+func CreateLoggingContext() StandardLoggingContext {
 	ctx := &stdLoggingContext{
 		lock: make(chan bool, 1),
 		streams: make(map[string]*stdLogStream),
 		defaultLogLevel: Info,
 		listeners: make(map[LogListener]LogLevel),
+		overrides: make(map[string]LogLevel),
+		saveLock: make(chan bool, 1),
 	}
+	ctx.filters = newFilterSet(ctx)
 	ctx.lock <- true
+	ctx.saveLock <- true
+	RegisterLoggingContext(ctx)
 	return ctx
 }
 
@@ -239,8 +359,10 @@ func (ctx *stdLoggingContext) Stream(key string) (LogStream, bool) {
 		listeners: make(map[LogListener]LogLevel),
 		traces: false,
 		active: true,
+		stats: NewStreamStatsCounter(key),
 	}
 	ns.lock <- true
+	ctx.streams[key] = ns
 	return ns, true
 }
 
@@ -316,6 +438,126 @@ func (ctx *stdLoggingContext) SetTracesByDefault(traces bool) {
 	ctx.traces = traces
 }
 
+func (ctx *stdLoggingContext) SetFallbackPolicy(policy *FallbackPolicy) {
+	<-ctx.lock 
+	defer func() { ctx.lock <- true }()
+	if policy == nil {
+		ctx.fallback = nil
+	} else {
+		ctx.fallback = newFallbackWriter(*policy)
+	}
+}
+
+func (ctx *stdLoggingContext) Streams() []LogStream {
+	<-ctx.lock 
+	defer func() { ctx.lock <- true }()
+	res := make([]LogStream, 0, len(ctx.streams))
+	for _, ls := range ctx.streams {
+		res = append(res, ls)
+	}
+	return res
+}
+
+func (ctx *stdLoggingContext) Filters() FilterSet {
+	return ctx.filters
+}
+
+func (ctx *stdLoggingContext) SetLevelOverride(stream string, level LogLevel) error {
+	if level == Default || level > None {
+		return fmt.Errorf("invalid level override for stream '%s'", stream)
+	}
+	<-ctx.saveLock
+	defer func() { ctx.saveLock <- true }()
+	<-ctx.lock 
+	ctx.overrides[stream] = level
+	return ctx.saveOverrides()
+}
+
+func (ctx *stdLoggingContext) ClearLevelOverride(stream string) error {
+	<-ctx.saveLock
+	defer func() { ctx.saveLock <- true }()
+	<-ctx.lock 
+	delete(ctx.overrides, stream)
+	return ctx.saveOverrides()
+}
+
+// Saves the overrides to the store, if any, and releases the lock.  The
+// caller holds saveLock across the change and the save, so that saves reach
+// the store in the order the changes were made.
+func (ctx *stdLoggingContext) saveOverrides() error {
+	store := ctx.levelStore
+	overrides := make(map[string]LogLevel, len(ctx.overrides))
+	for stream, level := range ctx.overrides {
+		overrides[stream] = level
+	}
+	ctx.lock <- true
+	if store == nil {
+		return nil
+	}
+	return store.Save(overrides)
+}
+
+func (ctx *stdLoggingContext) LevelOverrides() map[string]LogLevel {
+	<-ctx.lock 
+	defer func() { ctx.lock <- true }()
+	res := make(map[string]LogLevel, len(ctx.overrides))
+	for stream, level := range ctx.overrides {
+		res[stream] = level
+	}
+	return res
+}
+
+// SetLevelStore restores the overrides saved in store (replacing any set
+// so far), and saves later changes to it.
+func (ctx *stdLoggingContext) SetLevelStore(store LevelStore) error {
+	<-ctx.saveLock
+	defer func() { ctx.saveLock <- true }()
+	overrides := make(map[string]LogLevel)
+	if store != nil {
+		var err error
+		if overrides, err = store.Load(); err != nil {
+			return err
+		}
+	}
+	<-ctx.lock 
+	defer func() { ctx.lock <- true }()
+	ctx.levelStore = store
+	if store != nil {
+		ctx.overrides = overrides
+	}
+	return nil
+}
+
+func (ctx *stdLoggingContext) Flush() error {
+	err := flushListeners(ctx.allListeners())
+	return errors.Join(err, ctx.flushSequences())
+}
+
+func (ctx *stdLoggingContext) Reopen() error {
+	return reopenListeners(ctx.allListeners())
+}
+
+func (ctx *stdLoggingContext) allListeners() []LogListener {
+	<-ctx.lock 
+	listeners := make([]LogListener, 0, len(ctx.listeners))
+	for ll, _ := range ctx.listeners {
+		listeners = append(listeners, ll)
+	}
+	streams := make([]*stdLogStream, 0, len(ctx.streams))
+	for _, ls := range ctx.streams {
+		streams = append(streams, ls)
+	}
+	ctx.lock <- true
+	for _, ls := range streams {
+		<-ls.lock
+		for ll, _ := range ls.listeners {
+			listeners = append(listeners, ll)
+		}
+		ls.lock <- true
+	}
+	return listeners
+}
+
 func (ls *stdLogStream) Context() LoggingContext {
 	<-ls.lock 
 	defer func() { ls.lock <- true }()
@@ -359,6 +601,19 @@ func (ls *stdLogStream) RemoveLogListener(logListener LogListener) {
 	delete(ls.listeners, logListener)
 }
 
+func (ls *stdLogStream) Tee(writer io.Writer, formatter LogEntryFormatter) (detach func()) {
+	if formatter == nil {
+		formatter = NewLogEntryFormatter()
+	}
+	listener := NewWriterLogger(fmt.Sprintf("%s-tee", ls.name), writer, formatter)
+	ls.AddLogListener(listener, Default)
+	return func() { ls.RemoveLogListener(listener) }
+}
+
+func (ls *stdLogStream) Stats() StreamStats {
+	return ls.stats.Snapshot()
+}
+
 func (ls *stdLogStream) TracesByDefault() bool {
 	<-ls.lock 
 	defer func() { ls.lock <- true }()
@@ -385,14 +640,6 @@ func (ls *stdLogStream) Shutdown() {
 	panic("stdLogStream.Shutdown() unimplemented")
 }
 
-func lockChan(c chan bool) { <- c }
-func unlockChan(c chan bool) {
-	select {
-		case c <- true:
-		default: 
-	}
-}
-
 func (ls *stdLogStream) Log(level LogLevel, msg string) {
 	ls.dispatchLog(level, false, nil, msg)
 }
@@ -400,53 +647,275 @@ func (ls *stdLogStream) Logf(level LogLevel, format string, args ...interface{})
 	ls.dispatchLog(level, false, nil, format, args...)
 }
 
+func (ls *stdLogStream) LogTemplate(level LogLevel, template string, args ...interface{}) {
+	ls.dispatchTemplate(level, false, template, args)
+}
+
+func (ls *stdLogStream) LogContext(ctx context.Context, level LogLevel, msg string) {
+	ls.dispatchContext(ctx, level, msg, nil)
+}
+
+func (ls *stdLogStream) LogContextf(ctx context.Context, level LogLevel, format string, args ...interface{}) {
+	ls.dispatchContext(ctx, level, format, args)
+}
+
+// Each dispatch request passes through exactly one of the dispatchXXX()
+// helpers below on its way to dispatchEntry(), which keeps the stack depth
+// of the caller constant for trace generation.
+type dispatchRequest struct {
+	level LogLevel
+	generateTrace bool
+	err error
+	templated bool
+	format string
+	args []interface{}
+	verbosity LogLevel
+	correlation string
+	ctx context.Context
+	// Entries received over the wire, or replayed, are dispatched as
+	// they were built elsewhere.
+	received *wireEntry
+	replay *DispatchRecord
+	dryRun bool
+	// Imported entries carry the line's parsed time.
+	imported *ParsedLine
+	timeSource TimeSource
+	fields map[string]interface{}
+	lazy func() string
+}
+
+func (ls *stdLogStream) dispatchContext(ctx context.Context, level LogLevel, format string, args []interface{}) {
+	req := &dispatchRequest{
+		level: level,
+		format: format,
+		args: args,
+	}
+	if verbosity, has := VerbosityFromContext(ctx); has {
+		req.verbosity = verbosity
+	}
+	req.correlation, _ = CorrelationFromContext(ctx)
+	req.ctx = ctx
+	ls.dispatchEntry(req)
+}
+
+func (ls *stdLogStream) dispatchTemplate(level LogLevel, generateTrace bool, template string, args []interface{}) {
+	ls.dispatchEntry(&dispatchRequest{
+		level: level,
+		generateTrace: generateTrace,
+		templated: true,
+		format: template,
+		args: args,
+	})
+}
+
 func (ls *stdLogStream) dispatchLog(level LogLevel, generateTrace bool, setError error, format string, args ...interface{}) {
+	ls.dispatchEntry(&dispatchRequest{
+		level: level,
+		generateTrace: generateTrace,
+		err: setError,
+		format: format,
+		args: args,
+	})
+}
+
+func (ls *stdLogStream) dispatchImport(level LogLevel, templated bool, format string, args []interface{}, pl ParsedLine, source TimeSource) {
+	ls.dispatchEntry(&dispatchRequest{
+		level: level,
+		templated: templated,
+		format: format,
+		args: args,
+		imported: &pl,
+		timeSource: source,
+	})
+}
+
+func (ls *stdLogStream) dispatchEntry(req *dispatchRequest) {
+	if req.err != nil && req.received == nil {
+		req.level = ls.ctx.errorLevel(ls.name, req.err, req.level)
+	}
+	level := req.level
 	ts := time.Now()
+	if req.received != nil {
+		ts = req.received.ts
+	}
+	ls.stats.Record(level, ts)
 	// First assess interest - no point in doing the formatting
-	// if no loggers will receive.
-	lockChan(ls.lock)
-	defer unlockChan(ls.lock)
-	lockChan(ls.ctx.lock)
-	defer unlockChan(ls.ctx.lock)
+	// if no loggers will receive.  Both locks are released before any
+	// listener is called, so listeners may themselves log (or reconfigure
+	// the context) without deadlocking.
+	<-ls.lock
+	<-ls.ctx.lock
+	recorder := ls.ctx.recorder
+	verbosity := req.verbosity
+	if override, _, has := ls.ctx.resolveLevel(ls.name); has {
+		if !admits(override, level) {
+			prefix := ls.prefix
+			ls.ctx.lock <- true
+			ls.lock <- true
+			if recorder != nil {
+				entry := ls.buildEntry(req, ts, false)
+				if req.received == nil {
+					entry.prefix = prefix
+				}
+				dr := newDispatchRecord(entry)
+				dr.Dropped, dr.replayOf = "override", req.replay
+				recorder.record(dr)
+			}
+			return
+		}
+		if verbosity == All || Compare(override, verbosity) < 0 {
+			verbosity = override
+		}
+	}
 	interest := make([]LogListener, 0, 8)
+	verbose := verbosity != All && admits(verbosity, level)
 	for ll, lv := range ls.listeners {
-		if lv >= level || (lv == Default && ls.ctx.defaultListenerLevel <= level) || level == All {
+		if ListenerAccepts(lv, ls.ctx.defaultListenerLevel, level) || verbose {
 			interest = append(interest, ll)
 		}
 	}
 	for ll, lv := range ls.ctx.listeners {
-		//fmt.Printf("lv: %s level: %s show: ", lv.String(), level.String())
-		//fmt.Println(lv >= level)
-		if lv >= level || (lv == Default && ls.ctx.defaultListenerLevel <= level) || level == All {
+		if ListenerAccepts(lv, ls.ctx.defaultListenerLevel, level) || verbose {
 			interest = append(interest, ll)
 		}
 	}
-	unlockChan(ls.ctx.lock)
-	if len(interest) > 0 {
-		var msg string
-		if len(args) > 0 {
-			msg = fmt.Sprintf(format, args...)
-		} else {
-			msg = format
+	traces := ls.traces || ls.ctx.traces
+	prefix := ls.prefix
+	fallback := ls.ctx.fallback
+	schema := ls.ctx.schemas[ls.name]
+	annotate := ls.ctx.annotateErrors && req.received == nil
+	labels := ls.ctx.profilerLabels && req.ctx != nil
+	sequences := ls.ctx.sequences
+	var metadata []MetadataProvider
+	if req.received == nil {
+		metadata = ls.ctx.metadata
+	}
+	ancestors := ls.ctx.ancestorStreams(ls.name)
+	defaultListenerLevel := ls.ctx.defaultListenerLevel
+	ls.ctx.lock <- true
+	ls.lock <- true
+	for _, as := range ancestors {
+		interest = as.interest(interest, defaultListenerLevel, level, verbose)
+	}
+	var seq, cseq uint64
+	if sequences != nil && !req.dryRun {
+		seq = sequences.assign(ls.name)
+	}
+	if !req.dryRun {
+		cseq = atomic.AddUint64(&ls.ctx.dispatched, 1)
+	}
+	if len(interest) == 0 && recorder == nil {
+		return
+	}
+	entry := ls.buildEntry(req, ts, traces || req.generateTrace)
+	if req.received == nil {
+		entry.prefix = prefix
+	}
+	entry.seq, entry.cseq = seq, cseq
+	if annotate && entry.associatedError != nil {
+		annotateError(entry)
+	}
+	if labels {
+		addProperties(entry, ProfilerLabelFields(req.ctx))
+	}
+	if schema != nil && len(entry.properties) > 0 && ls.name != SchemaDiagnosticStream {
+		if violations := ls.ctx.enforceSchema(schema, entry); len(violations) > 0 {
+			defer ls.ctx.reportSchemaViolations(ls.name, violations)
 		}
-		entry := &stdLogEntry{
-			ts: ts,
-			stream: ls,
-			level: level,
-			message: msg,
+	}
+	for _, mp := range metadata {
+		addProperties(entry, mp.Metadata(entry))
+	}
+	var dr *DispatchRecord
+	if recorder != nil {
+		dr = newDispatchRecord(entry)
+		dr.Interested, dr.replayOf = listenerNames(interest), req.replay
+		defer recorder.record(dr)
+		if len(interest) == 0 {
+			dr.Dropped = "level"
+			return
+		}
+	}
+	interest, filter := ls.ctx.filters.apply(entry, interest)
+	if dr != nil {
+		dr.Filter, dr.Delivered = filter, listenerNames(interest)
+	}
+	if len(interest) == 0 {
+		if dr != nil {
+			dr.Dropped = "filter"
 		}
-		if ls.traces || ls.ctx.traces || generateTrace {
-			entry.stackTrace = GenerateStackTrace()
+		return
+	}
+	if req.dryRun {
+		return
+	}
+	failed, errs := deliverEntry(entry, interest)
+	if fallback != nil && len(errs) == len(interest) {
+		fallback.write(entry, errs)
+	}
+	if dr != nil {
+		dr.Failed = listenerNames(failed)
+		if req.received == nil {
+			dr.Delivery = time.Since(ts)
 		}
-		if setError != nil {
-			entry.associatedError = setError
+	}
+}
+
+func (ls *stdLogStream) buildEntry(req *dispatchRequest, ts time.Time, trace bool) *stdLogEntry {
+	entry := &stdLogEntry{
+		ts: ts,
+		stream: ls,
+		level: req.level,
+	}
+	if req.imported != nil {
+		entry.imported = &importedTime{event: req.imported.Time, hasEvent: req.imported.HasTime, ingested: ts}
+		if req.timeSource == TimeFromEvent && req.imported.HasTime {
+			entry.ts = req.imported.Time
 		}
-		unlockChan(ls.lock)
-		for _, ll := range interest {
-			// go ll.Receive(entry)
-			ll.Receive(entry)
+	}
+	switch {
+	case req.received != nil:
+		entry.message = req.received.message
+		if req.received.template != "" {
+			entry.template = cachedMessageTemplate(req.received.template)
+			entry.properties = req.received.properties
 		}
+		entry.associatedError = req.received.err
+		entry.stackTrace = req.received.trace
+		entry.prefix = req.received.MessagePrefix()
+		return entry
+	case req.lazy != nil:
+		entry.message = req.lazy()
+	case req.templated:
+		entry.template = cachedMessageTemplate(req.format)
+		entry.message = entry.template.Render(req.args...)
+		entry.properties = entry.template.Capture(req.args...)
+	case len(req.args) > 0:
+		entry.message = fmt.Sprintf(req.format, req.args...)
+		entry.format = req.format
+	default:
+		entry.message = req.format
+	}
+	if trace {
+		entry.stackTrace = generateStackTrace(1)
+	}
+	if req.err != nil {
+		entry.associatedError = req.err
+	}
+	if req.fields != nil {
+		addFields(entry, req.fields)
+	}
+	correlation := req.correlation
+	if correlation == "" {
+		correlation = AmbientCorrelation()
 	}
+	if _, has := entry.properties[CorrelationProperty]; correlation != "" && !has {
+		if entry.properties == nil {
+			entry.properties = make(map[string]interface{}, 1)
+		}
+		entry.properties[CorrelationProperty] = correlation
+	}
+	return entry
 }
 
 func (ls *stdLogStream) LogTrace(level LogLevel, msg string) {
@@ -513,37 +982,37 @@ func (ls *stdLogStream) InfoTracef(format string, args ...interface{}) {
 }
 
 func (ls *stdLogStream) Debug(msg string) {
-	if ls.ctx.debugging {
+	if ls.ctx.DebuggingEnabled() {
 		ls.dispatchLog(Debug, false, nil, msg)
 	}
 }
 
 func (ls *stdLogStream) Debugf(format string, args ...interface{}) {
-	if ls.ctx.debugging {
+	if ls.ctx.DebuggingEnabled() {
 		ls.dispatchLog(Debug, false, nil, format, args...)
 	}
 }
 
 func (ls *stdLogStream) DebugTrace(msg string) {
-	if ls.ctx.debugging {
+	if ls.ctx.DebuggingEnabled() {
 		ls.dispatchLog(Debug, true, nil, msg)
 	}
 }
 
 func (ls *stdLogStream) DebugTracef(format string, args ...interface{}) {
-	if ls.ctx.debugging {
+	if ls.ctx.DebuggingEnabled() {
 		ls.dispatchLog(Debug, true, nil, format, args...)
 	}
 }
 
 func (ls *stdLogStream) Trace(msg string) {
-	if ls.ctx.debugging {
+	if ls.ctx.DebuggingEnabled() {
 		ls.dispatchLog(Trace, true, nil, msg)
 	}
 }
 
 func (ls *stdLogStream) Tracef(format string, args ...interface{}) {
-	if ls.ctx.debugging {
+	if ls.ctx.DebuggingEnabled() {
 		ls.dispatchLog(Trace	, true, nil, format, args...)
 	}
 }
@@ -585,4 +1054,29 @@ func (le *stdLogEntry) Trace() []*StackTraceEntry {
 	res := make([]*StackTraceEntry, len(le.stackTrace))
 	copy(res, le.stackTrace)
 	return res
-}
\ No newline at end of file
+}
+
+func (le *stdLogEntry) MessageTemplate() string {
+	if le.template == nil {
+		return le.message
+	}
+	return le.template.Text()
+}
+
+func (le *stdLogEntry) Properties() map[string]interface{} {
+	res := make(map[string]interface{}, len(le.properties))
+	for k, v := range le.properties {
+		res[k] = v
+	}
+	return res
+}
+
+func (le *stdLogEntry) recordFormatted(n int) {
+	if ls, ok := le.stream.(*stdLogStream); ok {
+		ls.stats.RecordFormatted(n)
+	}
+}
+
+func (le *stdLogEntry) Fingerprint() string {
+	return computeFingerprint(le)
+}
@@ -1,8 +1,12 @@
 package log
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLog(t *testing.T) {
@@ -16,4 +20,190 @@ func TestLog(t *testing.T) {
 	GetGlobalLoggingContext().EnableDebugging(true)
 	GetGlobalLoggingContext().SetTracesByDefault(true)
 	log.DebugTracef("stack trace test: %s", "enabled")
-}
\ No newline at end of file
+}
+
+type captureListener struct {
+	lock    chan bool
+	entries []LogEntry
+}
+
+func newCaptureListener() *captureListener {
+	cl := &captureListener{lock: make(chan bool, 1)}
+	cl.lock <- true
+	return cl
+}
+
+func (cl *captureListener) Name() string {
+	return "capture"
+}
+
+func (cl *captureListener) Receive(entry LogEntry) {
+	<-cl.lock
+	defer func() { cl.lock <- true }()
+	cl.entries = append(cl.entries, entry)
+}
+
+func (cl *captureListener) Close() error {
+	return nil
+}
+
+func (cl *captureListener) Entries() []LogEntry {
+	<-cl.lock
+	defer func() { cl.lock <- true }()
+	res := make([]LogEntry, len(cl.entries))
+	copy(res, cl.entries)
+	return res
+}
+
+func TestStreamStats(t *testing.T) {
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("stats-test")
+	var buf bytes.Buffer
+	detach := stream.Tee(&buf, nil)
+	stream.Warning("one")
+	stream.Warning("two")
+	stream.Info("three")
+	detach()
+	stream.Info("four")
+	stats := stream.Stats()
+	if stats.Total != 4 || stats.Entries[Warning] != 2 || stats.Entries[Info] != 2 {
+		t.Errorf("unexpected entry counts: %v", stats.Entries)
+	}
+	if stats.BytesFormatted != uint64(buf.Len()) {
+		t.Errorf("expected %d bytes formatted, got %d", buf.Len(), stats.BytesFormatted)
+	}
+	if again, _ := ctx.Stream("stats-test"); again != stream {
+		t.Error("expected the stream to be registered with its context")
+	}
+}
+
+type echoListener struct {
+	stream LogStream
+}
+
+func (el *echoListener) Name() string {
+	return "echo"
+}
+
+func (el *echoListener) Receive(entry LogEntry) {
+	el.stream.Warningf("echo: %s", entry.Message())
+}
+
+func (el *echoListener) Close() error {
+	return nil
+}
+
+func TestReentrantListener(t *testing.T) {
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("reentrant-test")
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream.AddLogListener(&echoListener{stream: stream}, Trace)
+	drops := ReentrantDrops()
+	done := make(chan bool)
+	go func() {
+		stream.Info("hello")
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reentrant logging deadlocked")
+	}
+	if n := len(cl.Entries()); n != 2 {
+		t.Errorf("expected the original and echoed entry, got %d entries", n)
+	}
+	if ReentrantDrops() != drops+1 {
+		t.Errorf("expected one reentrant drop, got %d", ReentrantDrops()-drops)
+	}
+}
+
+type holdingListener struct {
+	entered chan bool
+	release chan bool
+}
+
+func (hl *holdingListener) Name() string {
+	return "holding"
+}
+
+func (hl *holdingListener) Receive(entry LogEntry) {
+	hl.entered <- InDelivery()
+	<-hl.release
+}
+
+func (hl *holdingListener) Close() error {
+	return nil
+}
+
+func TestReentrantListenerContended(t *testing.T) {
+	ctx := CreateLoggingContext()
+	held, _ := ctx.Stream("held")
+	hl := &holdingListener{make(chan bool), make(chan bool)}
+	held.AddLogListener(hl, Trace)
+	go held.Info("hold")
+	if !<-hl.entered {
+		t.Error("expected InDelivery() inside Receive()")
+	}
+	defer close(hl.release)
+	if InDelivery() {
+		t.Error("expected InDelivery() false outside any delivery")
+	}
+	stream, _ := ctx.Stream("reentrant-contended")
+	cl := newCaptureListener()
+	stream.AddLogListener(cl, Trace)
+	stream.AddLogListener(&echoListener{stream: stream}, Trace)
+	drops := ReentrantDrops()
+	done := make(chan bool)
+	go func() {
+		stream.Info("hello")
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reentrant logging deadlocked")
+	}
+	if n := len(cl.Entries()); n != 2 {
+		t.Errorf("expected the original and echoed entry, got %d entries", n)
+	}
+	if ReentrantDrops() != drops+1 {
+		t.Errorf("expected one reentrant drop, got %d", ReentrantDrops()-drops)
+	}
+}
+
+func TestContextVerbosity(t *testing.T) {
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("verbosity-test")
+	cl := newCaptureListener()
+	stream.AddLogListener(cl, Info)
+	stream.LogContext(context.Background(), Debug, "dropped")
+	verbose := WithVerbosity(context.Background(), Debug)
+	stream.LogContextf(verbose, Debug, "kept %d", 1)
+	stream.LogContext(verbose, Trace, "still dropped")
+	entries := cl.Entries()
+	if len(entries) != 1 || entries[0].Message() != "kept 1" {
+		t.Errorf("unexpected entries under verbosity override: %v", entries)
+	}
+}
+
+type failingWriter struct{}
+
+func (fw failingWriter) Write(data []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestFallbackPolicy(t *testing.T) {
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("fallback-test")
+	stream.AddLogListener(NewWriterLogger("broken", failingWriter{}, NewLogEntryFormatter()), Trace)
+	var buf bytes.Buffer
+	ctx.SetFallbackPolicy(&FallbackPolicy{Writer: &buf, Limit: 2})
+	for i := 0; i < 3; i++ {
+		stream.Errorf(nil, "lost %d", i)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "[fallback-test] lost 0") || !strings.Contains(lines[0], "disk full") {
+		t.Errorf("unexpected fallback output:\n%s", buf.String())
+	}
+}
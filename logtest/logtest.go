@@ -0,0 +1,163 @@
+// Package logtest locks down what an application logs: a Buffer listener
+// collects formatted output, and Golden compares it with a golden file
+// after normalizing what changes from run to run - timestamps, addresses,
+// source paths and standard library stack frames.  Golden files are
+// rewritten when the LOGTEST_UPDATE environment variable is set:
+//
+//	func TestStartup(t *testing.T) {
+//	    ctx := log.CreateLoggingContext()
+//	    out := logtest.NewBuffer("golden", log.NewLogEntryFormatter())
+//	    ctx.AddGlobalLogListener(out, log.Trace)
+//	    runStartup(ctx)
+//	    logtest.Golden(t, out.String())
+//	}
+package logtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/dtromb/log"
+)
+
+// UpdateEnv names the environment variable which makes Golden rewrite
+// golden files instead of comparing against them.
+const UpdateEnv = "LOGTEST_UPDATE"
+
+// Buffer is a listener which keeps its formatted output in memory.
+type Buffer struct {
+	lock      chan bool
+	name      string
+	formatter log.LogEntryFormatter
+	buf       bytes.Buffer
+}
+
+///
+
+func NewBuffer(name string, formatter log.LogEntryFormatter) *Buffer {
+	if formatter == nil {
+		formatter = log.NewLogEntryFormatter()
+	}
+	b := &Buffer{lock: make(chan bool, 1), name: name, formatter: formatter}
+	b.lock <- true
+	return b
+}
+
+func (b *Buffer) Name() string {
+	return b.name
+}
+
+func (b *Buffer) Receive(entry log.LogEntry) {
+	out := b.formatter.Format(entry)
+	<-b.lock
+	b.buf.WriteString(out)
+	b.lock <- true
+}
+
+func (b *Buffer) Close() error {
+	return nil
+}
+
+func (b *Buffer) String() string {
+	<-b.lock
+	defer func() { b.lock <- true }()
+	return b.buf.String()
+}
+
+func (b *Buffer) Reset() {
+	<-b.lock
+	b.buf.Reset()
+	b.lock <- true
+}
+
+var normalizers = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	// RFC 3339, and the same with a space between date and time.
+	{regexp.MustCompile(`\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:?\d\d)?`), "<time>"},
+	// The standard formatter's layout, and Go's log package.
+	{regexp.MustCompile(`\d\d/\d\d/\d\d \d\d:\d\d:\d\d(\.\d+)?`), "<time>"},
+	{regexp.MustCompile(`\d{4}/\d\d/\d\d \d\d:\d\d:\d\d(\.\d+)?`), "<time>"},
+	{regexp.MustCompile(`0x[0-9a-fA-F]{4,}`), "0x<addr>"},
+	// Absolute source paths keep only their file name.
+	{regexp.MustCompile(`(?:[A-Za-z]:)?[/\\](?:[^\s:"'/\\]+[/\\])+([^\s:"'/\\]+\.(?:go|s)):(\d+)`), "$1:$2"},
+}
+
+// Normalize replaces timestamps with <time>, addresses with 0x<addr> and
+// absolute source paths with their file names, and removes the lines
+// naming files in the Go installation (stack frames in the runtime and
+// testing packages, which vary between Go versions).
+func Normalize(output string) string {
+	goroot := filepath.ToSlash(runtime.GOROOT())
+	lines := strings.SplitAfter(output, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if goroot != "" && strings.Contains(filepath.ToSlash(line), goroot+"/") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	output = strings.Join(kept, "")
+	for _, n := range normalizers {
+		output = n.pattern.ReplaceAllString(output, n.replace)
+	}
+	return output
+}
+
+// Golden compares the normalized output with testdata/<test name>.golden.
+func Golden(t testing.TB, output string) {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_", ":", "_").Replace(t.Name())
+	GoldenFile(t, filepath.Join("testdata", name+".golden"), output)
+}
+
+// GoldenFile compares the normalized output with the golden file at path,
+// or rewrites the file if UpdateEnv is set.
+func GoldenFile(t testing.TB, path string, output string) {
+	t.Helper()
+	got := Normalize(output)
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (set %s=1 to create it)", err.Error(), UpdateEnv)
+	}
+	if got == string(want) {
+		return
+	}
+	t.Errorf("output differs from %s (set %s=1 to update it):\n%s", path, UpdateEnv, diffLines(string(want), got))
+}
+
+// Lists the lines which differ, by position.
+func diffLines(want, got string) string {
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var buf strings.Builder
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			fmt.Fprintf(&buf, "line %d:\n  want: %q\n  got:  %q\n", i+1, w, g)
+		}
+	}
+	return buf.String()
+}
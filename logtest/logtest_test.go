@@ -0,0 +1,27 @@
+package logtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dtromb/log"
+)
+
+func TestGolden(t *testing.T) {
+	ctx := log.CreateLoggingContext()
+	out := NewBuffer("golden", log.NewLogEntryFormatter())
+	ctx.AddGlobalLogListener(out, log.Trace)
+	stream, _ := ctx.Stream("startup")
+	stream.Info("listening on 127.0.0.1:8080")
+	stream.LogTemplate(log.Warning, "config {Path} is world-readable", "/etc/app.conf")
+	stream.Errorf(errors.New("pool exhausted at 0xc000123456"), "database unavailable")
+	stream.LogTrace(log.Warning, "startup complete")
+	Golden(t, out.String())
+}
+
+func TestNormalize(t *testing.T) {
+	in := "2024-05-06T07:08:09.123Z | 05/06/24 07:08:09.123 | /home/ci/src/app/main.go:42 | 0xdeadbeef\n"
+	if got, want := Normalize(in), "<time> | <time> | main.go:42 | 0x<addr>\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
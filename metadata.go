@@ -0,0 +1,88 @@
+package log
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	HostProperty      = "Host"
+	PIDProperty       = "PID"
+	GoroutineProperty = "Goroutine"
+	ServiceProperty   = "Service"
+	VersionProperty   = "Version"
+)
+
+// Metadata providers add process-level properties to every entry a
+// context dispatches; properties the entry already has are kept, so
+// earlier providers win.
+type MetadataProvider interface {
+	Metadata(entry LogEntry) []Field
+}
+
+// MetadataFunc adapts a function to MetadataProvider.
+type MetadataFunc func(entry LogEntry) []Field
+
+///
+
+func (mf MetadataFunc) Metadata(entry LogEntry) []Field {
+	return mf(entry)
+}
+
+func (ctx *stdLoggingContext) SetMetadataProviders(providers ...MetadataProvider) {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	ctx.metadata = append([]MetadataProvider(nil), providers...)
+}
+
+func (ctx *stdLoggingContext) MetadataProviders() []MetadataProvider {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	return append([]MetadataProvider(nil), ctx.metadata...)
+}
+
+// ProcessMetadata adds the host name and process ID, and the service and
+// version, if they are not empty.  The host name is looked up once.
+func ProcessMetadata(service string, version string) MetadataProvider {
+	host, _ := os.Hostname()
+	var fields []Field
+	if host != "" {
+		fields = append(fields, F(HostProperty, host))
+	}
+	fields = append(fields, F(PIDProperty, os.Getpid()))
+	if service != "" {
+		fields = append(fields, F(ServiceProperty, service))
+	}
+	if version != "" {
+		fields = append(fields, F(VersionProperty, version))
+	}
+	return MetadataFunc(func(entry LogEntry) []Field {
+		return fields
+	})
+}
+
+// GoroutineMetadata adds the ID of the logging goroutine.  Go does not
+// expose it, so it is read from the goroutine's stack header, at some cost
+// per entry.
+func GoroutineMetadata() MetadataProvider {
+	return MetadataFunc(func(entry LogEntry) []Field {
+		if id := goroutineID(); id != 0 {
+			return []Field{F(GoroutineProperty, id)}
+		}
+		return nil
+	})
+}
+
+// Parses "goroutine 18 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	header := string(buf[:runtime.Stack(buf[:], false)])
+	header = strings.TrimPrefix(header, "goroutine ")
+	if space := strings.IndexByte(header, ' '); space >= 0 {
+		header = header[:space]
+	}
+	id, _ := strconv.ParseUint(header, 10, 64)
+	return id
+}
@@ -0,0 +1,34 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMetadataProviders(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	ctx.SetMetadataProviders(ProcessMetadata("billing", "1.4.2"), GoroutineMetadata(),
+		MetadataFunc(func(entry LogEntry) []Field { return []Field{F(ServiceProperty, "ignored")} }))
+	stream, _ := ctx.Stream("metadata")
+	stream.LogTemplate(Info, "host {Host}", "given")
+	entry := cl.Entries()[0]
+	props := entry.(TemplatedLogEntry).Properties()
+	if props[HostProperty] != "given" || props[PIDProperty] != os.Getpid() ||
+		props[ServiceProperty] != "billing" || props[VersionProperty] != "1.4.2" {
+		t.Errorf("unexpected metadata %v", props)
+	}
+	if id, _ := props[GoroutineProperty].(uint64); id != goroutineID() {
+		t.Errorf("expected the logging goroutine's ID %d, got %v", goroutineID(), props[GoroutineProperty])
+	}
+	formatter := NewLogEntryFormatter()
+	formatter.ClearFlags(PrintTime)
+	formatter.SetFlags(PrintPID | PrintService)
+	want := fmt.Sprintf("%d | billing@1.4.2 | metadata | Info | host given", os.Getpid())
+	if out := strings.TrimSpace(formatter.Format(entry)); out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+}
@@ -0,0 +1,294 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+type Counter interface {
+	Add(delta float64)
+	Value() float64
+}
+
+type Gauge interface {
+	Set(value float64)
+	Value() float64
+}
+
+type Histogram interface {
+	Observe(value float64)
+	Snapshot() HistogramSnapshot
+}
+
+type HistogramSnapshot struct {
+	// Bounds are the bucket upper bounds; Counts[i] is the number of
+	// observations <= Bounds[i] (cumulative, as in Prometheus).
+	Bounds []float64
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// A MetricsRegistry lets the pipeline publish values without a metrics
+// library, rendering them in the Prometheus text format.  Asking for the
+// same name and labels again returns the same metric.
+type MetricsRegistry interface {
+	Counter(name string, labels map[string]string) Counter
+	Gauge(name string, labels map[string]string) Gauge
+	Histogram(name string, labels map[string]string, bounds []float64) Histogram
+	Each(visit func(name string, labels map[string]string, metric interface{}))
+	WriteText(w io.Writer) error
+}
+
+var DefaultLatencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+///
+
+type atomicFloat struct {
+	bits uint64
+}
+
+func (af *atomicFloat) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&af.bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&af.bits, old, next) {
+			return
+		}
+	}
+}
+
+func (af *atomicFloat) set(value float64) {
+	atomic.StoreUint64(&af.bits, math.Float64bits(value))
+}
+
+func (af *atomicFloat) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&af.bits))
+}
+
+type stdCounter struct {
+	value atomicFloat
+}
+
+func (c *stdCounter) Add(delta float64) {
+	c.value.add(delta)
+}
+
+func (c *stdCounter) Value() float64 {
+	return c.value.load()
+}
+
+type stdGauge struct {
+	value atomicFloat
+}
+
+func (g *stdGauge) Set(value float64) {
+	g.value.set(value)
+}
+
+func (g *stdGauge) Value() float64 {
+	return g.value.load()
+}
+
+type stdHistogram struct {
+	lock   chan bool
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *stdHistogram {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+	sorted := make([]float64, len(bounds))
+	copy(sorted, bounds)
+	sort.Float64s(sorted)
+	h := &stdHistogram{
+		lock:   make(chan bool, 1),
+		bounds: sorted,
+		counts: make([]uint64, len(sorted)),
+	}
+	h.lock <- true
+	return h
+}
+
+func (h *stdHistogram) Observe(value float64) {
+	idx := sort.SearchFloat64s(h.bounds, value)
+	<-h.lock
+	if idx < len(h.counts) {
+		h.counts[idx]++
+	}
+	h.count++
+	h.sum += value
+	h.lock <- true
+}
+
+func (h *stdHistogram) Snapshot() HistogramSnapshot {
+	<-h.lock
+	defer func() { h.lock <- true }()
+	snap := HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: make([]uint64, len(h.counts)),
+		Count:  h.count,
+		Sum:    h.sum,
+	}
+	var total uint64
+	for i, n := range h.counts {
+		total += n
+		snap.Counts[i] = total
+	}
+	return snap
+}
+
+type registeredMetric struct {
+	name   string
+	labels map[string]string
+	metric interface{}
+}
+
+type stdMetricsRegistry struct {
+	lock    chan bool
+	metrics map[string]*registeredMetric
+}
+
+var _GLOBAL_metrics = NewMetricsRegistry()
+
+func NewMetricsRegistry() MetricsRegistry {
+	reg := &stdMetricsRegistry{
+		lock:    make(chan bool, 1),
+		metrics: make(map[string]*registeredMetric),
+	}
+	reg.lock <- true
+	return reg
+}
+
+// DefaultMetricsRegistry returns the registry used by this package's own
+// components unless configured otherwise.
+func DefaultMetricsRegistry() MetricsRegistry {
+	return _GLOBAL_metrics
+}
+
+func metricKey(name string, labels map[string]string) string {
+	return name + "{" + formatLabels(labels) + "}"
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		val := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(labels[k])
+		parts[i] = fmt.Sprintf("%s=\"%s\"", k, val)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (reg *stdMetricsRegistry) lookup(name string, labels map[string]string, create func() interface{}) interface{} {
+	key := metricKey(name, labels)
+	<-reg.lock
+	defer func() { reg.lock <- true }()
+	if rm, has := reg.metrics[key]; has {
+		return rm.metric
+	}
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	rm := &registeredMetric{name: name, labels: copied, metric: create()}
+	reg.metrics[key] = rm
+	return rm.metric
+}
+
+// Asking for an existing metric as a different kind panics, as it would
+// with any metrics library.
+
+func (reg *stdMetricsRegistry) Counter(name string, labels map[string]string) Counter {
+	return reg.lookup(name, labels, func() interface{} { return &stdCounter{} }).(Counter)
+}
+
+func (reg *stdMetricsRegistry) Gauge(name string, labels map[string]string) Gauge {
+	return reg.lookup(name, labels, func() interface{} { return &stdGauge{} }).(Gauge)
+}
+
+func (reg *stdMetricsRegistry) Histogram(name string, labels map[string]string, bounds []float64) Histogram {
+	return reg.lookup(name, labels, func() interface{} { return newHistogram(bounds) }).(Histogram)
+}
+
+func (reg *stdMetricsRegistry) sorted() []*registeredMetric {
+	<-reg.lock
+	res := make([]*registeredMetric, 0, len(reg.metrics))
+	for _, rm := range reg.metrics {
+		res = append(res, rm)
+	}
+	reg.lock <- true
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].name != res[j].name {
+			return res[i].name < res[j].name
+		}
+		return formatLabels(res[i].labels) < formatLabels(res[j].labels)
+	})
+	return res
+}
+
+func (reg *stdMetricsRegistry) Each(visit func(name string, labels map[string]string, metric interface{})) {
+	for _, rm := range reg.sorted() {
+		visit(rm.name, rm.labels, rm.metric)
+	}
+}
+
+func (reg *stdMetricsRegistry) WriteText(w io.Writer) error {
+	lastName := ""
+	for _, rm := range reg.sorted() {
+		labels := formatLabels(rm.labels)
+		var lines []string
+		kind := ""
+		switch m := rm.metric.(type) {
+		case Counter:
+			kind = "counter"
+			lines = append(lines, sampleLine(rm.name, labels, m.Value()))
+		case Gauge:
+			kind = "gauge"
+			lines = append(lines, sampleLine(rm.name, labels, m.Value()))
+		case Histogram:
+			kind = "histogram"
+			snap := m.Snapshot()
+			for i, bound := range snap.Bounds {
+				lines = append(lines, sampleLine(rm.name+"_bucket", joinLabels(labels, fmt.Sprintf("le=\"%g\"", bound)), float64(snap.Counts[i])))
+			}
+			lines = append(lines, sampleLine(rm.name+"_bucket", joinLabels(labels, "le=\"+Inf\""), float64(snap.Count)))
+			lines = append(lines, sampleLine(rm.name+"_sum", labels, snap.Sum))
+			lines = append(lines, sampleLine(rm.name+"_count", labels, float64(snap.Count)))
+		}
+		if rm.name != lastName {
+			lines = append([]string{fmt.Sprintf("# TYPE %s %s", rm.name, kind)}, lines...)
+			lastName = rm.name
+		}
+		if _, err := io.WriteString(w, strings.Join(lines, "\n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinLabels(labels string, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func sampleLine(name string, labels string, value float64) string {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	return fmt.Sprintf("%s %g", name, value)
+}
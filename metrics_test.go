@@ -0,0 +1,54 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	h := NewMetricsRegistry().Histogram("latency", nil, []float64{1, 0.1, 0.5})
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.5, 0.7, 2} {
+		h.Observe(v)
+	}
+	snap := h.Snapshot()
+	// Bounds are sorted, and counts cumulative with the bound inclusive.
+	wantBounds, wantCounts := []float64{0.1, 0.5, 1}, []uint64{2, 4, 5}
+	for i := range wantBounds {
+		if snap.Bounds[i] != wantBounds[i] || snap.Counts[i] != wantCounts[i] {
+			t.Fatalf("unexpected buckets %v %v", snap.Bounds, snap.Counts)
+		}
+	}
+	if snap.Count != 6 || snap.Sum != 3.65 {
+		t.Errorf("count %d sum %g", snap.Count, snap.Sum)
+	}
+}
+
+func TestMetricsRegistryText(t *testing.T) {
+	reg := NewMetricsRegistry()
+	reg.Counter("requests_total", map[string]string{"code": "500"}).Add(2)
+	reg.Counter("requests_total", map[string]string{"code": "200"}).Add(5)
+	reg.Counter("requests_total", map[string]string{"code": "200"}).Add(1)
+	reg.Gauge("queue_depth", map[string]string{"queue": `a"b`}).Set(7)
+	h := reg.Histogram("op_seconds", map[string]string{"op": "read"}, []float64{0.5, 1})
+	h.Observe(0.2)
+	h.Observe(3)
+	var buf bytes.Buffer
+	if err := reg.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE op_seconds histogram
+op_seconds_bucket{op="read",le="0.5"} 1
+op_seconds_bucket{op="read",le="1"} 1
+op_seconds_bucket{op="read",le="+Inf"} 2
+op_seconds_sum{op="read"} 3.2
+op_seconds_count{op="read"} 2
+# TYPE queue_depth gauge
+queue_depth{queue="a\"b"} 7
+# TYPE requests_total counter
+requests_total{code="200"} 6
+requests_total{code="500"} 2
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
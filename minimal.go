@@ -0,0 +1,7 @@
+// +build logminimal
+
+package log
+
+func init() {
+	buildFeatures = append(buildFeatures, "logminimal")
+}
@@ -0,0 +1,157 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type Destination struct {
+	Name   string
+	Writer io.Writer
+	// Level is the destination's threshold, with the same meaning as a
+	// listener's level (Default resolves to Info).
+	Level LogLevel
+}
+
+// A MultiWriterListener formats each entry once, and writes it to every
+// destination whose threshold accepts it, in order.
+type MultiWriterListener interface {
+	FormattingLogListener
+	FallibleLogListener
+	Flusher
+	Destinations() []Destination
+}
+
+///
+
+type multiWriterDestination struct {
+	Destination
+	out           io.Writer
+	headerWritten bool
+}
+
+type multiWriterListener struct {
+	lock         chan bool
+	name         string
+	formatter    LogEntryFormatter
+	destinations []*multiWriterDestination
+	closed       bool
+}
+
+// NewMultiWriterListener writes to the destinations in the order given.
+// Close() closes the destinations' writers, other than os.Stdout and
+// os.Stderr, which are io.Closers.
+func NewMultiWriterListener(name string, formatter LogEntryFormatter, destinations ...Destination) MultiWriterListener {
+	if formatter == nil {
+		formatter = NewLogEntryFormatter()
+	}
+	mwl := &multiWriterListener{
+		lock:      make(chan bool, 1),
+		name:      name,
+		formatter: formatter,
+	}
+	for _, d := range destinations {
+		mwl.destinations = append(mwl.destinations, &multiWriterDestination{Destination: d, out: consoleWriter{d.Writer}})
+	}
+	mwl.lock <- true
+	return mwl
+}
+
+func (mwl *multiWriterListener) Name() string {
+	return mwl.name
+}
+
+func (mwl *multiWriterListener) Formatter() LogEntryFormatter {
+	return mwl.formatter
+}
+
+func (mwl *multiWriterListener) Destinations() []Destination {
+	res := make([]Destination, len(mwl.destinations))
+	for i, d := range mwl.destinations {
+		res[i] = d.Destination
+	}
+	return res
+}
+
+func (mwl *multiWriterListener) Receive(entry LogEntry) {
+	mwl.TryReceive(entry)
+}
+
+func (mwl *multiWriterListener) TryReceive(entry LogEntry) error {
+	accepting := make([]*multiWriterDestination, 0, len(mwl.destinations))
+	for _, d := range mwl.destinations {
+		if ListenerAccepts(d.Level, Info, entry.Level()) {
+			accepting = append(accepting, d)
+		}
+	}
+	if len(accepting) == 0 {
+		return nil
+	}
+	buf := []byte(mwl.formatter.Format(entry))
+	recordFormattedSize(entry, len(buf))
+	<-mwl.lock
+	defer func() { mwl.lock <- true }()
+	if mwl.closed {
+		return ErrListenerClosed
+	}
+	var failed []string
+	for _, d := range accepting {
+		if !d.headerWritten {
+			d.headerWritten = true
+			if hf, ok := mwl.formatter.(HeaderFormatter); ok {
+				if header := hf.Header(); header != "" {
+					d.out.Write([]byte(header))
+				}
+			}
+		}
+		if _, err := d.out.Write(buf); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", d.Name, err.Error()))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("write to %s failed", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (mwl *multiWriterListener) Flush() error {
+	<-mwl.lock
+	defer func() { mwl.lock <- true }()
+	if mwl.closed {
+		return nil
+	}
+	var first error
+	for _, d := range mwl.destinations {
+		if fl, ok := d.Writer.(interface{ Flush() error }); ok {
+			if err := fl.Flush(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (mwl *multiWriterListener) Close() error {
+	<-mwl.lock
+	defer func() { mwl.lock <- true }()
+	if mwl.closed {
+		return nil
+	}
+	mwl.closed = true
+	var errs []error
+	for _, d := range mwl.destinations {
+		if d.Writer == io.Writer(os.Stdout) || d.Writer == io.Writer(os.Stderr) {
+			continue
+		}
+		if fl, ok := d.Writer.(interface{ Flush() error }); ok {
+			errs = append(errs, fl.Flush())
+		}
+		if wc, ok := d.Writer.(io.Closer); ok {
+			errs = append(errs, wc.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
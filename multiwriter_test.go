@@ -0,0 +1,43 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type countingFormatter struct {
+	calls int
+}
+
+func (cf *countingFormatter) Format(entry LogEntry) string {
+	cf.calls++
+	return entry.Level().String() + " " + entry.Message() + "\n"
+}
+
+func TestMultiWriterListener(t *testing.T) {
+	var console, file bytes.Buffer
+	formatter := &countingFormatter{}
+	mwl := NewMultiWriterListener("out", formatter,
+		Destination{Name: "console", Writer: &console, Level: Warning},
+		Destination{Name: "file", Writer: &file, Level: Debug},
+	)
+	ctx := CreateLoggingContext()
+	ctx.AddGlobalLogListener(mwl, Trace)
+	stream, _ := ctx.Stream("app")
+	stream.Log(Error, "failed")
+	stream.Log(Info, "started")
+	stream.Log(Trace, "detail")
+	if console.String() != "Error failed\n" {
+		t.Errorf("unexpected console output: %q", console.String())
+	}
+	if file.String() != "Error failed\nInfo started\n" {
+		t.Errorf("unexpected file output: %q", file.String())
+	}
+	if formatter.calls != 2 {
+		t.Errorf("expected each accepted entry to be formatted once, got %d calls", formatter.calls)
+	}
+	if !strings.Contains(mwl.Destinations()[1].Name, "file") {
+		t.Errorf("unexpected destinations: %+v", mwl.Destinations())
+	}
+}
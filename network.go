@@ -0,0 +1,599 @@
+package log
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type NetworkOptions struct {
+	// DialTimeout and WriteTimeout default to 5s.
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	// RetryInterval is the minimum time between connection attempts
+	// (default 1s).
+	RetryInterval time.Duration
+	// Failover addresses are tried after the listener's address, in
+	// order; RoundRobin instead starts each connection at the endpoint
+	// after the last one used.  ResolveAll expands each TCP address to all
+	// the addresses its host resolves to.
+	Failover   []string
+	RoundRobin bool
+	ResolveAll bool
+	// EndpointBackoff is how long an endpoint which failed is passed over
+	// (default 30s).
+	EndpointBackoff time.Duration
+	// Proxy, if set, returns the HTTP proxy to tunnel a TCP address
+	// through, or nil to connect directly; see ProxyFromEnvironment.
+	Proxy func(address string) (*url.URL, error)
+	// TLS, if set, secures the connection; ServerName defaults to the
+	// endpoint's host (for SNI and verification) and a session cache is
+	// added for resumption if none is set.
+	TLS *tls.Config
+	// Token, if set, is called on each connection for the token presented
+	// to the server.
+	Token func() (string, error)
+	// Compression names the compression offered to the server: "gzip", or
+	// "" for none.  Only gzip is supported; zstd and snappy would need
+	// third-party codecs.
+	Compression string
+	// BatchSize (default 64) and BatchInterval (default 1s) bound the
+	// batches sent with compression.
+	BatchSize     int
+	BatchInterval time.Duration
+	// Receipts asks the server to acknowledge entries.  Up to
+	// RetainEntries (default 1024) unacknowledged entries are retained and
+	// resent on reconnecting if the server did not receive them; an entry
+	// retained when a write fails is not reported as failed.
+	Receipts      bool
+	RetainEntries int
+}
+
+type NetworkListener interface {
+	FallibleLogListener
+	Flusher
+	ContextFlusher
+	Network() string
+	Address() string
+	Connected() bool
+	// Endpoint returns the address connected to, or "".
+	Endpoint() string
+	// Compression returns the compression negotiated for the current
+	// connection, or "" if entries are sent uncompressed.
+	Compression() string
+	// Unacknowledged returns the number of entries retained for resending.
+	Unacknowledged() int
+}
+
+type StreamAuth struct {
+	Token  string
+	Remote net.Addr
+	// TLS is nil for connections without TLS.
+	TLS *tls.ConnectionState
+}
+
+type StreamServerOptions struct {
+	// StreamPrefix is prepended to the stream names of received entries.
+	StreamPrefix string
+	// TLS, if set, is required of every connection.
+	TLS *tls.Config
+	// Authenticate, if set, accepts or refuses each connection when its
+	// hello arrives; connections sending entries without a hello are
+	// refused.  Refused connections are closed without a handshake reply.
+	Authenticate func(auth StreamAuth) error
+	// AckInterval is how long after receiving an entry it is acknowledged,
+	// to senders asking for receipts (default 1s).
+	AckInterval time.Duration
+	// OnError is called with errors other than clean disconnects.
+	OnError func(remote net.Addr, err error)
+	// Handler, if set, sees each entry received before it is dispatched.
+	Handler ReceiveHandler
+}
+
+// A ReceiveHandler is given each entry received, with its sender's
+// address, and returns false to drop it.
+type ReceiveHandler func(remote net.Addr, entry LogEntry) bool
+
+// A StreamServer dispatches the entries received from network listeners
+// into a context, on streams of the same name.
+type StreamServer interface {
+	Addr() net.Addr
+	Connections() int
+	Close() error
+}
+
+///
+
+type networkListener struct {
+	lock        chan bool
+	name        string
+	network     string
+	address     string
+	opts        NetworkOptions
+	conn        net.Conn
+	endpoint    string
+	encoder     *stdStreamEncoder
+	lastAttempt time.Time
+	unhealthy   map[string]time.Time
+	next        int
+	// With receipts: the listener's session, the last sequence number sent,
+	// and the entries sent but not acknowledged.
+	session    string
+	receipts   bool
+	seq        uint64
+	retainLock chan bool
+	retained   []retainedEntry
+	flushTimer *time.Timer
+	closed     bool
+	// Closing cancels dials in progress, through dialCtx, and interrupts
+	// writes on the active connection.
+	closing int32
+	dialCtx context.Context
+	cancel  context.CancelFunc
+	active  atomic.Value
+}
+
+type activeConn struct {
+	conn net.Conn
+}
+
+// NewNetworkListener ships entries in the wire format to a stream server.
+// Entries arriving while disconnected are refused; wrap the listener in an
+// async listener to queue through short outages.
+func NewNetworkListener(name string, network string, address string, opts NetworkOptions) NetworkListener {
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 5 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	if opts.EndpointBackoff <= 0 {
+		opts.EndpointBackoff = 30 * time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 64
+	}
+	if opts.BatchInterval <= 0 {
+		opts.BatchInterval = time.Second
+	}
+	if opts.RetainEntries <= 0 {
+		opts.RetainEntries = 1024
+	}
+	if opts.TLS != nil {
+		opts.TLS = opts.TLS.Clone()
+		if opts.TLS.ClientSessionCache == nil {
+			opts.TLS.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+		}
+	}
+	nl := &networkListener{
+		lock:       make(chan bool, 1),
+		name:       name,
+		network:    network,
+		address:    address,
+		opts:       opts,
+		unhealthy:  make(map[string]time.Time),
+		retainLock: make(chan bool, 1),
+	}
+	nl.dialCtx, nl.cancel = context.WithCancel(context.Background())
+	nl.active.Store(activeConn{})
+	if opts.Receipts {
+		nl.session = newReceiptSession()
+	}
+	nl.lock <- true
+	nl.retainLock <- true
+	return nl
+}
+
+func (nl *networkListener) Name() string {
+	return nl.name
+}
+
+func (nl *networkListener) Network() string {
+	return nl.network
+}
+
+func (nl *networkListener) Address() string {
+	return nl.address
+}
+
+func (nl *networkListener) Connected() bool {
+	<-nl.lock
+	defer func() { nl.lock <- true }()
+	return nl.conn != nil
+}
+
+func (nl *networkListener) Endpoint() string {
+	<-nl.lock
+	defer func() { nl.lock <- true }()
+	return nl.endpoint
+}
+
+func (nl *networkListener) Compression() string {
+	<-nl.lock
+	defer func() { nl.lock <- true }()
+	if nl.encoder == nil || nl.encoder.encoding == FrameJSON {
+		return ""
+	}
+	return nl.encoder.encoding.String()
+}
+
+func (nl *networkListener) Receive(entry LogEntry) {
+	nl.TryReceive(entry)
+}
+
+func (nl *networkListener) connect() error {
+	if time.Since(nl.lastAttempt) < nl.opts.RetryInterval {
+		return errors.New("network listener is not connected to " + nl.address)
+	}
+	nl.lastAttempt = time.Now()
+	compression := FrameJSON
+	if nl.opts.Compression != "" {
+		var ok bool
+		if compression, ok = wireCompressions[nl.opts.Compression]; !ok {
+			return fmt.Errorf("unsupported network compression '%s' (available: gzip)", nl.opts.Compression)
+		}
+	}
+	var token string
+	if nl.opts.Token != nil {
+		var err error
+		if token, err = nl.opts.Token(); err != nil {
+			return err
+		}
+	}
+	conn, endpoint, err := nl.dialEndpoints()
+	if err != nil {
+		return err
+	}
+	encoder := &stdStreamEncoder{w: conn, token: token, encoding: FrameJSON}
+	nl.receipts = false
+	if compression != FrameJSON || nl.opts.Receipts {
+		offer := WireHello{Encodings: []string{FrameJSON.String()}, Token: token, Session: nl.session}
+		if compression != FrameJSON {
+			offer.Encodings = []string{compression.String(), FrameJSON.String()}
+		}
+		reply, err := handshake(conn, offer, time.Now().Add(nl.opts.DialTimeout))
+		if err != nil {
+			conn.Close()
+			nl.markUnhealthy(endpoint)
+			return err
+		}
+		encoder.helloSent = true
+		if reply != nil {
+			for _, name := range reply.Encodings {
+				if compression != FrameJSON && name == compression.String() {
+					encoder.encoding = compression
+				}
+			}
+			if nl.opts.Receipts && reply.Session == nl.session {
+				nl.receipts = true
+				nl.acknowledge(reply.Resume)
+				go nl.readReceipts(conn)
+			}
+		}
+	}
+	nl.conn, nl.endpoint, nl.encoder = conn, endpoint, encoder
+	nl.active.Store(activeConn{conn})
+	if nl.receipts {
+		conn.SetWriteDeadline(time.Now().Add(nl.opts.WriteTimeout))
+		for _, re := range nl.unacknowledged() {
+			if err := encoder.encode(re.entry, re.seq); err != nil {
+				nl.fail()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Drops the connection after a failed write.
+func (nl *networkListener) fail() {
+	if nl.conn != nil {
+		nl.markUnhealthy(nl.endpoint)
+	}
+	nl.disconnect()
+}
+
+func (nl *networkListener) disconnect() {
+	if nl.flushTimer != nil {
+		nl.flushTimer.Stop()
+		nl.flushTimer = nil
+	}
+	if nl.conn != nil {
+		nl.conn.Close()
+		nl.conn, nl.endpoint, nl.encoder = nil, "", nil
+		nl.active.Store(activeConn{})
+	}
+}
+
+func (nl *networkListener) flush() error {
+	if nl.flushTimer != nil {
+		nl.flushTimer.Stop()
+		nl.flushTimer = nil
+	}
+	if nl.encoder == nil {
+		return nil
+	}
+	nl.conn.SetWriteDeadline(time.Now().Add(nl.opts.WriteTimeout))
+	if err := nl.encoder.flush(); err != nil {
+		nl.fail()
+		return err
+	}
+	return nil
+}
+
+func (nl *networkListener) Flush() error {
+	<-nl.lock
+	defer func() { nl.lock <- true }()
+	return nl.flush()
+}
+
+func (nl *networkListener) TryReceive(entry LogEntry) error {
+	<-nl.lock
+	defer func() { nl.lock <- true }()
+	if nl.closed {
+		return ErrListenerClosed
+	}
+	if nl.conn == nil {
+		if err := nl.connect(); err != nil {
+			return err
+		}
+	}
+	var seq uint64
+	if nl.receipts {
+		nl.seq++
+		seq = nl.seq
+		nl.retain(seq, entry)
+	}
+	nl.conn.SetWriteDeadline(time.Now().Add(nl.opts.WriteTimeout))
+	if err := nl.encoder.encode(entry, seq); err != nil {
+		nl.fail()
+		if seq != 0 {
+			return nil
+		}
+		return err
+	}
+	switch {
+	case nl.encoder.pending >= nl.opts.BatchSize:
+		if err := nl.flush(); err != nil && seq == 0 {
+			return err
+		}
+	case nl.encoder.pending > 0 && nl.flushTimer == nil:
+		nl.flushTimer = time.AfterFunc(nl.opts.BatchInterval, func() { nl.Flush() })
+	}
+	return nil
+}
+
+func (nl *networkListener) Close() error {
+	if !beginClose(&nl.closing) {
+		return nil
+	}
+	acquireForClose(nl.lock, nl.interrupt)
+	defer func() { nl.lock <- true }()
+	nl.closed = true
+	nl.cancel()
+	err := nl.flush()
+	nl.disconnect()
+	return err
+}
+
+// Unblocks a delivery stalled dialing or writing.
+func (nl *networkListener) interrupt() {
+	nl.cancel()
+	if ac := nl.active.Load().(activeConn); ac.conn != nil {
+		ac.conn.SetWriteDeadline(time.Now())
+	}
+}
+
+type streamServer struct {
+	lock     chan bool
+	listener net.Listener
+	ctx      StandardLoggingContext
+	opts     StreamServerOptions
+	conns    map[net.Conn]bool
+	sessions map[string]uint64
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// ServeStreams accepts connections on l until the server is closed,
+// dispatching the entries received into ctx.
+func ServeStreams(l net.Listener, ctx StandardLoggingContext, opts StreamServerOptions) StreamServer {
+	if opts.TLS != nil {
+		l = tls.NewListener(l, opts.TLS)
+	}
+	if opts.AckInterval <= 0 {
+		opts.AckInterval = time.Second
+	}
+	ss := &streamServer{
+		lock:     make(chan bool, 1),
+		listener: l,
+		ctx:      ctx,
+		opts:     opts,
+		conns:    make(map[net.Conn]bool),
+		sessions: make(map[string]uint64),
+	}
+	ss.lock <- true
+	ss.wg.Add(1)
+	go ss.accept()
+	return ss
+}
+
+// NewReceiver listens on address - "tcp:host:port", "unix:path", or a
+// bare "host:port" for TCP - and dispatches the entries received from
+// network listeners into the global context.  handler may be nil.
+func NewReceiver(address string, handler ReceiveHandler) (StreamServer, error) {
+	network, addr := "tcp", address
+	if kind, rest, ok := strings.Cut(address, ":"); ok && (kind == "tcp" || kind == "unix") {
+		network, addr = kind, rest
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return ServeStreams(l, GetGlobalLoggingContext(), StreamServerOptions{Handler: handler}), nil
+}
+
+func (ss *streamServer) Addr() net.Addr {
+	return ss.listener.Addr()
+}
+
+func (ss *streamServer) Connections() int {
+	<-ss.lock
+	defer func() { ss.lock <- true }()
+	return len(ss.conns)
+}
+
+func (ss *streamServer) error(remote net.Addr, err error) {
+	if ss.opts.OnError != nil {
+		ss.opts.OnError(remote, err)
+	}
+}
+
+func (ss *streamServer) accept() {
+	defer ss.wg.Done()
+	for {
+		conn, err := ss.listener.Accept()
+		if err != nil {
+			<-ss.lock
+			closed := ss.closed
+			ss.lock <- true
+			if closed {
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			ss.error(nil, err)
+			return
+		}
+		<-ss.lock
+		if ss.closed {
+			ss.lock <- true
+			conn.Close()
+			return
+		}
+		ss.conns[conn] = true
+		ss.wg.Add(1)
+		ss.lock <- true
+		go ss.serve(conn)
+	}
+}
+
+func (ss *streamServer) serve(conn net.Conn) {
+	defer ss.wg.Done()
+	defer func() {
+		<-ss.lock
+		delete(ss.conns, conn)
+		ss.lock <- true
+		conn.Close()
+	}()
+	authenticated := ss.opts.Authenticate == nil
+	var acker *streamAcker
+	defer func() {
+		if acker != nil {
+			acker.stop()
+		}
+	}()
+	dec := &stdStreamDecoder{r: conn, onHello: func(hello WireHello) error {
+		if !authenticated {
+			if err := ss.authenticate(conn, hello); err != nil {
+				return err
+			}
+			authenticated = true
+		}
+		if hello.Session != "" && acker == nil {
+			acker = newStreamAcker(ss, conn, hello.Session)
+		}
+		return ss.reply(conn, hello)
+	}}
+	for {
+		entry, err := dec.Decode()
+		if err == nil && !authenticated {
+			err = errors.New("stream connection sent entries without a hello")
+		}
+		if err != nil {
+			<-ss.lock
+			closed := ss.closed
+			ss.lock <- true
+			if err != io.EOF && !closed {
+				ss.error(conn.RemoteAddr(), err)
+			}
+			return
+		}
+		we := entry.(*wireEntry)
+		if acker != nil && we.seq != 0 {
+			if !ss.receive(acker.session, we.seq) {
+				continue
+			}
+			acker.schedule()
+		}
+		if ss.opts.Handler != nil && !ss.opts.Handler(conn.RemoteAddr(), we) {
+			continue
+		}
+		ss.dispatch(we)
+	}
+}
+
+func (ss *streamServer) authenticate(conn net.Conn, hello WireHello) error {
+	auth := StreamAuth{Token: hello.Token, Remote: conn.RemoteAddr()}
+	if tc, ok := conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		auth.TLS = &state
+	}
+	if err := ss.opts.Authenticate(auth); err != nil {
+		return fmt.Errorf("stream connection refused: %s", err.Error())
+	}
+	return nil
+}
+
+// Answers a hello offering compression or asking for receipts, with the
+// encodings accepted and where the session resumes.
+func (ss *streamServer) reply(conn net.Conn, hello WireHello) error {
+	accepted := []string{FrameJSON.String()}
+	for _, name := range hello.Encodings {
+		if _, ok := wireCompressions[name]; ok {
+			accepted = append(accepted, name)
+		}
+	}
+	if len(accepted) == 1 && hello.Session == "" {
+		return nil
+	}
+	reply := WireHello{Encodings: accepted}
+	if hello.Session != "" {
+		reply.Session, reply.Resume = hello.Session, ss.resumeFrom(hello.Session)
+	}
+	return writeHello(conn, reply)
+}
+
+func (ss *streamServer) dispatch(we *wireEntry) {
+	stream, _ := ss.ctx.Stream(ss.opts.StreamPrefix + we.stream)
+	if ls, ok := stream.(*stdLogStream); ok {
+		ls.dispatchEntry(&dispatchRequest{level: we.level, received: we})
+		return
+	}
+	DeliverEntry(we, ss.ctx.GlobalListeners())
+}
+
+func (ss *streamServer) Close() error {
+	<-ss.lock
+	ss.closed = true
+	err := ss.listener.Close()
+	for conn := range ss.conns {
+		conn.Close()
+	}
+	ss.lock <- true
+	ss.wg.Wait()
+	return err
+}
@@ -0,0 +1,503 @@
+package log
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"bufio"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNetworkStreaming(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCtx := CreateLoggingContext()
+	cl := newCaptureListener()
+	serverCtx.AddGlobalLogListener(cl, Trace)
+	server := ServeStreams(l, serverCtx, StreamServerOptions{StreamPrefix: "remote/"})
+	defer server.Close()
+
+	ctx := CreateLoggingContext()
+	nl := NewNetworkListener("ship", "tcp", server.Addr().String(), NetworkOptions{})
+	ctx.AddGlobalLogListener(nl, Trace)
+	stream, _ := ctx.Stream("db")
+	stream.LogTemplate(Warning, "slow query {Query} took {Ms}ms", "select 1", 1500)
+	stream.Errorf(errors.New("disk full"), "write failed")
+	nl.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(cl.Entries()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	entries := cl.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	te := entries[0].(TemplatedLogEntry)
+	if te.Stream() != "remote/db" || te.Level() != Warning || te.Message() != "slow query select 1 took 1500ms" ||
+		te.MessageTemplate() != "slow query {Query} took {Ms}ms" || te.Properties()["Ms"] != float64(1500) {
+		t.Errorf("unexpected first entry: %s %s %q %q %v", te.Stream(), te.Level(), te.Message(), te.MessageTemplate(), te.Properties())
+	}
+	if !entries[1].HasAssociatedError() || entries[1].AssociatedError().Error() != "disk full" {
+		t.Errorf("unexpected second entry: %q %v", entries[1].Message(), entries[1].AssociatedError())
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	cl := newCaptureListener()
+	global := GetGlobalLoggingContext()
+	global.AddGlobalLogListener(cl, Trace)
+	defer global.RemoveGlobalLogListener(cl)
+	receiver, err := NewReceiver("tcp:127.0.0.1:0", func(remote net.Addr, entry LogEntry) bool {
+		return entry.Level() != Debug
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	ctx := CreateLoggingContext()
+	nl := NewNetworkListener("ship", "tcp", receiver.Addr().String(), NetworkOptions{})
+	ctx.AddGlobalLogListener(nl, Trace)
+	stream, _ := ctx.Stream("spoke")
+	stream.Logf(Debug, "dropped by the handler")
+	stream.Logf(Info, "republished")
+	nl.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(cl.Entries()) < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	entries := cl.Entries()
+	if len(entries) != 1 || entries[0].Stream() != "spoke" || entries[0].Message() != "republished" {
+		t.Fatalf("expected the info entry only, got %d entries", len(entries))
+	}
+}
+
+// Writes a certificate and key signed by ca (self-signed if ca is nil) to
+// dir as <name>.pem and <name>.key.
+func writeTestCert(t *testing.T, dir, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, server bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.DNSNames = []string{name}
+	}
+	if ca == nil {
+		tmpl.ExtKeyUsage = nil
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		ca, caKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func TestNetworkTLSAuthentication(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeTestCert(t, dir, "ca", nil, nil, false)
+	writeTestCert(t, dir, "logs.internal", ca, caKey, true)
+	writeTestCert(t, dir, "shipper", ca, caKey, false)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	serverTLS, err := LoadServerTLSConfig(path("logs.internal.pem"), path("logs.internal.key"), path("ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCtx := CreateLoggingContext()
+	cl := newCaptureListener()
+	serverCtx.AddGlobalLogListener(cl, Trace)
+	var lock sync.Mutex
+	var peers []string
+	var refused []error
+	server := ServeStreams(l, serverCtx, StreamServerOptions{
+		TLS: serverTLS,
+		Authenticate: func(auth StreamAuth) error {
+			if auth.Token != "s3cret" {
+				return errors.New("bad token")
+			}
+			lock.Lock()
+			peers = append(peers, auth.TLS.PeerCertificates[0].Subject.CommonName)
+			lock.Unlock()
+			return nil
+		},
+		OnError: func(remote net.Addr, err error) {
+			lock.Lock()
+			refused = append(refused, err)
+			lock.Unlock()
+		},
+	})
+	defer server.Close()
+
+	clientTLS, err := LoadClientTLSConfig(path("ca.pem"), path("shipper.pem"), path("shipper.key"), "logs.internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ship := func(token string, config *tls.Config) error {
+		nl := NewNetworkListener("ship", "tcp", server.Addr().String(), NetworkOptions{
+			TLS:   config,
+			Token: func() (string, error) { return token, nil },
+		})
+		defer nl.Close()
+		return nl.TryReceive(&stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "db"}, level: Info, message: token})
+	}
+	if err := ship("s3cret", clientTLS); err != nil {
+		t.Fatal(err)
+	}
+	ship("wrong", clientTLS)
+	noCert, _ := LoadClientTLSConfig(path("ca.pem"), "", "", "logs.internal")
+	ship("s3cret", noCert)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		lock.Lock()
+		n := len(refused)
+		lock.Unlock()
+		if n >= 2 && len(cl.Entries()) >= 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	entries := cl.Entries()
+	if len(entries) != 1 || entries[0].Message() != "s3cret" {
+		t.Fatalf("expected only the authenticated entry, got %d entries", len(entries))
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(peers) != 1 || peers[0] != "shipper" {
+		t.Errorf("expected the client certificate to be verified, got %v", peers)
+	}
+	if len(refused) != 2 {
+		t.Errorf("expected the bad token and missing certificate to be refused, got %v", refused)
+	}
+}
+
+func TestAdminBearerTokens(t *testing.T) {
+	srv := httptest.NewServer(NewAdminHandler(CreateLoggingContext(), AdminOptions{Authenticate: BearerTokens("ops-token")}))
+	defer srv.Close()
+	for token, status := range map[string]int{"": http.StatusUnauthorized, "guess": http.StatusUnauthorized, "ops-token": http.StatusOK} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/levels", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("token %q: expected status %d, got %d", token, status, resp.StatusCode)
+		}
+	}
+}
+
+func TestNetworkCompression(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCtx := CreateLoggingContext()
+	cl := newCaptureListener()
+	serverCtx.AddGlobalLogListener(cl, Trace)
+	server := ServeStreams(l, serverCtx, StreamServerOptions{})
+	defer server.Close()
+
+	if err := NewNetworkListener("ship", "tcp", server.Addr().String(), NetworkOptions{Compression: "zstd"}).TryReceive(
+		&stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "db"}, level: Info}); err == nil {
+		t.Error("expected an unsupported compression to be refused")
+	}
+
+	nl := NewNetworkListener("ship", "tcp", server.Addr().String(), NetworkOptions{Compression: "gzip", BatchSize: 32, BatchInterval: time.Hour})
+	ctx := CreateLoggingContext()
+	ctx.AddGlobalLogListener(nl, Trace)
+	stream, _ := ctx.Stream("db")
+	for i := 0; i < 100; i++ {
+		stream.LogTemplate(Info, "query {N} done", i)
+	}
+	if nl.Compression() != "gzip" {
+		t.Errorf("expected gzip to be negotiated, got %q", nl.Compression())
+	}
+	waitEntries := func(n int) []LogEntry {
+		deadline := time.Now().Add(5 * time.Second)
+		for len(cl.Entries()) < n && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return cl.Entries()
+	}
+	// Three full batches are sent; the rest waits for a flush.
+	if entries := waitEntries(96); len(entries) != 96 {
+		t.Fatalf("expected 96 entries before the flush, got %d", len(entries))
+	}
+	nl.Close()
+	entries := waitEntries(100)
+	if len(entries) != 100 || entries[99].Message() != "query 99 done" {
+		t.Fatalf("expected 100 entries in order after close, got %d", len(entries))
+	}
+
+	// A receiver which never answers the handshake gets json.
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	received := make(chan LogEntry, 1)
+	go func() {
+		conn, err := silent.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		entry, _ := NewStreamDecoder(conn).Decode()
+		received <- entry
+	}()
+	old := NewNetworkListener("ship", "tcp", silent.Addr().String(), NetworkOptions{Compression: "gzip", DialTimeout: 100 * time.Millisecond})
+	defer old.Close()
+	if err := old.TryReceive(&stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "db"}, level: Info, message: "plain"}); err != nil {
+		t.Fatal(err)
+	}
+	if old.Compression() != "" {
+		t.Errorf("expected no compression without a handshake reply, got %q", old.Compression())
+	}
+	select {
+	case entry := <-received:
+		if entry == nil || entry.Message() != "plain" {
+			t.Errorf("unexpected entry from fallback: %v", entry)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no entry received after fallback")
+	}
+}
+
+func TestNetworkFailoverAndProxy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCtx := CreateLoggingContext()
+	cl := newCaptureListener()
+	serverCtx.AddGlobalLogListener(cl, Trace)
+	server := ServeStreams(l, serverCtx, StreamServerOptions{})
+	defer server.Close()
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadAddress := dead.Addr().String()
+	dead.Close()
+
+	nl := NewNetworkListener("ship", "tcp", deadAddress, NetworkOptions{Failover: []string{server.Addr().String()}})
+	defer nl.Close()
+	if err := nl.TryReceive(&stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "db"}, level: Info, message: "failed over"}); err != nil {
+		t.Fatal(err)
+	}
+	if nl.Endpoint() != server.Addr().String() {
+		t.Errorf("expected the failover endpoint to be used, got %q", nl.Endpoint())
+	}
+
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	tunnels := make(chan string, 1)
+	go func() {
+		conn, err := proxy.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+		tunnels <- req.Host
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			return
+		}
+		defer target.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(target, conn)
+		io.Copy(conn, target)
+	}()
+	proxied := NewNetworkListener("ship", "tcp", server.Addr().String(), NetworkOptions{
+		Proxy: func(address string) (*url.URL, error) { return &url.URL{Scheme: "http", Host: proxy.Addr().String()}, nil },
+	})
+	defer proxied.Close()
+	if err := proxied.TryReceive(&stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "db"}, level: Info, message: "proxied"}); err != nil {
+		t.Fatal(err)
+	}
+	if host := <-tunnels; host != server.Addr().String() {
+		t.Errorf("expected a tunnel to %s, got %s", server.Addr(), host)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(cl.Entries()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	messages := make(map[string]bool)
+	for _, entry := range cl.Entries() {
+		messages[entry.Message()] = true
+	}
+	if len(messages) != 2 || !messages["failed over"] || !messages["proxied"] {
+		t.Fatalf("expected the failed over and proxied entries, got %v", messages)
+	}
+}
+
+// Relays connections to address, discarding what clients send while
+// blackholed.
+type testRelay struct {
+	net.Listener
+	lock      sync.Mutex
+	blackhole bool
+	conns     []net.Conn
+}
+
+func newTestRelay(t *testing.T, address string) *testRelay {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &testRelay{Listener: l}
+	go func() {
+		for {
+			client, err := l.Accept()
+			if err != nil {
+				return
+			}
+			server, err := net.Dial("tcp", address)
+			if err != nil {
+				client.Close()
+				continue
+			}
+			tr.lock.Lock()
+			tr.conns = append(tr.conns, client, server)
+			tr.lock.Unlock()
+			go io.Copy(client, server)
+			go func() {
+				buf := make([]byte, 4096)
+				for {
+					n, err := client.Read(buf)
+					if err != nil {
+						server.Close()
+						return
+					}
+					tr.lock.Lock()
+					blackhole := tr.blackhole
+					tr.lock.Unlock()
+					if !blackhole {
+						server.Write(buf[:n])
+					}
+				}
+			}()
+		}
+	}()
+	return tr
+}
+
+func (tr *testRelay) setBlackhole(blackhole bool) {
+	tr.lock.Lock()
+	tr.blackhole = blackhole
+	tr.lock.Unlock()
+}
+
+func (tr *testRelay) cut() {
+	tr.lock.Lock()
+	for _, conn := range tr.conns {
+		conn.Close()
+	}
+	tr.conns = nil
+	tr.lock.Unlock()
+}
+
+func TestNetworkReceipts(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCtx := CreateLoggingContext()
+	cl := newCaptureListener()
+	serverCtx.AddGlobalLogListener(cl, Trace)
+	server := ServeStreams(l, serverCtx, StreamServerOptions{AckInterval: 10 * time.Millisecond})
+	defer server.Close()
+	relay := newTestRelay(t, server.Addr().String())
+	defer relay.Close()
+
+	nl := NewNetworkListener("ship", "tcp", relay.Addr().String(), NetworkOptions{Receipts: true, RetryInterval: time.Millisecond})
+	defer nl.Close()
+	send := func(message string) {
+		if err := nl.TryReceive(&stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "db"}, level: Info, message: message}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(what string, done func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for " + what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	for _, message := range []string{"one", "two", "three"} {
+		send(message)
+	}
+	waitFor("acknowledgement", func() bool { return nl.Unacknowledged() == 0 })
+
+	relay.setBlackhole(true)
+	send("four")
+	send("five")
+	time.Sleep(50 * time.Millisecond)
+	if n := nl.Unacknowledged(); n != 2 {
+		t.Fatalf("expected 2 unacknowledged entries, got %d", n)
+	}
+	relay.cut()
+	relay.setBlackhole(false)
+	waitFor("disconnect", func() bool { return !nl.Connected() })
+	send("six")
+	waitFor("resent entries", func() bool { return len(cl.Entries()) >= 6 })
+	waitFor("acknowledgement", func() bool { return nl.Unacknowledged() == 0 })
+
+	var messages []string
+	for _, entry := range cl.Entries() {
+		messages = append(messages, entry.Message())
+	}
+	if fmt.Sprint(messages) != "[one two three four five six]" {
+		t.Errorf("expected each entry once, in order, got %v", messages)
+	}
+}
@@ -0,0 +1,167 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+type NotifyOptions struct {
+	// Level is the least severe level notified; defaults to FatalError.
+	Level LogLevel
+	// Bell writes a BEL character to Terminal (default os.Stderr).
+	Bell     bool
+	Terminal io.Writer
+	// Desktop raises a desktop notification.
+	Desktop bool
+	// Notify replaces the platform's desktop notifier.
+	Notify func(title, body string) error
+	// Title defaults to the program name.
+	Title string
+	// MinInterval between notifications; defaults to 10s.
+	MinInterval time.Duration
+}
+
+type NotifyListener interface {
+	LogListener
+	FallibleLogListener
+	// Suppressed returns the number of entries not notified because of
+	// the rate limit.
+	Suppressed() uint64
+}
+
+///
+
+type notifyListener struct {
+	lock       chan bool
+	name       string
+	opts       NotifyOptions
+	last       time.Time
+	pending    int
+	suppressed uint64
+}
+
+// NewNotifyListener rings the terminal bell or raises a desktop
+// notification for severe entries, at most once per MinInterval.  It is
+// meant for local development: it runs a process per notification.
+func NewNotifyListener(name string, opts NotifyOptions) NotifyListener {
+	if opts.Level == Default || opts.Level == All {
+		opts.Level = FatalError
+	}
+	if opts.Terminal == nil {
+		opts.Terminal = os.Stderr
+	}
+	if opts.Notify == nil {
+		opts.Notify = desktopNotify
+	}
+	if opts.Title == "" {
+		opts.Title = programName()
+	}
+	if opts.MinInterval <= 0 {
+		opts.MinInterval = 10 * time.Second
+	}
+	nl := &notifyListener{
+		lock: make(chan bool, 1),
+		name: name,
+		opts: opts,
+	}
+	nl.lock <- true
+	return nl
+}
+
+func (nl *notifyListener) Name() string {
+	return nl.name
+}
+
+func (nl *notifyListener) Receive(entry LogEntry) {
+	nl.TryReceive(entry)
+}
+
+func (nl *notifyListener) TryReceive(entry LogEntry) error {
+	if !admits(nl.opts.Level, entry.Level()) {
+		return nil
+	}
+	<-nl.lock
+	now := time.Now()
+	if !nl.last.IsZero() && now.Sub(nl.last) < nl.opts.MinInterval {
+		nl.pending++
+		nl.suppressed++
+		nl.lock <- true
+		return nil
+	}
+	nl.last = now
+	more := nl.pending
+	nl.pending = 0
+	nl.lock <- true
+	body := fmt.Sprintf("%s [%s] %s", entry.Level(), entry.Stream(), PrefixedMessage(entry))
+	if more > 0 {
+		body = fmt.Sprintf("%s (and %d more)", body, more)
+	}
+	var failed []string
+	if nl.opts.Bell {
+		if _, err := nl.opts.Terminal.Write([]byte{'\a'}); err != nil {
+			failed = append(failed, "bell: "+err.Error())
+		}
+	}
+	if nl.opts.Desktop {
+		if err := nl.opts.Notify(nl.opts.Title, body); err != nil {
+			failed = append(failed, "desktop: "+err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("notification failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (nl *notifyListener) Suppressed() uint64 {
+	<-nl.lock
+	defer func() { nl.lock <- true }()
+	return nl.suppressed
+}
+
+func (nl *notifyListener) Close() error {
+	return nil
+}
+
+func programName() string {
+	if len(os.Args) == 0 || os.Args[0] == "" {
+		return "log"
+	}
+	name := os.Args[0]
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// Starts the platform's notifier without waiting for it; the process is
+// reaped in the background.
+func desktopNotify(title, body string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(body), appleScriptString(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		cmd = exec.Command("notify-send", "--urgency=critical", "--", title, body)
+	default:
+		return errors.New("no desktop notifier on " + runtime.GOOS)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+func appleScriptString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
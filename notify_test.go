@@ -0,0 +1,45 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyListener(t *testing.T) {
+	var bell bytes.Buffer
+	var bodies []string
+	nl := NewNotifyListener("notify", NotifyOptions{
+		Bell:     true,
+		Terminal: &bell,
+		Desktop:  true,
+		Notify: func(title, body string) error {
+			bodies = append(bodies, title+": "+body)
+			return nil
+		},
+		Title:       "svc",
+		MinInterval: 50 * time.Millisecond,
+	})
+	ctx := CreateLoggingContext()
+	ctx.AddGlobalLogListener(nl, Trace)
+	stream, _ := ctx.Stream("app")
+	stream.Log(Error, "ignored")
+	stream.Log(FatalError, "disk gone")
+	stream.Log(FatalError, "still gone")
+	stream.Log(FatalError, "really gone")
+	if len(bodies) != 1 || bodies[0] != "svc: FatalError [app] disk gone" {
+		t.Fatalf("unexpected notifications: %q", bodies)
+	}
+	if nl.Suppressed() != 2 {
+		t.Errorf("expected 2 suppressed entries, got %d", nl.Suppressed())
+	}
+	time.Sleep(60 * time.Millisecond)
+	stream.Log(FatalError, "back again")
+	if len(bodies) != 2 || !strings.HasSuffix(bodies[1], "back again (and 2 more)") {
+		t.Errorf("unexpected notifications: %q", bodies)
+	}
+	if bell.String() != "\a\a" {
+		t.Errorf("expected two bells, got %q", bell.String())
+	}
+}
@@ -0,0 +1,94 @@
+package log
+
+import (
+	"time"
+)
+
+// An Operation times a unit of work and logs its outcome, observing the
+// duration into log_operation_duration_seconds by operation and outcome.
+type Operation interface {
+	Name() string
+	Elapsed() time.Duration
+	End()
+	Fail(err error)
+}
+
+// SetOperationMetrics sets the registry operation histograms are recorded
+// in (DefaultMetricsRegistry() initially); nil disables recording.
+func SetOperationMetrics(reg MetricsRegistry) {
+	<-_GLOBAL_operationLock
+	defer func() { _GLOBAL_operationLock <- true }()
+	_GLOBAL_operationMetrics = reg
+}
+
+// SetOperationLevel sets the level successful operations are logged at
+// (Debug initially).  Failures are logged at Error.
+func SetOperationLevel(level LogLevel) {
+	<-_GLOBAL_operationLock
+	defer func() { _GLOBAL_operationLock <- true }()
+	_GLOBAL_operationLevel = level
+}
+
+///
+
+var _GLOBAL_operationMetrics MetricsRegistry = _GLOBAL_metrics
+var _GLOBAL_operationLevel LogLevel = Debug
+var _GLOBAL_operationLock chan bool = make(chan bool, 1)
+
+func init() {
+	_GLOBAL_operationLock <- true
+}
+
+type stdOperation struct {
+	log   Log
+	name  string
+	start time.Time
+}
+
+func StartOperation(log Log, name string) Operation {
+	return &stdOperation{
+		log:   log,
+		name:  name,
+		start: time.Now(),
+	}
+}
+
+func (op *stdOperation) Name() string {
+	return op.name
+}
+
+func (op *stdOperation) Elapsed() time.Duration {
+	return time.Since(op.start)
+}
+
+func (op *stdOperation) End() {
+	op.finish(nil)
+}
+
+func (op *stdOperation) Fail(err error) {
+	op.finish(err)
+}
+
+func (op *stdOperation) finish(err error) {
+	elapsed := time.Since(op.start)
+	<-_GLOBAL_operationLock
+	reg, level := _GLOBAL_operationMetrics, _GLOBAL_operationLevel
+	_GLOBAL_operationLock <- true
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	if reg != nil {
+		reg.Histogram("log_operation_duration_seconds",
+			map[string]string{"operation": op.name, "outcome": outcome},
+			DefaultLatencyBuckets).Observe(elapsed.Seconds())
+	}
+	if op.log == nil {
+		return
+	}
+	if err != nil {
+		op.log.LogTemplate(Error, "{Operation} failed after {Duration}: {Error}", op.name, elapsed, err)
+	} else {
+		op.log.LogTemplate(level, "{Operation} completed in {Duration}", op.name, elapsed)
+	}
+}
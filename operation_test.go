@@ -0,0 +1,36 @@
+package log
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOperationMetrics(t *testing.T) {
+	reg := NewMetricsRegistry()
+	SetOperationMetrics(reg)
+	SetOperationLevel(Info)
+	defer SetOperationMetrics(DefaultMetricsRegistry())
+	defer SetOperationLevel(Debug)
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("ops")
+	StartOperation(stream, "fetch").End()
+	StartOperation(stream, "fetch").End()
+	StartOperation(stream, "fetch").Fail(errors.New("timeout"))
+	ctx.Flush()
+	for outcome, want := range map[string]uint64{"ok": 2, "error": 1} {
+		snap := reg.Histogram("log_operation_duration_seconds", map[string]string{"operation": "fetch", "outcome": outcome}, nil).Snapshot()
+		if snap.Count != want || len(snap.Bounds) != len(DefaultLatencyBuckets) {
+			t.Errorf("%s: %d observations in %d buckets", outcome, snap.Count, len(snap.Bounds))
+		}
+	}
+	entries := cl.Entries()
+	if len(entries) != 3 || entries[0].Level() != Info || entries[2].Level() != Error {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	props := entries[2].(TemplatedLogEntry).Properties()
+	if props["Operation"] != "fetch" || props["Error"] == nil || props["Duration"] == nil {
+		t.Errorf("unexpected properties %v", props)
+	}
+}
@@ -0,0 +1,24 @@
+package log
+
+import (
+	"runtime"
+)
+
+var _GLOBAL_packageStreams = newStreamCache()
+
+// Package returns the global context's stream named after the calling
+// package's import path.
+func Package() LogStream {
+	pc, file, _, ok := runtime.Caller(1)
+	if stream, has := _GLOBAL_packageStreams.get(pc); has {
+		return stream
+	}
+	name := "unknown"
+	if fn := runtime.FuncForPC(pc); ok && fn != nil {
+		if pkg := funcPackage(fn.Name(), file); pkg != "" {
+			name = pkg
+		}
+	}
+	stream, _ := GetGlobalLoggingContext().Stream(name)
+	return _GLOBAL_packageStreams.add(pc, stream)
+}
@@ -0,0 +1,41 @@
+package log
+
+import "testing"
+
+func TestPackage(t *testing.T) {
+	var streams []LogStream
+	for i := 0; i < 2; i++ {
+		streams = append(streams, Package())
+	}
+	func() {
+		streams = append(streams, Package())
+	}()
+	for _, stream := range streams {
+		if stream.Name() != "github.com/dtromb/log" {
+			t.Errorf("unexpected package stream %q", stream.Name())
+		}
+	}
+	if streams[0] != streams[1] || streams[0] != streams[2] {
+		t.Errorf("expected the same stream for every call site in a package")
+	}
+}
+
+func TestLoggerCache(t *testing.T) {
+	first := Logger("cached")
+	if Logger("cached") != first {
+		t.Errorf("expected the cached stream")
+	}
+	if stream, _ := GetGlobalLoggingContext().Stream("cached"); stream != first {
+		t.Errorf("expected the context's stream")
+	}
+	done := make(chan Log)
+	for i := 0; i < 8; i++ {
+		go func() { done <- Logger("raced") }()
+	}
+	raced := <-done
+	for i := 1; i < 8; i++ {
+		if <-done != raced {
+			t.Errorf("expected one stream for concurrent lookups")
+		}
+	}
+}
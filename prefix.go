@@ -0,0 +1,90 @@
+package log
+
+import (
+	"strings"
+)
+
+// A stream's prefix is a template whose holes are filled from the entry's
+// properties.  Entries keep their message unprefixed; formatters write
+// PrefixedMessage(entry).
+type PrefixedLogEntry interface {
+	LogEntry
+	// MessagePrefix returns the prefix of the entry's stream when it was
+	// logged, as a template.
+	MessagePrefix() string
+}
+
+///
+
+var prefixEscaper = strings.NewReplacer("{", "{{", "}", "}}")
+
+// PrefixedMessage returns an entry's message after its rendered prefix.
+func PrefixedMessage(entry LogEntry) string {
+	return renderedPrefix(entry) + entry.Message()
+}
+
+// RenderPrefix renders a prefix template, filling its holes from properties.
+func RenderPrefix(prefix string, properties map[string]interface{}) string {
+	if prefix == "" {
+		return ""
+	}
+	return cachedMessageTemplate(prefix).renderProperties(properties)
+}
+
+func renderedPrefix(entry LogEntry) string {
+	pe, ok := entry.(PrefixedLogEntry)
+	if !ok {
+		return ""
+	}
+	prefix := pe.MessagePrefix()
+	if prefix == "" {
+		return ""
+	}
+	mt := cachedMessageTemplate(prefix)
+	var props map[string]interface{}
+	if te, ok := entry.(TemplatedLogEntry); ok && len(mt.names) > 0 {
+		props = te.Properties()
+	}
+	return mt.renderProperties(props)
+}
+
+// Renders the template with holes filled by name.
+func (mt *stdMessageTemplate) renderProperties(props map[string]interface{}) string {
+	var buf []byte
+	for _, tok := range mt.tokens {
+		value, has := props[tok.name]
+		if !tok.hole || !has {
+			buf = append(buf, tok.text...)
+			continue
+		}
+		buf = append(buf, tok.renderValue(value)...)
+	}
+	return string(buf)
+}
+
+func (ls *stdLogStream) Prefix() string {
+	<-ls.lock
+	defer func() { ls.lock <- true }()
+	return ls.prefix
+}
+
+func (ls *stdLogStream) SetPrefix(prefix string) {
+	<-ls.lock
+	defer func() { ls.lock <- true }()
+	ls.prefix = prefix
+}
+
+func (le *stdLogEntry) MessagePrefix() string {
+	return le.prefix
+}
+
+func (de *derivedEntry) MessagePrefix() string {
+	if pe, ok := de.LogEntry.(PrefixedLogEntry); ok {
+		return pe.MessagePrefix()
+	}
+	return ""
+}
+
+func (we *wireEntry) MessagePrefix() string {
+	return prefixEscaper.Replace(we.prefix)
+}
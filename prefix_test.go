@@ -0,0 +1,46 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamPrefix(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Info)
+	stream, _ := ctx.Stream("cache")
+	stream.SetPrefix("[cache] ")
+	stream.Info("warmed")
+	stream.SetPrefix("[{Shard}] ")
+	stream.With("Shard", 3).Info("evicted")
+	stream.Info("flushed")
+	entries := cl.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	want := []string{"[cache] warmed", "[3] evicted", "[{Shard}] flushed"}
+	for i, entry := range entries {
+		if got := PrefixedMessage(entry); got != want[i] {
+			t.Errorf("expected %q, got %q", want[i], got)
+		}
+	}
+	if entries[1].Message() != "evicted" {
+		t.Errorf("expected the message unprefixed, got %q", entries[1].Message())
+	}
+	if out := NewJSONFormatter().Format(entries[1]); !strings.Contains(out, `"msg":"[3] evicted"`) {
+		t.Errorf("expected the JSON formatter to write the prefix:\n%s", out)
+	}
+
+	data, err := encodeWireEntry(entries[1], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, err := decodeWireEntry(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := PrefixedMessage(received); got != "[3] evicted" {
+		t.Errorf("expected the prefix to survive the wire, got %q", got)
+	}
+}
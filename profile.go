@@ -0,0 +1,130 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+type ProfileKind string
+
+const (
+	ProfileCPU       = ProfileKind("cpu")
+	ProfileHeap      = ProfileKind("heap")
+	ProfileGoroutine = ProfileKind("goroutine")
+)
+
+type ProfileOptions struct {
+	// Dir receives the profiles; defaults to os.TempDir().
+	Dir string
+	// Kinds defaults to heap and goroutine profiles.
+	Kinds []ProfileKind
+	// CPUDuration defaults to 10s.
+	CPUDuration time.Duration
+}
+
+///
+
+type profileAction struct {
+	opts ProfileOptions
+}
+
+// NewProfileAction captures pprof profiles when a trigger fires, adding
+// their paths to the triggering entry.  The CPU profile is recorded in the
+// background for CPUDuration.
+func NewProfileAction(opts ProfileOptions) TriggerAction {
+	if opts.Dir == "" {
+		opts.Dir = os.TempDir()
+	}
+	if len(opts.Kinds) == 0 {
+		opts.Kinds = []ProfileKind{ProfileHeap, ProfileGoroutine}
+	}
+	if opts.CPUDuration <= 0 {
+		opts.CPUDuration = 10 * time.Second
+	}
+	return &profileAction{opts: opts}
+}
+
+func (pa *profileAction) Run(ev *TriggerEvent) error {
+	if err := os.MkdirAll(pa.opts.Dir, 0755); err != nil {
+		return err
+	}
+	var errs []error
+	for _, kind := range pa.opts.Kinds {
+		name := fmt.Sprintf("%s-%s-%s.pprof", profileFileName(ev.Trigger), kind, ev.At.UTC().Format("20060102-150405.000"))
+		path := filepath.Join(pa.opts.Dir, name)
+		var err error
+		if kind == ProfileCPU {
+			err = pa.startCPUProfile(path)
+		} else {
+			err = writeProfile(kind, path)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s profile: %w", kind, err))
+			continue
+		}
+		ev.AddField(profileField(kind), path)
+	}
+	return errors.Join(errs...)
+}
+
+func profileField(kind ProfileKind) string {
+	switch kind {
+	case ProfileCPU:
+		return "CPUProfile"
+	case ProfileHeap:
+		return "HeapProfile"
+	case ProfileGoroutine:
+		return "GoroutineProfile"
+	}
+	return "Profile"
+}
+
+func writeProfile(kind ProfileKind, path string) error {
+	profile := pprof.Lookup(string(kind))
+	if profile == nil {
+		return fmt.Errorf("unknown profile '%s'", kind)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := profile.WriteTo(file, 0); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// The trigger name with anything that could leave Dir, or upset a
+// filesystem, replaced.
+func profileFileName(trigger string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, trigger)
+}
+
+func (pa *profileAction) startCPUProfile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	go func() {
+		time.Sleep(pa.opts.CPUDuration)
+		pprof.StopCPUProfile()
+		file.Close()
+	}()
+	return nil
+}
@@ -0,0 +1,389 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An EntryQuery is a boolean expression over entries, such as
+//
+//	level >= Warning && stream == "db" && message =~ "time(d )?out"
+//
+// The fields are level, stream, message, error and template; other names
+// are properties, and a name on its own tests for presence.  Levels
+// compare by severity.
+type EntryQuery interface {
+	Match(entry LogEntry) bool
+	String() string
+}
+
+///
+
+type queryNode interface {
+	match(entry LogEntry) bool
+}
+
+type stdEntryQuery struct {
+	text string
+	root queryNode
+}
+
+func ParseQuery(text string) (EntryQuery, error) {
+	p := &queryParser{text: text}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in query at offset %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+	return &stdEntryQuery{text: text, root: root}, nil
+}
+
+// ParseLogLevel looks up a level by name, ignoring case and the hyphen in
+// numbered levels ("error-2", "Error2"); "fatal" and "warn" are accepted
+// as well.
+func ParseLogLevel(name string) (LogLevel, bool) {
+	norm := strings.ToLower(strings.Replace(name, "-", "", -1))
+	switch norm {
+	case "fatal":
+		return FatalError, true
+	case "warn":
+		return Warning, true
+	}
+	for l := All; l <= None; l++ {
+		if strings.ToLower(strings.Replace(l.String(), "-", "", -1)) == norm {
+			return l, true
+		}
+	}
+	return None, false
+}
+
+func (q *stdEntryQuery) Match(entry LogEntry) bool {
+	return q.root.match(entry)
+}
+
+func (q *stdEntryQuery) String() string {
+	return q.text
+}
+
+type queryToken struct {
+	kind   byte // 'i'dent, 's'tring, 'n'umber, 'o'perator
+	text   string
+	offset int
+}
+
+type queryParser struct {
+	text   string
+	tokens []queryToken
+	pos    int
+}
+
+var queryOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"}
+
+func (p *queryParser) tokenize() error {
+	text := p.text
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			var buf []byte
+			j := i + 1
+			for ; j < len(text) && text[j] != c; j++ {
+				if text[j] == '\\' && j+1 < len(text) {
+					j++
+				}
+				buf = append(buf, text[j])
+			}
+			if j >= len(text) {
+				return fmt.Errorf("unterminated string in query at offset %d", i)
+			}
+			p.tokens = append(p.tokens, queryToken{kind: 's', text: string(buf), offset: i})
+			i = j + 1
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(text) && (text[j] >= '0' && text[j] <= '9' || text[j] == '.' || text[j] == 'e' || text[j] == 'E') {
+				j++
+			}
+			p.tokens = append(p.tokens, queryToken{kind: 'n', text: text[i:j], offset: i})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(text) && (text[j] == '_' || text[j] == '.' || text[j] == '-' || text[j] >= '0' && text[j] <= '9' ||
+				text[j] >= 'a' && text[j] <= 'z' || text[j] >= 'A' && text[j] <= 'Z') {
+				j++
+			}
+			word := text[i:j]
+			switch strings.ToLower(word) {
+			case "and":
+				p.tokens = append(p.tokens, queryToken{kind: 'o', text: "&&", offset: i})
+			case "or":
+				p.tokens = append(p.tokens, queryToken{kind: 'o', text: "||", offset: i})
+			case "not":
+				p.tokens = append(p.tokens, queryToken{kind: 'o', text: "!", offset: i})
+			default:
+				p.tokens = append(p.tokens, queryToken{kind: 'i', text: word, offset: i})
+			}
+			i = j
+		default:
+			matched := false
+			for _, op := range queryOperators {
+				if strings.HasPrefix(text[i:], op) {
+					p.tokens = append(p.tokens, queryToken{kind: 'o', text: op, offset: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("unexpected character '%c' in query at offset %d", c, i)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *queryParser) peek(op string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == 'o' && p.tokens[p.pos].text == op
+}
+
+type queryAnd struct{ left, right queryNode }
+type queryOr struct{ left, right queryNode }
+type queryNot struct{ node queryNode }
+
+func (n *queryAnd) match(entry LogEntry) bool { return n.left.match(entry) && n.right.match(entry) }
+func (n *queryOr) match(entry LogEntry) bool  { return n.left.match(entry) || n.right.match(entry) }
+func (n *queryNot) match(entry LogEntry) bool { return !n.node.match(entry) }
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek("||") {
+		p.pos++
+		var right queryNode
+		if right, err = p.parseAnd(); err == nil {
+			left = &queryOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek("&&") {
+		p.pos++
+		var right queryNode
+		if right, err = p.parseUnary(); err == nil {
+			left = &queryAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek("!") {
+		p.pos++
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNot{node}, nil
+	}
+	if p.peek("(") {
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")") {
+			return nil, fmt.Errorf("missing ')' in query")
+		}
+		p.pos++
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+type queryComparison struct {
+	field string
+	op    string
+	value string
+	num   float64
+	isNum bool
+	level LogLevel
+	re    *regexp.Regexp
+}
+
+func (p *queryParser) parseComparison() (queryNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	tok := p.tokens[p.pos]
+	if tok.kind != 'i' {
+		return nil, fmt.Errorf("expected a field name in query at offset %d", tok.offset)
+	}
+	p.pos++
+	cmp := &queryComparison{field: tok.text}
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != 'o' {
+		return cmp, nil
+	}
+	switch op := p.tokens[p.pos].text; op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+		cmp.op = op
+	default:
+		return cmp, nil
+	}
+	p.pos++
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind == 'o' {
+		return nil, fmt.Errorf("missing value after '%s' in query", cmp.op)
+	}
+	val := p.tokens[p.pos]
+	p.pos++
+	cmp.value = val.text
+	if val.kind == 'n' {
+		num, err := strconv.ParseFloat(val.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' in query", val.text)
+		}
+		cmp.num, cmp.isNum = num, true
+	}
+	if cmp.op == "=~" || cmp.op == "!~" {
+		re, err := regexp.Compile(cmp.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression in query: %s", err.Error())
+		}
+		cmp.re = re
+	} else if cmp.field == "level" {
+		level, ok := ParseLogLevel(cmp.value)
+		if !ok {
+			return nil, fmt.Errorf("unknown log level '%s' in query", cmp.value)
+		}
+		cmp.level = level
+	}
+	return cmp, nil
+}
+
+// Returns the field's value as a string (or a property's raw value), and
+// whether it is present.
+func (cmp *queryComparison) lookup(entry LogEntry) (interface{}, bool) {
+	switch cmp.field {
+	case "stream":
+		return entry.Stream(), true
+	case "message":
+		return entry.Message(), true
+	case "error":
+		if !entry.HasAssociatedError() {
+			return nil, false
+		}
+		return entry.AssociatedError().Error(), true
+	case "template":
+		if te, ok := entry.(TemplatedLogEntry); ok {
+			return te.MessageTemplate(), true
+		}
+		return nil, false
+	}
+	if te, ok := entry.(TemplatedLogEntry); ok {
+		if v, has := te.Properties()[cmp.field]; has {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (cmp *queryComparison) match(entry LogEntry) bool {
+	if cmp.field == "level" && cmp.re == nil {
+		if cmp.op == "" {
+			return true
+		}
+		return compareOrdered(cmp.op, entry.Level().Severity(), cmp.level.Severity())
+	}
+	var v interface{}
+	var has bool
+	if cmp.field == "level" {
+		v, has = entry.Level().String(), true
+	} else {
+		v, has = cmp.lookup(entry)
+	}
+	if cmp.op == "" {
+		return has
+	}
+	if !has {
+		return cmp.op == "!=" || cmp.op == "!~"
+	}
+	str := fmt.Sprintf("%v", v)
+	switch cmp.op {
+	case "=~":
+		return cmp.re.MatchString(str)
+	case "!~":
+		return !cmp.re.MatchString(str)
+	}
+	if cmp.isNum {
+		if num, ok := queryNumber(v); ok {
+			switch {
+			case num < cmp.num:
+				return compareOrdered(cmp.op, 0, 1)
+			case num > cmp.num:
+				return compareOrdered(cmp.op, 1, 0)
+			}
+			return compareOrdered(cmp.op, 0, 0)
+		}
+	}
+	return compareOrdered(cmp.op, strings.Compare(str, cmp.value), 0)
+}
+
+func compareOrdered(op string, a, b int) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+func queryNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
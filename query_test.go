@@ -0,0 +1,50 @@
+package log
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	mt := cachedMessageTemplate("user {UserId} from {IP}")
+	entry := &stdLogEntry{
+		ts:              time.Now(),
+		stream:          &stdLogStream{name: "db"},
+		level:           Warning2,
+		message:         mt.Render(42, "10.0.0.1"),
+		associatedError: errors.New("connection timed out"),
+		template:        mt,
+		properties:      mt.Capture(42, "10.0.0.1"),
+	}
+	cases := map[string]bool{
+		`level >= Warning`:                      false,
+		`level >= Warning-3`:                    true,
+		`level > Info && stream == "db"`:        true,
+		`level == warning2`:                     true,
+		`stream != 'db' || UserId == 42`:        true,
+		`UserId > 41.5 and IP =~ "^10\\."`:      true,
+		`not (UserId >= 43)`:                    true,
+		`error =~ "time(d )?out"`:               true,
+		`missing == 1`:                          false,
+		`missing != 1`:                          true,
+		`UserId && !missing`:                    true,
+		`template == "user {UserId} from {IP}"`: true,
+		`message !~ "user" || stream > "dc"`:    false,
+	}
+	for text, want := range cases {
+		q, err := ParseQuery(text)
+		if err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		if got := q.Match(entry); got != want {
+			t.Errorf("%s: got %v, want %v", text, got, want)
+		}
+	}
+	for _, bad := range []string{`level >= Loud`, `(stream == "x"`, `stream ==`, `message =~ "("`, `"x" == stream`} {
+		if _, err := ParseQuery(bad); err == nil {
+			t.Errorf("%s: expected a parse error", bad)
+		}
+	}
+}
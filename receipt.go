@@ -0,0 +1,174 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"time"
+)
+
+// The server remembers the last number received in up to
+// maxReceiptSessions sessions, so that a reconnecting listener resends only
+// the entries the server did not receive.
+const maxReceiptSessions = 4096
+
+///
+
+type retainedEntry struct {
+	seq   uint64
+	entry LogEntry
+}
+
+func newReceiptSession() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+func (nl *networkListener) retain(seq uint64, entry LogEntry) {
+	<-nl.retainLock
+	defer func() { nl.retainLock <- true }()
+	nl.retained = append(nl.retained, retainedEntry{seq: seq, entry: entry})
+	if len(nl.retained) > nl.opts.RetainEntries {
+		nl.retained = nl.retained[len(nl.retained)-nl.opts.RetainEntries:]
+	}
+}
+
+func (nl *networkListener) acknowledge(seq uint64) {
+	<-nl.retainLock
+	defer func() { nl.retainLock <- true }()
+	i := 0
+	for i < len(nl.retained) && nl.retained[i].seq <= seq {
+		i++
+	}
+	nl.retained = append(nl.retained[:0], nl.retained[i:]...)
+}
+
+func (nl *networkListener) unacknowledged() []retainedEntry {
+	<-nl.retainLock
+	defer func() { nl.retainLock <- true }()
+	return append([]retainedEntry(nil), nl.retained...)
+}
+
+func (nl *networkListener) Unacknowledged() int {
+	<-nl.retainLock
+	defer func() { nl.retainLock <- true }()
+	return len(nl.retained)
+}
+
+// FlushContext flushes, then with receipts waits until the entries sent
+// have been acknowledged or ctx is done; the entries still unacknowledged
+// are unsent.
+func (nl *networkListener) FlushContext(ctx context.Context) (int, error) {
+	if err := nl.Flush(); err != nil {
+		return nl.Unacknowledged(), err
+	}
+	if !nl.receipts {
+		return 0, nil
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		n := nl.Unacknowledged()
+		if n == 0 {
+			return 0, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return n, ctx.Err()
+		}
+	}
+}
+
+// Reads receipts from conn until it is closed; a connection closed by the
+// server is dropped, so that the next entry reconnects.
+func (nl *networkListener) readReceipts(conn net.Conn) {
+	for {
+		encoding, payload, err := ReadFrame(conn)
+		if err != nil {
+			<-nl.lock
+			if nl.conn == conn {
+				nl.fail()
+			}
+			nl.lock <- true
+			return
+		}
+		var ack wireAck
+		if encoding == FrameAck && json.Unmarshal(payload, &ack) == nil {
+			nl.acknowledge(ack.Seq)
+		}
+	}
+}
+
+// Records a received entry's sequence number, returning false for an entry
+// already received.
+func (ss *streamServer) receive(session string, seq uint64) bool {
+	<-ss.lock
+	defer func() { ss.lock <- true }()
+	last, ok := ss.sessions[session]
+	if seq <= last {
+		return false
+	}
+	if !ok && len(ss.sessions) >= maxReceiptSessions {
+		for s := range ss.sessions {
+			delete(ss.sessions, s)
+			break
+		}
+	}
+	ss.sessions[session] = seq
+	return true
+}
+
+func (ss *streamServer) resumeFrom(session string) uint64 {
+	<-ss.lock
+	defer func() { ss.lock <- true }()
+	return ss.sessions[session]
+}
+
+// Acknowledges a connection's entries, at most once per AckInterval.
+type streamAcker struct {
+	lock    chan bool
+	ss      *streamServer
+	conn    net.Conn
+	session string
+	timer   *time.Timer
+	stopped bool
+}
+
+func newStreamAcker(ss *streamServer, conn net.Conn, session string) *streamAcker {
+	sa := &streamAcker{lock: make(chan bool, 1), ss: ss, conn: conn, session: session}
+	sa.lock <- true
+	return sa
+}
+
+func (sa *streamAcker) schedule() {
+	<-sa.lock
+	defer func() { sa.lock <- true }()
+	if sa.timer == nil && !sa.stopped {
+		sa.timer = time.AfterFunc(sa.ss.opts.AckInterval, sa.ack)
+	}
+}
+
+func (sa *streamAcker) ack() {
+	<-sa.lock
+	defer func() { sa.lock <- true }()
+	sa.timer = nil
+	if sa.stopped {
+		return
+	}
+	sa.conn.SetWriteDeadline(time.Now().Add(sa.ss.opts.AckInterval + 5*time.Second))
+	writeAck(sa.conn, sa.ss.resumeFrom(sa.session))
+}
+
+func (sa *streamAcker) stop() {
+	<-sa.lock
+	defer func() { sa.lock <- true }()
+	sa.stopped = true
+	if sa.timer != nil {
+		sa.timer.Stop()
+		sa.timer = nil
+	}
+}
@@ -0,0 +1,162 @@
+package log
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// A listener is bypassed for entries generated inside its own Receive(),
+// and dispatch gives up past maxDeliveryDepth nested deliveries.  An
+// uncontended delivery claims a process-wide slot with one atomic
+// operation; only contended ones look up state by goroutine id.
+const maxDeliveryDepth = 8
+
+type goroutineDeliveries struct {
+	depth     int
+	receiving []LogListener
+}
+
+var _GLOBAL_fastDelivery goroutineDeliveries
+var _GLOBAL_fastDeliveryHeld int32
+var _GLOBAL_deliveries sync.Map // goroutine id -> *goroutineDeliveries
+var _GLOBAL_trackedDeliveries int32
+var _GLOBAL_reentrantDrops uint64
+var _GLOBAL_deliverEntryPC uintptr
+
+func init() {
+	_GLOBAL_deliverEntryPC = reflect.ValueOf(deliverEntry).Pointer()
+}
+
+// ReentrantDrops returns the number of times a listener has been bypassed
+// because the entry originated from inside that listener's own delivery.
+func ReentrantDrops() uint64 {
+	return atomic.LoadUint64(&_GLOBAL_reentrantDrops)
+}
+
+// InDelivery reports whether the calling goroutine is currently inside a
+// listener's Receive() call.
+func InDelivery() bool {
+	return insideDelivery(2)
+}
+
+// Reports whether deliverEntry() is on the calling goroutine's stack,
+// skip frames up.
+func insideDelivery(skip int) bool {
+	var pcs [128]uintptr
+	n := runtime.Callers(skip+1, pcs[:])
+	for _, pc := range pcs[:n] {
+		if fn := runtime.FuncForPC(pc - 1); fn != nil && fn.Entry() == _GLOBAL_deliverEntryPC {
+			return true
+		}
+	}
+	return false
+}
+
+func currentGoroutineId() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	// "goroutine 123 [running]: ..."
+	field := bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if idx := bytes.IndexByte(field, ' '); idx > 0 {
+		field = field[:idx]
+	}
+	gid, _ := strconv.ParseUint(string(field), 10, 64)
+	return gid
+}
+
+// Returns the calling goroutine's delivery state with its depth raised, and
+// the function which lowers it again; false past maxDeliveryDepth.
+func enterDelivery() (*goroutineDeliveries, func(), bool) {
+	// A goroutine with tracked state never takes the slot, so its nested
+	// deliveries always find that state again.
+	if atomic.LoadInt32(&_GLOBAL_trackedDeliveries) == 0 &&
+		atomic.CompareAndSwapInt32(&_GLOBAL_fastDeliveryHeld, 0, 1) {
+		gd := &_GLOBAL_fastDelivery
+		gd.depth = 1
+		return gd, func() {
+			gd.depth = 0
+			atomic.StoreInt32(&_GLOBAL_fastDeliveryHeld, 0)
+		}, true
+	}
+	gid := currentGoroutineId()
+	var gd *goroutineDeliveries
+	if v, has := _GLOBAL_deliveries.Load(gid); has {
+		gd = v.(*goroutineDeliveries)
+	} else if atomic.LoadInt32(&_GLOBAL_fastDeliveryHeld) == 1 && insideDelivery(3) {
+		// Nested inside the slot holder's own delivery; every other
+		// delivery in progress is tracked by goroutine id.
+		gd = &_GLOBAL_fastDelivery
+	} else {
+		gd = &goroutineDeliveries{}
+		_GLOBAL_deliveries.Store(gid, gd)
+		atomic.AddInt32(&_GLOBAL_trackedDeliveries, 1)
+	}
+	if gd.depth >= maxDeliveryDepth {
+		return gd, nil, false
+	}
+	gd.depth++
+	return gd, func() {
+		gd.depth--
+		if gd.depth == 0 && gd != &_GLOBAL_fastDelivery {
+			_GLOBAL_deliveries.Delete(gid)
+			atomic.AddInt32(&_GLOBAL_trackedDeliveries, -1)
+		}
+	}, true
+}
+
+func (gd *goroutineDeliveries) isReceiving(ll LogListener) bool {
+	for _, r := range gd.receiving {
+		if r == ll {
+			return true
+		}
+	}
+	return false
+}
+
+func (gd *goroutineDeliveries) receive(ll LogListener, entry LogEntry) error {
+	gd.receiving = append(gd.receiving, ll)
+	defer func() {
+		gd.receiving = gd.receiving[:len(gd.receiving)-1]
+	}()
+	if fl, ok := ll.(FallibleLogListener); ok {
+		return fl.TryReceive(entry)
+	}
+	ll.Receive(entry)
+	return nil
+}
+
+// DeliverEntry calls Receive() on each listener in turn on the calling
+// goroutine, with reentrancy protection.  No context or stream locks may be
+// held by the caller.  LoggingContext implementations outside this package
+// should deliver through it.
+func DeliverEntry(entry LogEntry, listeners []LogListener) {
+	deliverEntry(entry, listeners)
+}
+
+// deliverEntry returns the listeners which failed to accept the entry (see
+// FallibleLogListener), and their errors.
+func deliverEntry(entry LogEntry, listeners []LogListener) ([]LogListener, []error) {
+	gd, exit, ok := enterDelivery()
+	if !ok {
+		atomic.AddUint64(&_GLOBAL_reentrantDrops, uint64(len(listeners)))
+		return nil, nil
+	}
+	defer exit()
+	var failed []LogListener
+	var errs []error
+	for _, ll := range listeners {
+		if gd.depth > 1 && gd.isReceiving(ll) {
+			atomic.AddUint64(&_GLOBAL_reentrantDrops, 1)
+			continue
+		}
+		if err := gd.receive(ll, entry); err != nil {
+			failed = append(failed, ll)
+			errs = append(errs, err)
+		}
+	}
+	return failed, errs
+}
@@ -0,0 +1,78 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+)
+
+// Listeners writing to files implement Reopener, for external rotation
+// (logrotate's "create" mode) of long-running processes.
+type Reopener interface {
+	Reopen() error
+}
+
+// ReopenAll reopens the files of every listener in all registered logging
+// contexts.
+func ReopenAll() error {
+	contexts := registeredContexts()
+	var errs []error
+	for _, ctx := range contexts {
+		var err error
+		if rc, ok := ctx.(Reopener); ok {
+			err = rc.Reopen()
+		} else {
+			err = reopenListeners(ctx.GlobalListeners())
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReopenOnSignals installs a handler calling ReopenAll() each time one of the
+// given signals (SIGHUP, if none are given and the platform has it) is
+// received.  Errors are passed
+// to onError, which may be nil.  The returned function uninstalls the
+// handler.
+func ReopenOnSignals(onError func(error), sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = defaultReopenSignals()
+	}
+	if len(sigs) == 0 {
+		// signal.Notify() with no signals would relay all of them.
+		return func() {}
+	}
+	c := make(chan os.Signal, 1)
+	done := make(chan bool)
+	signal.Notify(c, sigs...)
+	go func() {
+		for {
+			select {
+			case <-c:
+				if err := ReopenAll(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+func reopenListeners(listeners []LogListener) error {
+	var errs []error
+	for _, ll := range listeners {
+		if rl, ok := ll.(Reopener); ok {
+			if err := rl.Reopen(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,263 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+type DispatchRecord struct {
+	Seq        uint64                 `json:"seq"`
+	Time       time.Time              `json:"time"`
+	Stream     string                 `json:"stream"`
+	Level      string                 `json:"level"`
+	Message    string                 `json:"message"`
+	Prefix     string                 `json:"prefix,omitempty"`
+	Template   string                 `json:"template,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	// Dropped gives the reason no listener received the entry:
+	// "override", "level" or "filter".
+	Dropped    string        `json:"dropped,omitempty"`
+	Interested []string      `json:"interested,omitempty"`
+	Filter     string        `json:"filter,omitempty"`
+	Delivered  []string      `json:"delivered,omitempty"`
+	Failed     []string      `json:"failed,omitempty"`
+	Delivery   time.Duration `json:"delivery_ns,omitempty"`
+	// The record being replayed, for records made during a replay.
+	replayOf *DispatchRecord
+}
+
+// A DispatchRecorder captures a context's routing decisions as JSON lines,
+// for replay against another configuration.  Listeners are identified by
+// Name().
+type DispatchRecorder interface {
+	Records() uint64
+	// Stop stops recording, returning the first write error.
+	Stop() error
+}
+
+type ReplayOptions struct {
+	// Timing reproduces the intervals between the recorded entries,
+	// divided by Speed (default 1); by default entries are replayed
+	// back-to-back.
+	Timing bool
+	Speed  float64
+	// DryRun makes the routing decisions without delivering entries.
+	DryRun bool
+}
+
+type ReplayDifference struct {
+	Original DispatchRecord
+	Replayed DispatchRecord
+}
+
+type ReplayReport struct {
+	Records     int
+	Differences []ReplayDifference
+}
+
+///
+
+type dispatchSink interface {
+	record(dr *DispatchRecord)
+}
+
+type dispatchRecorder struct {
+	lock    chan bool
+	ctx     *stdLoggingContext
+	enc     *json.Encoder
+	seq     uint64
+	err     error
+	stopped bool
+}
+
+func (ctx *stdLoggingContext) RecordDispatch(w io.Writer) DispatchRecorder {
+	dr := &dispatchRecorder{
+		lock: make(chan bool, 1),
+		ctx:  ctx,
+		enc:  json.NewEncoder(w),
+	}
+	dr.lock <- true
+	<-ctx.lock
+	ctx.recorder = dr
+	ctx.lock <- true
+	return dr
+}
+
+func (rec *dispatchRecorder) record(dr *DispatchRecord) {
+	<-rec.lock
+	defer func() { rec.lock <- true }()
+	if rec.stopped {
+		return
+	}
+	rec.seq++
+	dr.Seq = rec.seq
+	err := rec.enc.Encode(dr)
+	if err != nil && dr.Properties != nil {
+		dr.Properties = stringifyProperties(dr.Properties)
+		err = rec.enc.Encode(dr)
+	}
+	if err != nil && rec.err == nil {
+		rec.err = err
+	}
+}
+
+func (rec *dispatchRecorder) Records() uint64 {
+	<-rec.lock
+	defer func() { rec.lock <- true }()
+	return rec.seq
+}
+
+func (rec *dispatchRecorder) Stop() error {
+	<-rec.ctx.lock
+	if rec.ctx.recorder == dispatchSink(rec) {
+		rec.ctx.recorder = nil
+	}
+	rec.ctx.lock <- true
+	<-rec.lock
+	defer func() { rec.lock <- true }()
+	rec.stopped = true
+	return rec.err
+}
+
+func listenerNames(listeners []LogListener) []string {
+	if len(listeners) == 0 {
+		return nil
+	}
+	names := make([]string, len(listeners))
+	for i, ll := range listeners {
+		names[i] = ll.Name()
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newDispatchRecord(entry *stdLogEntry) *DispatchRecord {
+	dr := &DispatchRecord{
+		Time:    entry.ts,
+		Stream:  entry.Stream(),
+		Level:   entry.level.String(),
+		Message: entry.message,
+	}
+	if entry.template != nil {
+		dr.Template = entry.template.Text()
+		dr.Properties = entry.properties
+	}
+	if entry.associatedError != nil {
+		dr.Error = entry.associatedError.Error()
+	}
+	dr.Prefix = renderedPrefix(entry)
+	return dr
+}
+
+// Collects the records of a replay, in order.
+type replaySink struct {
+	lock    chan bool
+	records []*DispatchRecord
+}
+
+func (rs *replaySink) record(dr *DispatchRecord) {
+	<-rs.lock
+	rs.records = append(rs.records, dr)
+	rs.lock <- true
+}
+
+// ReplayDispatch re-dispatches the entries recorded in r to ctx, reporting
+// the entries delivered to a different set of listeners than when they
+// were recorded.  Any recorder on ctx is suspended during the replay.
+func ReplayDispatch(r io.Reader, ctx StandardLoggingContext, opts ReplayOptions) (ReplayReport, error) {
+	var report ReplayReport
+	sctx, ok := ctx.(*stdLoggingContext)
+	if !ok {
+		return report, errors.New("dispatch replay needs a context made by CreateLoggingContext")
+	}
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+	sink := &replaySink{lock: make(chan bool, 1)}
+	sink.lock <- true
+	<-sctx.lock
+	previous := sctx.recorder
+	sctx.recorder = sink
+	sctx.lock <- true
+	defer func() {
+		<-sctx.lock
+		sctx.recorder = previous
+		sctx.lock <- true
+	}()
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var last time.Time
+	for {
+		var original DispatchRecord
+		if err := dec.Decode(&original); err == io.EOF {
+			break
+		} else if err != nil {
+			return report, fmt.Errorf("dispatch record %d: %s", report.Records+1, err.Error())
+		}
+		level, ok := ParseLogLevel(original.Level)
+		if !ok {
+			return report, fmt.Errorf("dispatch record %d: unknown level '%s'", report.Records+1, original.Level)
+		}
+		if opts.Timing && !last.IsZero() && original.Time.After(last) {
+			time.Sleep(time.Duration(float64(original.Time.Sub(last)) / opts.Speed))
+		}
+		last = original.Time
+		stream, _ := sctx.Stream(original.Stream)
+		record := original
+		received := &wireEntry{
+			ts:         original.Time,
+			stream:     original.Stream,
+			level:      level,
+			message:    original.Message,
+			prefix:     original.Prefix,
+			template:   original.Template,
+			properties: original.Properties,
+		}
+		if original.Error != "" {
+			received.err = errors.New(original.Error)
+		}
+		stream.(*stdLogStream).dispatchEntry(&dispatchRequest{
+			level:    level,
+			received: received,
+			replay:   &record,
+			dryRun:   opts.DryRun,
+		})
+		report.Records++
+		<-sink.lock
+		// Entries logged during delivery (by listeners, or elsewhere) are
+		// recorded too.
+		var replayed *DispatchRecord
+		for _, dr := range sink.records {
+			if dr.replayOf == &record {
+				replayed = dr
+			}
+		}
+		sink.records = sink.records[:0]
+		sink.lock <- true
+		if replayed == nil {
+			continue
+		}
+		replayed.Seq = original.Seq
+		if !sameNames(original.Delivered, replayed.Delivered) {
+			report.Differences = append(report.Differences, ReplayDifference{Original: original, Replayed: *replayed})
+		}
+	}
+	return report, nil
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplayDispatch(t *testing.T) {
+	ctx := CreateLoggingContext()
+	var console, file bytes.Buffer
+	ctx.AddGlobalLogListener(NewWriterLogger("console", &console, NewLogEntryFormatter()), Warning)
+	ctx.AddGlobalLogListener(NewWriterLogger("file", &file, NewLogEntryFormatter()), Debug)
+	var recording bytes.Buffer
+	rec := ctx.RecordDispatch(&recording)
+	stream, _ := ctx.Stream("db")
+	stream.Log(Info, "connected")
+	stream.LogTemplate(Error, "query {Query} failed", "select 1")
+	stream.Log(Trace, "row read")
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Records() != 3 {
+		t.Fatalf("expected 3 records, got %d:\n%s", rec.Records(), recording.String())
+	}
+	// The replay configuration loses the file listener's Info entries to
+	// a filter.
+	replayCtx := CreateLoggingContext()
+	var replayConsole, replayFile bytes.Buffer
+	replayCtx.AddGlobalLogListener(NewWriterLogger("console", &replayConsole, NewLogEntryFormatter()), Warning)
+	replayCtx.AddGlobalLogListener(NewWriterLogger("file", &replayFile, NewLogEntryFormatter()), Debug)
+	if _, err := replayCtx.Filters().Install(DynamicFilter{Expression: `message == "connected"`}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := ReplayDispatch(strings.NewReader(recording.String()), replayCtx, ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Records != 3 || len(report.Differences) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	diff := report.Differences[0]
+	if diff.Original.Message != "connected" || diff.Replayed.Dropped != "filter" || diff.Replayed.Filter != "f1" ||
+		len(diff.Original.Delivered) != 1 || diff.Original.Delivered[0] != "file" {
+		t.Errorf("unexpected difference: %+v", diff)
+	}
+	if !strings.Contains(replayConsole.String(), "query select 1 failed") || strings.Contains(replayFile.String(), "| connected") {
+		t.Errorf("unexpected replayed output:\n%s\n%s", replayConsole.String(), replayFile.String())
+	}
+}
@@ -0,0 +1,143 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const rotatedFileTimeFormat = "20060102-150405.000000"
+
+// A RotationPolicy renames a file to "<path>.<timestamp>" when writing to it
+// would take it past MaxSize, or when its first entry is older than
+// Interval (which may be under a second), keeping at most MaxBackups
+// rotated files no older than MaxAge (zero disables any limit).  Rotated
+// names have microsecond timestamps, made unique if rotations collide.
+//
+// PreClose and PostOpen are called in the logging goroutine, with the
+// listener locked, as the file is rotated: PreClose with the path before
+// the file is closed and moved aside, PostOpen with the path and the
+// rotated file's path once the replacement is open.  OnRotate is called
+// afterwards in a separate goroutine with the rotated file's path, for
+// slow steps - e.g. to hand it to an Archiver.
+type RotationPolicy struct {
+	MaxSize    int64
+	Interval   time.Duration
+	MaxBackups int
+	MaxAge     time.Duration
+	PreClose   func(path string)
+	PostOpen   func(path string, rotatedPath string)
+	OnRotate   func(rotatedPath string)
+}
+
+///
+
+// started is when the file's first entry was written, or zero.
+func (rp *RotationPolicy) due(size int64, n int, started time.Time) bool {
+	if rp.Interval > 0 && !started.IsZero() && time.Since(started) >= rp.Interval {
+		return true
+	}
+	return rp.MaxSize > 0 && size > 0 && size+int64(n) > rp.MaxSize
+}
+
+// Returns "<path>.<timestamp>" for a rotation at t, moving the timestamp
+// on past any rotated file of the same name.
+func rotatedPath(path string, t time.Time) string {
+	for {
+		rotated := path + "." + t.UTC().Format(rotatedFileTimeFormat)
+		if _, err := os.Lstat(rotated); os.IsNotExist(err) {
+			return rotated
+		}
+		t = t.Add(time.Microsecond)
+	}
+}
+
+// rotate is called with the listener lock held (and, for shared files, the
+// exclusive file lock).  The header (and magic, for encrypted files) is
+// written to the replacement file by openFile().
+func (fl *fileListener) rotate() error {
+	rp := fl.opts.Rotation
+	if rp == nil {
+		rp = &RotationPolicy{}
+	}
+	if rp.PreClose != nil {
+		rp.PreClose(fl.path)
+	}
+	if err := fl.closeFile(); err != nil {
+		return err
+	}
+	rotated := rotatedPath(fl.path, time.Now())
+	if err := os.Rename(fl.path, rotated); err != nil {
+		fl.openFile()
+		return err
+	}
+	if err := fl.openFile(); err != nil {
+		return err
+	}
+	if rp.PostOpen != nil {
+		rp.PostOpen(fl.path, rotated)
+	}
+	rp.prune(fl.path, time.Now())
+	if rp.OnRotate != nil {
+		go rp.OnRotate(rotated)
+	}
+	return nil
+}
+
+// Rotate moves the file aside and starts a new one now, whatever the
+// rotation policy - e.g. at the start of each batch job run.  A shared
+// file which another process has just rotated is not rotated again.
+func (fl *fileListener) Rotate() error {
+	<-fl.lock
+	defer func() { fl.lock <- true }()
+	if fl.closed {
+		return errors.New("file listener is closed")
+	}
+	if fl.file == nil {
+		return errors.New("file listener '" + fl.name + "' has no open file")
+	}
+	if !fl.opts.Shared {
+		return fl.rotate()
+	}
+	unlock, err := fl.lockExclusive()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if fl.stale() {
+		fl.dropFile()
+		return fl.openFile()
+	}
+	return fl.rotate()
+}
+
+func rotatedFiles(path string) []string {
+	matches, _ := filepath.Glob(path + ".*")
+	var res []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, path+".")
+		if _, err := time.Parse(rotatedFileTimeFormat, suffix); err == nil {
+			res = append(res, match)
+		}
+	}
+	// The timestamp format sorts chronologically.
+	sort.Strings(res)
+	return res
+}
+
+func (rp *RotationPolicy) prune(path string, now time.Time) {
+	backups := rotatedFiles(path)
+	for i, backup := range backups {
+		expired := rp.MaxBackups > 0 && i < len(backups)-rp.MaxBackups
+		if !expired && rp.MaxAge > 0 {
+			at, _ := time.Parse(rotatedFileTimeFormat, strings.TrimPrefix(backup, path+"."))
+			expired = now.Sub(at) > rp.MaxAge
+		}
+		if expired {
+			os.Remove(backup)
+		}
+	}
+}
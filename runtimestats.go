@@ -0,0 +1,185 @@
+package log
+
+import (
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+type RuntimeOptions struct {
+	// Interval between periodic entries; defaults to 30s.
+	Interval time.Duration
+	// Stream defaults to the global context's "runtime" stream.
+	Stream LogStream
+	// Level of the periodic entries (default Info); GC event entries are
+	// logged at Debug.
+	Level    LogLevel
+	GCEvents bool
+	Metrics  MetricsRegistry
+}
+
+type RuntimeStats struct {
+	HeapBytes     uint64
+	HeapGoalBytes uint64
+	Goroutines    uint64
+	GCCycles      int64
+	GCPauseTotal  time.Duration
+	// MaxGCPause is the longest pause since the previous sample.
+	MaxGCPause time.Duration
+}
+
+// A RuntimeMonitor logs the heap size, goroutine count and GC pauses every
+// Interval, and publishes them as gauges; neither source stops the world.
+type RuntimeMonitor interface {
+	// Sample reads and logs the runtime statistics immediately; the
+	// monitor otherwise samples every Interval.
+	Sample() RuntimeStats
+	Stop()
+}
+
+///
+
+var runtimeMetricNames = []string{
+	"/memory/classes/heap/objects:bytes",
+	"/gc/heap/goal:bytes",
+	"/sched/goroutines:goroutines",
+}
+
+type runtimeMonitor struct {
+	lock      chan bool
+	opts      RuntimeOptions
+	samples   []metrics.Sample
+	gcStats   debug.GCStats
+	lastNumGC int64
+	gc        chan bool
+	stop      chan bool
+	stopped   int32
+}
+
+type gcSentinel struct {
+	rm *runtimeMonitor
+}
+
+func NewRuntimeMonitor(opts RuntimeOptions) RuntimeMonitor {
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	if opts.Stream == nil {
+		opts.Stream, _ = GetGlobalLoggingContext().Stream("runtime")
+	}
+	if opts.Level == All {
+		opts.Level = Info
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = DefaultMetricsRegistry()
+	}
+	rm := &runtimeMonitor{
+		lock:    make(chan bool, 1),
+		opts:    opts,
+		samples: make([]metrics.Sample, len(runtimeMetricNames)),
+		gc:      make(chan bool, 1),
+		stop:    make(chan bool),
+	}
+	for i, name := range runtimeMetricNames {
+		rm.samples[i].Name = name
+	}
+	rm.lock <- true
+	debug.ReadGCStats(&rm.gcStats)
+	rm.lastNumGC = rm.gcStats.NumGC
+	if opts.GCEvents {
+		rm.armSentinel()
+	}
+	go func() {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rm.Sample()
+			case <-rm.gc:
+				rm.logGC()
+			case <-rm.stop:
+				return
+			}
+		}
+	}()
+	return rm
+}
+
+func (rm *runtimeMonitor) armSentinel() {
+	s := &gcSentinel{rm: rm}
+	runtime.SetFinalizer(s, func(s *gcSentinel) {
+		if atomic.LoadInt32(&s.rm.stopped) != 0 {
+			return
+		}
+		select {
+		case s.rm.gc <- true:
+		default:
+		}
+		s.rm.armSentinel()
+	})
+}
+
+func metricUint64(s metrics.Sample) uint64 {
+	if s.Value.Kind() == metrics.KindUint64 {
+		return s.Value.Uint64()
+	}
+	return 0
+}
+
+// Reads the statistics; the caller holds the lock.  MaxGCPause covers the
+// cycles since the previous read.
+func (rm *runtimeMonitor) read() RuntimeStats {
+	metrics.Read(rm.samples)
+	debug.ReadGCStats(&rm.gcStats)
+	st := RuntimeStats{
+		HeapBytes:     metricUint64(rm.samples[0]),
+		HeapGoalBytes: metricUint64(rm.samples[1]),
+		Goroutines:    metricUint64(rm.samples[2]),
+		GCCycles:      rm.gcStats.NumGC,
+		GCPauseTotal:  rm.gcStats.PauseTotal,
+	}
+	// Pause is most recent first.
+	for i := 0; i < len(rm.gcStats.Pause) && int64(i) < rm.gcStats.NumGC-rm.lastNumGC; i++ {
+		if rm.gcStats.Pause[i] > st.MaxGCPause {
+			st.MaxGCPause = rm.gcStats.Pause[i]
+		}
+	}
+	rm.lastNumGC = rm.gcStats.NumGC
+	return st
+}
+
+func (rm *runtimeMonitor) Sample() RuntimeStats {
+	<-rm.lock
+	st := rm.read()
+	rm.lock <- true
+	rm.opts.Metrics.Gauge("log_runtime_heap_bytes", nil).Set(float64(st.HeapBytes))
+	rm.opts.Metrics.Gauge("log_runtime_goroutines", nil).Set(float64(st.Goroutines))
+	rm.opts.Metrics.Gauge("log_runtime_gc_pause_seconds", nil).Set(st.MaxGCPause.Seconds())
+	rm.opts.Stream.LogTemplate(rm.opts.Level, "runtime: heap {HeapBytes} bytes (goal {HeapGoalBytes}), {Goroutines} goroutines, {GCCycles} GC cycles, max pause {MaxGCPause}, total pause {GCPauseTotal}",
+		st.HeapBytes, st.HeapGoalBytes, st.Goroutines, st.GCCycles, st.MaxGCPause, st.GCPauseTotal)
+	return st
+}
+
+func (rm *runtimeMonitor) logGC() {
+	<-rm.lock
+	metrics.Read(rm.samples)
+	debug.ReadGCStats(&rm.gcStats)
+	heap := metricUint64(rm.samples[0])
+	var pause time.Duration
+	if len(rm.gcStats.Pause) > 0 {
+		pause = rm.gcStats.Pause[0]
+	}
+	cycle := rm.gcStats.NumGC
+	rm.lock <- true
+	rm.opts.Stream.LogTemplate(Debug, "GC cycle {GCCycle}: pause {GCPause}, heap {HeapBytes} bytes",
+		cycle, pause, heap)
+}
+
+func (rm *runtimeMonitor) Stop() {
+	if atomic.CompareAndSwapInt32(&rm.stopped, 0, 1) {
+		close(rm.stop)
+	}
+}
@@ -0,0 +1,53 @@
+package log
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRuntimeMonitorSample(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("runtime")
+	reg := NewMetricsRegistry()
+	rm := NewRuntimeMonitor(RuntimeOptions{Interval: time.Hour, Stream: stream, Metrics: reg})
+	defer rm.Stop()
+	release := make(chan bool)
+	defer close(release)
+	for i := 0; i < 5; i++ {
+		go func() { <-release }()
+	}
+	before := rm.Sample()
+	runtime.GC()
+	st := rm.Sample()
+	if st.HeapBytes == 0 || st.HeapGoalBytes == 0 {
+		t.Errorf("missing heap figures: %+v", st)
+	}
+	if st.Goroutines < 6 {
+		t.Errorf("expected at least 6 goroutines, got %d", st.Goroutines)
+	}
+	if st.GCCycles <= before.GCCycles || st.GCPauseTotal < before.GCPauseTotal {
+		t.Errorf("GC not counted: before %+v, after %+v", before, st)
+	}
+	if st.MaxGCPause <= 0 || st.MaxGCPause > st.GCPauseTotal {
+		t.Errorf("unexpected max pause %s (total %s)", st.MaxGCPause, st.GCPauseTotal)
+	}
+	// The maximum covers only the cycles since the previous sample.
+	if next := rm.Sample(); next.GCCycles == st.GCCycles && next.MaxGCPause != 0 {
+		t.Errorf("max pause %s carried over without a GC cycle", next.MaxGCPause)
+	}
+	if g := reg.Gauge("log_runtime_goroutines", nil).Value(); g < 6 {
+		t.Errorf("goroutine gauge %g", g)
+	}
+	ctx.Flush()
+	entries := cl.Entries()
+	if len(entries) != 3 || entries[1].Level() != Info {
+		t.Fatalf("expected 3 Info entries, got %v", entries)
+	}
+	props := entries[1].(TemplatedLogEntry).Properties()
+	if props["Goroutines"] != st.Goroutines || props["GCCycles"] != st.GCCycles || props["HeapBytes"] != st.HeapBytes {
+		t.Errorf("entry properties %v do not match %+v", props, st)
+	}
+}
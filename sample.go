@@ -0,0 +1,140 @@
+package log
+
+import (
+	"container/list"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type SamplingOptions struct {
+	Limit       int
+	Interval    time.Duration
+	Key         func(entry LogEntry) string
+	KeyProperty string
+	MaxKeys     int
+	KeepLevel   LogLevel
+}
+
+type SamplingListener interface {
+	LogListener
+	Target() LogListener
+	Sampled() uint64
+}
+
+///
+
+type sampleWindow struct {
+	key   string
+	start time.Time
+	count int
+}
+
+type samplingListener struct {
+	lock    chan bool
+	name    string
+	target  LogListener
+	opts    SamplingOptions
+	lru     *list.List
+	windows map[string]*list.Element
+	sampled uint64
+}
+
+// NewSamplingListener forwards at most Limit entries per Interval, per key
+// if Key or KeyProperty is set.  Keys are tracked in an LRU of MaxKeys;
+// entries at least as severe as KeepLevel are always forwarded.
+func NewSamplingListener(name string, target LogListener, opts SamplingOptions) SamplingListener {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = 10000
+	}
+	if opts.Key == nil && opts.KeyProperty != "" {
+		prop := opts.KeyProperty
+		opts.Key = func(entry LogEntry) string {
+			if te, ok := entry.(TemplatedLogEntry); ok {
+				if val, has := te.Properties()[prop]; has {
+					return fmt.Sprint(val)
+				}
+			}
+			return ""
+		}
+	}
+	sl := &samplingListener{
+		lock:    make(chan bool, 1),
+		name:    name,
+		target:  target,
+		opts:    opts,
+		lru:     list.New(),
+		windows: make(map[string]*list.Element),
+	}
+	sl.lock <- true
+	return sl
+}
+
+func (sl *samplingListener) Name() string {
+	return sl.name
+}
+
+func (sl *samplingListener) Target() LogListener {
+	return sl.target
+}
+
+func (sl *samplingListener) Sampled() uint64 {
+	return atomic.LoadUint64(&sl.sampled)
+}
+
+func (sl *samplingListener) Receive(entry LogEntry) {
+	if sl.admit(entry) {
+		sl.target.Receive(entry)
+	} else {
+		atomic.AddUint64(&sl.sampled, 1)
+	}
+}
+
+func (sl *samplingListener) admit(entry LogEntry) bool {
+	if sl.opts.KeepLevel != All && admits(sl.opts.KeepLevel, entry.Level()) || sl.opts.Limit <= 0 {
+		return true
+	}
+	key := ""
+	if sl.opts.Key != nil {
+		key = sl.opts.Key(entry)
+	}
+	now := entry.LogTime()
+	<-sl.lock
+	defer func() { sl.lock <- true }()
+	var win *sampleWindow
+	if elem, has := sl.windows[key]; has {
+		sl.lru.MoveToFront(elem)
+		win = elem.Value.(*sampleWindow)
+	} else {
+		win = &sampleWindow{key: key, start: now}
+		sl.windows[key] = sl.lru.PushFront(win)
+		if sl.lru.Len() > sl.opts.MaxKeys {
+			oldest := sl.lru.Back()
+			sl.lru.Remove(oldest)
+			delete(sl.windows, oldest.Value.(*sampleWindow).key)
+		}
+	}
+	if now.Sub(win.start) >= sl.opts.Interval || now.Before(win.start) {
+		win.start = now
+		win.count = 0
+	}
+	if win.count >= sl.opts.Limit {
+		return false
+	}
+	win.count++
+	return true
+}
+
+func (sl *samplingListener) Flush() error {
+	if fl, ok := sl.target.(Flusher); ok {
+		return fl.Flush()
+	}
+	return nil
+}
+
+func (sl *samplingListener) Close() error {
+	return sl.target.Close()
+}
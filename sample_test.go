@@ -0,0 +1,65 @@
+package log
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSamplingListener(t *testing.T) {
+	cl := newCaptureListener()
+	sl := NewSamplingListener("sampled", cl, SamplingOptions{
+		Limit:       2,
+		Interval:    time.Minute,
+		KeyProperty: "UserId",
+		MaxKeys:     2,
+		KeepLevel:   Error,
+	})
+	base := time.Now()
+	send := func(offset time.Duration, level LogLevel, user int) {
+		sl.Receive(&stdLogEntry{
+			ts:         base.Add(offset),
+			stream:     &stdLogStream{name: "api"},
+			level:      level,
+			message:    fmt.Sprintf("request from %d", user),
+			properties: map[string]interface{}{"UserId": user},
+		})
+	}
+	for i := 0; i < 5; i++ {
+		send(0, Info, 1)
+	}
+	send(0, Info, 2)
+	// Errors are always kept, and do not use up the user's limit.
+	send(0, Error, 1)
+	send(0, FatalError, 1)
+	if got, sampled := len(cl.Entries()), sl.Sampled(); got != 5 || sampled != 3 {
+		t.Fatalf("expected 5 forwarded and 3 sampled, got %d and %d", got, sampled)
+	}
+	// A new window restores the limit.
+	send(time.Minute, Info, 1)
+	if got := len(cl.Entries()); got != 6 {
+		t.Fatalf("new window not admitted, %d forwarded", got)
+	}
+	// User 3 evicts user 2, the least recently seen, which then starts
+	// a fresh window inside its old one.
+	send(30*time.Second, Info, 3)
+	send(30*time.Second, Info, 2)
+	send(30*time.Second, Info, 2)
+	send(30*time.Second, Info, 2)
+	if got, sampled := len(cl.Entries()), sl.Sampled(); got != 9 || sampled != 4 {
+		t.Fatalf("expected 9 forwarded and 4 sampled, got %d and %d", got, sampled)
+	}
+}
+
+func TestSamplingListenerKeepAll(t *testing.T) {
+	cl := newCaptureListener()
+	sl := NewSamplingListener("sampled", cl, SamplingOptions{Limit: 1})
+	now := time.Now()
+	for _, level := range []LogLevel{Info, Error, FatalError} {
+		sl.Receive(&stdLogEntry{ts: now, stream: &stdLogStream{name: "api"}, level: level, message: "x"})
+	}
+	// Without KeepLevel every level counts towards the limit.
+	if got := len(cl.Entries()); got != 1 || sl.Sampled() != 2 {
+		t.Errorf("expected 1 forwarded and 2 sampled, got %d and %d", got, sl.Sampled())
+	}
+}
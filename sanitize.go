@@ -0,0 +1,170 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type InvalidUTF8Policy uint8
+
+const (
+	ReplaceInvalidUTF8 InvalidUTF8Policy = iota
+	EscapeInvalidUTF8
+)
+
+// Sanitize escapes control characters, including ESC and the bidirectional
+// overrides, as \xNN or \uNNNN, and newlines unless AllowNewlines, so that
+// entry text cannot forge lines or recolor terminals.
+type SanitizePolicy struct {
+	AllowNewlines bool
+	AllowTabs     bool
+	InvalidUTF8   InvalidUTF8Policy
+}
+
+var DefaultSanitizePolicy = SanitizePolicy{AllowTabs: true}
+
+func Sanitize(str string, policy SanitizePolicy) string {
+	if !needsSanitizing(str, policy) {
+		return str
+	}
+	var buf strings.Builder
+	buf.Grow(len(str) + 16)
+	for i := 0; i < len(str); {
+		r, size := utf8.DecodeRuneInString(str[i:])
+		if r == utf8.RuneError && size <= 1 {
+			if policy.InvalidUTF8 == EscapeInvalidUTF8 {
+				fmt.Fprintf(&buf, "\\x%02x", str[i])
+			} else {
+				buf.WriteRune(utf8.RuneError)
+			}
+			i++
+			continue
+		}
+		i += size
+		switch {
+		case r == '\n' && policy.AllowNewlines, r == '\t' && policy.AllowTabs:
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString("\\n")
+		case r == '\r':
+			buf.WriteString("\\r")
+		case r == '\t':
+			buf.WriteString("\\t")
+		case r < 0x20 || r == 0x7F:
+			fmt.Fprintf(&buf, "\\x%02x", r)
+		case unsafeRune(r):
+			fmt.Fprintf(&buf, "\\u%04x", r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// C1 controls and the bidirectional embedding/override/isolate characters.
+func unsafeRune(r rune) bool {
+	return r >= 0x80 && r <= 0x9F || r >= 0x202A && r <= 0x202E || r >= 0x2066 && r <= 0x2069
+}
+
+func needsSanitizing(str string, policy SanitizePolicy) bool {
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c >= 0x80 {
+			// Slow path for non-ASCII.
+			for _, r := range str[i:] {
+				if r == utf8.RuneError || unsafeRune(r) || r < 0x20 || r == 0x7F {
+					return true
+				}
+			}
+			return !utf8.ValidString(str[i:])
+		}
+		if c < 0x20 || c == 0x7F {
+			if c == '\n' && policy.AllowNewlines || c == '\t' && policy.AllowTabs {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+///
+
+type sanitizedError struct {
+	err  error
+	text string
+}
+
+func (se *sanitizedError) Error() string {
+	return se.text
+}
+
+func (se *sanitizedError) Unwrap() error {
+	return se.err
+}
+
+type sanitizingListener struct {
+	target LogListener
+	policy SanitizePolicy
+}
+
+// NewSanitizingListener sanitizes the message, associated error text and
+// string properties of entries before passing them to target.
+func NewSanitizingListener(target LogListener, policy SanitizePolicy) LogListener {
+	return &sanitizingListener{target: target, policy: policy}
+}
+
+func (sl *sanitizingListener) Name() string {
+	return sl.target.Name()
+}
+
+func (sl *sanitizingListener) Target() LogListener {
+	return sl.target
+}
+
+func (sl *sanitizingListener) Receive(entry LogEntry) {
+	sl.target.Receive(sl.sanitize(entry))
+}
+
+func (sl *sanitizingListener) sanitize(entry LogEntry) LogEntry {
+	var de *derivedEntry
+	derive := func() {
+		if de == nil {
+			de = deriveEntry(entry)
+		}
+	}
+	if msg := entry.Message(); needsSanitizing(msg, sl.policy) {
+		derive()
+		de.message = Sanitize(msg, sl.policy)
+	}
+	if entry.HasAssociatedError() {
+		if text := entry.AssociatedError().Error(); needsSanitizing(text, sl.policy) {
+			derive()
+			de.err = &sanitizedError{err: entry.AssociatedError(), text: Sanitize(text, sl.policy)}
+		}
+	}
+	if te, ok := entry.(TemplatedLogEntry); ok {
+		for name, val := range te.Properties() {
+			if str, ok := val.(string); ok && needsSanitizing(str, sl.policy) {
+				derive()
+				de.setProperty(name, Sanitize(str, sl.policy))
+			}
+		}
+	}
+	if de == nil {
+		return entry
+	}
+	return de
+}
+
+func (sl *sanitizingListener) Flush() error {
+	if fl, ok := sl.target.(Flusher); ok {
+		return fl.Flush()
+	}
+	return nil
+}
+
+func (sl *sanitizingListener) Close() error {
+	return sl.target.Close()
+}
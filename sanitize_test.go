@@ -0,0 +1,87 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSanitize(t *testing.T) {
+	escape := SanitizePolicy{InvalidUTF8: EscapeInvalidUTF8}
+	lines := SanitizePolicy{AllowNewlines: true, AllowTabs: true}
+	for _, c := range []struct {
+		in     string
+		policy SanitizePolicy
+		want   string
+	}{
+		{"plain text", DefaultSanitizePolicy, "plain text"},
+		{"héllo wörld", DefaultSanitizePolicy, "héllo wörld"},
+		{"a\nb\rc\td", DefaultSanitizePolicy, "a\\nb\\rc\td"},
+		{"a\nb\rc\td", escape, "a\\nb\\rc\\td"},
+		{"a\nb\tc", lines, "a\nb\tc"},
+		{"\x1b[31mred\x1b[0m", DefaultSanitizePolicy, "\\x1b[31mred\\x1b[0m"},
+		{"bell\x07del\x7f", DefaultSanitizePolicy, "bell\\x07del\\x7f"},
+		{"c1\u0085\u009b", DefaultSanitizePolicy, "c1\\u0085\\u009b"},
+		{"user\u202eexe.txt", DefaultSanitizePolicy, "user\\u202eexe.txt"},
+		{"iso\u2066late\u2069", DefaultSanitizePolicy, "iso\\u2066late\\u2069"},
+		{"bad\xff\xfeend", DefaultSanitizePolicy, "bad\ufffd\ufffdend"},
+		{"bad\xff\xfeend", escape, "bad\\xff\\xfeend"},
+		{"é\xc3", escape, "é\\xc3"},
+		{"é\n\x1b", lines, "é\n\\x1b"},
+	} {
+		if got := Sanitize(c.in, c.policy); got != c.want {
+			t.Errorf("Sanitize(%q, %+v) = %q, want %q", c.in, c.policy, got, c.want)
+		}
+	}
+}
+
+func TestSanitizingListener(t *testing.T) {
+	cause := errors.New("disk\x1b[2J full")
+	wrapped := fmt.Errorf("write failed: %w", cause)
+	for _, c := range []struct {
+		policy  SanitizePolicy
+		message string
+		err     string
+		prop    string
+	}{
+		{DefaultSanitizePolicy, "line one\\nline two \\u202e", "write failed: disk\\x1b[2J full", "a\ufffdb"},
+		{SanitizePolicy{AllowNewlines: true, InvalidUTF8: EscapeInvalidUTF8}, "line one\nline two \\u202e", "write failed: disk\\x1b[2J full", "a\\xffb"},
+	} {
+		cl := newCaptureListener()
+		sl := NewSanitizingListener(cl, c.policy)
+		entry := &stdLogEntry{
+			ts:              time.Now(),
+			stream:          &stdLogStream{name: "web"},
+			level:           Error,
+			message:         "line one\nline two \u202e",
+			associatedError: wrapped,
+			properties:      map[string]interface{}{"Agent": "a\xffb", "Count": 3},
+		}
+		sl.Receive(entry)
+		got := cl.Entries()[0].(TemplatedLogEntry)
+		if got.Message() != c.message {
+			t.Errorf("%+v: message %q, want %q", c.policy, got.Message(), c.message)
+		}
+		if got.AssociatedError().Error() != c.err {
+			t.Errorf("%+v: error %q, want %q", c.policy, got.AssociatedError().Error(), c.err)
+		}
+		if !errors.Is(got.AssociatedError(), cause) {
+			t.Errorf("%+v: sanitized error does not wrap its cause", c.policy)
+		}
+		if props := got.Properties(); props["Agent"] != c.prop || props["Count"] != 3 {
+			t.Errorf("%+v: properties %q", c.policy, props)
+		}
+		if entry.message != "line one\nline two \u202e" || entry.properties["Agent"] != "a\xffb" {
+			t.Errorf("%+v: original entry modified", c.policy)
+		}
+	}
+
+	// Clean entries pass through as they are.
+	cl := newCaptureListener()
+	clean := &stdLogEntry{ts: time.Now(), stream: &stdLogStream{name: "web"}, level: Info, message: "fine"}
+	NewSanitizingListener(cl, DefaultSanitizePolicy).Receive(clean)
+	if cl.Entries()[0] != LogEntry(clean) {
+		t.Error("clean entry was rewritten")
+	}
+}
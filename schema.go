@@ -0,0 +1,260 @@
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const SchemaDiagnosticStream = "schema"
+
+type FieldType uint8
+
+const (
+	AnyField FieldType = iota
+	StringField
+	IntField
+	FloatField
+	BoolField
+	TimeField
+	DurationField
+)
+
+type SchemaPolicy uint8
+
+const (
+	SchemaCoerce SchemaPolicy = iota
+	SchemaDrop
+	SchemaReport
+)
+
+// A Schema declares the types of a stream's properties.  Violations are
+// converted, dropped or left alone per Policy, and reported once per
+// property and type on SchemaDiagnosticStream.  Nil satisfies every type.
+type Schema struct {
+	Fields map[string]FieldType
+	Policy SchemaPolicy
+	// Strict makes properties not named in Fields violations.
+	Strict bool
+}
+
+///
+
+func (ft FieldType) String() string {
+	switch ft {
+	case AnyField:
+		return "any"
+	case StringField:
+		return "string"
+	case IntField:
+		return "int"
+	case FloatField:
+		return "float"
+	case BoolField:
+		return "bool"
+	case TimeField:
+		return "time"
+	case DurationField:
+		return "duration"
+	}
+	return fmt.Sprintf("FieldType(%d)", uint8(ft))
+}
+
+// SetStreamSchema sets the schema of the named stream's entries; nil
+// removes it.
+func (ctx *stdLoggingContext) SetStreamSchema(stream string, schema *Schema) {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	if schema == nil {
+		delete(ctx.schemas, stream)
+		return
+	}
+	if ctx.schemas == nil {
+		ctx.schemas = make(map[string]*Schema)
+	}
+	copied := &Schema{Fields: make(map[string]FieldType, len(schema.Fields)), Policy: schema.Policy, Strict: schema.Strict}
+	for name, ft := range schema.Fields {
+		copied.Fields[name] = ft
+	}
+	ctx.schemas[stream] = copied
+}
+
+func (ctx *stdLoggingContext) StreamSchema(stream string) *Schema {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	return ctx.schemas[stream]
+}
+
+type schemaViolation struct {
+	field    string
+	actual   string
+	expected FieldType
+	action   string
+}
+
+// Applies schema to the entry's properties, returning the violations not
+// reported before.
+func (ctx *stdLoggingContext) enforceSchema(schema *Schema, entry *stdLogEntry) []schemaViolation {
+	var violations []schemaViolation
+	var props map[string]interface{}
+	for name, value := range entry.properties {
+		expected, declared := schema.Fields[name]
+		if declared && (expected == AnyField || conformsTo(value, expected)) || !declared && !schema.Strict {
+			continue
+		}
+		if props == nil {
+			props = make(map[string]interface{}, len(entry.properties))
+			for k, v := range entry.properties {
+				props[k] = v
+			}
+		}
+		v := schemaViolation{field: name, actual: fmt.Sprintf("%T", value), expected: expected}
+		switch {
+		case !declared:
+			v.actual = "undeclared"
+			if schema.Policy == SchemaReport {
+				v.action = "kept"
+			} else {
+				v.action = "dropped"
+				delete(props, name)
+			}
+		case schema.Policy == SchemaReport:
+			v.action = "kept"
+		case schema.Policy == SchemaCoerce:
+			if coerced, ok := coerceField(value, expected); ok {
+				v.action = "converted"
+				props[name] = coerced
+				break
+			}
+			fallthrough
+		default:
+			v.action = "dropped"
+			delete(props, name)
+		}
+		violations = append(violations, v)
+	}
+	if props != nil {
+		entry.properties = props
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	if ctx.schemaReported == nil {
+		ctx.schemaReported = make(map[string]bool)
+	}
+	unreported := violations[:0]
+	for _, v := range violations {
+		key := entry.Stream() + "\x00" + v.field + "\x00" + v.actual
+		if !ctx.schemaReported[key] {
+			ctx.schemaReported[key] = true
+			unreported = append(unreported, v)
+		}
+	}
+	return unreported
+}
+
+func (ctx *stdLoggingContext) reportSchemaViolations(stream string, violations []schemaViolation) {
+	diagnostics, _ := ctx.Stream(SchemaDiagnosticStream)
+	for _, v := range violations {
+		if v.actual == "undeclared" {
+			diagnostics.LogTemplate(Warning, "property {Property} on stream {Stream} is not in the schema: {Action}", v.field, stream, v.action)
+			continue
+		}
+		diagnostics.LogTemplate(Warning, "property {Property} on stream {Stream} is {Actual}, not {Expected}: {Action}", v.field, stream, v.actual, v.expected.String(), v.action)
+	}
+}
+
+func conformsTo(value interface{}, ft FieldType) bool {
+	if value == nil {
+		return true
+	}
+	switch ft {
+	case StringField:
+		_, ok := value.(string)
+		return ok
+	case IntField:
+		if _, ok := value.(time.Duration); ok {
+			return false
+		}
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+		return false
+	case FloatField:
+		switch value.(type) {
+		case float32, float64:
+			return true
+		}
+		return false
+	case BoolField:
+		_, ok := value.(bool)
+		return ok
+	case TimeField:
+		_, ok := value.(time.Time)
+		return ok
+	case DurationField:
+		_, ok := value.(time.Duration)
+		return ok
+	}
+	return true
+}
+
+func coerceField(value interface{}, ft FieldType) (interface{}, bool) {
+	rv := reflect.ValueOf(value)
+	text, isText := value.(string)
+	if !isText {
+		if s, ok := value.(fmt.Stringer); ok {
+			text = s.String()
+		}
+	}
+	switch ft {
+	case StringField:
+		return fmt.Sprintf("%v", value), true
+	case IntField:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int(), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(rv.Uint()), true
+		case reflect.Float32, reflect.Float64:
+			if f := rv.Float(); f == float64(int64(f)) {
+				return int64(f), true
+			}
+		case reflect.String:
+			if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+				return n, true
+			}
+		}
+	case FloatField:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(rv.Int()), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return float64(rv.Uint()), true
+		case reflect.Float32, reflect.Float64:
+			return rv.Float(), true
+		case reflect.String:
+			if f, err := strconv.ParseFloat(text, 64); err == nil {
+				return f, true
+			}
+		}
+	case BoolField:
+		if b, err := strconv.ParseBool(text); isText && err == nil {
+			return b, true
+		}
+	case TimeField:
+		if t, err := time.Parse(time.RFC3339Nano, text); isText && err == nil {
+			return t, true
+		}
+	case DurationField:
+		if d, err := time.ParseDuration(text); text != "" && err == nil {
+			return d, true
+		}
+	}
+	return nil, false
+}
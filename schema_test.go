@@ -0,0 +1,53 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamSchema(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("http")
+	ctx.SetStreamSchema("http", &Schema{
+		Fields: map[string]FieldType{"Status": IntField, "Latency": DurationField, "Path": StringField},
+		Policy: SchemaCoerce,
+	})
+	stream.LogTemplate(Info, "{Path} {Status} {Latency}", "/", "200", "15ms")
+	stream.LogTemplate(Info, "{Path} {Status} {Latency}", "/", "OK", 15*time.Millisecond)
+	stream.LogTemplate(Info, "{Path} {Status} {Latency}", "/", 404, time.Millisecond)
+
+	var entries, diagnostics []LogEntry
+	for _, e := range cl.Entries() {
+		if e.Stream() == SchemaDiagnosticStream {
+			diagnostics = append(diagnostics, e)
+		} else {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	props := entries[0].(TemplatedLogEntry).Properties()
+	if props["Status"] != int64(200) || props["Latency"] != 15*time.Millisecond {
+		t.Errorf("expected converted properties, got %#v", props)
+	}
+	if _, has := entries[1].(TemplatedLogEntry).Properties()["Status"]; has {
+		t.Errorf("expected an unconvertible property to be dropped")
+	}
+	if props := entries[2].(TemplatedLogEntry).Properties(); props["Status"] != 404 {
+		t.Errorf("expected a conforming property to be unchanged, got %#v", props)
+	}
+	// Status as a string is reported once, though it was seen twice.
+	if len(diagnostics) != 2 {
+		for _, d := range diagnostics {
+			t.Log(d.Message())
+		}
+		t.Fatalf("expected 2 diagnostics, got %d", len(diagnostics))
+	}
+	if msg := diagnostics[0].Message(); msg != "property Status on stream http is string, not int: converted" &&
+		msg != "property Latency on stream http is string, not duration: converted" {
+		t.Errorf("unexpected diagnostic %q", msg)
+	}
+}
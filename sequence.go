@@ -0,0 +1,186 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Numbers reserved at a time.
+const SequenceBlock = 1024
+
+// A SequenceStore keeps stream numbers across restarts.  Blocks of
+// SequenceBlock numbers are reserved at a time, so a crash leaves a gap but
+// never repeats a number.
+type SequenceStore interface {
+	Load() (map[string]uint64, error)
+	Save(next map[string]uint64) error
+}
+
+// Entries are numbered across the context, and, with sequences enabled,
+// within their stream, whether or not any listener receives them.
+type SequencedLogEntry interface {
+	LogEntry
+	// Sequence returns the entry's number in its stream, or 0 if the
+	// stream is not numbered.
+	Sequence() uint64
+	// ContextSequence returns the entry's number in its context, or 0 for
+	// an entry not dispatched by a context.
+	ContextSequence() uint64
+}
+
+///
+
+type sequencer struct {
+	lock    chan bool
+	store   SequenceStore
+	next    map[string]uint64
+	ceiling map[string]uint64
+	err     error
+}
+
+type fileSequenceStore struct {
+	path string
+}
+
+// NewFileSequenceStore keeps the next number of each stream in a JSON
+// file.  A missing file starts every stream at 1.
+func NewFileSequenceStore(path string) SequenceStore {
+	return &fileSequenceStore{path: path}
+}
+
+func (fss *fileSequenceStore) Load() (map[string]uint64, error) {
+	next := make(map[string]uint64)
+	data, err := os.ReadFile(fss.path)
+	if os.IsNotExist(err) {
+		return next, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &next); err != nil {
+		return nil, fmt.Errorf("sequences %s: %w", fss.path, err)
+	}
+	return next, nil
+}
+
+func (fss *fileSequenceStore) Save(next map[string]uint64) error {
+	data, err := json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(fss.path), "."+filepath.Base(fss.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fss.path)
+}
+
+// EnableSequences numbers entries from now on, continuing from the
+// numbers in store, if it is not nil.
+func (ctx *stdLoggingContext) EnableSequences(store SequenceStore) error {
+	sq := &sequencer{
+		lock:    make(chan bool, 1),
+		store:   store,
+		next:    make(map[string]uint64),
+		ceiling: make(map[string]uint64),
+	}
+	if store != nil {
+		next, err := store.Load()
+		if err != nil {
+			return err
+		}
+		for stream, n := range next {
+			sq.next[stream] = n
+			sq.ceiling[stream] = n
+		}
+	}
+	sq.lock <- true
+	<-ctx.lock
+	ctx.sequences = sq
+	ctx.lock <- true
+	return nil
+}
+
+// SequenceError returns the first error saving sequence numbers.
+func (ctx *stdLoggingContext) SequenceError() error {
+	<-ctx.lock
+	sq := ctx.sequences
+	ctx.lock <- true
+	if sq == nil {
+		return nil
+	}
+	<-sq.lock
+	defer func() { sq.lock <- true }()
+	return sq.err
+}
+
+func (sq *sequencer) assign(stream string) uint64 {
+	<-sq.lock
+	defer func() { sq.lock <- true }()
+	n := sq.next[stream]
+	if n == 0 {
+		n = 1
+	}
+	sq.next[stream] = n + 1
+	if sq.store != nil && n+1 > sq.ceiling[stream] {
+		sq.ceiling[stream] = n + SequenceBlock
+		sq.save(sq.ceiling)
+	}
+	return n
+}
+
+// Saves the exact numbers, so that numbering resumes without a gap.
+func (sq *sequencer) flush() error {
+	<-sq.lock
+	defer func() { sq.lock <- true }()
+	if sq.store == nil {
+		return nil
+	}
+	for stream, n := range sq.next {
+		sq.ceiling[stream] = n
+	}
+	return sq.save(sq.next)
+}
+
+// Called with the lock held; the first error is kept for SequenceError().
+func (sq *sequencer) save(next map[string]uint64) error {
+	err := sq.store.Save(next)
+	if err != nil && sq.err == nil {
+		sq.err = err
+	}
+	return err
+}
+
+func (ctx *stdLoggingContext) flushSequences() error {
+	<-ctx.lock
+	sq := ctx.sequences
+	ctx.lock <- true
+	if sq == nil {
+		return nil
+	}
+	return sq.flush()
+}
+
+func (le *stdLogEntry) Sequence() uint64 {
+	return le.seq
+}
+
+func (le *stdLogEntry) ContextSequence() uint64 {
+	return le.cseq
+}
+
+func (de *derivedEntry) Sequence() uint64 {
+	if se, ok := de.LogEntry.(SequencedLogEntry); ok {
+		return se.Sequence()
+	}
+	return 0
+}
+
+func (de *derivedEntry) ContextSequence() uint64 {
+	if se, ok := de.LogEntry.(SequencedLogEntry); ok {
+		return se.ContextSequence()
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package log
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSequences(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sequences.json")
+	run := func(flush bool, n int) []uint64 {
+		ctx := CreateLoggingContext()
+		capture := newCaptureListener()
+		ctx.AddGlobalLogListener(capture, Info)
+		if err := ctx.EnableSequences(NewFileSequenceStore(path)); err != nil {
+			t.Fatal(err)
+		}
+		stream, _ := ctx.Stream("app")
+		for i := 0; i < n; i++ {
+			stream.Log(Debug, "unseen, but numbered")
+			stream.Log(Info, "entry")
+		}
+		if flush {
+			ctx.Flush()
+		}
+		if err := ctx.SequenceError(); err != nil {
+			t.Fatal(err)
+		}
+		var seqs []uint64
+		for _, e := range capture.Entries() {
+			seqs = append(seqs, e.(SequencedLogEntry).Sequence())
+		}
+		return seqs
+	}
+	if seqs := run(true, 2); len(seqs) != 2 || seqs[0] != 2 || seqs[1] != 4 {
+		t.Fatalf("unexpected sequence numbers: %v", seqs)
+	}
+	// Resumes exactly after a flush...
+	if seqs := run(false, 1); seqs[0] != 6 {
+		t.Errorf("expected numbering to resume at 5 (the Info entry 6), got %v", seqs)
+	}
+	// ... and past the reserved block after a crash.
+	if seqs := run(false, 1); seqs[0] != 6+SequenceBlock {
+		t.Errorf("expected numbering to resume after the reserved block, got %v", seqs)
+	}
+	ctx := CreateLoggingContext()
+	capture := newCaptureListener()
+	ctx.AddGlobalLogListener(capture, Info)
+	ctx.EnableSequences(nil)
+	stream, _ := ctx.Stream("app")
+	stream.Info("first")
+	if out := NewJSONFormatter().Format(capture.Entries()[0]); !strings.Contains(out, `"seq":1`) {
+		t.Errorf("expected seq in JSON output: %s", out)
+	}
+}
+
+func TestContextSequence(t *testing.T) {
+	ctx := CreateLoggingContext()
+	capture := newCaptureListener()
+	ctx.AddGlobalLogListener(capture, Info)
+	db, _ := ctx.Stream("db")
+	web, _ := ctx.Stream("web")
+	db.Info("one")
+	web.Log(Debug, "unseen, but numbered")
+	web.Info("three")
+	db.With("Key", 1).Info("four")
+	var seqs []uint64
+	for _, e := range capture.Entries() {
+		seqs = append(seqs, e.(SequencedLogEntry).ContextSequence())
+	}
+	if len(seqs) != 3 || seqs[0] != 1 || seqs[1] != 3 || seqs[2] != 4 {
+		t.Errorf("unexpected context sequence numbers: %v", seqs)
+	}
+}
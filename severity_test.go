@@ -0,0 +1,32 @@
+package log
+
+import "testing"
+
+func TestSeverity(t *testing.T) {
+	ordered := []LogLevel{All, Trace, Debug5, Debug4, Debug3, Debug2, Debug, Info3, Info2, Info,
+		Warning3, Warning2, Warning, Error3, Error2, Error, FatalError, None}
+	for i := 1; i < len(ordered); i++ {
+		if Compare(ordered[i-1], ordered[i]) != -1 || Compare(ordered[i], ordered[i-1]) != 1 {
+			t.Errorf("expected %s less severe than %s", ordered[i-1], ordered[i])
+		}
+	}
+	if Compare(Default, None) != 0 || Compare(Warning, Warning) != 0 {
+		t.Errorf("unexpected comparison of equal severities")
+	}
+	for _, c := range []struct {
+		threshold, level LogLevel
+		accepts          bool
+	}{
+		{All, Trace, true},
+		{All, FatalError, true},
+		{Trace, Debug, true},
+		{Warning, Error, true},
+		{Warning, Info, false},
+		{None, FatalError, false},
+		{None, All, true},
+	} {
+		if ListenerAccepts(c.threshold, Info, c.level) != c.accepts {
+			t.Errorf("threshold %s: expected accepting %s to be %v", c.threshold, c.level, c.accepts)
+		}
+	}
+}
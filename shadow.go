@@ -0,0 +1,213 @@
+package log
+
+import (
+	"fmt"
+	"time"
+)
+
+type ShadowOptions struct {
+	// SampleRate is the fraction of entries copied to the shadow, between
+	// 0 and 1; defaults to 1.
+	SampleRate float64
+}
+
+type DeliveryStats struct {
+	Delivered  uint64
+	Failed     uint64
+	Panicked   uint64
+	Latency    time.Duration
+	MaxLatency time.Duration
+}
+
+type ShadowComparison struct {
+	// Sampled is the number of entries sent to both listeners, over which
+	// their statistics are gathered.
+	Sampled uint64
+	Primary DeliveryStats
+	Shadow  DeliveryStats
+}
+
+type ShadowListener interface {
+	FallibleLogListener
+	Flusher
+	Primary() LogListener
+	Shadow() LogListener
+	Compare() ShadowComparison
+	// Promote makes the shadow the primary, receiving every entry, and
+	// returns the former primary, which no longer receives entries and is
+	// not closed by Close().
+	Promote() LogListener
+}
+
+///
+
+type shadowListener struct {
+	lock       chan bool
+	name       string
+	primary    LogListener
+	shadow     LogListener
+	opts       ShadowOptions
+	share      float64
+	comparison ShadowComparison
+}
+
+// NewShadowListener delivers entries to primary, and a sampled copy to
+// shadow, measuring both deliveries for comparison.  The shadow's errors
+// and panics never reach the caller, but its latency does.
+func NewShadowListener(name string, primary LogListener, shadow LogListener, opts ShadowOptions) ShadowListener {
+	if opts.SampleRate <= 0 || opts.SampleRate > 1 {
+		opts.SampleRate = 1
+	}
+	sl := &shadowListener{
+		lock:    make(chan bool, 1),
+		name:    name,
+		primary: primary,
+		shadow:  shadow,
+		opts:    opts,
+	}
+	sl.lock <- true
+	return sl
+}
+
+func (sl *shadowListener) Name() string {
+	return sl.name
+}
+
+func (sl *shadowListener) Primary() LogListener {
+	<-sl.lock
+	defer func() { sl.lock <- true }()
+	return sl.primary
+}
+
+func (sl *shadowListener) Shadow() LogListener {
+	<-sl.lock
+	defer func() { sl.lock <- true }()
+	return sl.shadow
+}
+
+func (sl *shadowListener) Receive(entry LogEntry) {
+	sl.TryReceive(entry)
+}
+
+func (sl *shadowListener) TryReceive(entry LogEntry) error {
+	<-sl.lock
+	primary, shadow := sl.primary, sl.shadow
+	sampled := false
+	if shadow != nil {
+		sl.share += sl.opts.SampleRate
+		if sl.share >= 1 {
+			sl.share--
+			sampled = true
+		}
+	}
+	sl.lock <- true
+	if !sampled {
+		return tryReceive(primary, entry)
+	}
+	var pstats, sstats DeliveryStats
+	err := measureDelivery(primary, entry, &pstats, true)
+	measureDelivery(shadow, entry, &sstats, false)
+	<-sl.lock
+	sl.comparison.Sampled++
+	sl.comparison.Primary.add(pstats)
+	sl.comparison.Shadow.add(sstats)
+	sl.lock <- true
+	return err
+}
+
+func tryReceive(ll LogListener, entry LogEntry) error {
+	if fl, ok := ll.(FallibleLogListener); ok {
+		return fl.TryReceive(entry)
+	}
+	ll.Receive(entry)
+	return nil
+}
+
+// Delivers an entry, recording the outcome in stats.  Panics are recovered
+// and counted unless repanic is set.
+func measureDelivery(ll LogListener, entry LogEntry, stats *DeliveryStats, repanic bool) (err error) {
+	start := time.Now()
+	defer func() {
+		stats.Latency = time.Since(start)
+		stats.MaxLatency = stats.Latency
+		if p := recover(); p != nil {
+			stats.Panicked++
+			if repanic {
+				panic(p)
+			}
+			err = fmt.Errorf("listener %s panicked: %v", ll.Name(), p)
+			return
+		}
+		if err != nil {
+			stats.Failed++
+		} else {
+			stats.Delivered++
+		}
+	}()
+	return tryReceive(ll, entry)
+}
+
+func (ds *DeliveryStats) add(other DeliveryStats) {
+	ds.Delivered += other.Delivered
+	ds.Failed += other.Failed
+	ds.Panicked += other.Panicked
+	ds.Latency += other.Latency
+	if other.MaxLatency > ds.MaxLatency {
+		ds.MaxLatency = other.MaxLatency
+	}
+}
+
+// MeanLatency returns the mean delivery latency.
+func (ds DeliveryStats) MeanLatency() time.Duration {
+	n := ds.Delivered + ds.Failed + ds.Panicked
+	if n == 0 {
+		return 0
+	}
+	return ds.Latency / time.Duration(n)
+}
+
+func (ds DeliveryStats) String() string {
+	return fmt.Sprintf("%d delivered, %d failed, %d panicked, latency mean %s max %s",
+		ds.Delivered, ds.Failed, ds.Panicked, ds.MeanLatency(), ds.MaxLatency)
+}
+
+func (sc ShadowComparison) String() string {
+	return fmt.Sprintf("%d sampled entries\n    primary: %s\n    shadow:  %s", sc.Sampled, sc.Primary, sc.Shadow)
+}
+
+func (sl *shadowListener) Compare() ShadowComparison {
+	<-sl.lock
+	defer func() { sl.lock <- true }()
+	return sl.comparison
+}
+
+func (sl *shadowListener) Promote() LogListener {
+	<-sl.lock
+	defer func() { sl.lock <- true }()
+	if sl.shadow == nil {
+		return nil
+	}
+	former := sl.primary
+	sl.primary, sl.shadow = sl.shadow, nil
+	return former
+}
+
+func (sl *shadowListener) Flush() error {
+	primary, shadow := sl.Primary(), sl.Shadow()
+	var err error
+	if fl, ok := primary.(Flusher); ok {
+		err = fl.Flush()
+	}
+	if fl, ok := shadow.(Flusher); ok {
+		fl.Flush()
+	}
+	return err
+}
+
+func (sl *shadowListener) Close() error {
+	primary, shadow := sl.Primary(), sl.Shadow()
+	if shadow != nil {
+		shadow.Close()
+	}
+	return primary.Close()
+}
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"errors"
+	"testing"
+)
+
+type failingListener struct {
+	*captureListener
+}
+
+func (fl *failingListener) TryReceive(entry LogEntry) error {
+	return errors.New("sink unavailable")
+}
+
+type panickingListener struct {
+	*captureListener
+}
+
+func (pl *panickingListener) Receive(entry LogEntry) {
+	panic("bad formatter")
+}
+
+func TestShadowListener(t *testing.T) {
+	primary := newCaptureListener()
+	shadow := &failingListener{newCaptureListener()}
+	sl := NewShadowListener("canary", primary, shadow, ShadowOptions{SampleRate: 0.5})
+	ctx := CreateLoggingContext()
+	ctx.AddGlobalLogListener(sl, Trace)
+	stream, _ := ctx.Stream("app")
+	for i := 0; i < 10; i++ {
+		stream.Info("entry")
+	}
+	cmp := sl.Compare()
+	if len(primary.Entries()) != 10 || cmp.Sampled != 5 {
+		t.Fatalf("expected 10 primary deliveries and 5 sampled, got %d and %s", len(primary.Entries()), cmp)
+	}
+	if cmp.Primary.Delivered != 5 || cmp.Shadow.Failed != 5 {
+		t.Errorf("unexpected comparison: %s", cmp)
+	}
+
+	panicking := &panickingListener{newCaptureListener()}
+	sl = NewShadowListener("canary-2", primary, panicking, ShadowOptions{})
+	sl.Receive(primary.Entries()[0])
+	if cmp := sl.Compare(); cmp.Shadow.Panicked != 1 || len(primary.Entries()) != 11 {
+		t.Errorf("expected the shadow's panic recovered and counted: %s", cmp)
+	}
+	if former := sl.Promote(); former != LogListener(primary) || sl.Primary() != LogListener(panicking) || sl.Shadow() != nil {
+		t.Errorf("expected the shadow promoted")
+	}
+}
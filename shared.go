@@ -0,0 +1,152 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+func (fl *fileListener) openLockFile() error {
+	lockPath := fl.path + ".lock"
+	if fl.lockFile != nil && fl.lockPath == lockPath {
+		return nil
+	}
+	if fl.lockFile != nil {
+		fl.lockFile.Close()
+		fl.lockFile = nil
+	}
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fl.lockFile = file
+	fl.lockPath = lockPath
+	return nil
+}
+
+// lockExclusive takes the exclusive file lock, unless it is already held,
+// and returns the function releasing it.
+func (fl *fileListener) lockExclusive() (func(), error) {
+	if fl.exclusive {
+		return func() {}, nil
+	}
+	if err := fl.openLockFile(); err != nil {
+		return nil, err
+	}
+	if err := lockFile(fl.lockFile, true); err != nil {
+		return nil, err
+	}
+	fl.exclusive = true
+	return func() {
+		fl.exclusive = false
+		unlockFile(fl.lockFile)
+	}, nil
+}
+
+// lockForWrite takes the lock appending requires: shared, or exclusive.
+func (fl *fileListener) lockForWrite(exclusive bool) (func(), error) {
+	if exclusive {
+		return fl.lockExclusive()
+	}
+	if err := lockFile(fl.lockFile, false); err != nil {
+		return nil, err
+	}
+	return func() { unlockFile(fl.lockFile) }, nil
+}
+
+// stale reports whether another process has rotated the file out from
+// under us.
+func (fl *fileListener) stale() bool {
+	if fl.file == nil {
+		return true
+	}
+	pathInfo, err := os.Stat(fl.path)
+	if err != nil {
+		return true
+	}
+	fileInfo, err := fl.file.Stat()
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(pathInfo, fileInfo)
+}
+
+// Each entry is one write(2) on an O_APPEND descriptor, which local
+// filesystems (not NFS) perform atomically.  Rotation is coordinated through
+// an advisory lock on "<path>.lock", held shared while appending and
+// exclusively to rotate.  sharedWrite is called with the listener lock held.
+func (fl *fileListener) sharedWrite(data []byte) error {
+	if err := fl.openLockFile(); err != nil {
+		return err
+	}
+	// Encrypted files' records are numbered, so they are appended under the
+	// exclusive lock.  So is a write which found the file rotated, or
+	// rotated it: under the exclusive lock the file cannot be rotated again
+	// before the write.
+	exclusive := fl.crypt != nil
+	for attempt := 0; attempt < 3; attempt++ {
+		unlock, err := fl.lockForWrite(exclusive)
+		if err != nil {
+			return err
+		}
+		if fl.stale() {
+			if !exclusive {
+				unlock()
+				exclusive = true
+				continue
+			}
+			fl.dropFile()
+			if err := fl.openFile(); err != nil {
+				unlock()
+				return err
+			}
+		}
+		if info, err := fl.file.Stat(); err == nil {
+			fl.size = info.Size()
+		}
+		if fl.opts.Rotation != nil && fl.opts.Rotation.due(fl.size, len(data), fl.started) {
+			unlock()
+			if err := fl.sharedRotate(len(data)); err != nil {
+				return err
+			}
+			exclusive = true
+			continue
+		}
+		sealed := data
+		if fl.crypt != nil {
+			if err := fl.crypt.sync(fl.file); err != nil {
+				unlock()
+				return err
+			}
+			if sealed, err = fl.seal(data); err != nil {
+				unlock()
+				return err
+			}
+		}
+		n, err := fl.file.Write(sealed)
+		fl.size += int64(n)
+		if fl.started.IsZero() {
+			fl.started = time.Now()
+		}
+		unlock()
+		return err
+	}
+	return errors.New("shared log file kept changing during write")
+}
+
+func (fl *fileListener) sharedRotate(n int) error {
+	unlock, err := fl.lockExclusive()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// Another process may have rotated while we waited for the lock.
+	if fl.stale() {
+		fl.dropFile()
+		return fl.openFile()
+	}
+	if info, err := fl.file.Stat(); err == nil && !fl.opts.Rotation.due(info.Size(), n, fl.started) {
+		return nil
+	}
+	return fl.rotate()
+}
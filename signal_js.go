@@ -0,0 +1,12 @@
+// +build js
+
+package log
+
+import (
+	"os"
+)
+
+// There is no SIGHUP under js; ReopenOnSignals() needs explicit signals.
+func defaultReopenSignals() []os.Signal {
+	return nil
+}
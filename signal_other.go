@@ -0,0 +1,12 @@
+// +build !js
+
+package log
+
+import (
+	"os"
+	"syscall"
+)
+
+func defaultReopenSignals() []os.Signal {
+	return []os.Signal{syscall.SIGHUP}
+}
@@ -0,0 +1,139 @@
+package log
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// A SharedListener is a handle on a sink shared by the parts of an
+// application logging to the same file or address.  The first acquirer
+// opens the sink; closing the last handle closes it.
+type SharedListener interface {
+	FallibleLogListener
+	Flusher
+	// Target returns the shared listener.
+	Target() LogListener
+	// Key returns the sink's key in the registry.
+	Key() string
+	// Refs returns the number of handles holding the sink.
+	Refs() int
+}
+
+///
+
+type sharedSink struct {
+	key      string
+	listener LogListener
+	refs     int
+}
+
+type sharedHandle struct {
+	lock     chan bool
+	name     string
+	sink     *sharedSink
+	released bool
+}
+
+var _GLOBAL_sinks = make(map[string]*sharedSink)
+var _GLOBAL_sinksLock chan bool = make(chan bool, 1)
+
+// AcquireSink returns a handle on the sink registered under key, calling
+// open to create it if there is none.
+func AcquireSink(name string, key string, open func() (LogListener, error)) (SharedListener, error) {
+	_GLOBAL_sinksLock <- true
+	defer func() { <-_GLOBAL_sinksLock }()
+	sink, has := _GLOBAL_sinks[key]
+	if !has {
+		listener, err := open()
+		if err != nil {
+			return nil, err
+		}
+		sink = &sharedSink{key: key, listener: listener}
+		_GLOBAL_sinks[key] = sink
+	}
+	sink.refs++
+	sh := &sharedHandle{lock: make(chan bool, 1), name: name, sink: sink}
+	sh.lock <- true
+	return sh, nil
+}
+
+// AcquireFileListener shares file listeners by absolute path.
+func AcquireFileListener(name string, path string, formatter LogEntryFormatter, opts FileOptions) (SharedListener, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return AcquireSink(name, "file:"+abs, func() (LogListener, error) {
+		return NewFileListenerWithOptions(name, abs, formatter, opts)
+	})
+}
+
+// AcquireNetworkListener shares network listeners by network and address.
+func AcquireNetworkListener(name string, network string, address string, opts NetworkOptions) SharedListener {
+	sl, _ := AcquireSink(name, fmt.Sprintf("%s:%s", network, address), func() (LogListener, error) {
+		return NewNetworkListener(name, network, address, opts), nil
+	})
+	return sl
+}
+
+func (sh *sharedHandle) Name() string {
+	return sh.name
+}
+
+func (sh *sharedHandle) Target() LogListener {
+	return sh.sink.listener
+}
+
+func (sh *sharedHandle) Key() string {
+	return sh.sink.key
+}
+
+func (sh *sharedHandle) Refs() int {
+	_GLOBAL_sinksLock <- true
+	defer func() { <-_GLOBAL_sinksLock }()
+	return sh.sink.refs
+}
+
+func (sh *sharedHandle) Receive(entry LogEntry) {
+	sh.TryReceive(entry)
+}
+
+func (sh *sharedHandle) TryReceive(entry LogEntry) error {
+	<-sh.lock
+	released := sh.released
+	sh.lock <- true
+	if released {
+		return fmt.Errorf("listener %s: sink %s released", sh.name, sh.sink.key)
+	}
+	return tryReceive(sh.sink.listener, entry)
+}
+
+func (sh *sharedHandle) Flush() error {
+	if fl, ok := sh.sink.listener.(Flusher); ok {
+		return fl.Flush()
+	}
+	return nil
+}
+
+// Close releases the handle's reference, closing the sink if it was the
+// last.
+func (sh *sharedHandle) Close() error {
+	<-sh.lock
+	if sh.released {
+		sh.lock <- true
+		return nil
+	}
+	sh.released = true
+	sh.lock <- true
+	_GLOBAL_sinksLock <- true
+	sh.sink.refs--
+	last := sh.sink.refs == 0
+	if last && _GLOBAL_sinks[sh.sink.key] == sh.sink {
+		delete(_GLOBAL_sinks, sh.sink.key)
+	}
+	<-_GLOBAL_sinksLock
+	if !last {
+		return sh.Flush()
+	}
+	return sh.sink.listener.Close()
+}
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSharedSinks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shared.log")
+	first, err := AcquireFileListener("first", path, nil, FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := AcquireFileListener("second", filepath.Join(dir, ".", "shared.log"), nil, FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Target() != second.Target() || first.Refs() != 2 {
+		t.Fatalf("expected one sink with 2 references, got %d", first.Refs())
+	}
+	ctx := CreateLoggingContext()
+	a, _ := ctx.Stream("a")
+	b, _ := ctx.Stream("b")
+	a.AddLogListener(first, Trace)
+	b.AddLogListener(second, Trace)
+	a.Info("from a")
+	first.Close()
+	first.Close()
+	if second.Refs() != 1 {
+		t.Errorf("expected closing twice to release one reference, got %d", second.Refs())
+	}
+	b.Info("from b, after a detached")
+	if err := second.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "from a") || !strings.Contains(string(data), "after a detached") {
+		t.Errorf("unexpected file contents %q", data)
+	}
+	third, err := AcquireFileListener("third", path, nil, FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if third.Target() == second.Target() || third.Refs() != 1 {
+		t.Errorf("expected the released sink to be opened anew")
+	}
+}
@@ -0,0 +1,195 @@
+package log
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type SLOWindow struct {
+	Window        time.Duration
+	BurnThreshold float64
+}
+
+var DefaultSLOWindows = []SLOWindow{
+	{Window: time.Hour, BurnThreshold: 14.4},
+	{Window: 6 * time.Hour, BurnThreshold: 6},
+}
+
+type SLOOptions struct {
+	Objective      float64
+	Windows        []SLOWindow
+	SampleInterval time.Duration
+	// Log receives threshold crossing entries; nil disables them.
+	Log     Log
+	Metrics MetricsRegistry
+}
+
+type SLOStatus struct {
+	Window    time.Duration
+	Total     uint64
+	Errors    uint64
+	ErrorRate float64
+	BurnRate  float64
+	Burning   bool
+}
+
+// An SLOMonitor samples a stream's error and total counts and computes, per
+// window, the error rate and the burn rate (error rate over 1 - Objective).
+// Crossing a window's threshold logs a Warning, recovering an Info.
+type SLOMonitor interface {
+	Status() []SLOStatus
+	// Sample takes a sample immediately; the monitor otherwise samples
+	// every SampleInterval.
+	Sample()
+	Stop()
+}
+
+///
+
+type sloSample struct {
+	at     time.Time
+	total  uint64
+	errors uint64
+}
+
+type sloMonitor struct {
+	lock    chan bool
+	stream  LogStream
+	opts    SLOOptions
+	samples []sloSample
+	status  []SLOStatus
+	stop    chan bool
+	stopped int32
+}
+
+func NewSLOMonitor(stream LogStream, opts SLOOptions) SLOMonitor {
+	if opts.Objective <= 0 || opts.Objective >= 1 {
+		opts.Objective = 0.999
+	}
+	if len(opts.Windows) == 0 {
+		opts.Windows = DefaultSLOWindows
+	}
+	if opts.SampleInterval <= 0 {
+		opts.SampleInterval = 10 * time.Second
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = DefaultMetricsRegistry()
+	}
+	sm := &sloMonitor{
+		lock:   make(chan bool, 1),
+		stream: stream,
+		opts:   opts,
+		status: make([]SLOStatus, len(opts.Windows)),
+		stop:   make(chan bool),
+	}
+	for i, win := range opts.Windows {
+		sm.status[i].Window = win.Window
+	}
+	sm.lock <- true
+	sm.Sample()
+	go func() {
+		ticker := time.NewTicker(opts.SampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sm.Sample()
+			case <-sm.stop:
+				return
+			}
+		}
+	}()
+	return sm
+}
+
+func countErrors(stats StreamStats) uint64 {
+	var n uint64
+	for level, count := range stats.Entries {
+		if level.IsError() || level.IsFatal() {
+			n += count
+		}
+	}
+	return n
+}
+
+func (sm *sloMonitor) Sample() {
+	sm.sampleAt(time.Now())
+}
+
+func (sm *sloMonitor) sampleAt(now time.Time) {
+	stats := sm.stream.Stats()
+	sample := sloSample{at: now, total: stats.Total, errors: countErrors(stats)}
+	var crossings []SLOStatus
+	<-sm.lock
+	sm.samples = append(sm.samples, sample)
+	longest := time.Duration(0)
+	for _, win := range sm.opts.Windows {
+		if win.Window > longest {
+			longest = win.Window
+		}
+	}
+	// Keep one sample at or beyond the longest window as its baseline.
+	drop := 0
+	for drop+1 < len(sm.samples) && now.Sub(sm.samples[drop+1].at) >= longest {
+		drop++
+	}
+	sm.samples = sm.samples[drop:]
+	budget := 1 - sm.opts.Objective
+	for i, win := range sm.opts.Windows {
+		base := sm.samples[0]
+		for _, s := range sm.samples {
+			if now.Sub(s.at) < win.Window {
+				break
+			}
+			base = s
+		}
+		st := &sm.status[i]
+		st.Total = sample.total - base.total
+		st.Errors = sample.errors - base.errors
+		st.ErrorRate = 0
+		if st.Total > 0 {
+			st.ErrorRate = float64(st.Errors) / float64(st.Total)
+		}
+		st.BurnRate = st.ErrorRate / budget
+		burning := st.BurnRate >= win.BurnThreshold
+		if burning != st.Burning {
+			st.Burning = burning
+			crossings = append(crossings, *st)
+		}
+	}
+	status := make([]SLOStatus, len(sm.status))
+	copy(status, sm.status)
+	sm.lock <- true
+	name := sm.stream.Name()
+	for _, st := range status {
+		labels := map[string]string{"stream": name, "window": st.Window.String()}
+		sm.opts.Metrics.Gauge("log_slo_error_rate", labels).Set(st.ErrorRate)
+		sm.opts.Metrics.Gauge("log_slo_burn_rate", labels).Set(st.BurnRate)
+	}
+	if sm.opts.Log == nil {
+		return
+	}
+	for _, st := range crossings {
+		if st.Burning {
+			sm.opts.Log.LogTemplate(Warning, "SLO burn rate for {Stream} over {Window} is {BurnRate:%.2f} ({Errors} errors in {Total} entries)",
+				name, st.Window, st.BurnRate, st.Errors, st.Total)
+		} else {
+			sm.opts.Log.LogTemplate(Info, "SLO burn rate for {Stream} over {Window} recovered to {BurnRate:%.2f}",
+				name, st.Window, st.BurnRate)
+		}
+	}
+}
+
+func (sm *sloMonitor) Status() []SLOStatus {
+	<-sm.lock
+	defer func() { sm.lock <- true }()
+	status := make([]SLOStatus, len(sm.status))
+	copy(status, sm.status)
+	return status
+}
+
+func (sm *sloMonitor) Stop() {
+	if atomic.CompareAndSwapInt32(&sm.stopped, 0, 1) {
+		close(sm.stop)
+	}
+}
@@ -0,0 +1,78 @@
+package log
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSLOMonitorBurnRate(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	api, _ := ctx.Stream("api")
+	alerts, _ := ctx.Stream("slo")
+	reg := NewMetricsRegistry()
+	mon := NewSLOMonitor(api, SLOOptions{
+		Objective:      0.99,
+		Windows:        []SLOWindow{{Window: time.Minute, BurnThreshold: 10}},
+		SampleInterval: time.Hour,
+		Log:            alerts,
+		Metrics:        reg,
+	})
+	defer mon.Stop()
+	sm := mon.(*sloMonitor)
+	start := sm.samples[0].at
+	logged := func(n int, err bool) {
+		for i := 0; i < n; i++ {
+			if err {
+				api.Error(errors.New("failed"))
+			} else {
+				api.Info("ok")
+			}
+		}
+	}
+	burn := func() float64 {
+		return reg.Gauge("log_slo_burn_rate", map[string]string{"stream": "api", "window": "1m0s"}).Value()
+	}
+
+	logged(100, false)
+	sm.sampleAt(start.Add(30 * time.Second))
+	if st := mon.Status()[0]; st.Burning || st.Total != 100 || st.Errors != 0 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	// 30 errors in 220 entries is a burn rate of 13.64 against a 1% budget.
+	logged(90, false)
+	logged(30, true)
+	sm.sampleAt(start.Add(time.Minute))
+	st := mon.Status()[0]
+	if !st.Burning || st.Total != 220 || st.Errors != 30 || math.Abs(st.BurnRate-13.64) > 0.01 {
+		t.Fatalf("expected burning, got %+v", st)
+	}
+	if math.Abs(burn()-st.BurnRate) > 1e-9 {
+		t.Errorf("burn rate gauge %g, status %g", burn(), st.BurnRate)
+	}
+
+	// The errors age out of the window.
+	logged(1000, false)
+	sm.sampleAt(start.Add(3 * time.Minute))
+	if st := mon.Status()[0]; st.Burning || st.Total != 1000 || st.BurnRate != 0 || burn() != 0 {
+		t.Fatalf("expected recovery, got %+v", st)
+	}
+
+	ctx.Flush()
+	var crossings []LogEntry
+	for _, e := range cl.Entries() {
+		if e.Stream() == "slo" {
+			crossings = append(crossings, e)
+		}
+	}
+	if len(crossings) != 2 || crossings[0].Level() != Warning || crossings[1].Level() != Info {
+		t.Fatalf("expected a warning and a recovery, got %v", crossings)
+	}
+	if props := crossings[0].(TemplatedLogEntry).Properties(); props["Stream"] != "api" || props["Errors"] != uint64(30) {
+		t.Errorf("unexpected alert properties %v", props)
+	}
+}
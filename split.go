@@ -0,0 +1,101 @@
+package log
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+)
+
+// A LevelClass names the file receiving entries more severe than (or equal
+// to) MaxLevel which are not claimed by a more severe class.
+type LevelClass struct {
+	Name     string
+	MaxLevel LogLevel
+}
+
+var DefaultLevelClasses = []LevelClass{
+	{Name: "errors", MaxLevel: Error3},
+	{Name: "warnings", MaxLevel: Warning3},
+	{Name: "info", MaxLevel: Trace},
+}
+
+///
+
+type levelSplitListener struct {
+	name      string
+	formatter LogEntryFormatter
+	classes   []LevelClass
+	files     []FileListener
+}
+
+// NewLevelSplitListener writes entries to "<dir>/<class>.log" according to
+// their level class.  All files share opts, including its rotation policy.
+// Entries less severe than every class are dropped.
+func NewLevelSplitListener(name string, dir string, formatter LogEntryFormatter, classes []LevelClass, opts FileOptions) (FormattingLogListener, error) {
+	if len(classes) == 0 {
+		classes = DefaultLevelClasses
+	}
+	if formatter == nil {
+		formatter = NewLogEntryFormatter()
+	}
+	sorted := make([]LevelClass, len(classes))
+	copy(sorted, classes)
+	sort.SliceStable(sorted, func(i, j int) bool { return Compare(sorted[i].MaxLevel, sorted[j].MaxLevel) > 0 })
+	lsl := &levelSplitListener{
+		name:      name,
+		formatter: formatter,
+		classes:   sorted,
+	}
+	for _, class := range sorted {
+		fl, err := NewFileListenerWithOptions(name+"-"+class.Name, filepath.Join(dir, class.Name+".log"), formatter, opts)
+		if err != nil {
+			lsl.Close()
+			return nil, err
+		}
+		lsl.files = append(lsl.files, fl)
+	}
+	return lsl, nil
+}
+
+func (lsl *levelSplitListener) Name() string {
+	return lsl.name
+}
+
+func (lsl *levelSplitListener) Formatter() LogEntryFormatter {
+	return lsl.formatter
+}
+
+func (lsl *levelSplitListener) Receive(entry LogEntry) {
+	for i, class := range lsl.classes {
+		if admits(class.MaxLevel, entry.Level()) {
+			lsl.files[i].Receive(entry)
+			return
+		}
+	}
+}
+
+func (lsl *levelSplitListener) Flush() error {
+	var errs []error
+	for _, fl := range lsl.files {
+		if f, ok := fl.(Flusher); ok {
+			errs = append(errs, f.Flush())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (lsl *levelSplitListener) Reopen() error {
+	var errs []error
+	for _, fl := range lsl.files {
+		errs = append(errs, fl.Reopen())
+	}
+	return errors.Join(errs...)
+}
+
+func (lsl *levelSplitListener) Close() error {
+	var errs []error
+	for _, fl := range lsl.files {
+		errs = append(errs, fl.Close())
+	}
+	return errors.Join(errs...)
+}
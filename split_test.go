@@ -0,0 +1,64 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelSplitListener(t *testing.T) {
+	stream, _ := CreateLoggingContext().Stream("app")
+	formatter := NewLogEntryFormatter()
+	formatter.ClearFlags(PrintTime | PrintFileLine | PrintStreamName | PrintLevel)
+	for _, c := range []struct {
+		name    string
+		classes []LevelClass
+		want    map[string][]LogLevel
+	}{
+		{"default", nil, map[string][]LogLevel{
+			"errors":   {FatalError, Error, Error3},
+			"warnings": {Warning, Warning3},
+			"info":     {Info, Debug, Trace},
+		}},
+		// Classes are matched most severe first, whatever their order;
+		// entries below every class are dropped.
+		{"custom", []LevelClass{{Name: "verbose", MaxLevel: Info}, {Name: "fatal", MaxLevel: FatalError}}, map[string][]LogLevel{
+			"fatal":   {FatalError},
+			"verbose": {Error, Error3, Warning, Warning3, Info},
+		}},
+	} {
+		dir := t.TempDir()
+		lsl, err := NewLevelSplitListener("split", dir, formatter, c.classes, FileOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, level := range []LogLevel{FatalError, Error, Error3, Warning, Warning3, Info, Debug, Trace} {
+			lsl.Receive(&stdLogEntry{ts: time.Now(), stream: stream, level: level, message: level.String()})
+		}
+		if err := lsl.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for class, levels := range c.want {
+			data, err := os.ReadFile(filepath.Join(dir, class+".log"))
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				got = append(got, strings.TrimSpace(line))
+			}
+			var want []string
+			for _, level := range levels {
+				want = append(want, level.String())
+			}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%s: %s.log holds %v, want %v", c.name, class, got, want)
+			}
+		}
+		if files, _ := filepath.Glob(filepath.Join(dir, "*.log")); len(files) != len(c.want) {
+			t.Errorf("%s: unexpected files %v", c.name, files)
+		}
+	}
+}
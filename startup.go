@@ -0,0 +1,85 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+)
+
+const logModulePath = "github.com/dtromb/log"
+
+// RegisterLoggingFeature adds name to the features listed in the startup
+// entry; integrations compiled in by build tags register themselves.
+func RegisterLoggingFeature(name string) {
+	<-_GLOBAL_featureLock
+	defer func() { _GLOBAL_featureLock <- true }()
+	for _, f := range buildFeatures {
+		if f == name {
+			return
+		}
+	}
+	buildFeatures = append(buildFeatures, name)
+}
+
+///
+
+var buildFeatures []string
+var _GLOBAL_featureLock chan bool = make(chan bool, 1)
+
+func init() {
+	_GLOBAL_featureLock <- true
+}
+
+// LogStartupInfo logs one structured "started" entry with the program's
+// version and VCS stamp, the Go version and platform, this package's
+// version and the logging features in use.
+func LogStartupInfo(log Log) {
+	program := filepath.Base(os.Args[0])
+	version, module, logVersion := "unknown", "", "unknown"
+	revision, vcsTime, modified := "unknown", "unknown", ""
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		module, version = bi.Main.Path, bi.Main.Version
+		if bi.Main.Path == logModulePath {
+			logVersion = bi.Main.Version
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == logModulePath {
+				logVersion = dep.Version
+				if dep.Replace != nil {
+					logVersion += " => " + dep.Replace.Path + " " + dep.Replace.Version
+				}
+			}
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				revision = s.Value
+			case "vcs.time":
+				vcsTime = s.Value
+			case "vcs.modified":
+				if s.Value == "true" {
+					modified = "+dirty"
+				}
+			}
+		}
+	}
+	hostname, _ := os.Hostname()
+	log.LogTemplate(Info, "started {Program} {Version} ({Module} revision {VCSRevision}{VCSModified} of {VCSTime}), {GoVersion} {GOOS}/{GOARCH}, pid {PID} on {Hostname}, log {LogVersion} features {Features}",
+		program, version, module, revision, modified, vcsTime, runtime.Version(), runtime.GOOS, runtime.GOARCH,
+		os.Getpid(), hostname, logVersion, loggingFeatures())
+}
+
+func loggingFeatures() []string {
+	<-_GLOBAL_featureLock
+	features := append([]string(nil), buildFeatures...)
+	_GLOBAL_featureLock <- true
+	<-_GLOBAL_captureLock
+	if _GLOBAL_capture != nil {
+		features = append(features, "stdio-capture")
+	}
+	_GLOBAL_captureLock <- true
+	sort.Strings(features)
+	return features
+}
@@ -0,0 +1,53 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestLogStartupInfo(t *testing.T) {
+	RegisterLoggingFeature("test-feature")
+	RegisterLoggingFeature("test-feature")
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("startup")
+	LogStartupInfo(stream)
+	ctx.Flush()
+	entries := cl.Entries()
+	if len(entries) != 1 || entries[0].Level() != Info {
+		t.Fatalf("expected one Info entry, got %v", entries)
+	}
+	props := entries[0].(TemplatedLogEntry).Properties()
+	hostname, _ := os.Hostname()
+	for key, want := range map[string]interface{}{
+		"Program":   filepath.Base(os.Args[0]),
+		"GoVersion": runtime.Version(),
+		"GOOS":      runtime.GOOS,
+		"GOARCH":    runtime.GOARCH,
+		"PID":       os.Getpid(),
+		"Hostname":  hostname,
+	} {
+		if props[key] != want {
+			t.Errorf("%s is %v, want %v", key, props[key], want)
+		}
+	}
+	for _, key := range []string{"Version", "Module", "VCSRevision", "VCSTime", "LogVersion"} {
+		if _, has := props[key]; !has {
+			t.Errorf("missing %s in %v", key, props)
+		}
+	}
+	features, _ := props["Features"].([]string)
+	count := 0
+	for _, f := range features {
+		if f == "test-feature" {
+			count++
+		}
+	}
+	if count != 1 || !sort.StringsAreSorted(features) {
+		t.Errorf("unexpected features %v", features)
+	}
+}
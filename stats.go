@@ -0,0 +1,70 @@
+package log
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type StreamStats struct {
+	Stream         string
+	Entries        map[LogLevel]uint64
+	Total          uint64
+	LastEntryTime  time.Time
+	BytesFormatted uint64
+}
+
+// StreamStatsCounter accumulates StreamStats for a stream.  It is safe for
+// concurrent use, and is exported for use by LoggingContext implementations
+// outside this package.
+type StreamStatsCounter struct {
+	name      string
+	counts    [None + 1]uint64
+	lastEntry int64
+	bytes     uint64
+}
+
+// Listeners which format entries report the formatted size to the
+// originating stream through this interface, if the entry supports it.
+type formattedSizeRecorder interface {
+	recordFormatted(n int)
+}
+
+func NewStreamStatsCounter(stream string) *StreamStatsCounter {
+	return &StreamStatsCounter{name: stream}
+}
+
+func (sc *StreamStatsCounter) Record(level LogLevel, ts time.Time) {
+	if level > None {
+		level = None
+	}
+	atomic.AddUint64(&sc.counts[level], 1)
+	atomic.StoreInt64(&sc.lastEntry, ts.UnixNano())
+}
+
+func (sc *StreamStatsCounter) RecordFormatted(n int) {
+	atomic.AddUint64(&sc.bytes, uint64(n))
+}
+
+func (sc *StreamStatsCounter) Snapshot() StreamStats {
+	stats := StreamStats{
+		Stream:         sc.name,
+		Entries:        make(map[LogLevel]uint64),
+		BytesFormatted: atomic.LoadUint64(&sc.bytes),
+	}
+	for i := range sc.counts {
+		if n := atomic.LoadUint64(&sc.counts[i]); n > 0 {
+			stats.Entries[LogLevel(i)] = n
+			stats.Total += n
+		}
+	}
+	if ts := atomic.LoadInt64(&sc.lastEntry); ts != 0 {
+		stats.LastEntryTime = time.Unix(0, ts)
+	}
+	return stats
+}
+
+func recordFormattedSize(entry LogEntry, n int) {
+	if fr, ok := entry.(formattedSizeRecorder); ok {
+		fr.recordFormatted(n)
+	}
+}
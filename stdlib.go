@@ -0,0 +1,48 @@
+package log
+
+import (
+	stdlog "log"
+	"strings"
+)
+
+// HijackStdlib routes the default logger's output to stream, at level where
+// a message names none.  restore puts the logger's previous output, flags
+// and prefix back.
+func HijackStdlib(stream LogStream, level LogLevel) (restore func()) {
+	w := &stdlibWriter{stream: stream, level: level}
+	output, flags, prefix := stdlog.Writer(), stdlog.Flags(), stdlog.Prefix()
+	stdlog.SetFlags(flags & (stdlog.Lshortfile | stdlog.Llongfile))
+	stdlog.SetOutput(w)
+	return func() {
+		stdlog.SetOutput(output)
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+	}
+}
+
+///
+
+type stdlibWriter struct {
+	stream LogStream
+	level  LogLevel
+}
+
+// The default logger writes each message with a single Write.
+func (sw *stdlibWriter) Write(p []byte) (int, error) {
+	message := strings.TrimRight(string(p), "\r\n")
+	if prefix := stdlog.Prefix(); prefix != "" {
+		message = strings.TrimPrefix(message, prefix)
+	}
+	var location string
+	if stdlog.Flags()&(stdlog.Lshortfile|stdlog.Llongfile) != 0 {
+		if idx := strings.Index(message, ": "); idx >= 0 {
+			location, message = message[:idx+2], message[idx+2:]
+		}
+	}
+	level := sw.level
+	if parsed := (plainLineParser{}).ParseLine(message); parsed.HasLevel && !parsed.HasTime {
+		level, message = parsed.Level, parsed.Message
+	}
+	sw.stream.Log(level, location+message)
+	return len(p), nil
+}
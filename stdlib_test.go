@@ -0,0 +1,41 @@
+package log
+
+import (
+	stdlog "log"
+	"testing"
+)
+
+func TestHijackStdlib(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("stdlib")
+	stdlog.SetPrefix("app: ")
+	restore := HijackStdlib(stream, Info)
+	stdlog.Printf("[WARN] disk %d%% full", 91)
+	stdlog.Print("error: connection refused")
+	stdlog.Print("starting up")
+	restore()
+	stdlog.SetPrefix("")
+
+	expected := []struct {
+		level   LogLevel
+		message string
+	}{
+		{Warning, "disk 91% full"},
+		{Error, "connection refused"},
+		{Info, "starting up"},
+	}
+	entries := cl.Entries()
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+	for i, e := range expected {
+		if entries[i].Level() != e.level || entries[i].Message() != e.message {
+			t.Errorf("entry %d: expected %s %q, got %s %q", i, e.level, e.message, entries[i].Level(), entries[i].Message())
+		}
+	}
+	if stdlog.Flags() != stdlog.LstdFlags {
+		t.Errorf("expected the logger's flags to be restored, got %d", stdlog.Flags())
+	}
+}
@@ -0,0 +1,15 @@
+package log
+
+import "testing"
+
+func TestStreamRegistration(t *testing.T) {
+	ctx := CreateLoggingContext()
+	first, created := ctx.Stream("db")
+	second, again := ctx.Stream("db")
+	if !created || again {
+		t.Errorf("expected only the first call to create the stream")
+	}
+	if first != second || !ctx.HasStream("db") {
+		t.Errorf("expected the stream to be kept by the context")
+	}
+}
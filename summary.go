@@ -0,0 +1,215 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SummaryOptions struct {
+	// Log receives the report entry; defaults to the global context's
+	// "summary" stream.  Entries on it are not counted.
+	Log Log
+	// Level of the report entry; defaults to Warning.
+	Level LogLevel
+	// Top is the number of repeated messages reported; defaults to 5.
+	Top int
+}
+
+type SummaryStream struct {
+	Stream      string
+	Warnings    uint64
+	Errors      uint64
+	First, Last time.Time
+}
+
+type SummaryMessage struct {
+	Stream      string
+	Level       LogLevel
+	Message     string
+	Count       uint64
+	First, Last time.Time
+}
+
+type SummaryReport struct {
+	Warnings uint64
+	Errors   uint64
+	// Streams are in order of name.
+	Streams []SummaryStream
+	// Repeated holds the messages logged more than once, most frequent
+	// first.
+	Repeated []SummaryMessage
+}
+
+// A Summarizer counts the warnings and errors on each stream, and the most
+// repeated messages by template, and logs a report of them when flushed,
+// before any listener is flushed.
+type Summarizer interface {
+	LogListener
+	Flusher
+	Report() SummaryReport
+}
+
+///
+
+// Distinct messages tracked; beyond this, entries are only counted.
+const maxSummaryMessages = 1024
+
+type summaryKey struct {
+	stream  string
+	message string
+}
+
+type summarizer struct {
+	lock     chan bool
+	name     string
+	opts     SummaryOptions
+	own      string
+	streams  map[string]*SummaryStream
+	messages map[summaryKey]*SummaryMessage
+	total    uint64
+	reported uint64
+}
+
+func NewSummarizer(name string, opts SummaryOptions) Summarizer {
+	if opts.Log == nil {
+		opts.Log, _ = GetGlobalLoggingContext().Stream("summary")
+	}
+	if opts.Level == All || opts.Level == Default {
+		opts.Level = Warning
+	}
+	if opts.Top <= 0 {
+		opts.Top = 5
+	}
+	sm := &summarizer{
+		lock:     make(chan bool, 1),
+		name:     name,
+		opts:     opts,
+		streams:  make(map[string]*SummaryStream),
+		messages: make(map[summaryKey]*SummaryMessage),
+	}
+	if ls, ok := opts.Log.(LogStream); ok {
+		sm.own = ls.Name()
+	}
+	sm.lock <- true
+	return sm
+}
+
+func (sm *summarizer) Name() string {
+	return sm.name
+}
+
+func (sm *summarizer) Receive(entry LogEntry) {
+	level := entry.Level()
+	if level == All || Compare(level, Warning) < 0 || entry.Stream() == sm.own {
+		return
+	}
+	message := entry.Message()
+	if te, ok := entry.(TemplatedLogEntry); ok && te.MessageTemplate() != "" {
+		message = te.MessageTemplate()
+	}
+	ts := entry.LogTime()
+	<-sm.lock
+	defer func() { sm.lock <- true }()
+	sm.total++
+	ss, ok := sm.streams[entry.Stream()]
+	if !ok {
+		ss = &SummaryStream{Stream: entry.Stream(), First: ts}
+		sm.streams[entry.Stream()] = ss
+	}
+	if level == Warning {
+		ss.Warnings++
+	} else {
+		ss.Errors++
+	}
+	ss.Last = ts
+	key := summaryKey{stream: entry.Stream(), message: message}
+	msg, ok := sm.messages[key]
+	if !ok {
+		if len(sm.messages) >= maxSummaryMessages {
+			return
+		}
+		msg = &SummaryMessage{Stream: entry.Stream(), Level: level, Message: message, First: ts}
+		sm.messages[key] = msg
+	}
+	if Compare(level, msg.Level) > 0 {
+		msg.Level = level
+	}
+	msg.Count++
+	msg.Last = ts
+}
+
+func (sm *summarizer) Report() SummaryReport {
+	<-sm.lock
+	defer func() { sm.lock <- true }()
+	return sm.report()
+}
+
+func (sm *summarizer) report() SummaryReport {
+	var report SummaryReport
+	for _, ss := range sm.streams {
+		report.Warnings += ss.Warnings
+		report.Errors += ss.Errors
+		report.Streams = append(report.Streams, *ss)
+	}
+	sort.Slice(report.Streams, func(i, j int) bool {
+		return report.Streams[i].Stream < report.Streams[j].Stream
+	})
+	for _, msg := range sm.messages {
+		if msg.Count > 1 {
+			report.Repeated = append(report.Repeated, *msg)
+		}
+	}
+	sort.Slice(report.Repeated, func(i, j int) bool {
+		a, b := report.Repeated[i], report.Repeated[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.First.Before(b.First)
+	})
+	if len(report.Repeated) > sm.opts.Top {
+		report.Repeated = report.Repeated[:sm.opts.Top]
+	}
+	return report
+}
+
+// Flush logs the report, if anything has been counted since the last one.
+func (sm *summarizer) Flush() error {
+	sm.emitReport()
+	return nil
+}
+
+func (sm *summarizer) emitReport() {
+	<-sm.lock
+	if sm.total == sm.reported {
+		sm.lock <- true
+		return
+	}
+	sm.reported = sm.total
+	report := sm.report()
+	sm.lock <- true
+	sm.opts.Log.LogTemplate(sm.opts.Level, "summary: {Warnings} warnings and {Errors} errors{Details}",
+		report.Warnings, report.Errors, F("Details", report.details()))
+}
+
+func (sm *summarizer) Close() error {
+	return nil
+}
+
+func (report SummaryReport) details() string {
+	var buf strings.Builder
+	for _, ss := range report.Streams {
+		fmt.Fprintf(&buf, "\n    %s: %d warnings, %d errors, first %s, last %s",
+			ss.Stream, ss.Warnings, ss.Errors, ss.First.Format(time.RFC3339), ss.Last.Format(time.RFC3339))
+	}
+	for _, msg := range report.Repeated {
+		fmt.Fprintf(&buf, "\n    %dx %s [%s] %q, first %s, last %s",
+			msg.Count, msg.Level, msg.Stream, msg.Message, msg.First.Format(time.RFC3339), msg.Last.Format(time.RFC3339))
+	}
+	return buf.String()
+}
+
+func (report SummaryReport) String() string {
+	return fmt.Sprintf("%d warnings and %d errors%s", report.Warnings, report.Errors, report.details())
+}
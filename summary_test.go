@@ -0,0 +1,43 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummarizer(t *testing.T) {
+	ctx := CreateLoggingContext()
+	capture := newCaptureListener()
+	ctx.AddGlobalLogListener(capture, Trace)
+	report, _ := ctx.Stream("summary")
+	sm := NewSummarizer("summary", SummaryOptions{Log: report})
+	ctx.AddGlobalLogListener(sm, Trace)
+	app, _ := ctx.Stream("app")
+	db, _ := ctx.Stream("db")
+	for i := 0; i < 3; i++ {
+		db.LogTemplate(Warning, "slow query {Millis}ms", 100+i)
+	}
+	app.Log(Error, "upload failed")
+	app.Log(Info, "not counted")
+	ctx.Flush()
+	got := sm.Report()
+	if got.Warnings != 3 || got.Errors != 1 || len(got.Streams) != 2 {
+		t.Fatalf("unexpected report: %s", got)
+	}
+	if len(got.Repeated) != 1 || got.Repeated[0].Message != "slow query {Millis}ms" || got.Repeated[0].Count != 3 {
+		t.Errorf("unexpected repeated messages: %+v", got.Repeated)
+	}
+	var reports []LogEntry
+	for _, e := range capture.Entries() {
+		if e.Stream() == "summary" {
+			reports = append(reports, e)
+		}
+	}
+	if len(reports) != 1 || !strings.HasPrefix(reports[0].Message(), "summary: 3 warnings and 1 errors\n    app: 0 warnings, 1 errors") {
+		t.Fatalf("unexpected report entries: %v", reports)
+	}
+	ctx.Flush()
+	if n := len(capture.Entries()); n != 6 {
+		t.Errorf("expected no second report without new entries, got %d entries", n)
+	}
+}
@@ -0,0 +1,86 @@
+// +build android,logcat
+
+package support
+
+/*
+	#cgo LDFLAGS: -llog
+	#include <stdlib.h>
+	#include <android/log.h>
+
+	static void cgo_logcat_write(int prio, const char *tag, const char *msg) {
+		__android_log_write(prio, tag, msg);
+	}
+*/
+import "C"
+
+import (
+	"strings"
+	"unsafe"
+
+	"github.com/dtromb/log"
+)
+
+func init() {
+	log.RegisterLoggingFeature("logcat")
+}
+
+// A LogcatListener writes to the Android log through liblog.  (build with
+// '-tags logcat')
+type LogcatListener struct {
+	name      string
+	tag       string
+	formatter log.LogEntryFormatter
+}
+
+// NewLogcatListener creates a listener writing with the given tag, or the
+// entry's stream name if tag is empty.  A nil formatter writes the message
+// and error only, as logcat records time and priority itself.
+func NewLogcatListener(name string, tag string, formatter log.LogEntryFormatter) *LogcatListener {
+	if formatter == nil {
+		slf := log.NewLogEntryFormatter()
+		slf.ClearFlags(log.PrintTime | log.PrintStreamName | log.PrintLevel | log.PrintNewline | log.PrintFileLine)
+		formatter = slf
+	}
+	return &LogcatListener{name: name, tag: tag, formatter: formatter}
+}
+
+// LogcatPriority maps a level to an android_LogPriority value.
+func LogcatPriority(level log.LogLevel) int {
+	switch {
+	case level.IsFatal():
+		return C.ANDROID_LOG_FATAL
+	case level.IsError():
+		return C.ANDROID_LOG_ERROR
+	case level.IsWarning():
+		return C.ANDROID_LOG_WARN
+	case level.IsInfo():
+		return C.ANDROID_LOG_INFO
+	case level.IsDebug():
+		return C.ANDROID_LOG_DEBUG
+	}
+	return C.ANDROID_LOG_VERBOSE
+}
+
+func (lc *LogcatListener) Name() string {
+	return lc.name
+}
+
+func (lc *LogcatListener) Formatter() log.LogEntryFormatter {
+	return lc.formatter
+}
+
+func (lc *LogcatListener) Receive(entry log.LogEntry) {
+	tag := lc.tag
+	if tag == "" {
+		tag = entry.Stream()
+	}
+	ctag := C.CString(tag)
+	defer C.free(unsafe.Pointer(ctag))
+	cmsg := C.CString(strings.TrimSpace(lc.formatter.Format(entry)))
+	defer C.free(unsafe.Pointer(cmsg))
+	C.cgo_logcat_write(C.int(LogcatPriority(entry.Level())), ctag, cmsg)
+}
+
+func (lc *LogcatListener) Close() error {
+	return nil
+}
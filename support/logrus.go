@@ -24,12 +24,18 @@ package support
 // methods into actual /logrus/ fields.)
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"time"
 	"github.com/dtromb/log"
 	"github.com/Sirupsen/logrus"
 )
 
+func init() {
+	log.RegisterLoggingFeature("logrus")
+}
+
 type LogrusLoggingContext struct {
 	lock chan bool
 	streams map[string]*LogrusLogger
@@ -51,6 +57,8 @@ type LogrusLogger struct {
 	traces bool
 	active bool
 	listeners map[log.LogListener]*logrusHook
+	stats *log.StreamStatsCounter
+	prefix string
 }
 
 func CreateLogrusLoggingContext() *LogrusLoggingContext {
@@ -73,7 +81,9 @@ func (ctx *LogrusLoggingContext) getDefaultLogrusStream() *LogrusLogger {
 			ctx: ctx,
 			active: true,
 			listeners: make(map[log.LogListener]*logrusHook),
+			stats: log.NewStreamStatsCounter(""),
 		}
+		stream.Logger.Hooks.Add(&statsHook{stats: stream.stats})
 		ctx.defaultLogrusStream = stream
 	}
 	return ctx.defaultLogrusStream
@@ -102,9 +112,16 @@ func (ctx *LogrusLoggingContext) Stream(key string) (log.LogStream, bool) {
 		listeners: make(map[log.LogListener]*logrusHook),
 		defaultLogLevel: log.Default,
 		defaultListenerLevel: log.Default,
+		stats: log.NewStreamStatsCounter(key),
 	}
+	stream.Logger.Hooks.Add(&statsHook{stats: stream.stats})
 	ctx.streams[key] = stream
 	ctx.streamsByLogger[stream.Logger] = stream
+	// Global listeners receive from every stream, including those created
+	// after the listener was added.
+	for _, lh := range ctx.listeners {
+		installLogrusHook(stream.Logger, lh)
+	}
 	stream.Logger.Level = logLevelToLogrusLevel(ctx.defaultListenerLevel)
 	return stream, true
 }
@@ -145,6 +162,9 @@ func logrusLevelToLogLevel(ll logrus.Level) log.LogLevel {
 	panic("invalid logrus log level")
 }
 
+// The field LogTrace() carries the stack trace in.
+const logrusTraceField = "_trace"
+
 func logLevelToLogrusLevel(ll log.LogLevel) logrus.Level {
 	if ll.IsDebug() { return logrus.DebugLevel }
 	if ll.IsError() { return logrus.ErrorLevel }
@@ -169,6 +189,23 @@ type importLogEntry struct {
 	message string
 	err error
 	trace []*log.StackTraceEntry
+	properties map[string]interface{}
+	fields map[string]interface{}
+	ingested time.Time
+	prefix string
+}
+
+type statsHook struct {
+	stats *log.StreamStatsCounter
+}
+
+func (sh *statsHook) Fire(entry *logrus.Entry) error {
+	sh.stats.Record(logrusLevelToLogLevel(entry.Level), entry.Time)
+	return nil
+}
+
+func (sh *statsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
 }
 
 func (lh *logrusHook) Fire(entry *logrus.Entry) error {
@@ -178,12 +215,12 @@ func (lh *logrusHook) Fire(entry *logrus.Entry) error {
 	var stream log.LogStream
 	if lh.stream == nil {
 		<-lh.ctx.lock
-		defer func() { lh.ctx.lock <- true }()
 		if st, has := lh.ctx.streamsByLogger[entry.Logger]; has {
 			stream = st
 		} else {
 			stream = lh.ctx.getDefaultLogrusStream()
 		}
+		lh.ctx.lock <- true
 	} else {
 		stream = lh.stream
 	}
@@ -192,11 +229,36 @@ func (lh *logrusHook) Fire(entry *logrus.Entry) error {
 		time: entry.Time,
 		stream: stream.(*LogrusLogger),
 		message: entry.Message,
+		ingested: time.Now(),
+	}
+	logEntry.prefix = logEntry.stream.prefix
+	if len(entry.Data) > 0 {
+		logEntry.fields = make(map[string]interface{}, len(entry.Data))
+		logEntry.properties = make(map[string]interface{}, len(entry.Data)+1)
+		for k, v := range entry.Data {
+			if k == logrusTraceField {
+				continue
+			}
+			logEntry.fields[k] = v
+			logEntry.properties[k] = v
+		}
+	}
+	// The entry's own correlation ID (LogContext() adds the context's), or
+	// else the ambient one.
+	correlation, _ := entry.Data[log.CorrelationProperty].(string)
+	if correlation == "" {
+		correlation = log.AmbientCorrelation()
+	}
+	if correlation != "" {
+		if logEntry.properties == nil {
+			logEntry.properties = make(map[string]interface{}, 1)
+		}
+		logEntry.properties[log.CorrelationProperty] = correlation
 	}
 	// XXX - If this is an error, make a LogrusError out of the 
 	// fields and associate it here.
 	// XXX - Fill in the stack trace here if that is configured.
-	lh.target.Receive(logEntry)
+	log.DeliverEntry(logEntry, []log.LogListener{lh.target})
 	return nil
 }	
 
@@ -205,6 +267,9 @@ func (lh *logrusHook) Levels() []logrus.Level {
 	for _, l := range lh.levels {
 		levelMap[logLevelToLogrusLevel(l)] = true
 	}
+	if levelMap[logrus.FatalLevel] {
+		levelMap[logrus.PanicLevel] = true
+	}
 	res := make([]logrus.Level, 0, len(levelMap)) 
 	for l, _ := range levelMap {
 		res = append(res, l)
@@ -212,43 +277,52 @@ func (lh *logrusHook) Levels() []logrus.Level {
 	return res
 }
 
-func makeLevelsSlice(minLevel log.LogLevel) []log.LogLevel {
+// Returns the levels a listener registered at level receives, by the same
+// rules every other context applies (see log.ListenerAccepts).
+func makeLevelsSlice(level log.LogLevel, defaultLevel log.LogLevel) []log.LogLevel {
 	res := make([]log.LogLevel, 0, int(log.None))
-	for i := minLevel; i < log.None; i++ {
-		res = append(res, i)
+	for i := log.FatalError; i < log.None; i++ {
+		if log.ListenerAccepts(level, defaultLevel, i) {
+			res = append(res, i)
+		}
 	}
 	return res
 }
 
+func installLogrusHook(logger *logrus.Logger, listenerHook *logrusHook) {
+	removeLogrusHook(logger, listenerHook.target)
+	for _, lrl := range listenerHook.Levels() {
+		logger.Hooks[lrl] = append(logger.Hooks[lrl], listenerHook)
+	}
+}
+
+func removeLogrusHook(logger *logrus.Logger, logListener log.LogListener) {
+	for _, level := range logrus.AllLevels {
+		for i, h := range logger.Hooks[level] {
+			if lh, ok := h.(*logrusHook); ok {
+				if lh.target == logListener {
+					logger.Hooks[level] = append(logger.Hooks[level][0:i], logger.Hooks[level][i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
 func  (ctx *LogrusLoggingContext) AddGlobalLogListener(logListener log.LogListener, level log.LogLevel) {
 	<-ctx.lock
 	defer func() { ctx.lock <- true }()
 	listenerHook := &logrusHook{
 		target: logListener,
 		ctx: ctx,
-		levels: makeLevelsSlice(level),
+		levels: makeLevelsSlice(level, ctx.defaultListenerLevel),
 	}
 	delete(ctx.listeners,logListener)
 	ctx.listeners[logListener] = listenerHook
 	// Since this is a global listener, we must update every log stream
 	// that is currently available.
 	for _, ll := range ctx.streams { 
-		// First delete this listener from the hooks.
-		for _, level := range logrus.AllLevels {
-			for i, h := range ll.Hooks[level] {
-				if lh, ok := h.(*logrusHook); ok {
-					if lh.target == logListener {
-						ll.Hooks[level] = append(ll.Hooks[level][0:i], ll.Hooks[level][i+1:]...)
-						break
-					}
-				}
-			}
-		}
-		// Now re-add this listener with the correct/new set of levels.
-		for _, lhl := range listenerHook.levels {
-			lrl := logLevelToLogrusLevel(lhl)
-			ll.Hooks[lrl] = append(ll.Hooks[lrl], listenerHook)
-		}
+		installLogrusHook(ll.Logger, listenerHook)
 	}
 	// We are done, the logrus -> log global listener proxy is installed.
 }
@@ -257,19 +331,7 @@ func  (ctx *LogrusLoggingContext) RemoveGlobalLogListener(logListener log.LogLis
 	<-ctx.lock
 	defer func() { ctx.lock <- true }()		
 	for _, ll := range ctx.streams { 
-		for _, level := range logrus.AllLevels {
-			for i, h := range ll.Hooks[level] {
-				if lh, ok := h.(*logrusHook); ok {
-					if lh.target == logListener {
-						ll.Hooks[level] = append(ll.Hooks[level][0:i], ll.Hooks[level][i+1:]...)
-						break
-					}
-				}
-			}
-		}
-	}
-	if lh, ok := ctx.listeners[logListener]; ok {
-		delete(ctx.streamsByLogger, lh.stream.Logger)
+		removeLogrusHook(ll.Logger, logListener)
 	}
 	delete(ctx.listeners, logListener)
 }
@@ -347,6 +409,44 @@ func (ll *LogrusLogger) Logf(level log.LogLevel, format string, args ...interfac
 		case logrus.WarnLevel: ll.Logger.Warnf(format, args...)
 	}
 }
+
+func (ll *LogrusLogger) LogContext(ctx context.Context, level log.LogLevel, msg string) {
+	ll.LogContextf(ctx, level, "%s", msg)
+}
+
+func (ll *LogrusLogger) LogContextf(ctx context.Context, level log.LogLevel, format string, args ...interface{}) {
+	id, ok := log.CorrelationFromContext(ctx)
+	if !ok {
+		ll.Logf(level, format, args...)
+		return
+	}
+	e := ll.Logger.WithField(log.CorrelationProperty, id)
+	switch(logLevelToLogrusLevel(level)) {
+		case logrus.DebugLevel: e.Debugf(format, args...)
+		case logrus.ErrorLevel: e.Errorf(format, args...)
+		case logrus.FatalLevel: e.Fatalf(format, args...)
+		case logrus.InfoLevel: e.Infof(format, args...)
+		case logrus.WarnLevel: e.Warnf(format, args...)
+	}
+}
+
+func (ll *LogrusLogger) LogTemplate(level log.LogLevel, template string, args ...interface{}) {
+	mt, err := log.ParseMessageTemplate(template)
+	if err != nil {
+		ll.Log(level, template)
+		return
+	}
+	e := ll.Logger.WithFields(logrus.Fields(mt.Capture(args...)))
+	msg := mt.Render(args...)
+	switch(logLevelToLogrusLevel(level)) {
+		case logrus.DebugLevel: e.Debug(msg)
+		case logrus.ErrorLevel: e.Error(msg)
+		case logrus.FatalLevel: e.Fatal(msg)
+		case logrus.InfoLevel: e.Info(msg)
+		case logrus.WarnLevel: e.Warn(msg)
+	}
+}
+
 type StackTraceEntryPresentation struct {
 	Pc string			`json:"Pc"`
 	Filename string		`json:"Filename"`
@@ -369,7 +469,7 @@ func (ll *LogrusLogger) LogTracef(level log.LogLevel, format string, args ...int
 	for i, t := range trace {
 		stack[i] = *stackTraceEntryToJsonPresentation(t)
 	}
-	e := ll.Logger.WithField("_trace", stack)
+	e := ll.Logger.WithField(logrusTraceField, stack)
 	lrl := logLevelToLogrusLevel(level)
 	if level == log.Default {
 		if ll.DefaultLogLevel() == log.Default {
@@ -388,7 +488,7 @@ func (ll *LogrusLogger) LogTracef(level log.LogLevel, format string, args ...int
 }
 
 func (ll *LogrusLogger) LogTrace(level log.LogLevel, format string) {
-	ll.LogTracef(level, format)
+	ll.LogTracef(level, "%s", format)
 }
 
 func (ll *LogrusLogger) Fatal(msg string) {
@@ -452,7 +552,7 @@ func (ll *LogrusLogger) Debug(msg string) {
 }
 
 func (ll *LogrusLogger) Debugf(format string, args ...interface{}) {
-	ll.Logf(log.Debug, format, args)
+	ll.Logf(log.Debug, format, args...)
 }
 
 func (ll *LogrusLogger) DebugTrace(msg string) {
@@ -471,6 +571,32 @@ func (ll *LogrusLogger) Tracef(format string, args ...interface{}) {
 	ll.LogTracef(log.Trace, format, args...)
 }
 
+// Whether logger logs at level - the lazy methods' test of interest, as
+// its hooks only fire for the levels it logs.
+func logrusEnabled(logger *logrus.Logger, level log.LogLevel) bool {
+	return logger.Level >= logLevelToLogrusLevel(level)
+}
+
+func (ll *LogrusLogger) LogLazy(level log.LogLevel, fn func() string) {
+	if logrusEnabled(ll.Logger, level) {
+		ll.Log(level, fn())
+	}
+}
+
+func (ll *LogrusLogger) InfoLazy(fn func() string) {
+	ll.LogLazy(log.Info, fn)
+}
+
+func (ll *LogrusLogger) DebugLazy(fn func() string) {
+	ll.LogLazy(log.Debug, fn)
+}
+
+func (ll *LogrusLogger) TraceLazy(fn func() string) {
+	if logrusEnabled(ll.Logger, log.Trace) {
+		ll.LogTrace(log.Trace, fn())
+	}
+}
+
 func (ll *LogrusLogger) Context() log.LoggingContext {
 	return ll.ctx
 }
@@ -499,44 +625,33 @@ func (ll *LogrusLogger) AddLogListener(logListener log.LogListener, level log.Lo
 	listenerHook := &logrusHook{
 		target: logListener,
 		ctx: ll.ctx,
-		levels: makeLevelsSlice(level),
+		levels: makeLevelsSlice(level, ll.ctx.DefaultLogListenerLevel()),
 		stream: ll,
 	}
 	delete(ll.listeners,logListener)
 	ll.listeners[logListener] = listenerHook
-	// First delete this listener from the hooks.
-	for _, level := range logrus.AllLevels {
-		for i, h := range ll.Hooks[level] {
-			if lh, ok := h.(*logrusHook); ok {
-				if lh.target == logListener {
-					ll.Hooks[level] = append(ll.Hooks[level][0:i], ll.Hooks[level][i+1:]...)
-					break
-				}
-			}
-		}
-		}
-	// Now re-add this listener with the correct/new set of levels.
-	for _, lhl := range listenerHook.levels {
-		lrl := logLevelToLogrusLevel(lhl)
-		ll.Hooks[lrl] = append(ll.Hooks[lrl], listenerHook)
-	}
+	installLogrusHook(ll.Logger, listenerHook)
 	// We are done, the logrus -> log listener proxy is installed.
 }
 
 func (ll *LogrusLogger) RemoveLogListener(logListener log.LogListener) {
-	for _, level := range logrus.AllLevels {
-		for i, h := range ll.Hooks[level] {
-			if lh, ok := h.(*logrusHook); ok {
-				if lh.target == logListener {
-					ll.Hooks[level] = append(ll.Hooks[level][0:i], ll.Hooks[level][i+1:]...)
-					break
-				}
-			}
-		}
-	}
+	removeLogrusHook(ll.Logger, logListener)
 	delete(ll.listeners, logListener)
 }
 
+func (ll *LogrusLogger) Tee(writer io.Writer, formatter log.LogEntryFormatter) (detach func()) {
+	if formatter == nil {
+		formatter = log.NewLogEntryFormatter()
+	}
+	listener := log.NewWriterLogger(fmt.Sprintf("%s-tee", ll.name), writer, formatter)
+	ll.AddLogListener(listener, log.Trace)
+	return func() { ll.RemoveLogListener(listener) }
+}
+
+func (ll *LogrusLogger) Stats() log.StreamStats {
+	return ll.stats.Snapshot()
+}
+
 func (ll *LogrusLogger) TracesByDefault() bool {
 	return ll.traces
 }
@@ -545,6 +660,26 @@ func (ll *LogrusLogger) SetTracesByDefault(traces bool) {
 	ll.traces = traces
 }
 
+// The prefix is applied by the formatters of the stream's listeners, not
+// by logrus.
+func (ll *LogrusLogger) Prefix() string {
+	return ll.prefix
+}
+
+func (ll *LogrusLogger) SetPrefix(prefix string) {
+	ll.prefix = prefix
+}
+
+func (ll *LogrusLogger) Timed(level log.LogLevel, name string) func() {
+	sw := log.NewStopwatch(ll, level, name)
+	return func() { sw.Stop() }
+}
+
+func (ll *LogrusLogger) DebugHex(label string, data []byte) {
+	e := ll.Logger.WithFields(logrus.Fields{log.DumpLabelProperty: label, log.DumpSizeProperty: len(data)})
+	e.Debugf("%s (%d bytes):\n%s", label, len(data), log.HexDump(data, log.HexDumpLimit))
+}
+
 func (ll *LogrusLogger) IsActive() bool {
 	return ll.active
 }
@@ -565,6 +700,10 @@ func (le *importLogEntry) Level() log.LogLevel {
 	return le.level
 }
 
+func (le *importLogEntry) MessagePrefix() string {
+	return le.prefix
+}
+
 func (le *importLogEntry) Message() string {
 	return le.message
 }
@@ -583,4 +722,34 @@ func (le *importLogEntry) HasTrace() bool {
 
 func (le *importLogEntry) Trace() []*log.StackTraceEntry {
 	return le.trace
+}
+
+// The logrus entry's time is when it was logged, and is the entry's time;
+// it is imported as the hook fires.
+func (le *importLogEntry) EventTime() (time.Time, bool) {
+	return le.time, true
+}
+
+func (le *importLogEntry) IngestTime() time.Time {
+	return le.ingested
+}
+
+func (le *importLogEntry) MessageTemplate() string {
+	return le.message
+}
+
+func (le *importLogEntry) Properties() map[string]interface{} {
+	res := make(map[string]interface{}, len(le.properties))
+	for k, v := range le.properties {
+		res[k] = v
+	}
+	return res
+}
+
+func (le *importLogEntry) Fields() map[string]interface{} {
+	res := make(map[string]interface{}, len(le.fields))
+	for k, v := range le.fields {
+		res[k] = v
+	}
+	return res
 }
\ No newline at end of file
@@ -0,0 +1,182 @@
+// +build logrus
+
+package support
+
+import (
+	"context"
+	"fmt"
+	"github.com/dtromb/log"
+	"github.com/Sirupsen/logrus"
+)
+
+// A Log over a logrus entry carrying structured fields.
+type logrusFieldLog struct {
+	ll *LogrusLogger
+	entry *logrus.Entry
+}
+
+// WithFields logs through a /logrus/ entry with the given fields (shadowing
+// logrus.Logger's WithFields; use Logrus().WithFields() for that).
+func (ll *LogrusLogger) WithFields(fields map[string]interface{}) log.Log {
+	return &logrusFieldLog{ll: ll, entry: ll.Logger.WithFields(logrus.Fields(fields))}
+}
+
+func (ll *LogrusLogger) With(key string, value interface{}) log.Log {
+	return &logrusFieldLog{ll: ll, entry: ll.Logger.WithField(key, value)}
+}
+
+func (fl *logrusFieldLog) With(key string, value interface{}) log.Log {
+	return &logrusFieldLog{ll: fl.ll, entry: fl.entry.WithField(key, value)}
+}
+
+func logrusEntryLog(e *logrus.Entry, level log.LogLevel, msg string) {
+	switch(logLevelToLogrusLevel(level)) {
+		case logrus.DebugLevel: e.Debug(msg)
+		case logrus.ErrorLevel: e.Error(msg)
+		case logrus.FatalLevel: e.Fatal(msg)
+		case logrus.InfoLevel: e.Info(msg)
+		case logrus.WarnLevel: e.Warn(msg)
+	}
+}
+
+func (fl *logrusFieldLog) Log(level log.LogLevel, msg string) {
+	logrusEntryLog(fl.entry, level, msg)
+}
+
+func (fl *logrusFieldLog) Logf(level log.LogLevel, format string, args ...interface{}) {
+	logrusEntryLog(fl.entry, level, fmt.Sprintf(format, args...))
+}
+
+func (fl *logrusFieldLog) LogTemplate(level log.LogLevel, template string, args ...interface{}) {
+	mt, err := log.ParseMessageTemplate(template)
+	if err != nil {
+		fl.Log(level, template)
+		return
+	}
+	logrusEntryLog(fl.entry.WithFields(logrus.Fields(mt.Capture(args...))), level, mt.Render(args...))
+}
+
+func (fl *logrusFieldLog) LogContext(ctx context.Context, level log.LogLevel, msg string) {
+	e := fl.entry
+	if id, ok := log.CorrelationFromContext(ctx); ok {
+		e = e.WithField(log.CorrelationProperty, id)
+	}
+	logrusEntryLog(e, level, msg)
+}
+
+func (fl *logrusFieldLog) LogContextf(ctx context.Context, level log.LogLevel, format string, args ...interface{}) {
+	fl.LogContext(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func (fl *logrusFieldLog) LogTrace(level log.LogLevel, msg string) {
+	trace := log.GenerateStackTrace()
+	stack := make([]StackTraceEntryPresentation, len(trace))
+	for i, t := range trace {
+		stack[i] = *stackTraceEntryToJsonPresentation(t)
+	}
+	logrusEntryLog(fl.entry.WithField(logrusTraceField, stack), level, msg)
+}
+
+func (fl *logrusFieldLog) LogTracef(level log.LogLevel, format string, args ...interface{}) {
+	fl.LogTrace(level, fmt.Sprintf(format, args...))
+}
+
+func (fl *logrusFieldLog) Fatal(msg string) {
+	fl.Log(log.FatalError, msg)
+}
+
+func (fl *logrusFieldLog) Fatalf(format string, args ...interface{}) {
+	fl.Logf(log.FatalError, format, args...)
+}
+
+func (fl *logrusFieldLog) FatalTrace(msg string) {
+	fl.LogTrace(log.FatalError, msg)
+}
+
+func (fl *logrusFieldLog) FatalTracef(format string, args ...interface{}) {
+	fl.LogTracef(log.FatalError, format, args...)
+}
+
+func (fl *logrusFieldLog) Error(err error) {
+	fl.entry.WithError(err).Error()
+}
+
+func (fl *logrusFieldLog) Errorf(err error, format string, args ...interface{}) {
+	fl.entry.WithError(err).Errorf(format, args...)
+}
+
+func (fl *logrusFieldLog) Warning(msg string) {
+	fl.Log(log.Warning, msg)
+}
+
+func (fl *logrusFieldLog) Warningf(format string, args ...interface{}) {
+	fl.Logf(log.Warning, format, args...)
+}
+
+func (fl *logrusFieldLog) WarningTrace(msg string) {
+	fl.LogTrace(log.Warning, msg)
+}
+
+func (fl *logrusFieldLog) WarningTracef(format string, args ...interface{}) {
+	fl.LogTracef(log.Warning, format, args...)
+}
+
+func (fl *logrusFieldLog) Info(msg string) {
+	fl.Log(log.Info, msg)
+}
+
+func (fl *logrusFieldLog) Infof(format string, args ...interface{}) {
+	fl.Logf(log.Info, format, args...)
+}
+
+func (fl *logrusFieldLog) InfoTrace(msg string) {
+	fl.LogTrace(log.Info, msg)
+}
+
+func (fl *logrusFieldLog) InfoTracef(format string, args ...interface{}) {
+	fl.LogTracef(log.Info, format, args...)
+}
+
+func (fl *logrusFieldLog) Debug(msg string) {
+	fl.Log(log.Debug, msg)
+}
+
+func (fl *logrusFieldLog) Debugf(format string, args ...interface{}) {
+	fl.Logf(log.Debug, format, args...)
+}
+
+func (fl *logrusFieldLog) DebugTrace(msg string) {
+	fl.LogTrace(log.Debug, msg)
+}
+
+func (fl *logrusFieldLog) DebugTracef(format string, args ...interface{}) {
+	fl.LogTracef(log.Debug, format, args...)
+}
+
+func (fl *logrusFieldLog) Trace(msg string) {
+	fl.LogTrace(log.Trace, msg)
+}
+
+func (fl *logrusFieldLog) Tracef(format string, args ...interface{}) {
+	fl.LogTracef(log.Trace, format, args...)
+}
+
+func (fl *logrusFieldLog) LogLazy(level log.LogLevel, fn func() string) {
+	if logrusEnabled(fl.ll.Logger, level) {
+		logrusEntryLog(fl.entry, level, fn())
+	}
+}
+
+func (fl *logrusFieldLog) InfoLazy(fn func() string) {
+	fl.LogLazy(log.Info, fn)
+}
+
+func (fl *logrusFieldLog) DebugLazy(fn func() string) {
+	fl.LogLazy(log.Debug, fn)
+}
+
+func (fl *logrusFieldLog) TraceLazy(fn func() string) {
+	if logrusEnabled(fl.ll.Logger, log.Trace) {
+		fl.LogTrace(log.Trace, fn())
+	}
+}
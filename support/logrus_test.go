@@ -3,6 +3,7 @@
 package support
 
 import (
+	"context"
 	"reflect"
 	"os"
 	"errors"
@@ -23,3 +24,107 @@ func TestLogrus(t *testing.T) {
 	logrusLogger := log.(*LogrusLogger).Logrus()
 	logrusLogger.Warn("The other way also works!")
 }
+
+type collectingListener struct {
+	lock chan bool
+	messages []string
+}
+
+func (cl *collectingListener) Name() string {
+	return "collecting"
+}
+
+func (cl *collectingListener) Receive(entry logp.LogEntry) {
+	<-cl.lock
+	defer func() { cl.lock <- true }()
+	cl.messages = append(cl.messages, entry.Message())
+}
+
+func (cl *collectingListener) Close() error {
+	return nil
+}
+
+func TestSubscribeAcrossContexts(t *testing.T) {
+	cl := &collectingListener{lock: make(chan bool, 1)}
+	cl.lock <- true
+	std := logp.CreateLoggingContext()
+	lr := CreateLogrusLoggingContext()
+	detach := logp.Subscribe(cl, logp.Warning, std, lr)
+	stdStream, _ := std.Stream("std")
+	// The logrus stream is created after subscribing.
+	lrStream, _ := lr.Stream("logrus")
+	stdStream.Warning("std warning")
+	stdStream.Info("std info")
+	lrStream.(*LogrusLogger).Logrus().Warn("logrus warning")
+	lrStream.(*LogrusLogger).Logrus().Info("logrus info")
+	std.Flush()
+	detach()
+	stdStream.Warning("after detach")
+	lrStream.(*LogrusLogger).Logrus().Warn("after detach")
+	std.Flush()
+	<-cl.lock
+	defer func() { cl.lock <- true }()
+	if !reflect.DeepEqual(cl.messages, []string{"std warning", "logrus warning"}) {
+		t.Errorf("unexpected messages: %q", cl.messages)
+	}
+}
+
+type correlationListener struct {
+	collectingListener
+	ids []string
+}
+
+func (cl *correlationListener) Receive(entry logp.LogEntry) {
+	<-cl.lock
+	defer func() { cl.lock <- true }()
+	var id string
+	if te, ok := entry.(logp.TemplatedLogEntry); ok {
+		id, _ = te.Properties()[logp.CorrelationProperty].(string)
+	}
+	cl.ids = append(cl.ids, id)
+}
+
+func TestLogrusCorrelation(t *testing.T) {
+	cl := &correlationListener{collectingListener: collectingListener{lock: make(chan bool, 1)}}
+	cl.lock <- true
+	lr := CreateLogrusLoggingContext()
+	stream, _ := lr.Stream("logrus")
+	stream.AddLogListener(cl, logp.Trace)
+	stream.LogContext(logp.WithCorrelation(context.Background(), "request-1"), logp.Info, "from a request")
+	exit := logp.EnterCorrelation("job-7")
+	stream.(*LogrusLogger).Logrus().Info("from a logrus call site")
+	exit()
+	stream.Info("outside any scope")
+	<-cl.lock
+	defer func() { cl.lock <- true }()
+	if !reflect.DeepEqual(cl.ids, []string{"request-1", "job-7", ""}) {
+		t.Errorf("unexpected correlation IDs: %q", cl.ids)
+	}
+}
+
+type fieldsListener struct {
+	collectingListener
+	fields []map[string]interface{}
+}
+
+func (fl *fieldsListener) Receive(entry logp.LogEntry) {
+	<-fl.lock
+	defer func() { fl.lock <- true }()
+	fl.fields = append(fl.fields, entry.(logp.StructuredLogEntry).Fields())
+}
+
+func TestLogrusFields(t *testing.T) {
+	fl := &fieldsListener{collectingListener: collectingListener{lock: make(chan bool, 1)}}
+	fl.lock <- true
+	lr := CreateLogrusLoggingContext()
+	stream, _ := lr.Stream("logrus")
+	stream.AddLogListener(fl, logp.Trace)
+	stream.WithFields(map[string]interface{}{"Method": "GET"}).Info("served")
+	stream.(*LogrusLogger).Logrus().WithField("Path", "/").Info("from a logrus call site")
+	<-fl.lock
+	defer func() { fl.lock <- true }()
+	want := []map[string]interface{}{{"Method": "GET"}, {"Path": "/"}}
+	if !reflect.DeepEqual(fl.fields, want) {
+		t.Errorf("unexpected fields: %v", fl.fields)
+	}
+}
@@ -0,0 +1,109 @@
+// +build darwin,oslog
+
+package support
+
+/*
+	#include <stdlib.h>
+	#include <os/log.h>
+
+	static void *cgo_oslog_create(const char *subsystem, const char *category) {
+		return (void *)os_log_create(subsystem, category);
+	}
+
+	static void cgo_oslog_write(void *logger, int type, const char *msg) {
+		os_log_with_type((os_log_t)logger, (os_log_type_t)type, "%{public}s", msg);
+	}
+*/
+import "C"
+
+import (
+	"strings"
+	"unsafe"
+
+	"github.com/dtromb/log"
+)
+
+func init() {
+	log.RegisterLoggingFeature("oslog")
+}
+
+// An OsLogListener writes to Apple's unified logging, with each stream as a
+// category.  (build with '-tags oslog')
+type OsLogListener struct {
+	lock      chan bool
+	name      string
+	subsystem string
+	formatter log.LogEntryFormatter
+	loggers   map[string]unsafe.Pointer
+}
+
+// NewOsLogListener creates a listener logging under subsystem (typically
+// the app's bundle identifier).  A nil formatter writes the message and
+// error only, as unified logging records time and type itself.
+func NewOsLogListener(name string, subsystem string, formatter log.LogEntryFormatter) *OsLogListener {
+	if formatter == nil {
+		slf := log.NewLogEntryFormatter()
+		slf.ClearFlags(log.PrintTime | log.PrintStreamName | log.PrintLevel | log.PrintNewline | log.PrintFileLine)
+		formatter = slf
+	}
+	ol := &OsLogListener{
+		lock:      make(chan bool, 1),
+		name:      name,
+		subsystem: subsystem,
+		formatter: formatter,
+		loggers:   make(map[string]unsafe.Pointer),
+	}
+	ol.lock <- true
+	return ol
+}
+
+// OsLogType maps a level to an os_log_type_t value.
+func OsLogType(level log.LogLevel) int {
+	switch {
+	case level.IsFatal():
+		return C.OS_LOG_TYPE_FAULT
+	case level.IsError():
+		return C.OS_LOG_TYPE_ERROR
+	case level.IsWarning():
+		return C.OS_LOG_TYPE_DEFAULT
+	case level.IsInfo():
+		return C.OS_LOG_TYPE_INFO
+	}
+	return C.OS_LOG_TYPE_DEBUG
+}
+
+// Log objects are created once per category and never released, as Apple
+// recommends.
+func (ol *OsLogListener) logger(category string) unsafe.Pointer {
+	<-ol.lock
+	defer func() { ol.lock <- true }()
+	if logger, has := ol.loggers[category]; has {
+		return logger
+	}
+	csub := C.CString(ol.subsystem)
+	defer C.free(unsafe.Pointer(csub))
+	ccat := C.CString(category)
+	defer C.free(unsafe.Pointer(ccat))
+	logger := C.cgo_oslog_create(csub, ccat)
+	ol.loggers[category] = logger
+	return logger
+}
+
+func (ol *OsLogListener) Name() string {
+	return ol.name
+}
+
+func (ol *OsLogListener) Formatter() log.LogEntryFormatter {
+	return ol.formatter
+}
+
+func (ol *OsLogListener) Receive(entry log.LogEntry) {
+	logger := ol.logger(entry.Stream())
+	cmsg := C.CString(strings.TrimSpace(ol.formatter.Format(entry)))
+	defer C.free(unsafe.Pointer(cmsg))
+	C.cgo_oslog_write(logger, C.int(OsLogType(entry.Level())), cmsg)
+}
+
+func (ol *OsLogListener) Close() error {
+	return nil
+}
@@ -0,0 +1,313 @@
+// +build parquet
+
+package support
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"github.com/dtromb/log"
+	"github.com/parquet-go/parquet-go"
+)
+
+func init() {
+	log.RegisterLoggingFeature("parquet")
+}
+
+type ParquetPartitioning uint8
+const (
+	PartitionByDay 		ParquetPartitioning = iota
+	PartitionByHour
+)
+
+type ParquetColumnType uint8
+const (
+	ParquetString		ParquetColumnType = iota
+	ParquetInt64
+	ParquetDouble
+	ParquetBool
+	ParquetTimestamp
+)
+
+type ParquetColumn struct {
+	Name string
+	Type ParquetColumnType
+}
+
+type ParquetOptions struct {
+	Directory string
+	Partitioning ParquetPartitioning
+	Columns []ParquetColumn
+}
+
+type ParquetListener struct {
+	lock chan bool
+	name string
+	opts ParquetOptions
+	schema *parquet.Schema
+	columnIndex map[string]int
+	columnTypes map[string]ParquetColumnType
+	partition string
+	file *os.File
+	writer *parquet.Writer
+	lastErr error
+	closed bool
+}
+
+func ParquetColumnsFromFields(fields map[string]interface{}) []ParquetColumn {
+	cols := make([]ParquetColumn, 0, len(fields))
+	for name, val := range fields {
+		col := ParquetColumn{Name: name, Type: ParquetString}
+		switch val.(type) {
+			case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64: col.Type = ParquetInt64
+			case float32, float64: col.Type = ParquetDouble
+			case bool: col.Type = ParquetBool
+			case time.Time: col.Type = ParquetTimestamp
+		}
+		cols = append(cols, col)
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i].Name < cols[j].Name })
+	return cols
+}
+
+func parquetNode(ct ParquetColumnType) parquet.Node {
+	switch(ct) {
+		case ParquetInt64: return parquet.Int(64)
+		case ParquetDouble: return parquet.Leaf(parquet.DoubleType)
+		case ParquetBool: return parquet.Leaf(parquet.BooleanType)
+		case ParquetTimestamp: return parquet.Timestamp(parquet.Millisecond)
+	}
+	return parquet.String()
+}
+
+// NewParquetListener writes entries to Parquet files under
+// <directory>/dt=2006-01-02/[hour=15/], with time, stream, level, message
+// and error columns and typed columns filled from properties of the same
+// name.  A file is finalized, and readable, when the partition changes and
+// on Flush() and Close().
+func NewParquetListener(name string, opts ParquetOptions) (*ParquetListener, error) {
+	group := parquet.Group{
+		"time": parquet.Timestamp(parquet.Millisecond),
+		"stream": parquet.String(),
+		"level": parquet.String(),
+		"message": parquet.String(),
+		"error": parquet.Optional(parquet.String()),
+	}
+	columnTypes := map[string]ParquetColumnType{
+		"time": ParquetTimestamp,
+		"stream": ParquetString,
+		"level": ParquetString,
+		"message": ParquetString,
+		"error": ParquetString,
+	}
+	for _, col := range opts.Columns {
+		if _, has := group[col.Name]; has {
+			return nil, fmt.Errorf("parquet column '%s' conflicts with a standard column", col.Name)
+		}
+		group[col.Name] = parquet.Optional(parquetNode(col.Type))
+		columnTypes[col.Name] = col.Type
+	}
+	pl := &ParquetListener{
+		lock: make(chan bool, 1),
+		name: name,
+		opts: opts,
+		schema: parquet.NewSchema("entry", group),
+		columnIndex: make(map[string]int),
+		columnTypes: columnTypes,
+	}
+	for i, field := range pl.schema.Fields() {
+		pl.columnIndex[field.Name()] = i
+	}
+	if err := os.MkdirAll(opts.Directory, 0755); err != nil {
+		return nil, err
+	}
+	pl.lock <- true
+	return pl, nil
+}
+
+func (pl *ParquetListener) partitionFor(ts time.Time) string {
+	ts = ts.UTC()
+	if pl.opts.Partitioning == PartitionByHour {
+		return filepath.Join("dt=" + ts.Format("2006-01-02"), "hour=" + ts.Format("15"))
+	}
+	return "dt=" + ts.Format("2006-01-02")
+}
+
+// Unsigned values beyond the range of an INT64 column are refused, rather
+// than wrapped.
+func parquetUnsigned(v uint64) (parquet.Value, bool, error) {
+	if v > math.MaxInt64 {
+		return parquet.Value{}, false, fmt.Errorf("%d overflows an int64 column", v)
+	}
+	return parquet.Int64Value(int64(v)), true, nil
+}
+
+func parquetValue(ct ParquetColumnType, val interface{}) (parquet.Value, bool, error) {
+	switch(ct) {
+		case ParquetInt64: {
+			switch v := val.(type) {
+				case int: return parquet.Int64Value(int64(v)), true, nil
+				case int8: return parquet.Int64Value(int64(v)), true, nil
+				case int16: return parquet.Int64Value(int64(v)), true, nil
+				case int32: return parquet.Int64Value(int64(v)), true, nil
+				case int64: return parquet.Int64Value(v), true, nil
+				case uint: return parquetUnsigned(uint64(v))
+				case uint8: return parquet.Int64Value(int64(v)), true, nil
+				case uint16: return parquet.Int64Value(int64(v)), true, nil
+				case uint32: return parquet.Int64Value(int64(v)), true, nil
+				case uint64: return parquetUnsigned(v)
+			}
+		}
+		case ParquetDouble: {
+			switch v := val.(type) {
+				case float32: return parquet.DoubleValue(float64(v)), true, nil
+				case float64: return parquet.DoubleValue(v), true, nil
+			}
+		}
+		case ParquetBool: {
+			if v, ok := val.(bool); ok {
+				return parquet.BooleanValue(v), true, nil
+			}
+		}
+		case ParquetTimestamp: {
+			if v, ok := val.(time.Time); ok {
+				return parquet.Int64Value(v.UnixNano() / int64(time.Millisecond)), true, nil
+			}
+		}
+		default: {
+			return parquet.ByteArrayValue([]byte(fmt.Sprintf("%v", val))), true, nil
+		}
+	}
+	return parquet.Value{}, false, nil
+}
+
+func (pl *ParquetListener) makeRow(entry log.LogEntry) (parquet.Row, error) {
+	values := map[string]interface{}{
+		"time": entry.LogTime(),
+		"stream": entry.Stream(),
+		"level": entry.Level().String(),
+		"message": log.PrefixedMessage(entry),
+	}
+	if entry.HasAssociatedError() {
+		values["error"] = entry.AssociatedError().Error()
+	}
+	if te, ok := entry.(log.TemplatedLogEntry); ok {
+		for k, v := range te.Properties() {
+			if _, std := values[k]; !std {
+				values[k] = v
+			}
+		}
+	}
+	var err error
+	fields := pl.schema.Fields()
+	row := make(parquet.Row, len(fields))
+	for i, field := range fields {
+		name := field.Name()
+		val, has := values[name]
+		var pv parquet.Value
+		if has {
+			var verr error
+			if pv, has, verr = parquetValue(pl.columnTypes[name], val); verr != nil {
+				err = fmt.Errorf("parquet column '%s': %s", name, verr)
+			}
+		}
+		if !field.Optional() {
+			row[i] = pv.Level(0, 0, i)
+		} else if has {
+			row[i] = pv.Level(0, 1, i)
+		} else {
+			row[i] = parquet.NullValue().Level(0, 0, i)
+		}
+	}
+	return row, err
+}
+
+func (pl *ParquetListener) Name() string {
+	return pl.name
+}
+
+func (pl *ParquetListener) Receive(entry log.LogEntry) {
+	pl.TryReceive(entry)
+}
+
+// TryReceive writes entry, refusing it with log.ErrListenerClosed after
+// Close.  A value which cannot be stored in its column is written as null
+// and reported by LastError().
+func (pl *ParquetListener) TryReceive(entry log.LogEntry) error {
+	row, rowErr := pl.makeRow(entry)
+	partition := pl.partitionFor(entry.LogTime())
+	<-pl.lock
+	defer func() { pl.lock <- true }()
+	if pl.closed {
+		return log.ErrListenerClosed
+	}
+	if rowErr != nil {
+		pl.lastErr = rowErr
+	}
+	if pl.writer != nil && partition != pl.partition {
+		pl.finish()
+	}
+	if pl.writer == nil {
+		dir := filepath.Join(pl.opts.Directory, partition)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			pl.lastErr = err
+			return err
+		}
+		file, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s-%d.parquet", pl.name, time.Now().UnixNano())))
+		if err != nil {
+			pl.lastErr = err
+			return err
+		}
+		pl.file = file
+		pl.writer = parquet.NewWriter(file, pl.schema)
+		pl.partition = partition
+	}
+	if _, err := pl.writer.WriteRows([]parquet.Row{row}); err != nil {
+		pl.lastErr = err
+		return err
+	}
+	return rowErr
+}
+
+func (pl *ParquetListener) finish() error {
+	if pl.writer == nil {
+		return nil
+	}
+	err := pl.writer.Close()
+	if cerr := pl.file.Close(); err == nil {
+		err = cerr
+	}
+	pl.writer = nil
+	pl.file = nil
+	if err != nil {
+		pl.lastErr = err
+	}
+	return err
+}
+
+func (pl *ParquetListener) Flush() error {
+	<-pl.lock
+	defer func() { pl.lock <- true }()
+	return pl.finish()
+}
+
+func (pl *ParquetListener) LastError() error {
+	<-pl.lock
+	defer func() { pl.lock <- true }()
+	return pl.lastErr
+}
+
+// Close finishes the current file; it is idempotent, and entries received
+// afterwards are dropped.
+func (pl *ParquetListener) Close() error {
+	<-pl.lock
+	defer func() { pl.lock <- true }()
+	if pl.closed {
+		return nil
+	}
+	pl.closed = true
+	return pl.finish()
+}
@@ -0,0 +1,137 @@
+// +build parquet
+
+package support
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+	"github.com/dtromb/log"
+	"github.com/parquet-go/parquet-go"
+)
+
+type parquetTestEntry struct {
+	ts time.Time
+	message string
+	err error
+	properties map[string]interface{}
+}
+
+func (e *parquetTestEntry) LogTime() time.Time { return e.ts }
+func (e *parquetTestEntry) Stream() string { return "parquet-test" }
+func (e *parquetTestEntry) Level() log.LogLevel { return log.Info }
+func (e *parquetTestEntry) Message() string { return e.message }
+func (e *parquetTestEntry) HasAssociatedError() bool { return e.err != nil }
+func (e *parquetTestEntry) AssociatedError() error { return e.err }
+func (e *parquetTestEntry) HasTrace() bool { return false }
+func (e *parquetTestEntry) Trace() []*log.StackTraceEntry { return nil }
+func (e *parquetTestEntry) MessageTemplate() string { return e.message }
+func (e *parquetTestEntry) Properties() map[string]interface{} { return e.properties }
+func (e *parquetTestEntry) MessagePrefix() string { return "[{worker}] " }
+
+// Reads back the rows of every file under dir, by column name.
+func readParquetRows(t *testing.T, dir string) map[string][]map[string]parquet.Value {
+	files := make(map[string][]map[string]parquet.Value)
+	paths, _ := filepath.Glob(filepath.Join(dir, "dt=*", "hour=*", "*.parquet"))
+	sort.Strings(paths)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := parquet.NewReader(f)
+		fields := reader.Schema().Fields()
+		for {
+			rows := make([]parquet.Row, 1)
+			n, err := reader.ReadRows(rows)
+			if n == 1 {
+				values := make(map[string]parquet.Value)
+				for _, v := range rows[0] {
+					values[fields[v.Column()].Name()] = v
+				}
+				rel, _ := filepath.Rel(dir, path)
+				files[rel] = append(files[rel], values)
+			}
+			if err != nil {
+				break
+			}
+		}
+		reader.Close()
+		f.Close()
+	}
+	return files
+}
+
+func TestParquetListener(t *testing.T) {
+	dir := t.TempDir()
+	pl, err := NewParquetListener("test", ParquetOptions{
+		Directory: dir,
+		Partitioning: PartitionByHour,
+		Columns: []ParquetColumn{
+			{Name: "count", Type: ParquetInt64},
+			{Name: "ratio", Type: ParquetDouble},
+			{Name: "ok", Type: ParquetBool},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 3, 1, 10, 59, 0, 0, time.UTC)
+	props := map[string]interface{}{"worker": 7, "count": uint64(42), "ratio": 0.5, "ok": true}
+	pl.Receive(&parquetTestEntry{ts: base, message: "first", properties: props})
+	// The next hour starts a new file in a new partition.
+	pl.Receive(&parquetTestEntry{ts: base.Add(2 * time.Minute), message: "second", err: errors.New("failed"),
+		properties: map[string]interface{}{"worker": 7, "count": uint64(math.MaxUint64)}})
+	if err := pl.LastError(); err == nil {
+		t.Error("expected the overflowing count to be reported")
+	}
+	if err := pl.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Flush finishes the file; the next entry starts another in the same
+	// partition.
+	pl.Receive(&parquetTestEntry{ts: base.Add(3 * time.Minute), message: "third", properties: map[string]interface{}{"worker": 7}})
+	if err := pl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if err := pl.TryReceive(&parquetTestEntry{ts: base, message: "late"}); !errors.Is(err, log.ErrListenerClosed) {
+		t.Errorf("expected an entry after Close to be refused, got %v", err)
+	}
+
+	files := readParquetRows(t, dir)
+	var first, second, third map[string]parquet.Value
+	var hour10, hour11 int
+	for path, rows := range files {
+		if len(rows) != 1 {
+			t.Fatalf("%s: expected 1 row, got %d", path, len(rows))
+		}
+		switch rows[0]["message"].String() {
+		case "[7] first": first = rows[0]; hour10++
+		case "[7] second": second = rows[0]; hour11++
+		case "[7] third": third = rows[0]; hour11++
+		default: t.Errorf("%s: unexpected message %q", path, rows[0]["message"].String())
+		}
+		if filepath.Dir(path) != filepath.Join("dt=2024-03-01", "hour=10") && filepath.Dir(path) != filepath.Join("dt=2024-03-01", "hour=11") {
+			t.Errorf("unexpected partition %s", path)
+		}
+	}
+	if len(files) != 3 || hour10 != 1 || hour11 != 2 || first == nil || second == nil || third == nil {
+		t.Fatalf("expected 3 files across 2 partitions, got %v", files)
+	}
+	if first["time"].Int64() != base.UnixNano()/int64(time.Millisecond) || first["stream"].String() != "parquet-test" || first["level"].String() != log.Info.String() {
+		t.Errorf("unexpected standard columns %v", first)
+	}
+	if first["count"].Int64() != 42 || first["ratio"].Double() != 0.5 || !first["ok"].Boolean() || !first["error"].IsNull() {
+		t.Errorf("unexpected typed columns %v", first)
+	}
+	if second["error"].String() != "failed" || !second["count"].IsNull() || !second["ratio"].IsNull() || !second["ok"].IsNull() {
+		t.Errorf("expected the error and null typed columns, got %v", second)
+	}
+}
@@ -3,9 +3,13 @@
 package support
 
 import (
+	"context"
+	"io"
 	"time"
 	"runtime"
 	"fmt"
+	"strconv"
+	"strings"
 	"unsafe"
 	"github.com/dtromb/log"
 )
@@ -14,6 +18,7 @@ import (
 	#cgo pkg-config: sdl2	
 	#include <SDL.h>
 	#include <SDL_log.h>
+	#include <stdlib.h>
 	
 	extern sdlLogOutputDispatch(char *userdata, int category, SDL_LogPriority pri, char *msg);
 		
@@ -34,6 +39,34 @@ import (
 		SDL_LogMessage(category, priority, "%s", msg);
 	}
 
+	static SDL_LogOutputFunction cgo_sdl_prev_output = NULL;
+	static void *cgo_sdl_prev_userdata = NULL;
+
+	// Installs the dispatcher, remembering whatever output function was in
+	// place before (normally SDL's default console output).
+	void cgo_sdl_install_output(void) {
+		SDL_LogOutputFunction cur;
+		void *data;
+		SDL_LogGetOutputFunction(&cur, &data);
+		if (cur != cgo_sdl_log_output_dispatch_impl) {
+			cgo_sdl_prev_output = cur;
+			cgo_sdl_prev_userdata = data;
+		}
+		SDL_LogSetOutputFunction(cgo_sdl_log_output_dispatch, NULL);
+	}
+
+	void cgo_sdl_restore_output(void) {
+		if (cgo_sdl_prev_output != NULL) {
+			SDL_LogSetOutputFunction(cgo_sdl_prev_output, cgo_sdl_prev_userdata);
+		}
+	}
+
+	void cgo_sdl_forward_output(int category, SDL_LogPriority priority, const char *msg) {
+		if (cgo_sdl_prev_output != NULL) {
+			cgo_sdl_prev_output(cgo_sdl_prev_userdata, category, priority, msg);
+		}
+	}
+
 */
 import "C"
 
@@ -48,6 +81,8 @@ type SdlLoggingContext struct {
 	debugEnabled bool
 	traces bool
 	handleId int
+	fatalHooks []SdlFatalHook
+	capturing bool
 }
 
 type SdlLogStream struct {
@@ -58,6 +93,8 @@ type SdlLogStream struct {
 	defaultListenerLevel log.LogLevel
 	listeners map[log.LogListener]log.LogLevel
 	traces bool
+	stats *log.StreamStatsCounter
+	prefix string
 }
 
 type sdlLogEntry struct {
@@ -65,22 +102,42 @@ type sdlLogEntry struct {
 	stream SdlLogContextName
 	level log.LogLevel
 	msg string
+	correlation string
+	// Fields from WithFields() and the fatal hooks.
+	fields []log.Field
+	prefix string
 }
 
 type SdlLogUserdata struct {
 	lock chan bool
 	contexts map[int]*SdlLoggingContext
 	nextHandle int
+	forwardDefault bool
+	// SDL gives its output function no context, so LogContext() leaves the
+	// context's correlation ID here, keyed by a tag it prepends to the
+	// message (see sdlPendingTag).  Messages without one carry the ambient
+	// ID (see log.EnterCorrelation).  Logs from WithFields() leave their
+	// fields the same way.
+	pending map[uint64]*sdlPending
+	nextPending uint64
+}
+
+type sdlPending struct {
+	correlation string
+	fields map[string]interface{}
 }
 
 var global_SdlLogUserdata *SdlLogUserdata = &SdlLogUserdata{
 	lock: make(chan bool, 1),
 	contexts: make(map[int]*SdlLoggingContext),
 	nextHandle: 1,
+	forwardDefault: true,
+	pending: make(map[uint64]*sdlPending),
 }
 
 func init() {
 	global_SdlLogUserdata.lock <- true
+	log.RegisterLoggingFeature("sdl")
 }
 
 func CreateSdlLoggingContext() *SdlLoggingContext {
@@ -98,6 +155,8 @@ func CreateSdlLoggingContext() *SdlLoggingContext {
 			ctx: ctx,
 			name: string(key),
 			categoryCode: int(key.Code()),
+			listeners: make(map[log.LogListener]log.LogLevel),
+			stats: log.NewStreamStatsCounter(string(key)),
 		}
 		ctx.stdStreams[key] = nls
 	}
@@ -106,7 +165,7 @@ func CreateSdlLoggingContext() *SdlLoggingContext {
 	global_SdlLogUserdata.nextHandle++
 	global_SdlLogUserdata.contexts[ctx.handleId] = ctx
 	defer func() { global_SdlLogUserdata.lock <- true }()
-	C.SDL_LogSetOutputFunction(C.cgo_sdl_log_output_dispatch, unsafe.Pointer(uintptr(ctx.handleId)))
+	C.cgo_sdl_install_output()
 	runtime.SetFinalizer(ctx, clearGlobalContext)
 	ctx.lock <- true
 	return ctx
@@ -229,10 +288,10 @@ func (ctx *SdlLoggingContext) getCategoryByCode(code int) (SdlLogContextName,boo
 	return cat, true
 }
 
-func (ctx *SdlLoggingContext) dispatch(streamCtxName SdlLogContextName, logLevel log.LogLevel, msg string) {
+func (ctx *SdlLoggingContext) dispatch(streamCtxName SdlLogContextName, logLevel log.LogLevel, msg string, correlation string, fields []log.Field) {
 	var interested []log.LogListener
 	for listener, level := range ctx.listeners {
-		if level >= logLevel || (level == log.Default && ctx.defaultListenerLevel <= logLevel) || level == log.All {
+		if log.ListenerAccepts(level, ctx.defaultListenerLevel, logLevel) {
 			interested = append(interested, listener)
 		}
 	}
@@ -245,9 +304,12 @@ func (ctx *SdlLoggingContext) dispatch(streamCtxName SdlLogContextName, logLevel
 	} else {
 		stream = ctx.stdStreams[streamCtxName].(*SdlLogStream)
 	}
+	var prefix string
 	if stream != nil {
+		prefix = stream.prefix
+		stream.stats.Record(logLevel, time.Now())
 		for listener, level := range stream.listeners {
-			if level >= logLevel || (level == log.Default && ctx.defaultListenerLevel <= logLevel) || level == log.All {
+			if log.ListenerAccepts(level, ctx.defaultListenerLevel, logLevel) {
 				interested = append(interested, listener)
 			}
 		}
@@ -258,6 +320,9 @@ func (ctx *SdlLoggingContext) dispatch(streamCtxName SdlLogContextName, logLevel
 			stream: streamCtxName,
 			level: logLevel,
 			msg: msg,
+			correlation: correlation,
+			fields: fields,
+			prefix: prefix,
 		}
 		for _, l := range interested {
 			go l.Receive(entry)
@@ -361,24 +426,91 @@ func (ctx *SdlLoggingContext) EnableDebugging(val bool) {
 }
 
 func (ls *SdlLogStream) Log(level log.LogLevel, msg string) {
+	// SDL calls the output function synchronously, and the dispatcher takes
+	// the context lock - so it must not be held across the cgo call.
 	<-ls.ctx.lock
-	defer func() { ls.ctx.lock <- true }()
-	pri := SdlLogPriorityForLogLevel(level)
 	var cat int
 	if stream, has := ls.ctx.stdStreams[SdlLogContextName(ls.name)]; has {
 		cat = stream.(*SdlLogStream).categoryCode
 	} else if stream, has := ls.ctx.customStreams[ls.name]; has {
 		cat = stream.(*SdlLogStream).categoryCode
 	} else {
+		ls.ctx.lock <- true
 		return
 	}
-	C.cgo_sdl_log_message(C.int(cat), C.SDL_LogPriority(pri), C.CString(msg))
+	ls.ctx.lock <- true
+	SdlLogMessage(cat, SdlLogPriorityForLogLevel(level), msg)
 }
 
 func (ls *SdlLogStream) Logf(level log.LogLevel, format string, args ...interface{}) {
 	ls.Log(level, fmt.Sprintf(format, args...))
 }
 
+func (ls *SdlLogStream) LogContext(ctx context.Context, level log.LogLevel, msg string) {
+	id, ok := log.CorrelationFromContext(ctx)
+	if !ok {
+		ls.Log(level, msg)
+		return
+	}
+	ls.logPending(level, msg, id, nil)
+}
+
+// Logs a message with a correlation ID and fields left for the dispatcher.
+// The message is tagged so that the dispatcher matches it to its own
+// pending state, whatever other goroutines are logging at the same time.
+func (ls *SdlLogStream) logPending(level log.LogLevel, msg string, correlation string, fields map[string]interface{}) {
+	slu := global_SdlLogUserdata
+	<-slu.lock
+	slu.nextPending++
+	id := slu.nextPending
+	slu.pending[id] = &sdlPending{correlation: correlation, fields: fields}
+	slu.lock <- true
+	ls.Log(level, sdlPendingTag(id)+msg)
+	// SDL drops messages below the category's priority without calling out.
+	<-slu.lock
+	delete(slu.pending, id)
+	slu.lock <- true
+}
+
+func sdlPendingTag(id uint64) string {
+	return "\x1e" + strconv.FormatUint(id, 36) + "\x1f"
+}
+
+// takePending is called with the lock held, and strips the tag from a
+// message sent by logPending, returning its pending state.
+func (slu *SdlLogUserdata) takePending(msg string) (*sdlPending, string) {
+	if !strings.HasPrefix(msg, "\x1e") {
+		return nil, msg
+	}
+	end := strings.IndexByte(msg, '\x1f')
+	if end < 0 {
+		return nil, msg
+	}
+	id, err := strconv.ParseUint(msg[1:end], 36, 64)
+	if err != nil {
+		return nil, msg
+	}
+	pending, has := slu.pending[id]
+	if !has {
+		return nil, msg
+	}
+	delete(slu.pending, id)
+	return pending, msg[end+1:]
+}
+
+func (ls *SdlLogStream) LogContextf(ctx context.Context, level log.LogLevel, format string, args ...interface{}) {
+	ls.LogContext(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func (ls *SdlLogStream) LogTemplate(level log.LogLevel, template string, args ...interface{}) {
+	mt, err := log.ParseMessageTemplate(template)
+	if err != nil {
+		ls.Log(level, template)
+		return
+	}
+	ls.WithFields(mt.Capture(args...)).Log(level, mt.Render(args...))
+}
+
 func (ls *SdlLogStream) LogTrace(level log.LogLevel, msg string) {
 	panic("SdlLogStream.LogTrace() unimplemented")
 }
@@ -469,6 +601,31 @@ func (ls *SdlLogStream) Tracef(format string, args ...interface{}) {
 	ls.Log(log.Trace, fmt.Sprintf(format, args...))
 }
 
+// Whether SDL passes messages at level on the stream's category to its
+// output function - the lazy methods' test of interest.
+func (ls *SdlLogStream) enabled(level log.LogLevel) bool {
+	priority := SdlLogPriority(C.SDL_LogGetPriority(C.int(ls.categoryCode)))
+	return priority <= SdlLogPriorityForLogLevel(level)
+}
+
+func (ls *SdlLogStream) LogLazy(level log.LogLevel, fn func() string) {
+	if ls.enabled(level) {
+		ls.Log(level, fn())
+	}
+}
+
+func (ls *SdlLogStream) InfoLazy(fn func() string) {
+	ls.LogLazy(log.Info, fn)
+}
+
+func (ls *SdlLogStream) DebugLazy(fn func() string) {
+	ls.LogLazy(log.Debug, fn)
+}
+
+func (ls *SdlLogStream) TraceLazy(fn func() string) {
+	ls.LogLazy(log.Trace, fn)
+}
+
 func (ls *SdlLogStream) Context() log.LoggingContext {
 	return ls.ctx
 }
@@ -513,6 +670,19 @@ func (ls *SdlLogStream) RemoveLogListener(logListener log.LogListener) {
 	delete(ls.listeners, logListener)
 }
 
+func (ls *SdlLogStream) Tee(writer io.Writer, formatter log.LogEntryFormatter) (detach func()) {
+	if formatter == nil {
+		formatter = log.NewLogEntryFormatter()
+	}
+	listener := log.NewWriterLogger(fmt.Sprintf("%s-tee", ls.name), writer, formatter)
+	ls.AddLogListener(listener, log.Trace)
+	return func() { ls.RemoveLogListener(listener) }
+}
+
+func (ls *SdlLogStream) Stats() log.StreamStats {
+	return ls.stats.Snapshot()
+}
+
 func (ls *SdlLogStream) TracesByDefault() bool {
 	<-ls.ctx.lock
 	defer func() { ls.ctx.lock <- true }()
@@ -525,6 +695,30 @@ func (ls *SdlLogStream) SetTracesByDefault(traces bool) {
 	ls.traces = traces
 }
 
+// The prefix is applied by the formatters of the stream's listeners, not
+// to the message SDL writes.
+func (ls *SdlLogStream) Prefix() string {
+	<-ls.ctx.lock
+	defer func() { ls.ctx.lock <- true }()
+	return ls.prefix
+}
+
+func (ls *SdlLogStream) SetPrefix(prefix string) {
+	<-ls.ctx.lock
+	defer func() { ls.ctx.lock <- true }()
+	ls.prefix = prefix
+}
+
+func (ls *SdlLogStream) Timed(level log.LogLevel, name string) func() {
+	sw := log.NewStopwatch(ls, level, name)
+	return func() { sw.Stop() }
+}
+
+func (ls *SdlLogStream) DebugHex(label string, data []byte) {
+	ls.With(log.DumpLabelProperty, label).With(log.DumpSizeProperty, len(data)).
+		Debugf("%s (%d bytes):\n%s", label, len(data), log.HexDump(data, log.HexDumpLimit))
+}
+
 func (ls *SdlLogStream) IsActive() bool {
 	return true
 }
@@ -543,6 +737,10 @@ func (le *sdlLogEntry) Level() log.LogLevel {
 	return le.level
 }
 
+func (le *sdlLogEntry) MessagePrefix() string {
+	return le.prefix
+}
+
 func (le *sdlLogEntry) Message() string {
 	return le.msg
 }
@@ -563,15 +761,77 @@ func (le *sdlLogEntry) Trace() []*log.StackTraceEntry {
 	return nil
 }
 
-// test shims to work around lack of cgo support for test cases
-func test_SdlInit() {
-	C.SDL_Init(C.SDL_INIT_EVERYTHING)
+func (le *sdlLogEntry) MessageTemplate() string {
+	return le.msg
 }
 
-func test_SdlLog(msg string) {
-	C.cgo_sdl_log(C.CString(msg))
+func (le *sdlLogEntry) Properties() map[string]interface{} {
+	res := make(map[string]interface{}, len(le.fields)+1)
+	for _, f := range le.fields {
+		res[f.Key] = f.Value
+	}
+	if le.correlation != "" {
+		res[log.CorrelationProperty] = le.correlation
+	}
+	return res
 }
 
-func test_SdlQuit() {
+func (le *sdlLogEntry) Fields() map[string]interface{} {
+	res := make(map[string]interface{}, len(le.fields))
+	for _, f := range le.fields {
+		res[f.Key] = f.Value
+	}
+	return res
+}
+
+// InitSdlCapture initializes SDL (with no subsystems) and routes SDL's log
+// output through the logging contexts.  Messages are still forwarded to the
+// output function SDL had before, unless SetSdlDefaultOutput(false) is used.
+func InitSdlCapture() error {
+	if C.SDL_Init(0) != 0 {
+		return fmt.Errorf("SDL_Init failed: %s", C.GoString(C.SDL_GetError()))
+	}
+	<-global_SdlLogUserdata.lock
+	defer func() { global_SdlLogUserdata.lock <- true }()
+	C.cgo_sdl_install_output()
+	return nil
+}
+
+// QuitSdlCapture restores SDL's previous output function and shuts SDL down.
+func QuitSdlCapture() {
+	<-global_SdlLogUserdata.lock
+	C.cgo_sdl_restore_output()
+	global_SdlLogUserdata.lock <- true
 	C.SDL_Quit()
+}
+
+// SetSdlDefaultOutput controls whether captured messages are also passed on
+// to SDL's previous (default console) output.  Disable it when listeners
+// already print to the console, to avoid duplicate lines.
+func SetSdlDefaultOutput(forward bool) {
+	<-global_SdlLogUserdata.lock
+	defer func() { global_SdlLogUserdata.lock <- true }()
+	global_SdlLogUserdata.forwardDefault = forward
+}
+
+// SdlLog sends a message through SDL_Log (application category, info
+// priority), exactly as native SDL code would.
+func SdlLog(msg string) {
+	cmsg := C.CString(msg)
+	defer C.free(unsafe.Pointer(cmsg))
+	C.cgo_sdl_log(cmsg)
+}
+
+// SdlLogMessage sends a message through SDL_LogMessage with an explicit
+// category code and priority.
+func SdlLogMessage(category int, priority SdlLogPriority, msg string) {
+	cmsg := C.CString(msg)
+	defer C.free(unsafe.Pointer(cmsg))
+	C.cgo_sdl_log_message(C.int(category), C.SDL_LogPriority(priority), cmsg)
+}
+
+func forwardSdlDefaultOutput(category C.int, pri C.SDL_LogPriority, msg string) {
+	cmsg := C.CString(msg)
+	defer C.free(unsafe.Pointer(cmsg))
+	C.cgo_sdl_forward_output(category, pri, cmsg)
 }
\ No newline at end of file
@@ -0,0 +1,183 @@
+//+build sdl
+
+package support
+
+/*
+	#cgo pkg-config: sdl2
+	#include <SDL.h>
+	#include <stdlib.h>
+
+	// Reads the renderer's output, as RGBA bytes, into a malloc'd buffer.
+	static void *cgo_sdl_read_pixels(SDL_Renderer *r, int *w, int *h) {
+		void *pixels;
+		if (SDL_GetRendererOutputSize(r, w, h) != 0) {
+			return NULL;
+		}
+		if (*w <= 0 || *h <= 0) {
+			SDL_SetError("empty renderer output");
+			return NULL;
+		}
+		pixels = malloc((size_t)(*w) * (size_t)(*h) * 4);
+		if (pixels == NULL) {
+			SDL_OutOfMemory();
+			return NULL;
+		}
+		if (SDL_RenderReadPixels(r, NULL, SDL_PIXELFORMAT_RGBA32, pixels, *w * 4) != 0) {
+			free(pixels);
+			return NULL;
+		}
+		return pixels;
+	}
+
+	typedef const unsigned char *(*cgo_gl_get_string_fn)(unsigned int);
+
+	// Calls glGetString() in the current GL context, if there is one.
+	static const char *cgo_sdl_gl_string(unsigned int name) {
+		cgo_gl_get_string_fn get;
+		if (SDL_GL_GetCurrentContext() == NULL) {
+			return NULL;
+		}
+		get = (cgo_gl_get_string_fn)SDL_GL_GetProcAddress("glGetString");
+		if (get == NULL) {
+			return NULL;
+		}
+		return (const char *)get(name);
+	}
+*/
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"unsafe"
+	"github.com/dtromb/log"
+)
+
+const (
+	SdlScreenshotProperty = "Screenshot"
+	SdlRendererProperty   = "Renderer"
+)
+
+// SdlFatalHook returns the fields to add to a fatal entry.  Hooks run on
+// the goroutine which logged the entry, normally the one owning the
+// renderer, before it is dispatched.
+type SdlFatalHook func() []log.Field
+
+// SetFatalHooks sets the hooks run for fatal entries logged through the
+// context, replacing any set before.
+func (ctx *SdlLoggingContext) SetFatalHooks(hooks ...SdlFatalHook) {
+	<-ctx.lock
+	defer func() { ctx.lock <- true }()
+	ctx.fatalHooks = hooks
+}
+
+// Runs the fatal hooks, without the context lock.  Fatal entries logged by
+// the hooks themselves are not captured again.
+func (ctx *SdlLoggingContext) captureFatal(level log.LogLevel) []log.Field {
+	if !level.IsFatal() {
+		return nil
+	}
+	<-ctx.lock
+	if ctx.capturing || len(ctx.fatalHooks) == 0 {
+		ctx.lock <- true
+		return nil
+	}
+	hooks := ctx.fatalHooks
+	ctx.capturing = true
+	ctx.lock <- true
+	defer func() {
+		<-ctx.lock
+		ctx.capturing = false
+		ctx.lock <- true
+	}()
+	var fields []log.Field
+	for _, hook := range hooks {
+		fields = append(fields, hook()...)
+	}
+	return fields
+}
+
+// SdlScreenshotHook attaches the output of renderer (an SDL_Renderer*, for
+// go-sdl2 unsafe.Pointer(renderer)) as "Screenshot", a PNG of what has been
+// drawn since the last present.  If it cannot be read, SDL's error is
+// added as "ScreenshotError" instead.
+func SdlScreenshotHook(renderer unsafe.Pointer) SdlFatalHook {
+	return func() []log.Field {
+		var w, h C.int
+		pixels := C.cgo_sdl_read_pixels((*C.SDL_Renderer)(renderer), &w, &h)
+		if pixels == nil {
+			return []log.Field{log.F(SdlScreenshotProperty+"Error", C.GoString(C.SDL_GetError()))}
+		}
+		defer C.free(pixels)
+		img := &image.NRGBA{
+			Pix: C.GoBytes(pixels, w*h*4),
+			Stride: int(w) * 4,
+			Rect: image.Rect(0, 0, int(w), int(h)),
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return []log.Field{log.F(SdlScreenshotProperty+"Error", err.Error())}
+		}
+		return []log.Field{log.F(SdlScreenshotProperty, log.NewAttachment("screenshot.png", "image/png", buf.Bytes()))}
+	}
+}
+
+// SdlRendererInfoHook attaches a description of renderer (which may be
+// nil), the video driver and the current GL context's driver as
+// "Renderer", in plain text.
+func SdlRendererInfoHook(renderer unsafe.Pointer) SdlFatalHook {
+	return func() []log.Field {
+		var sb strings.Builder
+		if driver := C.SDL_GetCurrentVideoDriver(); driver != nil {
+			fmt.Fprintf(&sb, "video driver: %s\n", C.GoString(driver))
+		}
+		if renderer != nil {
+			writeRendererInfo(&sb, (*C.SDL_Renderer)(renderer))
+		}
+		for _, gs := range []struct {
+			name string
+			code C.uint
+		}{
+			{"GL vendor", 0x1F00},
+			{"GL renderer", 0x1F01},
+			{"GL version", 0x1F02},
+			{"GLSL version", 0x8B8C},
+		} {
+			if value := C.cgo_sdl_gl_string(gs.code); value != nil {
+				fmt.Fprintf(&sb, "%s: %s\n", gs.name, C.GoString(value))
+			}
+		}
+		return []log.Field{log.F(SdlRendererProperty, log.NewAttachment("renderer.txt", "text/plain", []byte(sb.String())))}
+	}
+}
+
+func writeRendererInfo(sb *strings.Builder, renderer *C.SDL_Renderer) {
+	var info C.SDL_RendererInfo
+	if C.SDL_GetRendererInfo(renderer, &info) != 0 {
+		fmt.Fprintf(sb, "renderer: %s\n", C.GoString(C.SDL_GetError()))
+		return
+	}
+	var flags []string
+	for _, flag := range []struct {
+		name string
+		bit C.Uint32
+	}{
+		{"software", C.SDL_RENDERER_SOFTWARE},
+		{"accelerated", C.SDL_RENDERER_ACCELERATED},
+		{"vsync", C.SDL_RENDERER_PRESENTVSYNC},
+		{"target-texture", C.SDL_RENDERER_TARGETTEXTURE},
+	} {
+		if info.flags&flag.bit != 0 {
+			flags = append(flags, flag.name)
+		}
+	}
+	fmt.Fprintf(sb, "renderer: %s (%s)\n", C.GoString(info.name), strings.Join(flags, ", "))
+	fmt.Fprintf(sb, "max texture size: %dx%d\n", int(info.max_texture_width), int(info.max_texture_height))
+	var w, h C.int
+	if C.SDL_GetRendererOutputSize(renderer, &w, &h) == 0 {
+		fmt.Fprintf(sb, "output size: %dx%d\n", int(w), int(h))
+	}
+}
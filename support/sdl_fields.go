@@ -0,0 +1,176 @@
+//+build sdl
+
+package support
+
+import (
+	"context"
+	"fmt"
+	"github.com/dtromb/log"
+)
+
+// A Log over an SDL stream, whose messages carry structured fields.
+type sdlFieldLog struct {
+	ls *SdlLogStream
+	fields map[string]interface{}
+}
+
+func (ls *SdlLogStream) WithFields(fields map[string]interface{}) log.Log {
+	fl := &sdlFieldLog{ls: ls, fields: make(map[string]interface{}, len(fields))}
+	for k, v := range fields {
+		fl.fields[k] = v
+	}
+	return fl
+}
+
+func (ls *SdlLogStream) With(key string, value interface{}) log.Log {
+	return &sdlFieldLog{ls: ls, fields: map[string]interface{}{key: value}}
+}
+
+func (fl *sdlFieldLog) With(key string, value interface{}) log.Log {
+	fields := make(map[string]interface{}, len(fl.fields)+1)
+	for k, v := range fl.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &sdlFieldLog{ls: fl.ls, fields: fields}
+}
+
+func (fl *sdlFieldLog) Log(level log.LogLevel, msg string) {
+	fl.ls.logPending(level, msg, "", fl.fields)
+}
+
+func (fl *sdlFieldLog) Logf(level log.LogLevel, format string, args ...interface{}) {
+	fl.Log(level, fmt.Sprintf(format, args...))
+}
+
+func (fl *sdlFieldLog) LogTemplate(level log.LogLevel, template string, args ...interface{}) {
+	mt, err := log.ParseMessageTemplate(template)
+	if err != nil {
+		fl.Log(level, template)
+		return
+	}
+	// Captured properties take precedence over fields, as on std streams.
+	fields := make(map[string]interface{}, len(fl.fields))
+	for k, v := range fl.fields {
+		fields[k] = v
+	}
+	for k, v := range mt.Capture(args...) {
+		fields[k] = v
+	}
+	(&sdlFieldLog{ls: fl.ls, fields: fields}).Log(level, mt.Render(args...))
+}
+
+func (fl *sdlFieldLog) LogContext(ctx context.Context, level log.LogLevel, msg string) {
+	id, _ := log.CorrelationFromContext(ctx)
+	fl.ls.logPending(level, msg, id, fl.fields)
+}
+
+func (fl *sdlFieldLog) LogContextf(ctx context.Context, level log.LogLevel, format string, args ...interface{}) {
+	fl.LogContext(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func (fl *sdlFieldLog) LogTrace(level log.LogLevel, msg string) {
+	fl.ls.LogTrace(level, msg)
+}
+
+func (fl *sdlFieldLog) LogTracef(level log.LogLevel, format string, args ...interface{}) {
+	fl.ls.LogTracef(level, format, args...)
+}
+
+func (fl *sdlFieldLog) Fatal(msg string) {
+	fl.Log(log.FatalError, msg)
+}
+
+func (fl *sdlFieldLog) Fatalf(format string, args ...interface{}) {
+	fl.Logf(log.FatalError, format, args...)
+}
+
+func (fl *sdlFieldLog) FatalTrace(msg string) {
+	fl.ls.FatalTrace(msg)
+}
+
+func (fl *sdlFieldLog) FatalTracef(format string, args ...interface{}) {
+	fl.ls.FatalTracef(format, args...)
+}
+
+func (fl *sdlFieldLog) Error(err error) {
+	fl.Log(log.Error, err.Error())
+}
+
+func (fl *sdlFieldLog) Errorf(err error, format string, args ...interface{}) {
+	fl.Log(log.Error, fmt.Sprintf("%s: %s", err.Error(), fmt.Sprintf(format, args...)))
+}
+
+func (fl *sdlFieldLog) Warning(msg string) {
+	fl.Log(log.Warning, msg)
+}
+
+func (fl *sdlFieldLog) Warningf(format string, args ...interface{}) {
+	fl.Logf(log.Warning, format, args...)
+}
+
+func (fl *sdlFieldLog) WarningTrace(msg string) {
+	fl.ls.WarningTrace(msg)
+}
+
+func (fl *sdlFieldLog) WarningTracef(format string, args ...interface{}) {
+	fl.ls.WarningTracef(format, args...)
+}
+
+func (fl *sdlFieldLog) Info(msg string) {
+	fl.Log(log.Info, msg)
+}
+
+func (fl *sdlFieldLog) Infof(format string, args ...interface{}) {
+	fl.Logf(log.Info, format, args...)
+}
+
+func (fl *sdlFieldLog) InfoTrace(msg string) {
+	fl.ls.InfoTrace(msg)
+}
+
+func (fl *sdlFieldLog) InfoTracef(format string, args ...interface{}) {
+	fl.ls.InfoTracef(format, args...)
+}
+
+func (fl *sdlFieldLog) Debug(msg string) {
+	fl.Log(log.Debug, msg)
+}
+
+func (fl *sdlFieldLog) Debugf(format string, args ...interface{}) {
+	fl.Logf(log.Debug, format, args...)
+}
+
+func (fl *sdlFieldLog) DebugTrace(msg string) {
+	fl.ls.DebugTrace(msg)
+}
+
+func (fl *sdlFieldLog) DebugTracef(format string, args ...interface{}) {
+	fl.ls.DebugTracef(format, args...)
+}
+
+func (fl *sdlFieldLog) Trace(msg string) {
+	fl.Log(log.Trace, msg)
+}
+
+func (fl *sdlFieldLog) Tracef(format string, args ...interface{}) {
+	fl.Logf(log.Trace, format, args...)
+}
+
+func (fl *sdlFieldLog) LogLazy(level log.LogLevel, fn func() string) {
+	if fl.ls.enabled(level) {
+		fl.Log(level, fn())
+	}
+}
+
+func (fl *sdlFieldLog) InfoLazy(fn func() string) {
+	fl.LogLazy(log.Info, fn)
+}
+
+func (fl *sdlFieldLog) DebugLazy(fn func() string) {
+	fl.LogLazy(log.Debug, fn)
+}
+
+func (fl *sdlFieldLog) TraceLazy(fn func() string) {
+	fl.LogLazy(log.Trace, fn)
+}
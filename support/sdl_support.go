@@ -8,26 +8,43 @@ package support
 */
 import "C"
 
+import "github.com/dtromb/log"
+
 //export sdlLogOutputDispatch
 func sdlLogOutputDispatch(userdata *C.char, category C.int, pri C.SDL_LogPriority, msg *C.char) {
+	// Snapshot the registered contexts and release the global lock before
+	// dispatching, so listeners (or SDL itself) may log re-entrantly.
 	slu := global_SdlLogUserdata
 	<-slu.lock
-	defer func() { slu.lock <- true }()
+	forward := slu.forwardDefault
+	pending, text := slu.takePending(C.GoString(msg))
+	contexts := make([]*SdlLoggingContext, 0, len(slu.contexts))
 	for _, ctx := range slu.contexts {
+		contexts = append(contexts, ctx)
+	}
+	slu.lock <- true
+	if forward {
+		forwardSdlDefaultOutput(category, pri, text)
+	}
+	var correlation string
+	var pendingFields map[string]interface{}
+	if pending != nil {
+		correlation, pendingFields = pending.correlation, pending.fields
+	}
+	if correlation == "" {
+		correlation = log.AmbientCorrelation()
+	}
+	level := SdlLogPriority(pri).Level()
+	for _, ctx := range contexts {
+		var fields []log.Field
+		for k, v := range pendingFields {
+			fields = append(fields, log.F(k, v))
+		}
+		fields = append(fields, ctx.captureFatal(level)...)
 		<-ctx.lock
-		defer func() {
-			select {
-				case ctx.lock <- true:
-				default: {}
-			}
-		}()
-		cat, has := ctx.getCategoryByCode(int(category))
-		if !has {
-			ctx.lock <- true
-			continue
+		if cat, has := ctx.getCategoryByCode(int(category)); has {
+			ctx.dispatch(cat, level, text, correlation, fields)
 		}
-		pri := SdlLogPriority(pri).Level()
-		msg := C.GoString(msg)
-		ctx.dispatch(cat, pri, msg)
+		ctx.lock <- true
 	}
-}
\ No newline at end of file
+}
@@ -3,13 +3,21 @@
 package support
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"testing"
+	"time"
 	"github.com/dtromb/log"
 )
 
 func TestSdl(t *testing.T) {
-	test_SdlInit()
+	if err := InitSdlCapture(); err != nil {
+		t.Fatal(err)
+	}
+	defer QuitSdlCapture()
+	SetSdlDefaultOutput(false)
+	defer SetSdlDefaultOutput(true)
 	ctx := CreateSdlLoggingContext()
 	formatter := log.NewLogEntryFormatter()
 	if log.IsTerminal(os.Stdout) {
@@ -17,6 +25,211 @@ func TestSdl(t *testing.T) {
 	}
 	stdoutLogger := log.NewWriterLogger("default-stdout", os.Stdout, formatter)
 	ctx.AddGlobalLogListener(stdoutLogger, log.All)
-	test_SdlLog("Hello, SDL!")
-	test_SdlQuit()
-}
\ No newline at end of file
+	SdlLog("Hello, SDL!")
+	SdlLogMessage(int(SdlLogContextError.Code()), SdlLogPriorityError, "Hello, SDL error!")
+}
+
+type sdlChanListener struct {
+	name string
+	entries chan log.LogEntry
+	relay log.LogStream
+}
+
+func (cl *sdlChanListener) Name() string {
+	return cl.name
+}
+
+func (cl *sdlChanListener) Receive(entry log.LogEntry) {
+	if cl.relay != nil && entry.Stream() != cl.relay.Name() {
+		cl.relay.Log(entry.Level(), "relayed: "+entry.Message())
+	}
+	cl.entries <- entry
+}
+
+func (cl *sdlChanListener) Close() error {
+	return nil
+}
+
+func TestSdlReentrantDispatch(t *testing.T) {
+	if err := InitSdlCapture(); err != nil {
+		t.Fatal(err)
+	}
+	defer QuitSdlCapture()
+	SetSdlDefaultOutput(false)
+	defer SetSdlDefaultOutput(true)
+	ctx := CreateSdlLoggingContext()
+	app, _ := ctx.Stream(string(SdlLogContextApplication))
+	sys, _ := ctx.Stream(string(SdlLogContextSystem))
+	cl := &sdlChanListener{name: "reentrant", entries: make(chan log.LogEntry, 8), relay: sys}
+	ctx.AddGlobalLogListener(cl, log.All)
+	done := make(chan bool)
+	go func() {
+		// Log re-enters the context through SDL's output callback.
+		app.Log(log.Error, "first")
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream Log deadlocked in SDL output dispatch")
+	}
+	want := map[string]bool{"first": true, "relayed: first": true}
+	for len(want) > 0 {
+		select {
+		case entry := <-cl.entries:
+			delete(want, entry.Message())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing entries: %v", want)
+		}
+	}
+}
+
+func TestSdlCorrelation(t *testing.T) {
+	if err := InitSdlCapture(); err != nil {
+		t.Fatal(err)
+	}
+	defer QuitSdlCapture()
+	SetSdlDefaultOutput(false)
+	defer SetSdlDefaultOutput(true)
+	ctx := CreateSdlLoggingContext()
+	app, _ := ctx.Stream(string(SdlLogContextApplication))
+	cl := &sdlChanListener{name: "correlation", entries: make(chan log.LogEntry, 8)}
+	ctx.AddGlobalLogListener(cl, log.Trace)
+	app.LogContext(log.WithCorrelation(context.Background(), "request-1"), log.Info, "from a request")
+	exit := log.EnterCorrelation("frame-9")
+	SdlLog("from an SDL callback")
+	exit()
+	want := map[string]string{"from a request": "request-1", "from an SDL callback": "frame-9"}
+	for len(want) > 0 {
+		select {
+		case entry := <-cl.entries:
+			id, _ := entry.(log.TemplatedLogEntry).Properties()[log.CorrelationProperty].(string)
+			if id != want[entry.Message()] {
+				t.Errorf("%q: unexpected correlation ID %q", entry.Message(), id)
+			}
+			delete(want, entry.Message())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing entries: %v", want)
+		}
+	}
+}
+
+func TestSdlFatalHooks(t *testing.T) {
+	if err := InitSdlCapture(); err != nil {
+		t.Fatal(err)
+	}
+	defer QuitSdlCapture()
+	SetSdlDefaultOutput(false)
+	defer SetSdlDefaultOutput(true)
+	ctx := CreateSdlLoggingContext()
+	app, _ := ctx.Stream(string(SdlLogContextApplication))
+	cl := &sdlChanListener{name: "fatal", entries: make(chan log.LogEntry, 8)}
+	ctx.AddGlobalLogListener(cl, log.Trace)
+	captures := 0
+	ctx.SetFatalHooks(func() []log.Field {
+		captures++
+		// Not captured again.
+		app.Fatal("from the hook")
+		return []log.Field{log.F("State", log.NewAttachment("state.txt", "text/plain", []byte("frame 9")))}
+	}, SdlRendererInfoHook(nil))
+	app.Error(fmt.Errorf("not fatal"))
+	app.Fatal("device lost")
+	if captures != 1 {
+		t.Errorf("expected one capture, got %d", captures)
+	}
+	for seen := 0; seen < 3; seen++ {
+		select {
+		case entry := <-cl.entries:
+			properties := entry.(log.TemplatedLogEntry).Properties()
+			_, hasState := properties["State"].(*log.Attachment)
+			_, hasRenderer := properties[SdlRendererProperty].(*log.Attachment)
+			if want := entry.Message() == "device lost"; hasState != want || hasRenderer != want {
+				t.Errorf("%q: unexpected attachments %v", entry.Message(), properties)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("missing entries")
+		}
+	}
+}
+
+func TestSdlTemplateProperties(t *testing.T) {
+	if err := InitSdlCapture(); err != nil {
+		t.Fatal(err)
+	}
+	defer QuitSdlCapture()
+	SetSdlDefaultOutput(false)
+	defer SetSdlDefaultOutput(true)
+	ctx := CreateSdlLoggingContext()
+	app, _ := ctx.Stream(string(SdlLogContextApplication))
+	cl := &sdlChanListener{name: "template", entries: make(chan log.LogEntry, 8)}
+	ctx.AddGlobalLogListener(cl, log.Trace)
+	app.LogTemplate(log.Info, "loaded {Level} in {Ms}ms", "forest", 12)
+	select {
+	case entry := <-cl.entries:
+		properties := entry.(log.TemplatedLogEntry).Properties()
+		if entry.Message() != "loaded forest in 12ms" || properties["Level"] != "forest" || properties["Ms"] != 12 {
+			t.Errorf("unexpected entry %q %v", entry.Message(), properties)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("missing entry")
+	}
+}
+
+func TestSdlConcurrentCorrelation(t *testing.T) {
+	if err := InitSdlCapture(); err != nil {
+		t.Fatal(err)
+	}
+	defer QuitSdlCapture()
+	SetSdlDefaultOutput(false)
+	defer SetSdlDefaultOutput(true)
+	ctx := CreateSdlLoggingContext()
+	app, _ := ctx.Stream(string(SdlLogContextApplication))
+	const n = 200
+	cl := &sdlChanListener{name: "concurrent", entries: make(chan log.LogEntry, 2*n)}
+	ctx.AddGlobalLogListener(cl, log.Trace)
+	done := make(chan bool)
+	go func() {
+		request := log.WithCorrelation(context.Background(), "request-1")
+		fields := app.With("user", "alice")
+		for i := 0; i < n; i++ {
+			app.LogContext(request, log.Info, "correlated")
+			fields.Info("with fields")
+		}
+		done <- true
+	}()
+	go func() {
+		for i := 0; i < n; i++ {
+			app.Log(log.Info, "plain")
+		}
+		done <- true
+	}()
+	<-done
+	<-done
+	ambient := log.AmbientCorrelation()
+	for i := 0; i < 3*n; i++ {
+		select {
+		case entry := <-cl.entries:
+			properties := entry.(log.TemplatedLogEntry).Properties()
+			id, _ := properties[log.CorrelationProperty].(string)
+			user, _ := properties["user"].(string)
+			switch entry.Message() {
+			case "correlated":
+				if id != "request-1" || user != "" {
+					t.Fatalf("correlated entry carries %q %q", id, user)
+				}
+			case "with fields":
+				if id != ambient || user != "alice" {
+					t.Fatalf("field entry carries %q %q", id, user)
+				}
+			case "plain":
+				if id != ambient || user != "" {
+					t.Fatalf("plain entry carries %q %q", id, user)
+				}
+			default:
+				t.Fatalf("unexpected message %q", entry.Message())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing entries after %d", i)
+		}
+	}
+}
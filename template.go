@@ -0,0 +1,270 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message templates follow messagetemplates.org: "User {UserId} logged
+// in" renders as text and keeps UserId as an entry property.  Holes may
+// destructure ({@Name}), stringify ({$Name}), align ({Name,-10}) and
+// format ({Name:%08.3f}); {{ and }} are literal braces.
+type MessageTemplate interface {
+	Text() string
+	PropertyNames() []string
+	Render(args ...interface{}) string
+	Capture(args ...interface{}) map[string]interface{}
+}
+
+type TemplateCapture uint8
+
+const (
+	CaptureDefault TemplateCapture = iota
+	CaptureDestructure
+	CaptureStringify
+)
+
+type TemplatedLogEntry interface {
+	LogEntry
+	MessageTemplate() string
+	Properties() map[string]interface{}
+}
+
+///
+
+type templateToken struct {
+	text      string
+	hole      bool
+	name      string
+	position  int
+	capture   TemplateCapture
+	alignment int
+	format    string
+}
+
+type stdMessageTemplate struct {
+	text       string
+	tokens     []*templateToken
+	names      []string
+	positional bool
+}
+
+var _GLOBAL_templateCache = make(map[string]*stdMessageTemplate)
+var _GLOBAL_templateCacheLock chan bool = make(chan bool, 1)
+
+const maxCachedTemplates = 1024
+
+const maxTemplateAlignment = 1024
+
+func init() {
+	_GLOBAL_templateCacheLock <- true
+}
+
+func ParseMessageTemplate(text string) (MessageTemplate, error) {
+	return parseMessageTemplate(text)
+}
+
+func cachedMessageTemplate(text string) *stdMessageTemplate {
+	<-_GLOBAL_templateCacheLock
+	defer func() { _GLOBAL_templateCacheLock <- true }()
+	if mt, has := _GLOBAL_templateCache[text]; has {
+		return mt
+	}
+	mt, err := parseMessageTemplate(text)
+	if err != nil {
+		// Malformed templates are rendered literally rather than
+		// losing the message.
+		mt = &stdMessageTemplate{
+			text:   text,
+			tokens: []*templateToken{&templateToken{text: text}},
+		}
+	}
+	if len(_GLOBAL_templateCache) >= maxCachedTemplates {
+		_GLOBAL_templateCache = make(map[string]*stdMessageTemplate)
+	}
+	_GLOBAL_templateCache[text] = mt
+	return mt
+}
+
+func parseMessageTemplate(text string) (*stdMessageTemplate, error) {
+	mt := &stdMessageTemplate{text: text}
+	var lit []byte
+	flush := func() {
+		if len(lit) > 0 {
+			mt.tokens = append(mt.tokens, &templateToken{text: string(lit)})
+			lit = nil
+		}
+	}
+	named := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == '}' {
+			if i+1 < len(text) && text[i+1] == '}' {
+				i++
+			}
+			lit = append(lit, '}')
+			continue
+		}
+		if c != '{' {
+			lit = append(lit, c)
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == '{' {
+			lit = append(lit, '{')
+			i++
+			continue
+		}
+		end := strings.IndexByte(text[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated property in message template at offset %d", i)
+		}
+		tok, err := parseTemplateHole(text[i+1 : i+end])
+		if err != nil {
+			return nil, err
+		}
+		flush()
+		if tok.position >= 0 {
+			mt.positional = true
+		} else {
+			named = true
+		}
+		mt.tokens = append(mt.tokens, tok)
+		mt.names = append(mt.names, tok.name)
+		i += end
+	}
+	flush()
+	if named && mt.positional {
+		return nil, errors.New("message template mixes named and positional properties")
+	}
+	return mt, nil
+}
+
+func parseTemplateHole(hole string) (*templateToken, error) {
+	tok := &templateToken{hole: true, text: "{" + hole + "}", position: -1}
+	if len(hole) > 0 && hole[0] == '@' {
+		tok.capture = CaptureDestructure
+		hole = hole[1:]
+	} else if len(hole) > 0 && hole[0] == '$' {
+		tok.capture = CaptureStringify
+		hole = hole[1:]
+	}
+	if idx := strings.IndexByte(hole, ':'); idx >= 0 {
+		tok.format = hole[idx+1:]
+		hole = hole[:idx]
+	}
+	if idx := strings.IndexByte(hole, ','); idx >= 0 {
+		align, err := strconv.Atoi(strings.TrimSpace(hole[idx+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid alignment in message template property '%s'", tok.text)
+		}
+		if align > maxTemplateAlignment || align < -maxTemplateAlignment {
+			return nil, fmt.Errorf("alignment out of range in message template property '%s'", tok.text)
+		}
+		tok.alignment = align
+		hole = hole[:idx]
+	}
+	if len(hole) == 0 {
+		return nil, fmt.Errorf("empty property name in message template")
+	}
+	for _, r := range hole {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return nil, fmt.Errorf("invalid character in message template property '%s'", tok.text)
+		}
+	}
+	tok.name = hole
+	if pos, err := strconv.Atoi(hole); err == nil {
+		tok.position = pos
+	}
+	return tok, nil
+}
+
+func (mt *stdMessageTemplate) Text() string {
+	return mt.text
+}
+
+func (mt *stdMessageTemplate) PropertyNames() []string {
+	res := make([]string, len(mt.names))
+	copy(res, mt.names)
+	return res
+}
+
+func (mt *stdMessageTemplate) argFor(hole int, tok *templateToken, args []interface{}) (interface{}, bool) {
+	idx := hole
+	if mt.positional {
+		idx = tok.position
+	}
+	if idx < 0 || idx >= len(args) {
+		return nil, false
+	}
+	return args[idx], true
+}
+
+func (mt *stdMessageTemplate) Render(args ...interface{}) string {
+	var buf []byte
+	hole := 0
+	for _, tok := range mt.tokens {
+		if !tok.hole {
+			buf = append(buf, []byte(tok.text)...)
+			continue
+		}
+		arg, has := mt.argFor(hole, tok, args)
+		hole++
+		if !has {
+			buf = append(buf, []byte(tok.text)...)
+			continue
+		}
+		buf = append(buf, []byte(tok.renderValue(arg))...)
+	}
+	return string(buf)
+}
+
+func (mt *stdMessageTemplate) Capture(args ...interface{}) map[string]interface{} {
+	props := make(map[string]interface{})
+	hole := 0
+	for _, tok := range mt.tokens {
+		if !tok.hole {
+			continue
+		}
+		arg, has := mt.argFor(hole, tok, args)
+		hole++
+		if !has {
+			continue
+		}
+		if f, ok := arg.(Field); ok {
+			arg = f.Value
+		}
+		if tok.capture == CaptureStringify {
+			props[tok.name] = fmt.Sprintf("%v", arg)
+		} else {
+			props[tok.name] = arg
+		}
+	}
+	return props
+}
+
+func (tok *templateToken) renderValue(arg interface{}) string {
+	var str string
+	switch {
+	case tok.capture == CaptureDestructure:
+		str = fmt.Sprintf("%+v", arg)
+	case tok.format == "":
+		str = fmt.Sprintf("%v", arg)
+	default:
+		if t, ok := arg.(time.Time); ok {
+			str = t.Format(tok.format)
+		} else if strings.HasPrefix(tok.format, "%") {
+			str = fmt.Sprintf(tok.format, arg)
+		} else {
+			str = fmt.Sprintf("%v", arg)
+		}
+	}
+	if tok.alignment > 0 && len(str) < tok.alignment {
+		str = strings.Repeat(" ", tok.alignment-len(str)) + str
+	} else if tok.alignment < 0 && len(str) < -tok.alignment {
+		str = str + strings.Repeat(" ", -tok.alignment-len(str))
+	}
+	return str
+}
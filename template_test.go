@@ -0,0 +1,58 @@
+package log
+
+import (
+	"testing"
+)
+
+func TestMessageTemplate(t *testing.T) {
+	mt, err := ParseMessageTemplate("User {UserId} logged in from {IP,-8}| {{ok}} {@Extra}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := mt.Render(42, "10.0.0.1")
+	if str != "User 42 logged in from 10.0.0.1| {ok} {@Extra}" {
+		t.Errorf("unexpected rendering: %q", str)
+	}
+	props := mt.Capture(42, "10.0.0.1")
+	if props["UserId"] != 42 || props["IP"] != "10.0.0.1" || len(props) != 2 {
+		t.Errorf("unexpected capture: %v", props)
+	}
+	pos, err := ParseMessageTemplate("{1} before {0:%05.1f}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := pos.Render(2.5, "after"); str != "after before 002.5" {
+		t.Errorf("unexpected positional rendering: %q", str)
+	}
+	if _, err := ParseMessageTemplate("{Name} and {0}"); err == nil {
+		t.Error("expected error for mixed named/positional template")
+	}
+	if _, err := ParseMessageTemplate("unterminated {Name"); err == nil {
+		t.Error("expected error for unterminated property")
+	}
+}
+
+func TestLogTemplate(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("template-test")
+	stream.LogTemplate(Info, "Processed {Count} items in {Elapsed}ms", 12, 7)
+	entries := cl.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	te, ok := entries[0].(TemplatedLogEntry)
+	if !ok {
+		t.Fatal("entry does not implement TemplatedLogEntry")
+	}
+	if te.Message() != "Processed 12 items in 7ms" {
+		t.Errorf("unexpected message: %q", te.Message())
+	}
+	if te.MessageTemplate() != "Processed {Count} items in {Elapsed}ms" {
+		t.Errorf("unexpected template: %q", te.MessageTemplate())
+	}
+	if props := te.Properties(); props["Count"] != 12 || props["Elapsed"] != 7 {
+		t.Errorf("unexpected properties: %v", props)
+	}
+}
@@ -0,0 +1,22 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+// +build !logminimal
+
+package log
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func hasTerminal(writer io.Writer) bool {
+	var termios syscall.Termios
+	switch v := writer.(type) {
+	case *os.File:
+		_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(v.Fd()),
+			syscall.TIOCGETA, uintptr(unsafe.Pointer(&termios)), 0, 0, 0)
+		return err == 0
+	}
+	return false
+}
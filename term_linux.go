@@ -0,0 +1,21 @@
+// +build linux,!logminimal
+
+package log
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func hasTerminal(writer io.Writer) bool {
+	var termios syscall.Termios
+	switch v := writer.(type) {
+	case *os.File:
+		_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(v.Fd()),
+			syscall.TCGETS, uintptr(unsafe.Pointer(&termios)), 0, 0, 0)
+		return err == 0
+	}
+	return false
+}
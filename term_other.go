@@ -0,0 +1,13 @@
+// +build logminimal !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package log
+
+import (
+	"io"
+)
+
+// Minimal builds make no terminal-detection syscalls; use
+// SetDefaultColor() to opt in to colored default output.
+func hasTerminal(writer io.Writer) bool {
+	return false
+}
@@ -0,0 +1,88 @@
+package log
+
+import (
+	"time"
+)
+
+const (
+	TimerProperty   = "Timer"
+	ElapsedProperty = "Elapsed"
+	LapProperty     = "Lap"
+)
+
+// A Stopwatch logs the time elapsed on a piece of work, as templated
+// entries with Timer and Elapsed properties (and Lap, for laps).  Unlike
+// an Operation it records no metrics and has no outcome.
+type Stopwatch interface {
+	Name() string
+	Elapsed() time.Duration
+	// Lap logs the time elapsed since the start under label, and returns
+	// it.
+	Lap(label string) time.Duration
+	// Stop logs the time elapsed since the start, and returns it; later
+	// calls log nothing and return the same duration.
+	Stop() time.Duration
+}
+
+///
+
+type stdStopwatch struct {
+	lock    chan bool
+	log     Log
+	level   LogLevel
+	name    string
+	start   time.Time
+	stopped bool
+	elapsed time.Duration
+}
+
+func NewStopwatch(log Log, level LogLevel, name string) Stopwatch {
+	sw := &stdStopwatch{
+		lock:  make(chan bool, 1),
+		log:   log,
+		level: level,
+		name:  name,
+		start: time.Now(),
+	}
+	sw.lock <- true
+	return sw
+}
+
+func (sw *stdStopwatch) Name() string {
+	return sw.name
+}
+
+func (sw *stdStopwatch) Elapsed() time.Duration {
+	<-sw.lock
+	defer func() { sw.lock <- true }()
+	if sw.stopped {
+		return sw.elapsed
+	}
+	return time.Since(sw.start)
+}
+
+func (sw *stdStopwatch) Lap(label string) time.Duration {
+	elapsed := time.Since(sw.start)
+	sw.log.LogTemplate(sw.level, "{Timer} {Lap} at {Elapsed}", sw.name, label, elapsed)
+	return elapsed
+}
+
+func (sw *stdStopwatch) Stop() time.Duration {
+	elapsed := time.Since(sw.start)
+	<-sw.lock
+	if sw.stopped {
+		elapsed = sw.elapsed
+		sw.lock <- true
+		return elapsed
+	}
+	sw.stopped, sw.elapsed = true, elapsed
+	sw.lock <- true
+	sw.log.LogTemplate(sw.level, "{Timer} took {Elapsed}", sw.name, elapsed)
+	return elapsed
+}
+
+// Timed starts a stopwatch, returning the func which stops it.
+func (ls *stdLogStream) Timed(level LogLevel, name string) func() {
+	sw := NewStopwatch(ls, level, name)
+	return func() { sw.Stop() }
+}
@@ -0,0 +1,33 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStopwatch(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Info)
+	stream, _ := ctx.Stream("timer")
+	done := stream.Timed(Info, "rebuild")
+	time.Sleep(5 * time.Millisecond)
+	done()
+	sw := NewStopwatch(stream, Info, "import")
+	sw.Lap("parsed")
+	elapsed := sw.Stop()
+	if again := sw.Stop(); again != elapsed || sw.Elapsed() != elapsed {
+		t.Errorf("expected a stopped stopwatch to keep its time")
+	}
+	entries := cl.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	props := entries[0].(TemplatedLogEntry).Properties()
+	if props[TimerProperty] != "rebuild" || props[ElapsedProperty].(time.Duration) < 5*time.Millisecond {
+		t.Errorf("unexpected properties %v", props)
+	}
+	if props := entries[1].(TemplatedLogEntry).Properties(); props[LapProperty] != "parsed" {
+		t.Errorf("unexpected lap properties %v", props)
+	}
+}
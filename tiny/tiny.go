@@ -0,0 +1,248 @@
+// Package tiny is a reduced logging core for TinyGo and firmware targets.
+// It does not use reflection, fmt or goroutines, and performs no allocation
+// when logging: entries are written into caller-provided sinks such as the
+// fixed-size Ring, or rendered into a reused buffer by the writer sink (for
+// UARTs and other io.Writers).
+//
+// Levels have the same values and names as log.LogLevel, so entries
+// captured on a device can be forwarded to, or compared with, host-side
+// logs.  A Logger is not safe for concurrent use.
+package tiny
+
+import (
+	"io"
+	"strconv"
+)
+
+type Level uint8
+
+const (
+	All Level = iota
+	FatalError
+	Error
+	Error2
+	Error3
+	Warning
+	Warning2
+	Warning3
+	Info
+	Info2
+	Info3
+	Debug
+	Debug2
+	Debug3
+	Debug4
+	Debug5
+	Trace
+	None
+	Default
+)
+
+var levelNames = [...]string{"All", "FatalError", "Error", "Error-2", "Error-3", "Warning", "Warning-2",
+	"Warning-3", "Info", "Info-2", "Info-3", "Debug", "Debug-2", "Debug-3", "Debug-4", "Debug-5",
+	"Trace", "None", "Default"}
+
+func (l Level) String() string {
+	if int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return "Unknown"
+}
+
+// Severity ranks levels as log.LogLevel.Severity does, from Trace (1) to
+// FatalError (16).  As thresholds, All ranks below every level and None
+// above; Default and unknown levels rank with None.
+func (l Level) Severity() int {
+	switch {
+	case l == All:
+		return 0
+	case l >= FatalError && l <= Trace:
+		return int(Trace) + 1 - int(l)
+	}
+	return int(Trace) + 1
+}
+
+// Entries are passed to sinks by pointer and are only valid for the
+// duration of the Write call; sinks must copy what they keep.
+type Entry struct {
+	Ticks   int64
+	Level   Level
+	Stream  string
+	Message string
+	// An optional integer value, for the Logi call.
+	Key      string
+	Value    int64
+	HasValue bool
+}
+
+type Sink interface {
+	Write(entry *Entry)
+}
+
+type Logger struct {
+	stream string
+	level  Level
+	clock  func() int64
+	sinks  [4]Sink
+	nsinks int
+	entry  Entry
+}
+
+// NewLogger creates a logger passing entries at or more severe than level
+// to its sinks.  clock, if not nil, supplies entry timestamps (e.g. a
+// hardware tick counter).
+func NewLogger(stream string, level Level, clock func() int64) *Logger {
+	return &Logger{stream: stream, level: level, clock: clock}
+}
+
+// AddSink adds a sink; at most four are supported.
+func (lg *Logger) AddSink(sink Sink) bool {
+	if lg.nsinks == len(lg.sinks) {
+		return false
+	}
+	lg.sinks[lg.nsinks] = sink
+	lg.nsinks++
+	return true
+}
+
+func (lg *Logger) SetLevel(level Level) {
+	lg.level = level
+}
+
+// Enabled applies the host's threshold rule: entries at least as severe as
+// the logger's level pass, as do entries logged at All.
+func (lg *Logger) Enabled(level Level) bool {
+	return level == All || level.Severity() >= lg.level.Severity()
+}
+
+func (lg *Logger) Log(level Level, msg string) {
+	if !lg.Enabled(level) {
+		return
+	}
+	lg.entry = Entry{Level: level, Stream: lg.stream, Message: msg}
+	lg.dispatch()
+}
+
+// Logi logs msg with a single named integer value, without formatting it
+// into the message.
+func (lg *Logger) Logi(level Level, msg string, key string, value int64) {
+	if !lg.Enabled(level) {
+		return
+	}
+	lg.entry = Entry{Level: level, Stream: lg.stream, Message: msg, Key: key, Value: value, HasValue: true}
+	lg.dispatch()
+}
+
+func (lg *Logger) dispatch() {
+	if lg.clock != nil {
+		lg.entry.Ticks = lg.clock()
+	}
+	for i := 0; i < lg.nsinks; i++ {
+		lg.sinks[i].Write(&lg.entry)
+	}
+}
+
+func (lg *Logger) Error(msg string) {
+	lg.Log(Error, msg)
+}
+
+func (lg *Logger) Warning(msg string) {
+	lg.Log(Warning, msg)
+}
+
+func (lg *Logger) Info(msg string) {
+	lg.Log(Info, msg)
+}
+
+func (lg *Logger) Debug(msg string) {
+	lg.Log(Debug, msg)
+}
+
+// A Ring keeps the most recent entries in a fixed, preallocated buffer.
+// Strings are referenced, not copied: messages should be constants or
+// otherwise not reused by the caller.
+type Ring struct {
+	entries []Entry
+	next    int
+	count   int
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{entries: make([]Entry, size)}
+}
+
+func (r *Ring) Write(entry *Entry) {
+	if len(r.entries) == 0 {
+		return
+	}
+	r.entries[r.next] = *entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.count < len(r.entries) {
+		r.count++
+	}
+}
+
+func (r *Ring) Len() int {
+	return r.count
+}
+
+// Each visits the buffered entries, oldest first.
+func (r *Ring) Each(visit func(entry *Entry)) {
+	start := r.next - r.count
+	if start < 0 {
+		start += len(r.entries)
+	}
+	for i := 0; i < r.count; i++ {
+		visit(&r.entries[(start+i)%len(r.entries)])
+	}
+}
+
+func (r *Ring) Reset() {
+	r.next, r.count = 0, 0
+}
+
+// A WriterSink renders entries as single lines - "ticks level stream:
+// message key=value" - into a reused buffer, and writes each with one Write
+// call.  Its output is suitable for a UART (machine.UART implements
+// io.Writer).
+type WriterSink struct {
+	out  io.Writer
+	buf  []byte
+	crlf bool
+}
+
+// NewWriterSink creates a sink writing to out; lines end in "\r\n" when
+// crlf is set, as serial terminals usually expect.
+func NewWriterSink(out io.Writer, crlf bool) *WriterSink {
+	return &WriterSink{out: out, buf: make([]byte, 0, 128), crlf: crlf}
+}
+
+// NewUARTListener is NewWriterSink with serial line endings.
+func NewUARTListener(uart io.Writer) *WriterSink {
+	return NewWriterSink(uart, true)
+}
+
+func (ws *WriterSink) Write(entry *Entry) {
+	buf := ws.buf[:0]
+	if entry.Ticks != 0 {
+		buf = strconv.AppendInt(buf, entry.Ticks, 10)
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, entry.Level.String()...)
+	buf = append(buf, ' ')
+	buf = append(buf, entry.Stream...)
+	buf = append(buf, ": "...)
+	buf = append(buf, entry.Message...)
+	if entry.HasValue {
+		buf = append(buf, ' ')
+		buf = append(buf, entry.Key...)
+		buf = append(buf, '=')
+		buf = strconv.AppendInt(buf, entry.Value, 10)
+	}
+	if ws.crlf {
+		buf = append(buf, '\r')
+	}
+	buf = append(buf, '\n')
+	ws.out.Write(buf)
+	ws.buf = buf
+}
@@ -0,0 +1,80 @@
+package tiny
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/dtromb/log"
+)
+
+func TestRingWraparound(t *testing.T) {
+	ring := NewRing(3)
+	lg := NewLogger("ring", Trace, nil)
+	lg.AddSink(ring)
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		lg.Info(msg)
+	}
+	var got []string
+	ring.Each(func(entry *Entry) {
+		got = append(got, entry.Message)
+	})
+	if ring.Len() != 3 || fmt.Sprint(got) != "[c d e]" {
+		t.Errorf("ring holds %d entries %v", ring.Len(), got)
+	}
+	ring.Reset()
+	lg.Info("f")
+	got = got[:0]
+	ring.Each(func(entry *Entry) {
+		got = append(got, entry.Message)
+	})
+	if fmt.Sprint(got) != "[f]" {
+		t.Errorf("reset ring holds %v", got)
+	}
+}
+
+func TestWriterSinkFormat(t *testing.T) {
+	var out bytes.Buffer
+	ticks := int64(0)
+	lg := NewLogger("uart", Trace, func() int64 { return ticks })
+	lg.AddSink(NewWriterSink(&out, false))
+	lg.Warning("no ticks")
+	ticks = 1234
+	lg.Logi(Debug2, "adc", "mv", -42)
+	if out.String() != "Warning uart: no ticks\n1234 Debug-2 uart: adc mv=-42\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	out.Reset()
+	NewUARTListener(&out).Write(&Entry{Level: Error, Stream: "s", Message: "m"})
+	if out.String() != "Error s: m\r\n" {
+		t.Errorf("unexpected serial output %q", out.String())
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	lg := NewLogger("levels", None, nil)
+	if lg.Enabled(FatalError) {
+		t.Error("None enables FatalError")
+	}
+	lg.SetLevel(All)
+	if !lg.Enabled(Trace) || !lg.Enabled(FatalError) {
+		t.Error("All does not enable every level")
+	}
+	lg.SetLevel(Warning)
+	if !lg.Enabled(Error) || !lg.Enabled(Warning) || lg.Enabled(Warning2) || lg.Enabled(Info) {
+		t.Error("Warning threshold admits the wrong levels")
+	}
+	// The same rule as the host's listeners.
+	for threshold := All; threshold <= None; threshold++ {
+		lg.SetLevel(threshold)
+		for level := All; level <= None; level++ {
+			want := log.ListenerAccepts(log.LogLevel(threshold), log.Info, log.LogLevel(level))
+			if lg.Enabled(level) != want {
+				t.Errorf("threshold %s, level %s: enabled %v, host accepts %v", threshold, level, lg.Enabled(level), want)
+			}
+			if level.String() != log.LogLevel(level).String() {
+				t.Errorf("level %d named %q, host names it %q", level, level, log.LogLevel(level))
+			}
+		}
+	}
+}
@@ -1,7 +1,22 @@
 package log
 
 import (
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// With TraceModulePaths, File() returns paths relative to the module
+// ("github.com/org/repo/pkg/file.go", "net/http/server.go") wherever the
+// file was built, so fingerprints are stable.  AbsFile() always returns
+// the recorded path.
+type TracePathMode int32
+
+const (
+	TraceAbsolutePaths TracePathMode = iota
+	TraceModulePaths
 )
 
 type StackTraceEntry struct {
@@ -15,10 +30,32 @@ func (ste *StackTraceEntry) Pc() uintptr {
 	return ste.pc
 }
 
+// File returns the frame's source file, as SetTracePaths configures.
 func (ste *StackTraceEntry) File() string {
+	if TracePaths() == TraceModulePaths {
+		return ste.ModuleFile()
+	}
 	return ste.file
 }
 
+func (ste *StackTraceEntry) AbsFile() string {
+	return ste.file
+}
+
+// ModuleFile returns the frame's source file relative to its module.
+func (ste *StackTraceEntry) ModuleFile() string {
+	f := ste.f
+	if f == nil && ste.pc != 0 {
+		f = runtime.FuncForPC(ste.pc)
+	}
+	if f != nil {
+		if pkg := funcPackage(f.Name(), ste.file); pkg != "" && pkg != "main" {
+			return pkg + "/" + filepath.Base(ste.file)
+		}
+	}
+	return trimSourcePath(ste.file)
+}
+
 func (ste *StackTraceEntry) Line() int {
 	return ste.line
 }
@@ -27,10 +64,25 @@ func (ste *StackTraceEntry) Function() *runtime.Func {
 	return ste.f
 }
 
+// NewStackTraceEntry makes a frame for entries built outside the package
+// (imported or replayed logs, tests); the function is looked up from pc if
+// it is non-zero.
+func NewStackTraceEntry(pc uintptr, file string, line int) *StackTraceEntry {
+	ste := &StackTraceEntry{pc: pc, file: file, line: line}
+	if pc != 0 {
+		ste.f = runtime.FuncForPC(pc)
+	}
+	return ste
+}
+
 func GenerateStackTrace() []*StackTraceEntry {
+	return generateStackTrace(0)
+}
+
+func generateStackTrace(skip int) []*StackTraceEntry {
 	trace := make([]*StackTraceEntry, 0, 16)
 	for i := 1; i < 1000; i++ {
-		pc, file, line, ok := runtime.Caller(2+i)
+		pc, file, line, ok := runtime.Caller(3+skip+i)
 		if !ok {
 			break
 		}
@@ -41,4 +93,49 @@ func GenerateStackTrace() []*StackTraceEntry {
 		})
 	}
 	return trace 
-}
\ No newline at end of file
+}
+
+var _GLOBAL_tracePaths int32
+
+func SetTracePaths(mode TracePathMode) {
+	atomic.StoreInt32(&_GLOBAL_tracePaths, int32(mode))
+}
+
+func TracePaths() TracePathMode {
+	return TracePathMode(atomic.LoadInt32(&_GLOBAL_tracePaths))
+}
+
+// Returns the package path of a function name such as
+// "github.com/org/repo/pkg.(*T).Method.func1", defined in file.  The last
+// element of the path may itself contain dots ("gopkg.in/yaml.v3"), so the
+// name of file's directory is preferred where it matches.
+func funcPackage(name string, file string) string {
+	slash := strings.LastIndexByte(name, '/')
+	last := name[slash+1:]
+	dir := filepath.Base(filepath.Dir(file))
+	if at := strings.IndexByte(dir, '@'); at >= 0 {
+		dir = dir[:at]
+	}
+	if strings.HasPrefix(last, dir+".") {
+		return name[:slash+1+len(dir)]
+	}
+	dot := strings.IndexByte(last, '.')
+	if dot < 0 {
+		return ""
+	}
+	return name[:slash+1+dot]
+}
+
+// Trims the module cache or GOPATH prefix from a source path.
+func trimSourcePath(file string) string {
+	path := filepath.ToSlash(file)
+	if i := strings.LastIndex(path, "/pkg/mod/"); i >= 0 {
+		return path[i+len("/pkg/mod/"):]
+	}
+	for _, gopath := range filepath.SplitList(os.Getenv("GOPATH")) {
+		if prefix := filepath.ToSlash(gopath) + "/src/"; gopath != "" && strings.HasPrefix(path, prefix) {
+			return strings.TrimPrefix(path, prefix)
+		}
+	}
+	return file
+}
@@ -0,0 +1,36 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTracePaths(t *testing.T) {
+	defer SetTracePaths(TraceAbsolutePaths)
+	ctx := CreateLoggingContext()
+	capture := newCaptureListener()
+	ctx.AddGlobalLogListener(capture, Trace)
+	stream, _ := ctx.Stream("trace")
+	stream.LogTrace(Info, "traced")
+	frame := capture.Entries()[0].Trace()[0]
+	if !strings.HasSuffix(frame.File(), "/trace_test.go") || !strings.HasPrefix(frame.File(), "/") {
+		t.Errorf("expected an absolute path by default, got %s", frame.File())
+	}
+	SetTracePaths(TraceModulePaths)
+	if frame.File() != "github.com/dtromb/log/trace_test.go" || frame.AbsFile() == frame.File() {
+		t.Errorf("unexpected module-relative path %s", frame.File())
+	}
+	for name, want := range map[string]string{
+		"gopkg.in/yaml.v3.(*decoder).unmarshal": "gopkg.in/yaml.v3",
+		"github.com/org/repo/pkg.F.func1":       "github.com/org/repo/pkg",
+		"net/http.(*conn).serve":                "net/http",
+	} {
+		file := "/root/go/pkg/mod/" + want + "@v1.0.0/file.go"
+		if got := funcPackage(name, file); got != want {
+			t.Errorf("%s: expected package %s, got %s", name, want, got)
+		}
+	}
+	if got := trimSourcePath("/home/build/go/pkg/mod/github.com/org/repo@v1.2.0/pkg/file.go"); got != "github.com/org/repo@v1.2.0/pkg/file.go" {
+		t.Errorf("unexpected trimmed path %s", got)
+	}
+}
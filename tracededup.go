@@ -0,0 +1,131 @@
+package log
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+const TraceHashProperty = "TraceHash"
+
+type TraceDedupOptions struct {
+	// Window is how long a trace is referenced by hash before it is
+	// written in full again (default 1m).
+	Window time.Duration
+	// MaxTraces bounds the number of hashes remembered (default 10000).
+	MaxTraces int
+}
+
+type TraceDedupListener interface {
+	FallibleLogListener
+	Flusher
+	Target() LogListener
+	// Deduplicated returns the number of entries forwarded without their
+	// trace.
+	Deduplicated() uint64
+}
+
+///
+
+type traceDedupListener struct {
+	lock         chan bool
+	name         string
+	target       LogListener
+	opts         TraceDedupOptions
+	emitted      map[string]time.Time
+	deduplicated uint64
+}
+
+// NewTraceDedupListener tags entries with traces with TraceHash, and
+// forwards only the first entry with a given stack in each Window with its
+// trace.  Entries without traces pass unchanged.
+func NewTraceDedupListener(name string, target LogListener, opts TraceDedupOptions) TraceDedupListener {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.MaxTraces <= 0 {
+		opts.MaxTraces = 10000
+	}
+	tl := &traceDedupListener{
+		lock:    make(chan bool, 1),
+		name:    name,
+		target:  target,
+		opts:    opts,
+		emitted: make(map[string]time.Time),
+	}
+	tl.lock <- true
+	return tl
+}
+
+// TraceHash identifies a stack by all of its frames.
+func TraceHash(trace []*StackTraceEntry) string {
+	h := fnv.New64a()
+	for _, frame := range trace {
+		fmt.Fprintf(h, "%s:%d\x00", frame.AbsFile(), frame.Line())
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func (tl *traceDedupListener) Name() string {
+	return tl.name
+}
+
+func (tl *traceDedupListener) Target() LogListener {
+	return tl.target
+}
+
+func (tl *traceDedupListener) Deduplicated() uint64 {
+	return atomic.LoadUint64(&tl.deduplicated)
+}
+
+func (tl *traceDedupListener) Receive(entry LogEntry) {
+	tl.TryReceive(entry)
+}
+
+func (tl *traceDedupListener) TryReceive(entry LogEntry) error {
+	if !entry.HasTrace() || len(entry.Trace()) == 0 {
+		return tryReceive(tl.target, entry)
+	}
+	hash := TraceHash(entry.Trace())
+	de := deriveEntry(entry)
+	de.setProperty(TraceHashProperty, hash)
+	if !tl.first(hash, entry.LogTime()) {
+		de.noTrace = true
+		atomic.AddUint64(&tl.deduplicated, 1)
+	}
+	return tryReceive(tl.target, de)
+}
+
+// Reports whether the trace must be written in full, and if so starts its
+// window.
+func (tl *traceDedupListener) first(hash string, now time.Time) bool {
+	<-tl.lock
+	defer func() { tl.lock <- true }()
+	if at, has := tl.emitted[hash]; has && now.Sub(at) < tl.opts.Window && !now.Before(at) {
+		return false
+	}
+	if len(tl.emitted) >= tl.opts.MaxTraces {
+		for h, at := range tl.emitted {
+			if now.Sub(at) >= tl.opts.Window {
+				delete(tl.emitted, h)
+			}
+		}
+		if len(tl.emitted) >= tl.opts.MaxTraces {
+			tl.emitted = make(map[string]time.Time)
+		}
+	}
+	tl.emitted[hash] = now
+	return true
+}
+
+func (tl *traceDedupListener) Flush() error {
+	if fl, ok := tl.target.(Flusher); ok {
+		return fl.Flush()
+	}
+	return nil
+}
+
+func (tl *traceDedupListener) Close() error {
+	return tl.target.Close()
+}
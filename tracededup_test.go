@@ -0,0 +1,48 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTraceDedup(t *testing.T) {
+	ctx := CreateLoggingContext()
+	capture := newCaptureListener()
+	dedup := NewTraceDedupListener("dedup", capture, TraceDedupOptions{Window: 50 * time.Millisecond})
+	ctx.AddGlobalLogListener(dedup, Trace)
+	stream, _ := ctx.Stream("storm")
+	for i := 0; i < 4; i++ {
+		if i == 3 {
+			stream.Log(Info, "no trace")
+			time.Sleep(60 * time.Millisecond)
+		}
+		stream.LogTrace(Error, "hot path failed")
+	}
+	entries := capture.Entries()
+	if len(entries) != 5 {
+		t.Fatalf("expected 5 entries, got %d", len(entries))
+	}
+	withTrace := []bool{true, false, false, false, true}
+	var hash interface{}
+	for i, entry := range entries {
+		if entry.HasTrace() != withTrace[i] {
+			t.Errorf("entry %d: expected trace %v", i, withTrace[i])
+		}
+		props := entry.(TemplatedLogEntry).Properties()
+		if i == 3 {
+			if _, has := props[TraceHashProperty]; has {
+				t.Errorf("entry without a trace was given a hash")
+			}
+			continue
+		}
+		if hash == nil {
+			hash = props[TraceHashProperty]
+		}
+		if props[TraceHashProperty] == nil || props[TraceHashProperty] != hash {
+			t.Errorf("entry %d: unexpected hash %v", i, props[TraceHashProperty])
+		}
+	}
+	if dedup.Deduplicated() != 2 {
+		t.Errorf("expected 2 deduplicated entries, got %d", dedup.Deduplicated())
+	}
+}
@@ -0,0 +1,189 @@
+package log
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// TriggerCheck returns the current value of the watched quantity.
+type TriggerCheck func() float64
+
+type TriggerEvent struct {
+	Trigger   string
+	Value     float64
+	Threshold float64
+	At        time.Time
+	// Fields are added to the triggering entry as properties.
+	Fields []Field
+}
+
+type TriggerAction interface {
+	Run(ev *TriggerEvent) error
+}
+
+type TriggerActionFunc func(ev *TriggerEvent) error
+
+type TriggerOptions struct {
+	Name      string
+	Check     TriggerCheck
+	Threshold float64
+	// Interval between checks; defaults to 10s.
+	Interval time.Duration
+	// Cooldown is the minimum time between firings; defaults to 5m.
+	Cooldown time.Duration
+	Actions  []TriggerAction
+	// Log receives the triggering entries; defaults to the global
+	// context's "trigger" stream.
+	Log   Log
+	Level LogLevel
+}
+
+// A Trigger runs its actions when its check crosses the threshold, then
+// logs a triggering entry carrying the fields the actions added.  It fires
+// again only after dropping back below the threshold and Cooldown.
+type Trigger interface {
+	Name() string
+	// Check samples the value immediately, firing if due, and reports
+	// whether the trigger fired.
+	Check() bool
+	Fired() uint64
+	Stop()
+}
+
+///
+
+func (f TriggerActionFunc) Run(ev *TriggerEvent) error {
+	return f(ev)
+}
+
+func (ev *TriggerEvent) AddField(key string, value interface{}) {
+	ev.Fields = append(ev.Fields, F(key, value))
+}
+
+// ErrorRate checks the rate of error (and fatal) entries per second on a
+// stream, since the previous check.
+func ErrorRate(stream LogStream) TriggerCheck {
+	var lastErrors uint64
+	var lastAt time.Time
+	lock := make(chan bool, 1)
+	lock <- true
+	return func() float64 {
+		<-lock
+		defer func() { lock <- true }()
+		now := time.Now()
+		errors := countErrors(stream.Stats())
+		var rate float64
+		if !lastAt.IsZero() && now.After(lastAt) {
+			rate = float64(errors-lastErrors) / now.Sub(lastAt).Seconds()
+		}
+		lastErrors, lastAt = errors, now
+		return rate
+	}
+}
+
+// QueueDepth checks the number of entries pending in an async listener.
+func QueueDepth(al AsyncListener) TriggerCheck {
+	return func() float64 {
+		return float64(al.Pending())
+	}
+}
+
+type stdTrigger struct {
+	lock      chan bool
+	opts      TriggerOptions
+	above     bool
+	lastFired time.Time
+	fired     uint64
+	stop      chan bool
+	stopped   int32
+}
+
+func NewTrigger(opts TriggerOptions) Trigger {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 5 * time.Minute
+	}
+	if opts.Log == nil {
+		opts.Log, _ = GetGlobalLoggingContext().Stream("trigger")
+	}
+	if opts.Level == All {
+		opts.Level = Warning
+	}
+	tr := &stdTrigger{
+		lock: make(chan bool, 1),
+		opts: opts,
+		stop: make(chan bool),
+	}
+	tr.lock <- true
+	go func() {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				tr.Check()
+			case <-tr.stop:
+				return
+			}
+		}
+	}()
+	return tr
+}
+
+func (tr *stdTrigger) Name() string {
+	return tr.opts.Name
+}
+
+func (tr *stdTrigger) Check() bool {
+	<-tr.lock
+	value := tr.opts.Check()
+	now := time.Now()
+	above := value >= tr.opts.Threshold
+	fire := above && !tr.above && now.Sub(tr.lastFired) >= tr.opts.Cooldown
+	tr.above = above
+	if fire {
+		tr.lastFired = now
+		tr.fired++
+	}
+	tr.lock <- true
+	if fire {
+		tr.fire(value, now)
+	}
+	return fire
+}
+
+func (tr *stdTrigger) fire(value float64, now time.Time) {
+	ev := &TriggerEvent{
+		Trigger:   tr.opts.Name,
+		Value:     value,
+		Threshold: tr.opts.Threshold,
+		At:        now,
+	}
+	for i, action := range tr.opts.Actions {
+		if err := action.Run(ev); err != nil {
+			ev.AddField(fmt.Sprintf("Action%dError", i), err.Error())
+		}
+	}
+	template := "trigger {Trigger} fired: {Value} >= {Threshold}"
+	args := []interface{}{ev.Trigger, ev.Value, ev.Threshold}
+	for _, f := range ev.Fields {
+		template += fmt.Sprintf(", %s={%s}", f.Key, f.Key)
+		args = append(args, f)
+	}
+	tr.opts.Log.LogTemplate(tr.opts.Level, template, args...)
+}
+
+func (tr *stdTrigger) Fired() uint64 {
+	<-tr.lock
+	defer func() { tr.lock <- true }()
+	return tr.fired
+}
+
+func (tr *stdTrigger) Stop() {
+	if atomic.CompareAndSwapInt32(&tr.stopped, 0, 1) {
+		close(tr.stop)
+	}
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTriggerProfileAction(t *testing.T) {
+	ctx := CreateLoggingContext()
+	cl := newCaptureListener()
+	ctx.AddGlobalLogListener(cl, Trace)
+	stream, _ := ctx.Stream("trigger")
+	value := 0.0
+	tr := NewTrigger(TriggerOptions{
+		Name:      "queue",
+		Check:     func() float64 { return value },
+		Threshold: 100,
+		Interval:  time.Hour,
+		Cooldown:  time.Nanosecond,
+		Actions:   []TriggerAction{NewProfileAction(ProfileOptions{Dir: t.TempDir()})},
+		Log:       stream,
+	})
+	defer tr.Stop()
+	if tr.Check() {
+		t.Fatal("trigger fired below threshold")
+	}
+	value = 150
+	if !tr.Check() {
+		t.Fatal("trigger did not fire at threshold")
+	}
+	// Staying above the threshold does not fire again.
+	if tr.Check() {
+		t.Fatal("trigger fired twice for one crossing")
+	}
+	value = 10
+	tr.Check()
+	value = 200
+	if !tr.Check() || tr.Fired() != 2 {
+		t.Fatalf("trigger did not re-fire, fired=%d", tr.Fired())
+	}
+	ctx.Flush()
+	entries := cl.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 triggering entries, got %d", len(entries))
+	}
+	props := entries[0].(TemplatedLogEntry).Properties()
+	for _, key := range []string{"HeapProfile", "GoroutineProfile"} {
+		path, ok := props[key].(string)
+		if !ok {
+			t.Fatalf("missing %s property in %v", key, props)
+		}
+		if fi, err := os.Stat(path); err != nil || fi.Size() == 0 {
+			t.Errorf("%s not written: %v", key, err)
+		}
+	}
+}
+
+func TestTriggerConcurrentChecks(t *testing.T) {
+	ctx := CreateLoggingContext()
+	stream, _ := ctx.Stream("errors")
+	tr := NewTrigger(TriggerOptions{
+		Name:      "errors",
+		Check:     ErrorRate(stream),
+		Threshold: 1e12,
+		Interval:  time.Millisecond,
+		Log:       stream,
+	})
+	defer tr.Stop()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				stream.Error(errors.New("failed"))
+				tr.Check()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTriggerProfileFileName(t *testing.T) {
+	dir := t.TempDir()
+	action := NewProfileAction(ProfileOptions{Dir: dir, Kinds: []ProfileKind{ProfileHeap}})
+	ev := &TriggerEvent{Trigger: "../escape/" + `a\b`, At: time.Now()}
+	if err := action.Run(ev); err != nil {
+		t.Fatal(err)
+	}
+	path, _ := ev.Fields[0].Value.(string)
+	if filepath.Dir(path) != dir {
+		t.Fatalf("profile written outside %s: %s", dir, path)
+	}
+	if name := filepath.Base(path); !strings.HasPrefix(name, ".._escape_a_b-heap-") {
+		t.Errorf("unexpected profile name %s", name)
+	}
+}
@@ -0,0 +1,22 @@
+package log
+
+import (
+	"context"
+)
+
+type verbosityKey struct{}
+
+// WithVerbosity raises every listener's threshold to level for entries
+// logged through LogContext() with the returned context - to capture Debug
+// output for one request, say.
+func WithVerbosity(ctx context.Context, level LogLevel) context.Context {
+	return context.WithValue(ctx, verbosityKey{}, level)
+}
+
+func VerbosityFromContext(ctx context.Context) (LogLevel, bool) {
+	if ctx == nil {
+		return All, false
+	}
+	level, ok := ctx.Value(verbosityKey{}).(LogLevel)
+	return level, ok
+}
@@ -0,0 +1,129 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Formatters that produce a preamble (column headers, directives) implement
+// HeaderFormatter.  Listeners write the header once before the first entry
+// they write to a new output.
+type HeaderFormatter interface {
+	LogEntryFormatter
+	Header() string
+}
+
+// A W3CFormatter writes the W3C Extended Log File Format: a directive
+// header, then a line per entry.  Fields are date, time, x-stream, x-level,
+// x-message, x-error, x-file, x-line, x-fingerprint and x-prop(Name).
+type W3CFormatter interface {
+	HeaderFormatter
+	Fields() []string
+}
+
+var DefaultW3CFields = []string{"date", "time", "x-stream", "x-level", "x-message", "x-error"}
+
+///
+
+type w3cFormatter struct {
+	fields []string
+}
+
+func NewW3CFormatter(fields ...string) W3CFormatter {
+	if len(fields) == 0 {
+		fields = DefaultW3CFields
+	}
+	wf := &w3cFormatter{fields: make([]string, len(fields))}
+	copy(wf.fields, fields)
+	return wf
+}
+
+func (wf *w3cFormatter) Fields() []string {
+	res := make([]string, len(wf.fields))
+	copy(res, wf.fields)
+	return res
+}
+
+func (wf *w3cFormatter) Header() string {
+	return fmt.Sprintf("#Version: 1.0\n#Software: github.com/dtromb/log\n#Date: %s\n#Fields: %s\n",
+		time.Now().UTC().Format("2006-01-02 15:04:05"), strings.Join(wf.fields, " "))
+}
+
+func (wf *w3cFormatter) Format(entry LogEntry) string {
+	var buf []byte
+	ts := entry.LogTime().UTC()
+	for i, field := range wf.fields {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		switch field {
+		case "date":
+			buf = append(buf, []byte(ts.Format("2006-01-02"))...)
+		case "time":
+			buf = append(buf, []byte(ts.Format("15:04:05.000"))...)
+		case "x-stream":
+			buf = appendW3CString(buf, entry.Stream())
+		case "x-level":
+			buf = appendW3CString(buf, entry.Level().String())
+		case "x-message":
+			buf = appendW3CString(buf, PrefixedMessage(entry))
+		case "x-error":
+			if entry.HasAssociatedError() {
+				buf = appendW3CString(buf, entry.AssociatedError().Error())
+			} else {
+				buf = append(buf, '-')
+			}
+		case "x-file", "x-line":
+			var trace []*StackTraceEntry
+			if entry.HasTrace() {
+				trace = entry.Trace()
+			}
+			if len(trace) == 0 {
+				buf = append(buf, '-')
+			} else if field == "x-file" {
+				buf = appendW3CString(buf, trace[0].File())
+			} else {
+				buf = append(buf, []byte(fmt.Sprintf("%d", trace[0].Line()))...)
+			}
+		case "x-fingerprint":
+			buf = append(buf, []byte(Fingerprint(entry))...)
+		default:
+			if strings.HasPrefix(field, "x-prop(") && strings.HasSuffix(field, ")") {
+				name := field[7 : len(field)-1]
+				if te, ok := entry.(TemplatedLogEntry); ok {
+					if val, has := te.Properties()[name]; has {
+						buf = appendW3CString(buf, fmt.Sprintf("%v", val))
+						continue
+					}
+				}
+			}
+			buf = append(buf, '-')
+		}
+	}
+	buf = append(buf, '\n')
+	return string(buf)
+}
+
+// Quotes str, doubling quotes; control characters, which would break the
+// line or its fields, become spaces (and a carriage return nothing).
+func appendW3CString(buf []byte, str string) []byte {
+	if str == "" {
+		return append(buf, '-')
+	}
+	buf = append(buf, '"')
+	for _, r := range str {
+		switch {
+		case r == '"':
+			buf = append(buf, '"', '"')
+		case r == '\r':
+		case unicode.IsControl(r):
+			buf = append(buf, ' ')
+		default:
+			buf = utf8.AppendRune(buf, r)
+		}
+	}
+	return append(buf, '"')
+}
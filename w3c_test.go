@@ -0,0 +1,36 @@
+package log
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestW3CFormatter(t *testing.T) {
+	wf := NewW3CFormatter("date", "time", "x-level", "x-prop(user)", "x-prop(missing)", "x-error", "x-message")
+	header := wf.Header()
+	if !strings.HasPrefix(header, "#Version: 1.0\n") ||
+		!strings.Contains(header, "\n#Fields: date time x-level x-prop(user) x-prop(missing) x-error x-message\n") {
+		t.Errorf("unexpected header:\n%s", header)
+	}
+	entry := &stdLogEntry{
+		ts:         time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.FixedZone("EST", -5*3600)),
+		stream:     &stdLogStream{name: "web"},
+		level:      Warning,
+		message:    "said \"hi\"\tand\r\nleft\x1b[0m\u0085",
+		properties: map[string]interface{}{"user": 42},
+	}
+	want := "2020-01-02 08:04:05.006 \"" + Warning.String() + "\" \"42\" - - \"said \"\"hi\"\" and left [0m \"\n"
+	if got := wf.Format(entry); got != want {
+		t.Errorf("formatted %q, want %q", got, want)
+	}
+	entry.associatedError = errors.New("bad\nthing")
+	entry.message = ""
+	if got := NewW3CFormatter("x-stream", "x-error", "x-message").Format(entry); got != "\"web\" \"bad thing\" -\n" {
+		t.Errorf("formatted %q", got)
+	}
+	if fields := NewW3CFormatter().Fields(); strings.Join(fields, " ") != strings.Join(DefaultW3CFields, " ") {
+		t.Errorf("default fields %v", fields)
+	}
+}
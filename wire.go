@@ -0,0 +1,451 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"time"
+)
+
+// The wire format carries entries between processes as frames of
+// [4 byte big-endian length][1 byte encoding tag][payload], opened by a
+// hello announcing the sender's encodings.  FrameJSON payloads are single
+// entries; FrameGzip payloads are gzipped batches of FrameJSON frames.
+type FrameEncoding uint8
+
+const (
+	FrameHello FrameEncoding = iota
+	FrameJSON
+	FrameGzip
+	FrameAck
+)
+
+const WireVersion = 1
+
+// Frames larger than MaxFrameSize are rejected by decoders.
+const MaxFrameSize = 16 << 20
+
+type WireHello struct {
+	Version   int      `json:"version"`
+	Encodings []string `json:"encodings"`
+	// Token authenticates the sender to servers which require it.
+	Token string `json:"token,omitempty"`
+	// Session names a sender asking for receipts; in a reply, Resume is
+	// the last sequence number received in the session.
+	Session string `json:"session,omitempty"`
+	Resume  uint64 `json:"resume,omitempty"`
+}
+
+type StreamEncoder interface {
+	Encode(entry LogEntry) error
+}
+
+type StreamDecoder interface {
+	// Decode returns the next entry, or io.EOF at the end of the stream.
+	Decode() (LogEntry, error)
+	// Hello returns the sender's hello, once it has been read.
+	Hello() (WireHello, bool)
+}
+
+///
+
+var ErrFrameTooLarge = errors.New("wire frame exceeds MaxFrameSize")
+
+func (fe FrameEncoding) String() string {
+	switch fe {
+	case FrameHello:
+		return "hello"
+	case FrameJSON:
+		return "json"
+	case FrameGzip:
+		return "gzip"
+	case FrameAck:
+		return "ack"
+	}
+	return fmt.Sprintf("encoding-%d", uint8(fe))
+}
+
+// The compressed encodings a receiver accepts, by name - gzip only, as the
+// standard library has no zstd or snappy codec.
+var wireCompressions = map[string]FrameEncoding{
+	FrameGzip.String(): FrameGzip,
+}
+
+// Batches are flushed before they reach this size uncompressed, so that
+// their receivers can decompress them.
+const maxWireBatch = MaxFrameSize / 2
+
+func WriteFrame(w io.Writer, encoding FrameEncoding, payload []byte) error {
+	if len(payload) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	frame := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	frame[4] = byte(encoding)
+	copy(frame[5:], payload)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame returns io.EOF at a clean end of stream, io.ErrUnexpectedEOF
+// inside a frame.
+func ReadFrame(r io.Reader) (FrameEncoding, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:4])
+	if n > MaxFrameSize {
+		return 0, nil, ErrFrameTooLarge
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return FrameEncoding(header[4]), payload, nil
+}
+
+type wireFrame struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Function string `json:"function,omitempty"`
+}
+
+type wireRecord struct {
+	Seq        uint64                 `json:"seq,omitempty"`
+	Time       time.Time              `json:"time"`
+	Stream     string                 `json:"stream"`
+	Level      string                 `json:"level"`
+	Message    string                 `json:"message"`
+	Prefix     string                 `json:"prefix,omitempty"`
+	Template   string                 `json:"template,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Trace      []wireFrame            `json:"trace,omitempty"`
+}
+
+// An entry received from elsewhere: decoded from the wire, or replayed.
+type wireEntry struct {
+	seq        uint64
+	ts         time.Time
+	stream     string
+	level      LogLevel
+	message    string
+	prefix     string
+	template   string
+	properties map[string]interface{}
+	err        error
+	trace      []*StackTraceEntry
+}
+
+func (we *wireEntry) LogTime() time.Time        { return we.ts }
+func (we *wireEntry) Stream() string            { return we.stream }
+func (we *wireEntry) Level() LogLevel           { return we.level }
+func (we *wireEntry) Message() string           { return we.message }
+func (we *wireEntry) HasAssociatedError() bool  { return we.err != nil }
+func (we *wireEntry) AssociatedError() error    { return we.err }
+func (we *wireEntry) HasTrace() bool            { return we.trace != nil }
+func (we *wireEntry) Trace() []*StackTraceEntry { return we.trace }
+
+func (we *wireEntry) MessageTemplate() string {
+	if we.template == "" {
+		return we.message
+	}
+	return we.template
+}
+
+func (we *wireEntry) Properties() map[string]interface{} {
+	res := make(map[string]interface{}, len(we.properties))
+	for k, v := range we.properties {
+		res[k] = v
+	}
+	return res
+}
+
+// Property values which do not encode as JSON (channels, funcs, cycles)
+// are sent as their text.
+func stringifyProperties(props map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		res[k] = fmt.Sprintf("%v", v)
+	}
+	return res
+}
+
+func encodeWireEntry(entry LogEntry, seq uint64) ([]byte, error) {
+	rec := wireRecord{
+		Seq:     seq,
+		Time:    entry.LogTime(),
+		Stream:  entry.Stream(),
+		Level:   entry.Level().String(),
+		Message: entry.Message(),
+		Prefix:  renderedPrefix(entry),
+	}
+	if te, ok := entry.(TemplatedLogEntry); ok {
+		if template := te.MessageTemplate(); template != rec.Message {
+			rec.Template = template
+		}
+		if props := te.Properties(); len(props) > 0 {
+			rec.Properties = props
+		}
+	}
+	if entry.HasAssociatedError() {
+		rec.Error = entry.AssociatedError().Error()
+	}
+	if entry.HasTrace() {
+		rec.Trace = make([]wireFrame, 0, len(entry.Trace()))
+		for _, frame := range entry.Trace() {
+			wf := wireFrame{File: frame.File(), Line: frame.Line()}
+			if f := frame.Function(); f != nil {
+				wf.Function = f.Name()
+			} else if f := runtime.FuncForPC(frame.Pc()); frame.Pc() != 0 && f != nil {
+				wf.Function = f.Name()
+			}
+			rec.Trace = append(rec.Trace, wf)
+		}
+	}
+	data, err := json.Marshal(&rec)
+	if err != nil && rec.Properties != nil {
+		rec.Properties = stringifyProperties(rec.Properties)
+		data, err = json.Marshal(&rec)
+	}
+	return data, err
+}
+
+func decodeWireEntry(payload []byte) (*wireEntry, error) {
+	var rec wireRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return nil, err
+	}
+	level, ok := ParseLogLevel(rec.Level)
+	if !ok {
+		return nil, fmt.Errorf("unknown level '%s' in wire entry", rec.Level)
+	}
+	we := &wireEntry{
+		seq:        rec.Seq,
+		ts:         rec.Time,
+		stream:     rec.Stream,
+		level:      level,
+		message:    rec.Message,
+		prefix:     rec.Prefix,
+		template:   rec.Template,
+		properties: rec.Properties,
+	}
+	if rec.Error != "" {
+		we.err = errors.New(rec.Error)
+	}
+	if rec.Trace != nil {
+		we.trace = make([]*StackTraceEntry, len(rec.Trace))
+		for i, wf := range rec.Trace {
+			we.trace[i] = NewStackTraceEntry(0, wf.File, wf.Line)
+		}
+	}
+	return we, nil
+}
+
+type stdStreamEncoder struct {
+	w         io.Writer
+	token     string
+	helloSent bool
+	// With FrameGzip, entries are buffered as frames until flush writes them
+	// as one compressed frame.
+	encoding   FrameEncoding
+	batch      bytes.Buffer
+	pending    int
+	compressed bytes.Buffer
+	gz         *gzip.Writer
+}
+
+// NewStreamEncoder writes entries to w as frames, starting with a hello.
+// It is not safe for concurrent use.
+func NewStreamEncoder(w io.Writer) StreamEncoder {
+	return &stdStreamEncoder{w: w, encoding: FrameJSON}
+}
+
+func writeHello(w io.Writer, hello WireHello) error {
+	hello.Version = WireVersion
+	payload, _ := json.Marshal(hello)
+	return WriteFrame(w, FrameHello, payload)
+}
+
+func (se *stdStreamEncoder) Encode(entry LogEntry) error {
+	return se.encode(entry, 0)
+}
+
+func (se *stdStreamEncoder) encode(entry LogEntry, seq uint64) error {
+	if !se.helloSent {
+		if err := writeHello(se.w, WireHello{Encodings: []string{FrameJSON.String()}, Token: se.token}); err != nil {
+			return err
+		}
+		se.helloSent = true
+	}
+	payload, err := encodeWireEntry(entry, seq)
+	if err != nil {
+		return err
+	}
+	if se.encoding != FrameGzip {
+		return WriteFrame(se.w, FrameJSON, payload)
+	}
+	if err := WriteFrame(&se.batch, FrameJSON, payload); err != nil {
+		return err
+	}
+	se.pending++
+	if se.batch.Len() >= maxWireBatch {
+		return se.flush()
+	}
+	return nil
+}
+
+// Writes the buffered batch; the batch is discarded even if the write
+// fails.
+func (se *stdStreamEncoder) flush() error {
+	if se.pending == 0 {
+		return nil
+	}
+	se.compressed.Reset()
+	if se.gz == nil {
+		se.gz = gzip.NewWriter(&se.compressed)
+	} else {
+		se.gz.Reset(&se.compressed)
+	}
+	se.gz.Write(se.batch.Bytes())
+	se.gz.Close()
+	se.batch.Reset()
+	se.pending = 0
+	return WriteFrame(se.w, FrameGzip, se.compressed.Bytes())
+}
+
+// Sends offer on conn and reads the receiver's reply, which is nil if the
+// receiver does not reply before deadline.
+func handshake(conn net.Conn, offer WireHello, deadline time.Time) (*WireHello, error) {
+	if err := writeHello(conn, offer); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(deadline)
+	defer conn.SetReadDeadline(time.Time{})
+	encoding, payload, err := ReadFrame(conn)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return nil, nil
+	}
+	if err == io.EOF {
+		return nil, errors.New("stream server closed the connection during the handshake")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var reply WireHello
+	if encoding != FrameHello || json.Unmarshal(payload, &reply) != nil {
+		return nil, errors.New("invalid handshake reply from stream server")
+	}
+	return &reply, nil
+}
+
+type wireAck struct {
+	Seq uint64 `json:"seq"`
+}
+
+func writeAck(w io.Writer, seq uint64) error {
+	payload, _ := json.Marshal(wireAck{Seq: seq})
+	return WriteFrame(w, FrameAck, payload)
+}
+
+type stdStreamDecoder struct {
+	r        io.Reader
+	hello    WireHello
+	hasHello bool
+	// Entries decoded from a batch, not yet returned.
+	pending []*wireEntry
+	// Called with each hello as it is read; an error ends the stream.
+	onHello func(hello WireHello) error
+}
+
+func NewStreamDecoder(r io.Reader) StreamDecoder {
+	return &stdStreamDecoder{r: r}
+}
+
+func (sd *stdStreamDecoder) Hello() (WireHello, bool) {
+	return sd.hello, sd.hasHello
+}
+
+func (sd *stdStreamDecoder) Decode() (LogEntry, error) {
+	for {
+		if len(sd.pending) > 0 {
+			we := sd.pending[0]
+			sd.pending = sd.pending[1:]
+			return we, nil
+		}
+		encoding, payload, err := ReadFrame(sd.r)
+		if err != nil {
+			return nil, err
+		}
+		switch encoding {
+		case FrameHello:
+			var hello WireHello
+			if err := json.Unmarshal(payload, &hello); err != nil {
+				return nil, fmt.Errorf("invalid wire hello: %s", err.Error())
+			}
+			if hello.Version > WireVersion {
+				return nil, fmt.Errorf("unsupported wire version %d", hello.Version)
+			}
+			sd.hello, sd.hasHello = hello, true
+			if sd.onHello != nil {
+				if err := sd.onHello(hello); err != nil {
+					return nil, err
+				}
+			}
+		case FrameJSON:
+			return decodeWireEntry(payload)
+		case FrameGzip:
+			if sd.pending, err = decodeWireBatch(payload); err != nil {
+				return nil, err
+			}
+		case FrameAck:
+			// Receipts are read by senders, not decoders.
+		default:
+			return nil, fmt.Errorf("unsupported wire frame encoding %s", encoding)
+		}
+	}
+}
+
+func decodeWireBatch(payload []byte) ([]*wireEntry, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip wire batch: %s", err.Error())
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(gz, MaxFrameSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip wire batch: %s", err.Error())
+	}
+	if len(data) > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	var entries []*wireEntry
+	r := bytes.NewReader(data)
+	for {
+		encoding, frame, err := ReadFrame(r)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if encoding != FrameJSON {
+			return nil, fmt.Errorf("unsupported frame encoding %s in wire batch", encoding)
+		}
+		we, err := decodeWireEntry(frame)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, we)
+	}
+}